@@ -0,0 +1,238 @@
+// Package admin implements the administration of the user accounts by the service accounts:
+// a user can be approved or rejected, deactivated, which prevents it from logging in and refreshing its tokens,
+// reactivated, or purged, which removes all the data stored about the user.
+package admin
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
+	"github.com/fabric8-services/fabric8-auth/token/provider"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PurgeReport describes what was removed when a user was purged
+type PurgeReport struct {
+	UserID      *uuid.UUID
+	IdentityIDs []uuid.UUID
+	// ExternalTokens is the number of tokens of the external providers removed
+	ExternalTokens int
+	// IdentityRoles is the number of roles assigned to the identities removed, including the space collaborations
+	IdentityRoles int64
+	// SpaceCollaborations contains the IDs of the spaces the user was a collaborator of
+	SpaceCollaborations []string
+	// OutboxEvents is the number of events about the identities removed, whether they were delivered or not
+	OutboxEvents int64
+	// WebhookDeliveries is the number of deliveries of these events to the webhooks removed
+	WebhookDeliveries int64
+}
+
+// Deactivate deactivates the user of the identity and revokes the refresh tokens of all its identities.
+// Returns NotFoundError if the identity doesn't exist.
+func Deactivate(ctx context.Context, appl application.Application, identityID uuid.UUID) error {
+	return updateUser(ctx, appl, identityID, func(user *account.User) bool {
+		changed := !user.Deactivated
+		user.Deactivated = true
+		return changed
+	})
+}
+
+// Reactivate reactivates the user of the identity, which can log in again.
+// Returns NotFoundError if the identity doesn't exist.
+func Reactivate(ctx context.Context, appl application.Application, identityID uuid.UUID) error {
+	return updateUser(ctx, appl, identityID, func(user *account.User) bool {
+		changed := user.Deactivated
+		user.Deactivated = false
+		return changed
+	})
+}
+
+// Approve approves the user of the identity, which can log in from now on.
+// Keycloak is updated once the change is delivered from the outbox to the ApprovalSink.
+// Returns NotFoundError if the identity doesn't exist.
+func Approve(ctx context.Context, appl application.Application, identityID uuid.UUID) error {
+	return setApprovalState(ctx, appl, identityID, account.ApprovalStateApproved)
+}
+
+// Reject rejects the registration of the user of the identity and revokes the refresh tokens of all its identities.
+// Keycloak is updated once the change is delivered from the outbox to the ApprovalSink.
+// Returns NotFoundError if the identity doesn't exist.
+func Reject(ctx context.Context, appl application.Application, identityID uuid.UUID) error {
+	return setApprovalState(ctx, appl, identityID, account.ApprovalStateRejected)
+}
+
+func setApprovalState(ctx context.Context, appl application.Application, identityID uuid.UUID, approvalState string) error {
+	return updateUser(ctx, appl, identityID, func(user *account.User) bool {
+		changed := user.ApprovalState == nil || *user.ApprovalState != approvalState
+		user.ApprovalState = &approvalState
+		return changed
+	})
+}
+
+// updateUser applies the change to the user of the identity and records the change, if any.
+// The refresh tokens of all the identities of the user are revoked if the user can't log in anymore.
+func updateUser(ctx context.Context, appl application.Application, identityID uuid.UUID, change func(user *account.User) bool) error {
+	identity, err := loadIdentity(ctx, appl, identityID)
+	if err != nil {
+		return err
+	}
+	if !identity.UserID.Valid {
+		return errors.NewBadParameterError("identity_id", identityID.String()).Expected("an identity with a user")
+	}
+	if !change(&identity.User) {
+		return nil
+	}
+	err = appl.Users().Save(ctx, &identity.User)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	if identity.User.Deactivated || !identity.User.Approved() {
+		identities, err := appl.Identities().Query(account.IdentityFilterByUserID(identity.User.ID))
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		for _, userIdentity := range identities {
+			_, err = appl.RefreshTokens().RevokeForIdentity(ctx, userIdentity.ID)
+			if err != nil {
+				return errors.NewInternalError(ctx, err)
+			}
+		}
+	}
+	err = outbox.RecordUserEvent(ctx, appl.OutboxEvents(), outbox.UserUpdated, *identity)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id":    identityID,
+		"user_id":        identity.User.ID,
+		"deactivated":    identity.User.Deactivated,
+		"approval_state": identity.User.ApprovalState,
+	}, "user account updated")
+	return nil
+}
+
+// Purge removes the user of the identity with all its identities, their tokens of the external providers,
+// their roles, including the space collaborations, and the events about them.
+// It must be called in a single transaction, so nothing is removed if the purge fails.
+// Returns NotFoundError if the identity doesn't exist, or BadParameterError if one of the identities
+// owns resources, whose ownership must be transferred first.
+func Purge(ctx context.Context, appl application.Application, identityID uuid.UUID) (*PurgeReport, error) {
+	identity, err := loadIdentity(ctx, appl, identityID)
+	if err != nil {
+		return nil, err
+	}
+	report := &PurgeReport{}
+	identities := []account.Identity{*identity}
+	if identity.UserID.Valid {
+		report.UserID = &identity.User.ID
+		identities, err = appl.Identities().Query(account.IdentityFilterByUserID(identity.User.ID))
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+	}
+	for _, userIdentity := range identities {
+		owner, err := appl.ResourceRepository().ExistsForOwner(ctx, userIdentity.ID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		if owner {
+			return nil, errors.NewBadParameterError("identity_id", userIdentity.ID.String()).Expected("an identity which owns no resources. Transfer the ownership of its resources first")
+		}
+	}
+	for _, userIdentity := range identities {
+		err = purgeIdentity(ctx, appl, userIdentity.ID, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if report.UserID != nil {
+		err = appl.Users().HardDelete(ctx, *report.UserID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id":     identityID,
+		"user_id":         report.UserID,
+		"identities":      report.IdentityIDs,
+		"external_tokens": report.ExternalTokens,
+		"identity_roles":  report.IdentityRoles,
+		"outbox_events":   report.OutboxEvents,
+	}, "user purged")
+	return report, nil
+}
+
+// purgeIdentity removes the identity and all the data about it, and records what was removed in the report.
+// The refresh tokens of the identity are removed with it.
+func purgeIdentity(ctx context.Context, appl application.Application, identityID uuid.UUID, report *PurgeReport) error {
+	identityRoles, err := appl.IdentityRoleRepository().FindIdentityRolesByIdentity(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, identityRole := range identityRoles {
+		if identityRole.Role.Name == collaborator.ContributorRole && identityRole.Resource.ResourceType.Name == collaborator.SpaceResourceType {
+			report.SpaceCollaborations = append(report.SpaceCollaborations, identityRole.ResourceID)
+		}
+	}
+	deleted, err := appl.IdentityRoleRepository().HardDeleteForIdentity(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	report.IdentityRoles += deleted
+
+	externalTokens, err := appl.ExternalTokens().Query(provider.ExternalTokenFilterByIdentityID(identityID))
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, externalToken := range externalTokens {
+		err = appl.ExternalTokens().Delete(ctx, externalToken.ID)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+	}
+	report.ExternalTokens += len(externalTokens)
+
+	events, err := appl.OutboxEvents().ListByIdentity(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	eventIDs := make([]uuid.UUID, len(events))
+	for i, event := range events {
+		eventIDs[i] = event.ID
+	}
+	deleted, err = appl.WebhookDeliveries().DeleteByEvents(ctx, eventIDs)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	report.WebhookDeliveries += deleted
+	deleted, err = appl.OutboxEvents().DeleteByIdentity(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	report.OutboxEvents += deleted
+
+	err = appl.Identities().HardDelete(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	report.IdentityIDs = append(report.IdentityIDs, identityID)
+	return nil
+}
+
+// loadIdentity loads the identity with its user
+func loadIdentity(ctx context.Context, appl application.Application, identityID uuid.UUID) (*account.Identity, error) {
+	identities, err := appl.Identities().Query(account.IdentityFilterByID(identityID), account.IdentityWithUser())
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	if len(identities) == 0 {
+		return nil, errors.NewNotFoundError("identity", identityID.String())
+	}
+	return &identities[0], nil
+}
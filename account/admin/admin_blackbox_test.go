@@ -0,0 +1,211 @@
+package admin_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/admin"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/token/provider"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type adminBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunAdminBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &adminBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *adminBlackBoxTest) TestDeactivateRevokesRefreshTokens() {
+	// given
+	identity := s.createUserIdentity()
+	refreshToken := s.createRefreshToken(identity.ID)
+	// when
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		return admin.Deactivate(s.Ctx, appl, identity.ID)
+	})
+	// then
+	require.Nil(s.T(), err)
+	user, err := s.Application.Users().Load(s.Ctx, identity.User.ID)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), user.Deactivated)
+	revoked, err := s.Application.RefreshTokens().Load(s.Ctx, refreshToken.ID)
+	require.Nil(s.T(), err)
+	assert.NotNil(s.T(), revoked.RevokedAt)
+	events, err := s.Application.OutboxEvents().ListByIdentity(s.Ctx, identity.ID)
+	require.Nil(s.T(), err)
+	require.NotEmpty(s.T(), events)
+	assert.Equal(s.T(), outbox.UserUpdated, events[len(events)-1].Type)
+
+	// when the user is reactivated
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		return admin.Reactivate(s.Ctx, appl, identity.ID)
+	})
+	// then
+	require.Nil(s.T(), err)
+	user, err = s.Application.Users().Load(s.Ctx, identity.User.ID)
+	require.Nil(s.T(), err)
+	assert.False(s.T(), user.Deactivated)
+}
+
+func (s *adminBlackBoxTest) TestRejectRevokesRefreshTokens() {
+	// given
+	identity := s.createUserIdentity()
+	refreshToken := s.createRefreshToken(identity.ID)
+	// when
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		return admin.Reject(s.Ctx, appl, identity.ID)
+	})
+	// then
+	require.Nil(s.T(), err)
+	user, err := s.Application.Users().Load(s.Ctx, identity.User.ID)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), user.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStateRejected, *user.ApprovalState)
+	revoked, err := s.Application.RefreshTokens().Load(s.Ctx, refreshToken.ID)
+	require.Nil(s.T(), err)
+	assert.NotNil(s.T(), revoked.RevokedAt)
+
+	// when the user is approved
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		return admin.Approve(s.Ctx, appl, identity.ID)
+	})
+	// then
+	require.Nil(s.T(), err)
+	user, err = s.Application.Users().Load(s.Ctx, identity.User.ID)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), user.Approved())
+}
+
+func (s *adminBlackBoxTest) TestDeactivateUnknownIdentityNotFound() {
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		return admin.Deactivate(s.Ctx, appl, uuid.NewV4())
+	})
+	require.NotNil(s.T(), err)
+	notFound, _ := errors.IsNotFoundError(err)
+	assert.True(s.T(), notFound)
+}
+
+func (s *adminBlackBoxTest) TestPurgeRemovesUserData() {
+	// given a user collaborating on a space, with an external token, a refresh token and events
+	identity := s.createUserIdentity()
+	owner, err := testsupport.CreateTestIdentity(s.DB, "admin_blackbox_test-"+uuid.NewV4().String(), "admin_blackbox_test")
+	require.Nil(s.T(), err)
+	spaceID := uuid.NewV4()
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		res, err := collaborator.CreateSpaceResource(s.Ctx, appl, spaceID, owner.ID)
+		if err != nil {
+			return err
+		}
+		_, err = collaborator.Add(s.Ctx, appl, res, identity.ID)
+		return err
+	})
+	require.Nil(s.T(), err)
+	externalToken := provider.ExternalToken{
+		ProviderID: uuid.NewV4(),
+		Token:      "1234-from-github",
+		Scope:      "user:email",
+		IdentityID: identity.ID,
+	}
+	require.Nil(s.T(), s.Application.ExternalTokens().Create(s.Ctx, &externalToken))
+	refreshToken := s.createRefreshToken(identity.ID)
+	require.Nil(s.T(), outbox.RecordUserEvent(s.Ctx, s.Application.OutboxEvents(), outbox.UserCreated, identity))
+	// when
+	var report *admin.PurgeReport
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		report, err = admin.Purge(s.Ctx, appl, identity.ID)
+		return err
+	})
+	// then
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), report.UserID)
+	assert.Equal(s.T(), identity.User.ID, *report.UserID)
+	assert.Equal(s.T(), []uuid.UUID{identity.ID}, report.IdentityIDs)
+	assert.Equal(s.T(), 1, report.ExternalTokens)
+	assert.Equal(s.T(), int64(1), report.IdentityRoles)
+	assert.Equal(s.T(), []string{spaceID.String()}, report.SpaceCollaborations)
+	assert.Equal(s.T(), int64(1), report.OutboxEvents)
+
+	_, err = s.Application.Users().Load(s.Ctx, identity.User.ID)
+	assert.NotNil(s.T(), err)
+	_, err = s.Application.Identities().Load(s.Ctx, identity.ID)
+	assert.NotNil(s.T(), err)
+	_, err = s.Application.ExternalTokens().Load(s.Ctx, externalToken.ID)
+	assert.NotNil(s.T(), err)
+	_, err = s.Application.RefreshTokens().Load(s.Ctx, refreshToken.ID)
+	assert.NotNil(s.T(), err)
+	events, err := s.Application.OutboxEvents().ListByIdentity(s.Ctx, identity.ID)
+	require.Nil(s.T(), err)
+	assert.Empty(s.T(), events)
+	// the records are removed from the database, not only marked as deleted
+	var count int
+	require.Nil(s.T(), s.DB.Unscoped().Table("identity_role").Where("identity_id = ?", identity.ID).Count(&count).Error)
+	assert.Equal(s.T(), 0, count)
+	require.Nil(s.T(), s.DB.Unscoped().Table("users").Where("id = ?", identity.User.ID).Count(&count).Error)
+	assert.Equal(s.T(), 0, count)
+}
+
+func (s *adminBlackBoxTest) TestPurgeResourceOwnerBadParameter() {
+	// given
+	identity := s.createUserIdentity()
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		_, err := collaborator.CreateSpaceResource(s.Ctx, appl, uuid.NewV4(), identity.ID)
+		return err
+	})
+	require.Nil(s.T(), err)
+	// when
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		_, err := admin.Purge(s.Ctx, appl, identity.ID)
+		return err
+	})
+	// then
+	require.NotNil(s.T(), err)
+	badParameter, _ := errors.IsBadParameterError(err)
+	assert.True(s.T(), badParameter)
+	_, err = s.Application.Identities().Load(s.Ctx, identity.ID)
+	assert.Nil(s.T(), err)
+}
+
+func (s *adminBlackBoxTest) createUserIdentity() account.Identity {
+	user := account.User{
+		ID:       uuid.NewV4(),
+		Email:    uuid.NewV4().String() + "@example.com",
+		FullName: "admin_blackbox_test",
+	}
+	require.Nil(s.T(), s.Application.Users().Create(s.Ctx, &user))
+	identity := account.Identity{
+		Username:     "admin_blackbox_test-" + uuid.NewV4().String(),
+		ProviderType: account.KeycloakIDP,
+		User:         user,
+		UserID:       account.NullUUID{UUID: user.ID, Valid: true},
+	}
+	require.Nil(s.T(), s.Application.Identities().Create(s.Ctx, &identity))
+	return identity
+}
+
+func (s *adminBlackBoxTest) createRefreshToken(identityID uuid.UUID) refresh.RefreshToken {
+	refreshToken := refresh.RefreshToken{
+		TokenHash:  refresh.Hash(uuid.NewV4().String()),
+		IdentityID: identityID,
+		SessionID:  uuid.NewV4(),
+		IssuedAt:   time.Now(),
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	require.Nil(s.T(), s.Application.RefreshTokens().Create(s.Ctx, &refreshToken))
+	return refreshToken
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+
+	"github.com/goadesign/goa"
+)
+
+// KeycloakUsers updates the users in Keycloak
+type KeycloakUsers interface {
+	SetAttribute(ctx context.Context, req *goa.RequestData, userID string, name string, values []string) error
+}
+
+// ApprovalSink keeps the "approved" attribute of the Keycloak users in sync with their approval state,
+// as Keycloak refuses the login of the users who are not approved before the Auth service is involved.
+// The attribute is updated when the changes of the users are delivered from the outbox,
+// so Keycloak is never called in the transactions approving or rejecting the users.
+type ApprovalSink struct {
+	KeycloakUsers KeycloakUsers
+}
+
+// NewApprovalSink creates a sink updating the approval of the users in Keycloak
+func NewApprovalSink(keycloakUsers KeycloakUsers) *ApprovalSink {
+	return &ApprovalSink{
+		KeycloakUsers: keycloakUsers,
+	}
+}
+
+// Name returns the name of the sink
+func (s *ApprovalSink) Name() string {
+	return "keycloak-user-approval"
+}
+
+// Deliver sets the "approved" attribute of the Keycloak user from the approval state of the user after the change,
+// so delivering the events several times or out of order leaves Keycloak in sync with the latest event.
+// The users whose approval state is not known yet are ignored.
+func (s *ApprovalSink) Deliver(ctx context.Context, event outbox.Event) error {
+	if event.Type != outbox.UserUpdated {
+		return nil
+	}
+	var user outbox.User
+	err := event.Unmarshal(&user)
+	if err != nil {
+		return err
+	}
+	if user.ProviderType != account.KeycloakIDP || user.ApprovalState == nil {
+		return nil
+	}
+	approved := *user.ApprovalState == account.ApprovalStateApproved
+	err = s.KeycloakUsers.SetAttribute(ctx, event.RequestData(), user.IdentityID.String(), login.ApprovedAttributeName, []string{strconv.FormatBool(approved)})
+	if notFound, _ := errors.IsNotFoundError(err); notFound {
+		log.Warn(ctx, map[string]interface{}{
+			"identity_id": user.IdentityID,
+			"event_id":    event.ID,
+		}, "the user doesn't exist in Keycloak. Skipping the update of its approval")
+		return nil
+	}
+	return err
+}
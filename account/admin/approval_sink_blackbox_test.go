@@ -0,0 +1,98 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/admin"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dummyKeycloakUsers keeps the attributes of the Keycloak users in memory
+type dummyKeycloakUsers struct {
+	attributes map[string]map[string][]string
+}
+
+func (u *dummyKeycloakUsers) SetAttribute(ctx context.Context, req *goa.RequestData, userID string, name string, values []string) error {
+	attributes, found := u.attributes[userID]
+	if !found {
+		return errors.NewNotFoundError("keycloak user", userID)
+	}
+	attributes[name] = values
+	return nil
+}
+
+func TestApprovalSinkUpdatesKeycloakUser(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	// given
+	identityID := uuid.NewV4()
+	keycloakUsers := &dummyKeycloakUsers{attributes: map[string]map[string][]string{
+		identityID.String(): {"approved": {"false"}, "company": {"Company Inc."}},
+	}}
+	sink := admin.NewApprovalSink(keycloakUsers)
+
+	// when the user is approved
+	err := sink.Deliver(context.Background(), approvalEvent(t, outbox.UserUpdated, identityID, account.KeycloakIDP, account.ApprovalStateApproved))
+	// then
+	require.Nil(t, err)
+	assert.Equal(t, map[string][]string{"approved": {"true"}, "company": {"Company Inc."}}, keycloakUsers.attributes[identityID.String()])
+
+	// when the user is rejected
+	err = sink.Deliver(context.Background(), approvalEvent(t, outbox.UserUpdated, identityID, account.KeycloakIDP, account.ApprovalStateRejected))
+	// then
+	require.Nil(t, err)
+	assert.Equal(t, map[string][]string{"approved": {"false"}, "company": {"Company Inc."}}, keycloakUsers.attributes[identityID.String()])
+}
+
+func TestApprovalSinkIgnoresOtherEvents(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	// given
+	identityID := uuid.NewV4()
+	keycloakUsers := &dummyKeycloakUsers{attributes: map[string]map[string][]string{
+		identityID.String(): {"approved": {"false"}},
+	}}
+	sink := admin.NewApprovalSink(keycloakUsers)
+
+	// when the user is created, or is not a Keycloak user
+	err := sink.Deliver(context.Background(), approvalEvent(t, outbox.UserCreated, identityID, account.KeycloakIDP, account.ApprovalStateApproved))
+	require.Nil(t, err)
+	err = sink.Deliver(context.Background(), approvalEvent(t, outbox.UserUpdated, identityID, "github", account.ApprovalStateApproved))
+	require.Nil(t, err)
+	// or its approval state is not known yet
+	payload, err := json.Marshal(outbox.User{IdentityID: identityID, UserID: uuid.NewV4(), ProviderType: account.KeycloakIDP})
+	require.Nil(t, err)
+	err = sink.Deliver(context.Background(), outbox.Event{ID: uuid.NewV4(), Type: outbox.UserUpdated, IdentityID: identityID, Origin: "https://auth.example.com", Payload: payload})
+	require.Nil(t, err)
+
+	// then
+	assert.Equal(t, map[string][]string{"approved": {"false"}}, keycloakUsers.attributes[identityID.String()])
+}
+
+func TestApprovalSinkIgnoresDeletedKeycloakUsers(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	// given
+	sink := admin.NewApprovalSink(&dummyKeycloakUsers{attributes: map[string]map[string][]string{}})
+	// when
+	err := sink.Deliver(context.Background(), approvalEvent(t, outbox.UserUpdated, uuid.NewV4(), account.KeycloakIDP, account.ApprovalStateApproved))
+	// then
+	assert.Nil(t, err)
+}
+
+// approvalEvent returns an event about the user of the identity in the given approval state
+func approvalEvent(t *testing.T, eventType string, identityID uuid.UUID, providerType string, approvalState string) outbox.Event {
+	payload, err := json.Marshal(outbox.User{IdentityID: identityID, UserID: uuid.NewV4(), ProviderType: providerType, ApprovalState: &approvalState})
+	require.Nil(t, err)
+	return outbox.Event{ID: uuid.NewV4(), Type: eventType, IdentityID: identityID, Origin: "https://auth.example.com", Payload: payload}
+}
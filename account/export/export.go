@@ -0,0 +1,117 @@
+// Package export collects the data stored about a user, so it can be handed over to the user.
+// The values of the tokens of the external providers are never exported.
+package export
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
+	"github.com/fabric8-services/fabric8-auth/token/provider"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Data is the data stored about a user
+type Data struct {
+	// User is nil if the identity has no user
+	User                *account.User
+	Identities          []account.Identity
+	ExternalAccounts    []ExternalAccount
+	RoleAssignments     []RoleAssignment
+	SpaceCollaborations []SpaceCollaboration
+}
+
+// ExternalAccount is an account of an external provider linked to an identity
+type ExternalAccount struct {
+	IdentityID uuid.UUID
+	ProviderID uuid.UUID
+	Username   string
+	Scope      string
+	LinkedAt   time.Time
+}
+
+// RoleAssignment is a role assigned to an identity for a resource
+type RoleAssignment struct {
+	IdentityID   uuid.UUID
+	ResourceID   string
+	ResourceType string
+	Role         string
+	AssignedAt   time.Time
+}
+
+// SpaceCollaboration is a space an identity is a collaborator of
+type SpaceCollaboration struct {
+	IdentityID uuid.UUID
+	SpaceID    string
+	AddedAt    time.Time
+}
+
+// Collect returns the data stored about the user of the identity and all its identities.
+// Returns NotFoundError if the identity doesn't exist.
+func Collect(ctx context.Context, appl application.Application, identityID uuid.UUID) (*Data, error) {
+	identities, err := appl.Identities().Query(account.IdentityFilterByID(identityID), account.IdentityWithUser())
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	if len(identities) == 0 {
+		return nil, errors.NewNotFoundError("identity", identityID.String())
+	}
+	data := &Data{Identities: identities}
+	if identities[0].UserID.Valid {
+		user := identities[0].User
+		data.User = &user
+		data.Identities, err = appl.Identities().Query(account.IdentityFilterByUserID(user.ID))
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+	}
+	for _, identity := range data.Identities {
+		err = collectIdentity(ctx, appl, identity.ID, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// collectIdentity adds the external accounts and the roles of the identity to the data
+func collectIdentity(ctx context.Context, appl application.Application, identityID uuid.UUID, data *Data) error {
+	externalTokens, err := appl.ExternalTokens().Query(provider.ExternalTokenFilterByIdentityID(identityID))
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, externalToken := range externalTokens {
+		data.ExternalAccounts = append(data.ExternalAccounts, ExternalAccount{
+			IdentityID: identityID,
+			ProviderID: externalToken.ProviderID,
+			Username:   externalToken.Username,
+			Scope:      externalToken.Scope,
+			LinkedAt:   externalToken.CreatedAt,
+		})
+	}
+	identityRoles, err := appl.IdentityRoleRepository().FindIdentityRolesByIdentity(ctx, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, identityRole := range identityRoles {
+		data.RoleAssignments = append(data.RoleAssignments, RoleAssignment{
+			IdentityID:   identityID,
+			ResourceID:   identityRole.ResourceID,
+			ResourceType: identityRole.Resource.ResourceType.Name,
+			Role:         identityRole.Role.Name,
+			AssignedAt:   identityRole.CreatedAt,
+		})
+		if identityRole.Role.Name == collaborator.ContributorRole && identityRole.Resource.ResourceType.Name == collaborator.SpaceResourceType {
+			data.SpaceCollaborations = append(data.SpaceCollaborations, SpaceCollaboration{
+				IdentityID: identityID,
+				SpaceID:    identityRole.ResourceID,
+				AddedAt:    identityRole.CreatedAt,
+			})
+		}
+	}
+	return nil
+}
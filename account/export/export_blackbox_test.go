@@ -0,0 +1,109 @@
+package export_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/export"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/token/provider"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type exportBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunExportBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &exportBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *exportBlackBoxTest) TestCollectUserData() {
+	// given a user with two identities, an external account and a space collaboration
+	user := account.User{
+		ID:                 uuid.NewV4(),
+		Email:              uuid.NewV4().String() + "@example.com",
+		FullName:           "export_blackbox_test",
+		ContextInformation: account.ContextInformation{"last_visited_url": "https://openshift.io"},
+	}
+	require.Nil(s.T(), s.Application.Users().Create(s.Ctx, &user))
+	identity := s.createIdentity(user, account.KeycloakIDP)
+	other := s.createIdentity(user, "github")
+	externalToken := provider.ExternalToken{
+		ProviderID: uuid.NewV4(),
+		Token:      "1234-from-github",
+		Scope:      "user:email",
+		Username:   "export-github",
+		IdentityID: identity.ID,
+	}
+	require.Nil(s.T(), s.Application.ExternalTokens().Create(s.Ctx, &externalToken))
+	owner, err := testsupport.CreateTestIdentity(s.DB, "export_blackbox_test-"+uuid.NewV4().String(), "export_blackbox_test")
+	require.Nil(s.T(), err)
+	spaceID := uuid.NewV4()
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		res, err := collaborator.CreateSpaceResource(s.Ctx, appl, spaceID, owner.ID)
+		if err != nil {
+			return err
+		}
+		_, err = collaborator.Add(s.Ctx, appl, res, other.ID)
+		return err
+	})
+	require.Nil(s.T(), err)
+	// when
+	var data *export.Data
+	err = application.Transactional(s.Application, func(appl application.Application) error {
+		data, err = export.Collect(s.Ctx, appl, identity.ID)
+		return err
+	})
+	// then
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), data.User)
+	assert.Equal(s.T(), user.ID, data.User.ID)
+	assert.Equal(s.T(), "https://openshift.io", data.User.ContextInformation["last_visited_url"])
+	assert.Len(s.T(), data.Identities, 2)
+	require.Len(s.T(), data.ExternalAccounts, 1)
+	assert.Equal(s.T(), export.ExternalAccount{
+		IdentityID: identity.ID,
+		ProviderID: externalToken.ProviderID,
+		Username:   "export-github",
+		Scope:      "user:email",
+		LinkedAt:   data.ExternalAccounts[0].LinkedAt,
+	}, data.ExternalAccounts[0])
+	require.Len(s.T(), data.RoleAssignments, 1)
+	assert.Equal(s.T(), other.ID, data.RoleAssignments[0].IdentityID)
+	assert.Equal(s.T(), collaborator.SpaceResourceType, data.RoleAssignments[0].ResourceType)
+	assert.Equal(s.T(), collaborator.ContributorRole, data.RoleAssignments[0].Role)
+	require.Len(s.T(), data.SpaceCollaborations, 1)
+	assert.Equal(s.T(), spaceID.String(), data.SpaceCollaborations[0].SpaceID)
+}
+
+func (s *exportBlackBoxTest) TestCollectUnknownIdentityNotFound() {
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		_, err := export.Collect(s.Ctx, appl, uuid.NewV4())
+		return err
+	})
+	require.NotNil(s.T(), err)
+	notFound, _ := errors.IsNotFoundError(err)
+	assert.True(s.T(), notFound)
+}
+
+func (s *exportBlackBoxTest) createIdentity(user account.User, providerType string) account.Identity {
+	identity := account.Identity{
+		Username:     "export_blackbox_test-" + uuid.NewV4().String(),
+		ProviderType: providerType,
+		User:         user,
+		UserID:       account.NullUUID{UUID: user.ID, Valid: true},
+	}
+	require.Nil(s.T(), s.Application.Identities().Create(s.Ctx, &identity))
+	return identity
+}
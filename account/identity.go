@@ -11,6 +11,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
@@ -112,6 +113,7 @@ type IdentityRepository interface {
 	Lookup(ctx context.Context, username, profileURL, providerType string) (*Identity, error)
 	Save(ctx context.Context, identity *Identity) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	HardDelete(ctx context.Context, id uuid.UUID) error
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Identity, error)
 	List(ctx context.Context) ([]Identity, error)
 	IsValid(context.Context, uuid.UUID) bool
@@ -131,6 +133,7 @@ func (m *GormIdentityRepository) TableName() string {
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormIdentityRepository) Load(ctx context.Context, id uuid.UUID) (*Identity, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "load").Finish()
 
 	var native Identity
 	err := m.db.Table(m.TableName()).Where("id = ?", id).Find(&native).Error
@@ -144,12 +147,14 @@ func (m *GormIdentityRepository) Load(ctx context.Context, id uuid.UUID) (*Ident
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormIdentityRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "exists").Finish()
 	return repository.CheckExists(ctx, m.db, m.TableName(), id)
 }
 
 // Create creates a new record.
 func (m *GormIdentityRepository) Create(ctx context.Context, model *Identity) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "create").Finish()
 	if model.ID == uuid.Nil {
 		model.ID = uuid.NewV4()
 	}
@@ -201,6 +206,7 @@ func (m *GormIdentityRepository) Lookup(ctx context.Context, username, profileUR
 // Save modifies a single record.
 func (m *GormIdentityRepository) Save(ctx context.Context, model *Identity) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "save").Finish()
 
 	err := m.db.Save(model).Error
 
@@ -214,6 +220,7 @@ func (m *GormIdentityRepository) Save(ctx context.Context, model *Identity) erro
 // Delete removes a single record.
 func (m *GormIdentityRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "delete").Finish()
 
 	obj := Identity{ID: id}
 	db := m.db.Delete(obj)
@@ -236,6 +243,31 @@ func (m *GormIdentityRepository) Delete(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// HardDelete removes a single record from the database, whereas Delete only marks it as deleted.
+// returns NotFoundError if the identity doesn't exist
+func (m *GormIdentityRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "identity", "hardDelete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "hardDelete").Finish()
+
+	db := m.db.Unscoped().Delete(&Identity{ID: id})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": id,
+			"err":         db.Error,
+		}, "unable to hard delete the identity")
+		return errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return errors.NewNotFoundError("identity", id.String())
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"identity_id": id,
+	}, "Identity hard deleted!")
+
+	return nil
+}
+
 // Query expose an open ended Query model
 func (m *GormIdentityRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Identity, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "query"}, time.Now())
@@ -325,6 +357,7 @@ func IdentityFilterByRegistrationCompleted(registrationCompleted bool) func(db *
 // List return all user identities
 func (m *GormIdentityRepository) List(ctx context.Context) ([]Identity, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity", "list").Finish()
 	var rows []Identity
 
 	err := m.db.Model(&Identity{}).Order("username").Find(&rows).Error
@@ -2,13 +2,12 @@ package account
 
 import (
 	"context"
-	"net/http"
 	"net/url"
 
 	"github.com/fabric8-services/fabric8-auth/account/tenant"
 	"github.com/fabric8-services/fabric8-auth/goasupport"
 	"github.com/fabric8-services/fabric8-auth/rest"
-	"github.com/goadesign/goa/client"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 )
 
 type tenantConfig interface {
@@ -44,7 +43,7 @@ func createClient(ctx context.Context, config tenantConfig) (*tenant.Client, err
 		return nil, err
 	}
 
-	c := tenant.New(client.HTTPClientDoer(http.DefaultClient))
+	c := tenant.New(tracing.NewDoer("tenant"))
 	c.Host = u.Host
 	c.Scheme = u.Scheme
 	c.SetJWTSigner(goasupport.NewForwardSigner(ctx))
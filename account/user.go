@@ -9,6 +9,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
@@ -16,6 +17,15 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+const (
+	// ApprovalStateApproved is the approval state of the users who can log in
+	ApprovalStateApproved = "approved"
+	// ApprovalStatePending is the approval state of the users waiting to be approved
+	ApprovalStatePending = "pending"
+	// ApprovalStateRejected is the approval state of the users whose registration has been rejected
+	ApprovalStateRejected = "rejected"
+)
+
 // In future, we could add support for FieldDefinitions the way we have for workitems.
 // Hence. keeping the map as a string->interface and not string->string.
 // At the moment, FieldDefinitions could be an overkill, so keeping it out.
@@ -33,6 +43,22 @@ type User struct {
 	Cluster            string             // The OpenShift cluster allocted to the user.
 	Identities         []Identity         // has many Identities from different IDPs
 	ContextInformation ContextInformation `sql:"type:jsonb"` // context information of the user activity
+	Deactivated        bool               // Whether the user account has been deactivated. A deactivated user can't log in nor refresh its tokens
+	ApprovalState      *string            // Whether the user has been approved, is pending or has been rejected. Only approved users can log in. Not known yet for the users created before it was stored locally
+}
+
+// Approved returns true if the user is approved, so it can log in
+func (m User) Approved() bool {
+	return m.ApprovalState != nil && *m.ApprovalState == ApprovalStateApproved
+}
+
+// KeycloakApprovalState returns the approval state of a user approved or not in Keycloak
+func KeycloakApprovalState(approved bool) *string {
+	approvalState := ApprovalStatePending
+	if approved {
+		approvalState = ApprovalStateApproved
+	}
+	return &approvalState
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -70,7 +96,9 @@ type UserRepository interface {
 	Save(ctx context.Context, u *User) error
 	List(ctx context.Context) ([]User, error)
 	Delete(ctx context.Context, ID uuid.UUID) error
+	HardDelete(ctx context.Context, ID uuid.UUID) error
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]User, error)
+	ListByApprovalState(ctx context.Context, approvalState string, start int, limit int) ([]User, error)
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -85,6 +113,7 @@ func (m *GormUserRepository) TableName() string {
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormUserRepository) Load(ctx context.Context, id uuid.UUID) (*User, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "load").Finish()
 	var native User
 	err := m.db.Table(m.TableName()).Where("id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
@@ -96,15 +125,21 @@ func (m *GormUserRepository) Load(ctx context.Context, id uuid.UUID) (*User, err
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormUserRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "exists").Finish()
 	return repository.CheckExists(ctx, m.db, m.TableName(), id)
 }
 
 // Create creates a new record.
 func (m *GormUserRepository) Create(ctx context.Context, u *User) error {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "create").Finish()
 	if u.ID == uuid.Nil {
 		u.ID = uuid.NewV4()
 	}
+	if u.ApprovalState == nil {
+		approvalState := ApprovalStateApproved
+		u.ApprovalState = &approvalState
+	}
 
 	err := m.db.Create(u).Error
 	if err != nil {
@@ -123,6 +158,7 @@ func (m *GormUserRepository) Create(ctx context.Context, u *User) error {
 // Save modifies a single record
 func (m *GormUserRepository) Save(ctx context.Context, model *User) error {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "save").Finish()
 
 	err := m.db.Save(model).Error
 	if err != nil {
@@ -138,6 +174,7 @@ func (m *GormUserRepository) Save(ctx context.Context, model *User) error {
 // Delete removes a single record.
 func (m *GormUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "delete").Finish()
 
 	obj := User{ID: id}
 
@@ -158,9 +195,35 @@ func (m *GormUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// HardDelete removes a single record from the database, whereas Delete only marks it as deleted.
+// returns NotFoundError if the user doesn't exist
+func (m *GormUserRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "user", "hardDelete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "hardDelete").Finish()
+
+	db := m.db.Unscoped().Delete(&User{ID: id})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"user_id": id,
+			"err":     db.Error,
+		}, "unable to hard delete the user")
+		return errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return errors.NewNotFoundError("user", id.String())
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"user_id": id,
+	}, "User hard deleted!")
+
+	return nil
+}
+
 // List return all users
 func (m *GormUserRepository) List(ctx context.Context) ([]User, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "list").Finish()
 	var rows []User
 
 	err := m.db.Model(&User{}).Order("email").Find(&rows).Error
@@ -170,6 +233,19 @@ func (m *GormUserRepository) List(ctx context.Context) ([]User, error) {
 	return rows, nil
 }
 
+// ListByApprovalState returns the users in the given approval state with their identities, in the order they registered
+func (m *GormUserRepository) ListByApprovalState(ctx context.Context, approvalState string, start int, limit int) ([]User, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "user", "listByApprovalState"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "user", "listByApprovalState").Finish()
+	var rows []User
+
+	err := m.db.Model(&User{}).Preload("Identities").Where("approval_state = ?", approvalState).Order("created_at").Offset(start).Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
 // Query expose an open ended Query model
 func (m *GormUserRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]User, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "user", "query"}, time.Now())
@@ -2,10 +2,15 @@ package application
 
 import (
 	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
 	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/space"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+	"github.com/fabric8-services/fabric8-auth/webhook"
 )
 
 //An Application stands for a particular implementation of the business logic of our application
@@ -15,8 +20,16 @@ type Application interface {
 	Users() account.UserRepository
 	OauthStates() auth.OauthStateReferenceRepository
 	ExternalTokens() provider.ExternalTokenRepository
+	RefreshTokens() refresh.RefreshTokenRepository
+	OutboxEvents() outbox.EventRepository
+	WebhookSubscriptions() webhook.SubscriptionRepository
+	WebhookDeliveries() webhook.DeliveryRepository
+	AuditEvents() audit.EventRepository
 	ResourceRepository() resource.ResourceRepository
 	ResourceTypeRepository() resource.ResourceTypeRepository
+	ResourceTypeScopeRepository() resource.ResourceTypeScopeRepository
+	RoleRepository() role.RoleRepository
+	IdentityRoleRepository() role.IdentityRoleRepository
 }
 
 // A Transaction abstracts a database transaction. The repositories created for the transaction object make changes inside the the transaction
@@ -0,0 +1,210 @@
+// Package audit records the security-relevant events (logins, token exchanges, links of external accounts,
+// changes of the space collaborators, etc.) in an append-only log which can be queried by the service accounts
+// for incident response and compliance.
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/tracing"
+
+	"github.com/goadesign/goa"
+	"github.com/goadesign/goa/middleware"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// Login is the action of a user logging in after the redirect from Keycloak
+	Login = "login"
+	// ServiceAccountExchange is the action of a service account exchanging its credentials or a user token for a token
+	ServiceAccountExchange = "service_account.exchange"
+	// ExternalTokenLink is the action of a user linking an account of an external provider
+	ExternalTokenLink = "external_token.link"
+	// ExternalTokenDelete is the action of a user deleting the token of an external provider
+	ExternalTokenDelete = "external_token.delete"
+	// CollaboratorAdd is the action of a user adding an identity to the collaborators of a space
+	CollaboratorAdd = "collaborator.add"
+	// CollaboratorRemove is the action of a user removing an identity from the collaborators of a space
+	CollaboratorRemove = "collaborator.remove"
+	// ResourceRegister is the action of a service account registering a resource
+	ResourceRegister = "resource.register"
+	// ProfileEmailChange is the action of a user changing its email
+	ProfileEmailChange = "profile.email.change"
+	// ProfileUsernameChange is the action of a user changing its username
+	ProfileUsernameChange = "profile.username.change"
+
+	// Success is the outcome of an action which has been performed
+	Success = "success"
+	// Failure is the outcome of an action which has been refused or has failed
+	Failure = "failure"
+)
+
+// Event is an entry of the audit log
+type Event struct {
+	gormsupport.LifecycleHardDelete
+	ID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:audit_event_id"`
+	// ActorID is the ID of the identity which performed the action. It is not set if the actor is unknown,
+	// e.g. a failed exchange requested with an unknown service account ID
+	ActorID account.NullUUID `sql:"type:uuid"`
+	// Subject is what the action was performed on, e.g. the ID of the identity added to a space or the name of a provider
+	Subject   string
+	Action    string
+	Outcome   string
+	ClientIP  string
+	RequestID string
+	Details   Details `sql:"type:jsonb"`
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m Event) TableName() string {
+	return "audit_event"
+}
+
+// Details contains the additional data of an event, specific to its action
+type Details map[string]interface{}
+
+// Value implements the driver.Valuer interface
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (d *Details) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errs.Errorf("unexpected type %T of the details", src)
+	}
+	return errs.WithStack(json.Unmarshal(b, d))
+}
+
+// NewEvent returns an event of the given action performed by the actor on the subject.
+// The actor is unknown if its ID is uuid.Nil. The client IP and the request ID are taken from the request found in the context, if any.
+func NewEvent(ctx context.Context, action string, actorID uuid.UUID, subject string, outcome string, details Details) *Event {
+	event := &Event{
+		ActorID:   account.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		Subject:   subject,
+		Action:    action,
+		Outcome:   outcome,
+		RequestID: middleware.ContextRequestID(ctx),
+		Details:   details,
+	}
+	if req := goa.ContextRequest(ctx); req != nil && req.Request != nil {
+		event.ClientIP = rest.ClientIP(req.Request)
+	}
+	return event
+}
+
+// Record records an event of the given action performed by the actor on the subject.
+// The failures are recorded outside of the transaction of the action, since it is rolled back.
+func Record(ctx context.Context, repo EventRepository, action string, actorID uuid.UUID, subject string, outcome string, details Details) error {
+	return repo.Create(ctx, NewEvent(ctx, action, actorID, subject, outcome, details))
+}
+
+// OutcomeOf returns the outcome of an action which succeeded if success is true
+func OutcomeOf(success bool) string {
+	if success {
+		return Success
+	}
+	return Failure
+}
+
+// Filter selects the events returned by EventRepository.List. The zero values match all the events.
+type Filter struct {
+	ActorID uuid.UUID
+	Action  string
+	From    *time.Time
+	To      *time.Time
+}
+
+// GormEventRepository is the implementation of the storage interface for Event.
+// The events can't be updated once recorded.
+type GormEventRepository struct {
+	db *gorm.DB
+}
+
+// NewEventRepository creates a new storage type.
+func NewEventRepository(db *gorm.DB) *GormEventRepository {
+	return &GormEventRepository{db: db}
+}
+
+// EventRepository represents the storage interface.
+type EventRepository interface {
+	Create(ctx context.Context, event *Event) error
+	List(ctx context.Context, filter Filter, start int, limit int) ([]Event, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormEventRepository) TableName() string {
+	return "audit_event"
+}
+
+// Create creates a new record.
+func (m *GormEventRepository) Create(ctx context.Context, model *Event) error {
+	defer goa.MeasureSince([]string{"goa", "db", "audit_event", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "audit_event", "create").Finish()
+	if model.ID == uuid.Nil {
+		model.ID = uuid.NewV4()
+	}
+	err := m.db.Create(model).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"audit_event_id": model.ID,
+			"action":         model.Action,
+			"subject":        model.Subject,
+			"err":            err,
+		}, "unable to record the audit event")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// List returns the events matching the filter, most recent first
+func (m *GormEventRepository) List(ctx context.Context, filter Filter, start int, limit int) ([]Event, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "audit_event", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "audit_event", "list").Finish()
+	db := m.db.Table(m.TableName())
+	if filter.ActorID != uuid.Nil {
+		db = db.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		db = db.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		db = db.Where("created_at < ?", *filter.To)
+	}
+	var rows []Event
+	err := db.Order("created_at DESC").Offset(start).Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,146 @@
+package audit_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/audit"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type eventBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo *audit.GormEventRepository
+}
+
+func TestRunEventBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &eventBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *eventBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = audit.NewEventRepository(s.DB)
+}
+
+func (s *eventBlackboxTest) TestRecord() {
+	// given
+	actorID := uuid.NewV4()
+	req := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:41234"}
+	ctx := goa.NewContext(context.Background(), nil, req, nil)
+	// when
+	err := audit.Record(ctx, s.repo, audit.ExternalTokenLink, actorID, "github", audit.Success, audit.Details{"provider_id": "b2ca0b53"})
+	// then
+	require.Nil(s.T(), err)
+	events, err := s.repo.List(s.Ctx, audit.Filter{ActorID: actorID}, 0, 10)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), events, 1)
+	event := events[0]
+	assert.True(s.T(), event.ActorID.Valid)
+	assert.Equal(s.T(), actorID, event.ActorID.UUID)
+	assert.Equal(s.T(), audit.ExternalTokenLink, event.Action)
+	assert.Equal(s.T(), "github", event.Subject)
+	assert.Equal(s.T(), audit.Success, event.Outcome)
+	assert.Equal(s.T(), "10.0.0.1", event.ClientIP)
+	assert.Equal(s.T(), "b2ca0b53", event.Details["provider_id"])
+}
+
+func (s *eventBlackboxTest) TestRecordWithUnknownActor() {
+	// given
+	subject := "unknown-" + uuid.NewV4().String()
+	req := &http.Request{Header: http.Header{"X-Forwarded-For": []string{"192.168.1.10"}}}
+	ctx := goa.NewContext(context.Background(), nil, req, nil)
+	// when
+	err := audit.Record(ctx, s.repo, audit.ServiceAccountExchange, uuid.Nil, subject, audit.Failure, nil)
+	// then
+	require.Nil(s.T(), err)
+	events, err := s.repo.List(s.Ctx, audit.Filter{Action: audit.ServiceAccountExchange}, 0, 100)
+	require.Nil(s.T(), err)
+	var recorded *audit.Event
+	for i := range events {
+		if events[i].Subject == subject {
+			recorded = &events[i]
+		}
+	}
+	require.NotNil(s.T(), recorded)
+	assert.False(s.T(), recorded.ActorID.Valid)
+	assert.Equal(s.T(), "192.168.1.10", recorded.ClientIP)
+	assert.Nil(s.T(), recorded.Details)
+}
+
+func (s *eventBlackboxTest) TestListFilters() {
+	// given
+	actorID := uuid.NewV4()
+	login := s.recordEvent(actorID, audit.Login, time.Now().Add(-2*time.Hour))
+	collaborator := s.recordEvent(actorID, audit.CollaboratorAdd, time.Now().Add(-time.Hour))
+	latest := s.recordEvent(actorID, audit.Login, time.Now())
+	s.recordEvent(uuid.NewV4(), audit.Login, time.Now())
+
+	s.T().Run("by actor, most recent first", func(t *testing.T) {
+		events, err := s.repo.List(s.Ctx, audit.Filter{ActorID: actorID}, 0, 10)
+		require.Nil(t, err)
+		assert.Equal(t, []uuid.UUID{latest.ID, collaborator.ID, login.ID}, eventIDs(events))
+	})
+
+	s.T().Run("by actor and action", func(t *testing.T) {
+		events, err := s.repo.List(s.Ctx, audit.Filter{ActorID: actorID, Action: audit.Login}, 0, 10)
+		require.Nil(t, err)
+		assert.Equal(t, []uuid.UUID{latest.ID, login.ID}, eventIDs(events))
+	})
+
+	s.T().Run("by time range", func(t *testing.T) {
+		from := time.Now().Add(-90 * time.Minute)
+		to := time.Now().Add(-time.Minute)
+		events, err := s.repo.List(s.Ctx, audit.Filter{ActorID: actorID, From: &from, To: &to}, 0, 10)
+		require.Nil(t, err)
+		assert.Equal(t, []uuid.UUID{collaborator.ID}, eventIDs(events))
+	})
+
+	s.T().Run("paged", func(t *testing.T) {
+		events, err := s.repo.List(s.Ctx, audit.Filter{ActorID: actorID}, 1, 1)
+		require.Nil(t, err)
+		assert.Equal(t, []uuid.UUID{collaborator.ID}, eventIDs(events))
+	})
+}
+
+func (s *eventBlackboxTest) TestEventsCantBeUpdated() {
+	// given
+	event := s.recordEvent(uuid.NewV4(), audit.Login, time.Now())
+	// when
+	err := s.DB.Model(event).Update("outcome", audit.Failure).Error
+	// then
+	require.NotNil(s.T(), err)
+}
+
+func (s *eventBlackboxTest) TestEventsCantBeDeleted() {
+	// given
+	event := s.recordEvent(uuid.NewV4(), audit.Login, time.Now())
+	// when
+	err := s.DB.Delete(event).Error
+	// then
+	require.NotNil(s.T(), err)
+}
+
+func (s *eventBlackboxTest) recordEvent(actorID uuid.UUID, action string, createdAt time.Time) *audit.Event {
+	event := audit.NewEvent(s.Ctx, action, actorID, actorID.String(), audit.Success, nil)
+	event.CreatedAt = createdAt
+	require.Nil(s.T(), s.repo.Create(s.Ctx, event))
+	return event
+}
+
+func eventIDs(events []audit.Event) []uuid.UUID {
+	ids := make([]uuid.UUID, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
@@ -11,8 +11,10 @@ import (
 
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/metric"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	errs "github.com/pkg/errors"
 )
 
@@ -189,7 +191,7 @@ func CreateResource(ctx context.Context, resource KeycloakResource, authzEndpoin
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "create_resource", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"auth_endpoint": authzEndpoint,
@@ -239,7 +241,7 @@ func GetClientID(ctx context.Context, clientsEndpoint string, publicClientID str
 		return "", errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "get_client_id", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"public_client_id": publicClientID,
@@ -299,7 +301,7 @@ func CreatePolicy(ctx context.Context, clientsEndpoint string, clientID string,
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "create_policy", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"client_id": clientID,
@@ -354,7 +356,7 @@ func CreatePermission(ctx context.Context, clientsEndpoint string, clientID stri
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "create_permission", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"client_id":  clientID,
@@ -407,7 +409,7 @@ func DeleteResource(ctx context.Context, kcResourceID string, authzEndpoint stri
 		return errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "delete_resource", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"kc_resource_id": kcResourceID,
@@ -447,7 +449,7 @@ func DeletePolicy(ctx context.Context, clientsEndpoint string, clientID string,
 		return errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "delete_policy", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"policy_id": policyID,
@@ -487,7 +489,7 @@ func DeletePermission(ctx context.Context, clientsEndpoint string, clientID stri
 		return errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "delete_permission", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"permission_id": permissionID,
@@ -527,7 +529,7 @@ func GetPolicy(ctx context.Context, clientsEndpoint string, clientID string, pol
 		return nil, errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "get_policy", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"client_id": clientID,
@@ -595,7 +597,7 @@ func UpdatePolicy(ctx context.Context, clientsEndpoint string, clientID string,
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "update_policy", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"client_id": clientID,
@@ -648,7 +650,7 @@ func GetEntitlement(ctx context.Context, entitlementEndpoint string, entitlement
 	}
 
 	req.Header.Add("Authorization", "Bearer "+userAccesToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "get_entitlement", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"entitlement_resource": entitlementResource,
@@ -695,7 +697,7 @@ func GetUserInfo(ctx context.Context, userInfoEndpoint string, userAccessToken s
 		return nil, errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+userAccessToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "get_user_info", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"err": err.Error(),
@@ -731,7 +733,7 @@ func ValidateKeycloakUser(ctx context.Context, adminEndpoint string, userID, pro
 		return false, errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+protectionAPIToken)
-	res, err := http.DefaultClient.Do(req)
+	res, err := doRequest(ctx, "validate_user", req)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"user_id": userID,
@@ -758,12 +760,18 @@ func ValidateKeycloakUser(ctx context.Context, adminEndpoint string, userID, pro
 
 // GetProtectedAPIToken obtains a Protected API Token (PAT) from Keycloak
 func GetProtectedAPIToken(ctx context.Context, openidConnectTokenURL string, clientID string, clientSecret string) (string, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	res, err := client.PostForm(openidConnectTokenURL, url.Values{
+	req, err := http.NewRequest("POST", openidConnectTokenURL, strings.NewReader(url.Values{
 		"client_id":     {clientID},
 		"client_secret": {clientSecret},
 		"grant_type":    {"client_credentials"},
-	})
+	}.Encode()))
+	if err != nil {
+		return "", errors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	res, err := doRequest(reqCtx, "get_protected_api_token", req)
 	if err != nil {
 		return "", errors.NewInternalError(ctx, errs.Wrap(err, "error when obtaining token"))
 	}
@@ -785,3 +793,14 @@ func GetProtectedAPIToken(ctx context.Context, openidConnectTokenURL string, cli
 	}
 	return *t.AccessToken, nil
 }
+
+// keycloakClient sends the requests to Keycloak as part of the trace of the context of the requests
+var keycloakClient = tracing.NewHTTPClient("keycloak")
+
+// doRequest sends the request to Keycloak with the given context and records its latency and response status for the given operation
+func doRequest(ctx context.Context, operation string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := keycloakClient.Do(req.WithContext(ctx))
+	metric.ObserveKeycloakRequest(operation, start, res, err)
+	return res, err
+}
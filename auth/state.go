@@ -20,6 +20,12 @@ type OauthStateReference struct {
 	gormsupport.Lifecycle
 	ID       uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key"`
 	Referrer string
+	// CodeChallenge and CodeChallengeMethod are the RFC 7636 code challenge sent by a public client
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// IdentityID and SessionState are set for the authorization codes issued to the public clients at login
+	IdentityID   *uuid.UUID `sql:"type:uuid"`
+	SessionState string
 }
 
 // TableName implements gorm.tabler
@@ -39,9 +45,22 @@ func (r OauthStateReference) Equal(u convert.Equaler) bool {
 	if r.Referrer != other.Referrer {
 		return false
 	}
+	if r.CodeChallenge != other.CodeChallenge || r.CodeChallengeMethod != other.CodeChallengeMethod {
+		return false
+	}
+	if !uuid.Equal(uuidOrNil(r.IdentityID), uuidOrNil(other.IdentityID)) || r.SessionState != other.SessionState {
+		return false
+	}
 	return true
 }
 
+func uuidOrNil(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
 // OauthStateReferenceRepository encapsulate storage & retrieval of state references
 type OauthStateReferenceRepository interface {
 	Create(ctx context.Context, state *OauthStateReference) (*OauthStateReference, error)
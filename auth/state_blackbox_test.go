@@ -54,3 +54,27 @@ func (s *stateBlackBoxTest) TestCreateDeleteLoad() {
 	require.NotNil(s.T(), foundState)
 	require.True(s.T(), state2.Equal(*foundState))
 }
+
+func (s *stateBlackBoxTest) TestCreateLoadWithCodeChallenge() {
+	// given
+	identityID := uuid.NewV4()
+	state := &auth.OauthStateReference{
+		ID:                  uuid.NewV4(),
+		Referrer:            "domain.org",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+		IdentityID:          &identityID,
+		SessionState:        "some-session-state",
+	}
+	_, err := s.repo.Create(s.Ctx, state)
+	require.Nil(s.T(), err)
+	// when
+	foundState, err := s.repo.Load(s.Ctx, state.ID)
+	// then
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), foundState.IdentityID)
+	assert.Equal(s.T(), identityID, *foundState.IdentityID)
+	assert.True(s.T(), state.Equal(*foundState))
+	foundState.IdentityID = nil
+	assert.False(s.T(), state.Equal(*foundState))
+}
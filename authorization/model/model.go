@@ -0,0 +1,230 @@
+// Package model reconciles the authorization model declared in the configuration, i.e. the resource types
+// with their scopes and roles, into the database.
+package model
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+)
+
+// reconcileLockID is the ID of the advisory lock held while the model is reconciled
+// so that the instances of the service started concurrently don't create the same records twice
+const reconcileLockID = 43
+
+// ModelConfiguration represents the configuration of the authorization model
+type ModelConfiguration interface {
+	GetAuthorizationResourceTypes() []configuration.ResourceTypeConfig
+}
+
+// Reconcile creates the declared resource types, scopes and roles which don't exist yet in the database,
+// updates their descriptions and the scopes granted by the declared roles.
+// Resource types, scopes and roles which are no longer declared are kept in the database as they may still be
+// referenced by resources or role assignments; a warning is logged for each of them.
+func Reconcile(ctx context.Context, db *gorm.DB, config ModelConfiguration) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return errs.WithStack(tx.Error)
+	}
+	err := tx.Exec("SELECT pg_advisory_xact_lock(?)", reconcileLockID).Error
+	if err == nil {
+		err = reconcile(ctx, tx, config.GetAuthorizationResourceTypes())
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "unable to reconcile the authorization model")
+		return errs.WithStack(err)
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"resource_types": len(config.GetAuthorizationResourceTypes()),
+	}, "authorization model reconciled")
+	return nil
+}
+
+func reconcile(ctx context.Context, tx *gorm.DB, resourceTypes []configuration.ResourceTypeConfig) error {
+	resourceTypeRepo := resource.NewResourceTypeRepository(tx)
+	declared := map[string]bool{}
+	for _, resourceTypeConfig := range resourceTypes {
+		declared[resourceTypeConfig.Name] = true
+		err := reconcileResourceType(ctx, tx, resourceTypeConfig)
+		if err != nil {
+			return err
+		}
+	}
+	existing, err := resourceTypeRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, resourceType := range existing {
+		if !declared[resourceType.Name] {
+			log.Warn(ctx, map[string]interface{}{
+				"resource_type": resourceType.Name,
+			}, "the resource type is not declared in the authorization model")
+		}
+	}
+	return nil
+}
+
+func reconcileResourceType(ctx context.Context, tx *gorm.DB, resourceTypeConfig configuration.ResourceTypeConfig) error {
+	resourceTypeRepo := resource.NewResourceTypeRepository(tx)
+	resourceType, err := resourceTypeRepo.Lookup(ctx, resourceTypeConfig.Name)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); !notFound {
+			return err
+		}
+		resourceType = &resource.ResourceType{
+			Name:        resourceTypeConfig.Name,
+			Description: resourceTypeConfig.Description,
+		}
+		err = resourceTypeRepo.Create(ctx, resourceType)
+		if err != nil {
+			return err
+		}
+	} else if resourceType.Description != resourceTypeConfig.Description {
+		resourceType.Description = resourceTypeConfig.Description
+		err = resourceTypeRepo.Save(ctx, resourceType)
+		if err != nil {
+			return err
+		}
+	}
+
+	scopes, err := reconcileScopes(ctx, tx, resourceType, resourceTypeConfig.Scopes)
+	if err != nil {
+		return err
+	}
+	return reconcileRoles(ctx, tx, resourceType, resourceTypeConfig.Roles, scopes)
+}
+
+// reconcileScopes returns the declared scopes of the resource type by name
+func reconcileScopes(ctx context.Context, tx *gorm.DB, resourceType *resource.ResourceType, scopeConfigs []configuration.ScopeConfig) (map[string]*resource.ResourceTypeScope, error) {
+	scopeRepo := resource.NewResourceTypeScopeRepository(tx)
+	existing, err := scopeRepo.List(ctx, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	existingByName := map[string]*resource.ResourceTypeScope{}
+	for i := range existing {
+		existingByName[existing[i].Name] = &existing[i]
+	}
+
+	scopes := map[string]*resource.ResourceTypeScope{}
+	for _, scopeConfig := range scopeConfigs {
+		scope, found := existingByName[scopeConfig.Name]
+		if !found {
+			scope = &resource.ResourceTypeScope{
+				ResourceTypeID: resourceType.ResourceTypeID,
+				Name:           scopeConfig.Name,
+				Description:    scopeConfig.Description,
+			}
+			err = scopeRepo.Create(ctx, scope)
+			if err != nil {
+				return nil, err
+			}
+		} else if scope.Description != scopeConfig.Description {
+			scope.Description = scopeConfig.Description
+			err = scopeRepo.Save(ctx, scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+		scopes[scopeConfig.Name] = scope
+	}
+	for name := range existingByName {
+		if _, declared := scopes[name]; !declared {
+			log.Warn(ctx, map[string]interface{}{
+				"resource_type": resourceType.Name,
+				"scope":         name,
+			}, "the scope is not declared in the authorization model")
+		}
+	}
+	return scopes, nil
+}
+
+func reconcileRoles(ctx context.Context, tx *gorm.DB, resourceType *resource.ResourceType, roleConfigs []configuration.RoleConfig, scopes map[string]*resource.ResourceTypeScope) error {
+	roleRepo := role.NewRoleRepository(tx)
+	declared := map[string]bool{}
+	for _, roleConfig := range roleConfigs {
+		declared[roleConfig.Name] = true
+		r, err := roleRepo.Lookup(ctx, roleConfig.Name, resourceType.ResourceTypeID)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); !notFound {
+				return err
+			}
+			r = &role.Role{
+				ResourceTypeID: resourceType.ResourceTypeID,
+				Name:           roleConfig.Name,
+			}
+			err = roleRepo.Create(ctx, r)
+			if err != nil {
+				return err
+			}
+		}
+		err = reconcileRoleScopes(ctx, roleRepo, r, roleConfig.Scopes, scopes)
+		if err != nil {
+			return err
+		}
+	}
+	existing, err := roleRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if r.ResourceTypeID == resourceType.ResourceTypeID && !declared[r.Name] {
+			log.Warn(ctx, map[string]interface{}{
+				"resource_type": resourceType.Name,
+				"role":          r.Name,
+			}, "the role is not declared in the authorization model")
+		}
+	}
+	return nil
+}
+
+// reconcileRoleScopes adds the declared scopes which are not granted by the role yet
+// and removes the scopes the role should no longer grant
+func reconcileRoleScopes(ctx context.Context, roleRepo role.RoleRepository, r *role.Role, scopeNames []string, scopes map[string]*resource.ResourceTypeScope) error {
+	granted, err := roleRepo.ListScopes(ctx, r)
+	if err != nil {
+		return err
+	}
+	grantedByName := map[string]bool{}
+	for i := range granted {
+		grantedByName[granted[i].Name] = true
+		if !contains(scopeNames, granted[i].Name) {
+			err = roleRepo.RemoveScope(ctx, r, &granted[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range scopeNames {
+		if !grantedByName[name] {
+			err = roleRepo.AddScope(ctx, r, scopes[name])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
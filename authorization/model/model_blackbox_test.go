@@ -0,0 +1,145 @@
+package model_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/authorization/model"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type modelConfig struct {
+	resourceTypes []configuration.ResourceTypeConfig
+}
+
+func (c *modelConfig) GetAuthorizationResourceTypes() []configuration.ResourceTypeConfig {
+	return c.resourceTypes
+}
+
+type modelBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	resourceTypeName string
+	config           *modelConfig
+}
+
+func TestRunModelBlackBoxTest(t *testing.T) {
+	suite.Run(t, &modelBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *modelBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.resourceTypeName = "model_blackbox_test_Area" + uuid.NewV4().String()
+	s.config = &modelConfig{
+		resourceTypes: []configuration.ResourceTypeConfig{
+			{
+				Name:        s.resourceTypeName,
+				Description: "An area is a logical grouping within a space",
+				Scopes: []configuration.ScopeConfig{
+					{Name: "view", Description: "View the area"},
+					{Name: "contribute", Description: "Contribute to the area"},
+				},
+				Roles: []configuration.RoleConfig{
+					{Name: "viewer", Scopes: []string{"view"}},
+					{Name: "contributor", Scopes: []string{"view", "contribute"}},
+				},
+			},
+		},
+	}
+}
+
+func (s *modelBlackBoxTest) TestReconcileCreatesModel() {
+	// when
+	err := model.Reconcile(s.Ctx, s.DB, s.config)
+	// then
+	require.Nil(s.T(), err)
+	resourceType, err := resource.NewResourceTypeRepository(s.DB).Lookup(s.Ctx, s.resourceTypeName)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "An area is a logical grouping within a space", resourceType.Description)
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.scopeNames(resourceType))
+	assert.Equal(s.T(), []string{"view"}, s.roleScopeNames(resourceType, "viewer"))
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.roleScopeNames(resourceType, "contributor"))
+}
+
+func (s *modelBlackBoxTest) TestReconcileTwice() {
+	// given
+	err := model.Reconcile(s.Ctx, s.DB, s.config)
+	require.Nil(s.T(), err)
+	// when
+	err = model.Reconcile(s.Ctx, s.DB, s.config)
+	// then
+	require.Nil(s.T(), err)
+	resourceType, err := resource.NewResourceTypeRepository(s.DB).Lookup(s.Ctx, s.resourceTypeName)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.scopeNames(resourceType))
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.roleScopeNames(resourceType, "contributor"))
+}
+
+func (s *modelBlackBoxTest) TestReconcileUpdatesModel() {
+	// given
+	err := model.Reconcile(s.Ctx, s.DB, s.config)
+	require.Nil(s.T(), err)
+	resourceTypeConfig := &s.config.resourceTypes[0]
+	resourceTypeConfig.Description = "An area of a space"
+	resourceTypeConfig.Scopes[1].Description = "Contribute to the content of the area"
+	resourceTypeConfig.Roles[0].Scopes = []string{"view", "contribute"}
+	resourceTypeConfig.Roles[1].Scopes = []string{"contribute"}
+	// when
+	err = model.Reconcile(s.Ctx, s.DB, s.config)
+	// then
+	require.Nil(s.T(), err)
+	resourceType, err := resource.NewResourceTypeRepository(s.DB).Lookup(s.Ctx, s.resourceTypeName)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "An area of a space", resourceType.Description)
+	scopes, err := resource.NewResourceTypeScopeRepository(s.DB).List(s.Ctx, resourceType)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), scopes, 2)
+	assert.Equal(s.T(), "Contribute to the content of the area", scopes[0].Description)
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.roleScopeNames(resourceType, "viewer"))
+	assert.Equal(s.T(), []string{"contribute"}, s.roleScopeNames(resourceType, "contributor"))
+}
+
+func (s *modelBlackBoxTest) TestReconcileKeepsUndeclaredRoles() {
+	// given
+	err := model.Reconcile(s.Ctx, s.DB, s.config)
+	require.Nil(s.T(), err)
+	s.config.resourceTypes[0].Roles = s.config.resourceTypes[0].Roles[:1]
+	// when
+	err = model.Reconcile(s.Ctx, s.DB, s.config)
+	// then
+	require.Nil(s.T(), err)
+	resourceType, err := resource.NewResourceTypeRepository(s.DB).Lookup(s.Ctx, s.resourceTypeName)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"contribute", "view"}, s.roleScopeNames(resourceType, "contributor"))
+}
+
+func (s *modelBlackBoxTest) scopeNames(resourceType *resource.ResourceType) []string {
+	scopes, err := resource.NewResourceTypeScopeRepository(s.DB).List(s.Ctx, resourceType)
+	require.Nil(s.T(), err)
+	var names []string
+	for _, scope := range scopes {
+		names = append(names, scope.Name)
+	}
+	return names
+}
+
+func (s *modelBlackBoxTest) roleScopeNames(resourceType *resource.ResourceType, roleName string) []string {
+	roleRepo := role.NewRoleRepository(s.DB)
+	r, err := roleRepo.Lookup(s.Ctx, roleName, resourceType.ResourceTypeID)
+	require.Nil(s.T(), err)
+	scopes, err := roleRepo.ListScopes(s.Ctx, r)
+	require.Nil(s.T(), err)
+	var names []string
+	for _, scope := range scopes {
+		names = append(names, scope.Name)
+	}
+	sort.Strings(names)
+	return names
+}
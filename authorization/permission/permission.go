@@ -0,0 +1,109 @@
+// Package permission evaluates the permissions of identities on resources
+// using the roles assigned in the authorization tables.
+package permission
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/satori/go.uuid"
+)
+
+// PermissionService answers permission questions about identities and resources
+type PermissionService interface {
+	HasScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) (bool, error)
+	ListScopes(ctx context.Context, identityID uuid.UUID, resourceID string) ([]string, error)
+}
+
+// LocalPermissionService implements PermissionService by evaluating the roles
+// stored in the database without any call to Keycloak
+type LocalPermissionService struct {
+	db application.DB
+}
+
+// NewPermissionService creates a new permission service
+func NewPermissionService(db application.DB) *LocalPermissionService {
+	return &LocalPermissionService{db: db}
+}
+
+// HasScope returns true if the identity has the given scope on the resource,
+// either through a role assigned for the resource itself or through a role assigned for one of its parents
+func (s *LocalPermissionService) HasScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) (bool, error) {
+	scopes, err := s.ListScopes(ctx, identityID, resourceID)
+	if err != nil {
+		return false, err
+	}
+	for _, scope := range scopes {
+		if scope == scopeName {
+			return true, nil
+		}
+	}
+	log.Debug(ctx, map[string]interface{}{
+		"identity_id": identityID,
+		"resource_id": resourceID,
+		"scope":       scopeName,
+	}, "scope not granted")
+	return false, nil
+}
+
+// ListScopes returns the names of all the scopes the identity has on the resource.
+// The roles assigned for the resource and all its parents are taken into account.
+func (s *LocalPermissionService) ListScopes(ctx context.Context, identityID uuid.UUID, resourceID string) ([]string, error) {
+	var scopes []string
+	err := application.Transactional(s.db, func(appl application.Application) error {
+		res, err := appl.ResourceRepository().Load(ctx, resourceID)
+		if err != nil {
+			return err
+		}
+		found := map[string]bool{}
+		visited := map[string]bool{}
+		for res != nil {
+			if visited[res.ResourceID] {
+				log.Error(ctx, map[string]interface{}{
+					"resource_id": res.ResourceID,
+				}, "cycle detected in the resource hierarchy")
+				return errors.NewInternalErrorFromString(ctx, "cycle detected in the resource hierarchy")
+			}
+			visited[res.ResourceID] = true
+
+			identityRoles, err := appl.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(ctx, identityID, res.ResourceID)
+			if err != nil {
+				return errors.NewInternalError(ctx, err)
+			}
+			for _, identityRole := range identityRoles {
+				roleScopes, err := appl.RoleRepository().ListScopes(ctx, &identityRole.Role)
+				if err != nil {
+					return errors.NewInternalError(ctx, err)
+				}
+				for _, scope := range roleScopes {
+					if !found[scope.Name] {
+						found[scope.Name] = true
+						scopes = append(scopes, scope.Name)
+					}
+				}
+			}
+
+			res, err = loadParent(ctx, appl, res)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scopes, nil
+}
+
+// loadParent returns the parent of the given resource or nil if the resource has no parent
+func loadParent(ctx context.Context, appl application.Application, res *resource.Resource) (*resource.Resource, error) {
+	if res.ParentResourceID == nil {
+		return nil, nil
+	}
+	return appl.ResourceRepository().Load(ctx, *res.ParentResourceID)
+}
@@ -0,0 +1,159 @@
+package permission_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/authorization/permission"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type permissionBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	service      permission.PermissionService
+	identity     *account.Identity
+	resourceType *resource.ResourceType
+	viewScope    *resource.ResourceTypeScope
+	editScope    *resource.ResourceTypeScope
+	viewerRole   *role.Role
+	editorRole   *role.Role
+}
+
+func TestRunPermissionBlackBoxTest(t *testing.T) {
+	suite.Run(t, &permissionBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *permissionBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.service = permission.NewPermissionService(s.Application)
+
+	s.identity = &account.Identity{
+		ID:           uuid.NewV4(),
+		Username:     "permission_blackbox_test_" + uuid.NewV4().String(),
+		ProviderType: account.KeycloakIDP}
+	err := s.Application.Identities().Create(s.Ctx, s.identity)
+	require.Nil(s.T(), err, "Could not create identity")
+
+	s.resourceType = &resource.ResourceType{
+		Name: "permission_blackbox_test_Area" + uuid.NewV4().String(),
+	}
+	err = s.Application.ResourceTypeRepository().Create(s.Ctx, s.resourceType)
+	require.Nil(s.T(), err, "Could not create resource type")
+
+	s.viewScope = s.createScope("view")
+	s.editScope = s.createScope("edit")
+	s.viewerRole = s.createRole("viewer", s.viewScope)
+	s.editorRole = s.createRole("editor", s.viewScope, s.editScope)
+}
+
+func (s *permissionBlackBoxTest) createScope(name string) *resource.ResourceTypeScope {
+	scope := &resource.ResourceTypeScope{
+		ResourceTypeID: s.resourceType.ResourceTypeID,
+		Name:           name,
+	}
+	err := s.Application.ResourceTypeScopeRepository().Create(s.Ctx, scope)
+	require.Nil(s.T(), err, "Could not create resource type scope")
+	return scope
+}
+
+func (s *permissionBlackBoxTest) createRole(name string, scopes ...*resource.ResourceTypeScope) *role.Role {
+	r := &role.Role{
+		ResourceTypeID: s.resourceType.ResourceTypeID,
+		Name:           name,
+	}
+	err := s.Application.RoleRepository().Create(s.Ctx, r)
+	require.Nil(s.T(), err, "Could not create role")
+	for _, scope := range scopes {
+		err = s.Application.RoleRepository().AddScope(s.Ctx, r, scope)
+		require.Nil(s.T(), err, "Could not add scope to role")
+	}
+	return r
+}
+
+func (s *permissionBlackBoxTest) createResource(parent *resource.Resource) *resource.Resource {
+	res := &resource.Resource{
+		ResourceID:     uuid.NewV4().String(),
+		OwnerID:        s.identity.ID,
+		ResourceTypeID: s.resourceType.ResourceTypeID,
+	}
+	if parent != nil {
+		res.ParentResourceID = &parent.ResourceID
+	}
+	err := s.Application.ResourceRepository().Create(s.Ctx, res)
+	require.Nil(s.T(), err, "Could not create resource")
+	return res
+}
+
+func (s *permissionBlackBoxTest) assignRole(res *resource.Resource, r *role.Role) {
+	identityRole := &role.IdentityRole{
+		IdentityID: s.identity.ID,
+		ResourceID: res.ResourceID,
+		RoleID:     r.RoleID,
+	}
+	err := s.Application.IdentityRoleRepository().Create(s.Ctx, identityRole)
+	require.Nil(s.T(), err, "Could not assign role")
+}
+
+func (s *permissionBlackBoxTest) TestHasScopeFromDirectRole() {
+	res := s.createResource(nil)
+	s.assignRole(res, s.viewerRole)
+
+	hasView, err := s.service.HasScope(s.Ctx, s.identity.ID, res.ResourceID, "view")
+	require.Nil(s.T(), err)
+	assert.True(s.T(), hasView)
+
+	hasEdit, err := s.service.HasScope(s.Ctx, s.identity.ID, res.ResourceID, "edit")
+	require.Nil(s.T(), err)
+	assert.False(s.T(), hasEdit)
+}
+
+func (s *permissionBlackBoxTest) TestHasScopeInheritedFromParent() {
+	root := s.createResource(nil)
+	parent := s.createResource(root)
+	child := s.createResource(parent)
+	s.assignRole(root, s.editorRole)
+
+	hasEdit, err := s.service.HasScope(s.Ctx, s.identity.ID, child.ResourceID, "edit")
+	require.Nil(s.T(), err)
+	assert.True(s.T(), hasEdit)
+
+	scopes, err := s.service.ListScopes(s.Ctx, s.identity.ID, child.ResourceID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), scopes, 2)
+	assert.Contains(s.T(), scopes, "view")
+	assert.Contains(s.T(), scopes, "edit")
+}
+
+func (s *permissionBlackBoxTest) TestRoleNotInheritedFromChild() {
+	parent := s.createResource(nil)
+	child := s.createResource(parent)
+	s.assignRole(child, s.viewerRole)
+
+	hasView, err := s.service.HasScope(s.Ctx, s.identity.ID, parent.ResourceID, "view")
+	require.Nil(s.T(), err)
+	assert.False(s.T(), hasView)
+}
+
+func (s *permissionBlackBoxTest) TestNoScopeForOtherIdentity() {
+	res := s.createResource(nil)
+	s.assignRole(res, s.editorRole)
+
+	scopes, err := s.service.ListScopes(s.Ctx, uuid.NewV4(), res.ResourceID)
+	require.Nil(s.T(), err)
+	assert.Empty(s.T(), scopes)
+}
+
+func (s *permissionBlackBoxTest) TestUnknownResource() {
+	_, err := s.service.HasScope(s.Ctx, s.identity.ID, uuid.NewV4().String(), "view")
+	require.NotNil(s.T(), err)
+	notFound, _ := errors.IsNotFoundError(err)
+	assert.True(s.T(), notFound)
+}
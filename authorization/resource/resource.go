@@ -12,6 +12,7 @@ import (
 
 	"fmt"
 	"github.com/fabric8-services/fabric8-auth/application/repository"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	"github.com/goadesign/goa"
 	errs "github.com/pkg/errors"
 	"github.com/satori/go.uuid"
@@ -23,13 +24,15 @@ type Resource struct {
 	// This is the primary key value
 	ResourceID string `sql:"type:string" gorm:"primary_key" gorm:"column:resource_id"`
 	// The parent resource
-	ParentResource *Resource
+	ParentResource *Resource `gorm:"ForeignKey:ParentResourceID;AssociationForeignKey:ResourceID"`
+	// The identifier for the parent resource
+	ParentResourceID *string
 	// The owning identity
-	Owner account.Identity
+	Owner account.Identity `gorm:"ForeignKey:OwnerID"`
 	// The identifier for the owning identity
 	OwnerID uuid.UUID
 	// The resource type
-	ResourceType ResourceType
+	ResourceType ResourceType `gorm:"ForeignKey:ResourceTypeID;AssociationForeignKey:ResourceTypeID"`
 	// The identifier for the resource type
 	ResourceTypeID uuid.UUID
 	// Resource description
@@ -62,9 +65,11 @@ func NewResourceRepository(db *gorm.DB) ResourceRepository {
 type ResourceRepository interface {
 	repository.Exister
 	Load(ctx context.Context, id string) (*Resource, error)
+	LoadChildren(ctx context.Context, id string) ([]Resource, error)
 	Create(ctx context.Context, resource *Resource) error
 	Save(ctx context.Context, resource *Resource) error
 	Delete(ctx context.Context, id string) error
+	ExistsForOwner(ctx context.Context, ownerID uuid.UUID) (bool, error)
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -78,9 +83,10 @@ func (m *GormResourceRepository) TableName() string {
 // Load returns a single Resource as a Database Model
 func (m *GormResourceRepository) Load(ctx context.Context, id string) (*Resource, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "load").Finish()
 
 	var native Resource
-	err := m.db.Table(m.TableName()).Where("resource_id = ?", id).Find(&native).Error
+	err := m.db.Table(m.TableName()).Preload("ResourceType").Preload("Owner").Where("resource_id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
 		return nil, errs.WithStack(errors.NewNotFoundError("resource", id))
 	}
@@ -88,9 +94,44 @@ func (m *GormResourceRepository) Load(ctx context.Context, id string) (*Resource
 	return &native, errs.WithStack(err)
 }
 
+// LoadChildren returns the resources which have the given resource as their direct parent
+func (m *GormResourceRepository) LoadChildren(ctx context.Context, id string) ([]Resource, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "resource", "loadChildren"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "loadChildren").Finish()
+
+	var rows []Resource
+	err := m.db.Table(m.TableName()).Where("parent_resource_id = ?", id).Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// ExistsForOwner returns true if the identity owns at least one resource,
+// including the resources which are marked as deleted
+func (m *GormResourceRepository) ExistsForOwner(ctx context.Context, ownerID uuid.UUID) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "resource", "existsForOwner"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "existsForOwner").Finish()
+
+	var exists bool
+	query := fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT 1 FROM %[1]s
+			WHERE
+				owner_id=$1
+		)`, m.TableName())
+
+	err := m.db.CommonDB().QueryRow(query, ownerID).Scan(&exists)
+	if err != nil {
+		return false, errs.Wrapf(err, "unable to verify if the identity owns resources")
+	}
+	return exists, nil
+}
+
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormResourceRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "exists").Finish()
 
 	var exists bool
 	query := fmt.Sprintf(`
@@ -114,6 +155,7 @@ func (m *GormResourceRepository) CheckExists(ctx context.Context, id string) err
 // Create creates a new record.
 func (m *GormResourceRepository) Create(ctx context.Context, resource *Resource) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "create").Finish()
 
 	// If no identifier has been specified for the new resource, then generate one
 	if resource.ResourceID == "" {
@@ -149,6 +191,7 @@ func (m *GormResourceRepository) Create(ctx context.Context, resource *Resource)
 // Save modifies a single record.
 func (m *GormResourceRepository) Save(ctx context.Context, resource *Resource) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "save").Finish()
 
 	obj, err := m.Load(ctx, resource.ResourceID)
 	if err != nil {
@@ -158,7 +201,8 @@ func (m *GormResourceRepository) Save(ctx context.Context, resource *Resource) e
 		}, "unable to update the resource")
 		return errs.WithStack(err)
 	}
-	err = m.db.Model(obj).Save(resource).Error
+	// the owner, the resource type and the parent resource are only referenced by their IDs and must not be updated
+	err = m.db.Model(obj).Omit("Owner", "ResourceType", "ParentResource").Save(resource).Error
 
 	log.Debug(ctx, map[string]interface{}{
 		"resource_id": resource.ResourceID,
@@ -170,6 +214,7 @@ func (m *GormResourceRepository) Save(ctx context.Context, resource *Resource) e
 // Delete removes a single record.
 func (m *GormResourceRepository) Delete(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource", "delete").Finish()
 
 	obj := Resource{ResourceID: id}
 	db := m.db.Delete(obj)
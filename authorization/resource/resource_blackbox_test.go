@@ -86,6 +86,47 @@ func (s *resourceBlackBoxTest) TestOKToSave() {
 	assert.Equal(s.T(), updatedResource.Description, "foo")
 }
 
+func (s *resourceBlackBoxTest) TestSaveDoesNotUpdateAssociations() {
+	parent := createAndLoadResource(s)
+	res := createAndLoadResource(s)
+	res.ParentResource = parent
+	res.ParentResourceID = &parent.ResourceID
+	ownerUsername := res.Owner.Username
+	res.Owner.Username = "resource_blackbox_test_modified"
+	parent.Description = "modified parent"
+
+	err := s.repo.Save(s.Ctx, res)
+	require.Nil(s.T(), err, "Could not update resource")
+
+	owner, err := s.identityRepo.Load(s.Ctx, res.OwnerID)
+	require.Nil(s.T(), err, "Could not load owner")
+	assert.Equal(s.T(), ownerUsername, owner.Username)
+	loadedParent, err := s.repo.Load(s.Ctx, parent.ResourceID)
+	require.Nil(s.T(), err, "Could not load parent resource")
+	assert.NotEqual(s.T(), "modified parent", loadedParent.Description)
+	updatedResource, err := s.repo.Load(s.Ctx, res.ResourceID)
+	require.Nil(s.T(), err, "Could not load resource")
+	require.NotNil(s.T(), updatedResource.ParentResourceID)
+	assert.Equal(s.T(), parent.ResourceID, *updatedResource.ParentResourceID)
+}
+
+func (s *resourceBlackBoxTest) TestLoadChildren() {
+	parent := createAndLoadResource(s)
+	child := createAndLoadResource(s)
+	child.ParentResourceID = &parent.ResourceID
+	err := s.repo.Save(s.Ctx, child)
+	require.Nil(s.T(), err, "Could not update resource")
+
+	children, err := s.repo.LoadChildren(s.Ctx, parent.ResourceID)
+	require.Nil(s.T(), err, "Could not load child resources")
+	require.Len(s.T(), children, 1)
+	assert.Equal(s.T(), child.ResourceID, children[0].ResourceID)
+
+	children, err = s.repo.LoadChildren(s.Ctx, child.ResourceID)
+	require.Nil(s.T(), err, "Could not load child resources")
+	assert.Empty(s.T(), children)
+}
+
 func createAndLoadResource(s *resourceBlackBoxTest) *resource.Resource {
 	identity := &account.Identity{
 		ID:           uuid.NewV4(),
@@ -7,6 +7,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
@@ -51,6 +52,7 @@ func NewResourceTypeRepository(db *gorm.DB) ResourceTypeRepository {
 type ResourceTypeRepository interface {
 	CheckExists(ctx context.Context, id string) (bool, error)
 	Load(ctx context.Context, ID uuid.UUID) (*ResourceType, error)
+	Lookup(ctx context.Context, name string) (*ResourceType, error)
 	LookupOrCreate(ctx context.Context, name string) (*ResourceType, error)
 	Create(ctx context.Context, u *ResourceType) error
 	Save(ctx context.Context, u *ResourceType) error
@@ -70,6 +72,7 @@ func (m *GormResourceTypeRepository) TableName() string {
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormResourceTypeRepository) Load(ctx context.Context, id uuid.UUID) (*ResourceType, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "load").Finish()
 	var native ResourceType
 	err := m.db.Table(m.TableName()).Where("resource_type_id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
@@ -78,10 +81,23 @@ func (m *GormResourceTypeRepository) Load(ctx context.Context, id uuid.UUID) (*R
 	return &native, errs.WithStack(err)
 }
 
+// Lookup returns the ResourceType with the specified name
+func (m *GormResourceTypeRepository) Lookup(ctx context.Context, name string) (*ResourceType, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "lookup"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "lookup").Finish()
+	var native ResourceType
+	err := m.db.Table(m.TableName()).Where("name = ?", name).First(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("resource_type", name)
+	}
+	return &native, errs.WithStack(err)
+}
+
 // LookupOrCreate looks up the ResourceType record with the specified name.  If there is no such record, then
 // a new ResourceType will be created with the specified name and returned.
 func (m *GormResourceTypeRepository) LookupOrCreate(ctx context.Context, name string) (*ResourceType, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "lookupOrCreate"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "lookupOrCreate").Finish()
 
 	var native ResourceType
 	err := m.db.Table(m.TableName()).Where("name = ?", name).First(&native).Error
@@ -114,6 +130,7 @@ func (m *GormResourceTypeRepository) LookupOrCreate(ctx context.Context, name st
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormResourceTypeRepository) CheckExists(ctx context.Context, id string) (bool, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "exists").Finish()
 
 	//return repository.CheckExists(ctx, m.db, m.TableName(), id)
 
@@ -139,6 +156,7 @@ func (m *GormResourceTypeRepository) CheckExists(ctx context.Context, id string)
 // Create creates a new record.
 func (m *GormResourceTypeRepository) Create(ctx context.Context, u *ResourceType) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "create").Finish()
 	if u.ResourceTypeID == uuid.Nil {
 		u.ResourceTypeID = uuid.NewV4()
 	}
@@ -159,6 +177,7 @@ func (m *GormResourceTypeRepository) Create(ctx context.Context, u *ResourceType
 // Save modifies a single record
 func (m *GormResourceTypeRepository) Save(ctx context.Context, model *ResourceType) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "save").Finish()
 
 	obj, err := m.Load(ctx, model.ResourceTypeID)
 	if err != nil {
@@ -182,6 +201,7 @@ func (m *GormResourceTypeRepository) Save(ctx context.Context, model *ResourceTy
 // Delete removes a single record.
 func (m *GormResourceTypeRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "delete").Finish()
 
 	obj := ResourceType{ResourceTypeID: id}
 
@@ -205,6 +225,7 @@ func (m *GormResourceTypeRepository) Delete(ctx context.Context, id uuid.UUID) e
 // List return all resource types
 func (m *GormResourceTypeRepository) List(ctx context.Context) ([]ResourceType, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "resource_type", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "resource_type", "list").Finish()
 	var rows []ResourceType
 
 	err := m.db.Model(&ResourceType{}).Order("name").Find(&rows).Error
@@ -85,6 +85,17 @@ func (s *resourceTypeBlackBoxTest) TestOKToSave() {
 	assert.Equal(s.T(), resourceType.Description, "An area is a logical grouping within a space")
 }
 
+func (s *resourceTypeBlackBoxTest) TestLookup() {
+	resourceType := createAndLoadResourceType(s)
+
+	found, err := s.repo.Lookup(s.Ctx, resourceType.Name)
+	require.Nil(s.T(), err, "Could not lookup resource type")
+	assert.Equal(s.T(), resourceType.ResourceTypeID, found.ResourceTypeID)
+
+	_, err = s.repo.Lookup(s.Ctx, "resource_type_blackbox_test_Unknown"+uuid.NewV4().String())
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
 func createAndLoadResourceType(s *resourceTypeBlackBoxTest) *resource.ResourceType {
 	resourceType := &resource.ResourceType{
 		ResourceTypeID: uuid.NewV4(),
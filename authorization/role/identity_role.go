@@ -10,6 +10,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
@@ -24,11 +25,17 @@ type IdentityRole struct {
 	// This is the primary key value
 	IdentityRoleID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key" gorm:"column:identity_role_id"`
 	// The identity to which the role is assigned
-	Identity account.Identity
+	Identity account.Identity `gorm:"ForeignKey:IdentityID"`
+	// The identifier for the identity
+	IdentityID uuid.UUID
 	// The resource to which the role is applied
-	Resource resource.Resource
+	Resource resource.Resource `gorm:"ForeignKey:ResourceID;AssociationForeignKey:ResourceID"`
+	// The identifier for the resource
+	ResourceID string
 	// The role that is assigned
-	Role Role
+	Role Role `gorm:"ForeignKey:RoleID;AssociationForeignKey:RoleID"`
+	// The identifier for the role
+	RoleID uuid.UUID
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -59,7 +66,12 @@ type IdentityRoleRepository interface {
 	Create(ctx context.Context, u *IdentityRole) error
 	Save(ctx context.Context, u *IdentityRole) error
 	List(ctx context.Context) ([]IdentityRole, error)
+	FindIdentityRolesByIdentityAndResource(ctx context.Context, identityID uuid.UUID, resourceID string) ([]IdentityRole, error)
+	FindIdentityRolesByResource(ctx context.Context, resourceID string) ([]IdentityRole, error)
+	FindIdentityRolesByIdentity(ctx context.Context, identityID uuid.UUID) ([]IdentityRole, error)
 	Delete(ctx context.Context, ID uuid.UUID) error
+	DeleteForResource(ctx context.Context, resourceID string) error
+	HardDeleteForIdentity(ctx context.Context, identityID uuid.UUID) (int64, error)
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -74,6 +86,7 @@ func (m *GormIdentityRoleRepository) TableName() string {
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormIdentityRoleRepository) Load(ctx context.Context, id uuid.UUID) (*IdentityRole, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "load").Finish()
 	var native IdentityRole
 	err := m.db.Table(m.TableName()).Where("identity_role_id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
@@ -85,12 +98,14 @@ func (m *GormIdentityRoleRepository) Load(ctx context.Context, id uuid.UUID) (*I
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormIdentityRoleRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "exists").Finish()
 	return repository.CheckExists(ctx, m.db, m.TableName(), id)
 }
 
 // Create creates a new record.
 func (m *GormIdentityRoleRepository) Create(ctx context.Context, u *IdentityRole) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "create").Finish()
 	if u.IdentityRoleID == uuid.Nil {
 		u.IdentityRoleID = uuid.NewV4()
 	}
@@ -111,6 +126,7 @@ func (m *GormIdentityRoleRepository) Create(ctx context.Context, u *IdentityRole
 // Save modifies a single record
 func (m *GormIdentityRoleRepository) Save(ctx context.Context, model *IdentityRole) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "save").Finish()
 
 	obj, err := m.Load(ctx, model.IdentityRoleID)
 	if err != nil {
@@ -134,6 +150,7 @@ func (m *GormIdentityRoleRepository) Save(ctx context.Context, model *IdentityRo
 // Delete removes a single record.
 func (m *GormIdentityRoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "delete").Finish()
 
 	obj := IdentityRole{IdentityRoleID: id}
 
@@ -154,12 +171,84 @@ func (m *GormIdentityRoleRepository) Delete(ctx context.Context, id uuid.UUID) e
 	return nil
 }
 
+// DeleteForResource removes all the identity roles assigned for the given resource.
+func (m *GormIdentityRoleRepository) DeleteForResource(ctx context.Context, resourceID string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "deleteForResource"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "deleteForResource").Finish()
+
+	err := m.db.Where("resource_id = ?", resourceID).Delete(&IdentityRole{}).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": resourceID,
+			"err":         err,
+		}, "unable to delete the identity roles for the resource")
+		return errs.WithStack(err)
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"resource_id": resourceID,
+	}, "Identity roles for resource deleted!")
+
+	return nil
+}
+
+// HardDeleteForIdentity removes from the database all the identity roles assigned to the given identity,
+// including the ones which are marked as deleted, and returns the number of removed rows
+func (m *GormIdentityRoleRepository) HardDeleteForIdentity(ctx context.Context, identityID uuid.UUID) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "hardDeleteForIdentity"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "hardDeleteForIdentity").Finish()
+
+	db := m.db.Unscoped().Where("identity_id = ?", identityID).Delete(&IdentityRole{})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": identityID,
+			"err":         db.Error,
+		}, "unable to hard delete the identity roles of the identity")
+		return 0, errs.WithStack(db.Error)
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"identity_id": identityID,
+		"deleted":     db.RowsAffected,
+	}, "Identity roles of identity hard deleted!")
+
+	return db.RowsAffected, nil
+}
+
 // List returns all identity roles
 func (m *GormIdentityRoleRepository) List(ctx context.Context) ([]IdentityRole, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "list").Finish()
 	var rows []IdentityRole
 
-	err := m.db.Model(&resource.ResourceType{}).Find(&rows).Error
+	err := m.db.Model(&IdentityRole{}).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// FindIdentityRolesByIdentityAndResource returns the roles assigned to the given identity
+// directly for the given resource. Roles inherited from parent resources are not included.
+func (m *GormIdentityRoleRepository) FindIdentityRolesByIdentityAndResource(ctx context.Context, identityID uuid.UUID, resourceID string) ([]IdentityRole, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "findByIdentityAndResource"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "findByIdentityAndResource").Finish()
+	var rows []IdentityRole
+
+	err := m.db.Where("identity_id = ? AND resource_id = ?", identityID, resourceID).Preload("Role").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// FindIdentityRolesByIdentity returns all the roles assigned to the given identity, with their resource and role
+func (m *GormIdentityRoleRepository) FindIdentityRolesByIdentity(ctx context.Context, identityID uuid.UUID) ([]IdentityRole, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "findByIdentity"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "findByIdentity").Finish()
+	var rows []IdentityRole
+
+	err := m.db.Where("identity_id = ?", identityID).Preload("Role").Preload("Resource.ResourceType").Order("created_at").Find(&rows).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, errs.WithStack(err)
 	}
@@ -172,3 +261,16 @@ func IdentityRoleFilterByID(identityRoleID uuid.UUID) func(db *gorm.DB) *gorm.DB
 		return db.Where("identity_role_id = ?", identityRoleID)
 	}
 }
+
+// FindIdentityRolesByResource returns all the roles assigned directly for the given resource
+func (m *GormIdentityRoleRepository) FindIdentityRolesByResource(ctx context.Context, resourceID string) ([]IdentityRole, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "findByResource"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "identity_role", "findByResource").Finish()
+	var rows []IdentityRole
+
+	err := m.db.Where("resource_id = ?", resourceID).Preload("Role").Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
 
@@ -75,6 +76,7 @@ func NewRoleRepository(db *gorm.DB) RoleRepository {
 type RoleRepository interface {
 	CheckExists(ctx context.Context, id string) (bool, error)
 	Load(ctx context.Context, ID uuid.UUID) (*Role, error)
+	Lookup(ctx context.Context, name string, resourceTypeID uuid.UUID) (*Role, error)
 	Create(ctx context.Context, u *Role) error
 	Save(ctx context.Context, u *Role) error
 	List(ctx context.Context) ([]Role, error)
@@ -82,6 +84,7 @@ type RoleRepository interface {
 
 	ListScopes(ctx context.Context, u *Role) ([]resource.ResourceTypeScope, error)
 	AddScope(ctx context.Context, u *Role, s *resource.ResourceTypeScope) error
+	RemoveScope(ctx context.Context, u *Role, s *resource.ResourceTypeScope) error
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -93,6 +96,7 @@ func (m *GormRoleRepository) TableName() string {
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormRoleRepository) CheckExists(ctx context.Context, id string) (bool, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "exists").Finish()
 
 	var exists bool
 	query := fmt.Sprintf(`
@@ -119,6 +123,7 @@ func (m *GormRoleRepository) CheckExists(ctx context.Context, id string) (bool,
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormRoleRepository) Load(ctx context.Context, id uuid.UUID) (*Role, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "load").Finish()
 	var native Role
 	err := m.db.Table(m.TableName()).Preload("ResourceType"). /*.Preload("Scopes")*/ Where("role_id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
@@ -127,9 +132,22 @@ func (m *GormRoleRepository) Load(ctx context.Context, id uuid.UUID) (*Role, err
 	return &native, errs.WithStack(err)
 }
 
+// Lookup returns the role with the given name defined for the given resource type
+func (m *GormRoleRepository) Lookup(ctx context.Context, name string, resourceTypeID uuid.UUID) (*Role, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "role", "lookup"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "lookup").Finish()
+	var native Role
+	err := m.db.Table(m.TableName()).Preload("ResourceType").Where("name = ? AND resource_type_id = ?", name, resourceTypeID).First(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("role", name)
+	}
+	return &native, errs.WithStack(err)
+}
+
 // Create creates a new record.
 func (m *GormRoleRepository) Create(ctx context.Context, u *Role) error {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "create").Finish()
 	if u.RoleID == uuid.Nil {
 		u.RoleID = uuid.NewV4()
 	}
@@ -150,6 +168,7 @@ func (m *GormRoleRepository) Create(ctx context.Context, u *Role) error {
 // Save modifies a single record
 func (m *GormRoleRepository) Save(ctx context.Context, model *Role) error {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "save").Finish()
 
 	obj, err := m.Load(ctx, model.RoleID)
 	if err != nil {
@@ -173,6 +192,7 @@ func (m *GormRoleRepository) Save(ctx context.Context, model *Role) error {
 // Delete removes a single record.
 func (m *GormRoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "delete").Finish()
 
 	obj := Role{RoleID: id}
 
@@ -196,6 +216,7 @@ func (m *GormRoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
 // List returns all roles
 func (m *GormRoleRepository) List(ctx context.Context) ([]Role, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "list"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "list").Finish()
 	var rows []Role
 
 	err := m.db.Model(&Role{}).Find(&rows).Error
@@ -207,6 +228,7 @@ func (m *GormRoleRepository) List(ctx context.Context) ([]Role, error) {
 
 func (m *GormRoleRepository) ListScopes(ctx context.Context, u *Role) ([]resource.ResourceTypeScope, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "listscopes"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "listscopes").Finish()
 
 	var scopes []RoleScope
 
@@ -225,6 +247,7 @@ func (m *GormRoleRepository) ListScopes(ctx context.Context, u *Role) ([]resourc
 
 func (m *GormRoleRepository) AddScope(ctx context.Context, u *Role, s *resource.ResourceTypeScope) error {
 	defer goa.MeasureSince([]string{"goa", "db", "role", "addscope"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "addscope").Finish()
 
 	roleScope := &RoleScope{
 		RoleID:  u.RoleID,
@@ -247,3 +270,25 @@ func (m *GormRoleRepository) AddScope(ctx context.Context, u *Role, s *resource.
 	}, "Role scope created!")
 	return nil
 }
+
+// RemoveScope removes the scope from the role.
+// The role scope is hard deleted so that the scope can be added to the role again.
+func (m *GormRoleRepository) RemoveScope(ctx context.Context, u *Role, s *resource.ResourceTypeScope) error {
+	defer goa.MeasureSince([]string{"goa", "db", "role", "removescope"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "role", "removescope").Finish()
+
+	err := m.db.Unscoped().Where("role_id = ? AND scope_id = ?", u.RoleID, s.ResourceTypeScopeID).Delete(&RoleScope{}).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"role_id":  u.RoleID,
+			"scope_id": s.ResourceTypeScopeID,
+			"err":      err,
+		}, "unable to delete the role scope")
+		return errs.WithStack(err)
+	}
+	log.Debug(ctx, map[string]interface{}{
+		"role_id":  u.RoleID,
+		"scope_id": s.ResourceTypeScopeID,
+	}, "Role scope deleted!")
+	return nil
+}
@@ -104,6 +104,29 @@ func (s *roleBlackBoxTest) TestScopes() {
 	require.NotNil(s.T(), roleScopes, "Could not load role scopes")
 
 	require.Equal(s.T(), len(roleScopes), 1, "Should be exactly one role scope")
+
+	err = s.repo.RemoveScope(s.Ctx, role, &resourceTypeScopes[0])
+	require.Nil(s.T(), err, "Role scope not removed")
+
+	roleScopes, err = s.repo.ListScopes(s.Ctx, role)
+	require.Nil(s.T(), err, "Could not load role scopes")
+	require.Empty(s.T(), roleScopes)
+
+	// The scope can be added again once removed
+	err = s.repo.AddScope(s.Ctx, role, &resourceTypeScopes[0])
+	require.Nil(s.T(), err, "Role scope not created again")
+}
+
+func (s *roleBlackBoxTest) TestLookup() {
+	r := createAndLoadRole(s)
+
+	found, err := s.repo.Lookup(s.Ctx, r.Name, r.ResourceTypeID)
+	require.Nil(s.T(), err, "Could not lookup role")
+	assert.Equal(s.T(), r.RoleID, found.RoleID)
+
+	// The role is not defined for other resource types
+	_, err = s.repo.Lookup(s.Ctx, r.Name, uuid.NewV4())
+	require.IsType(s.T(), errors.NotFoundError{}, err)
 }
 
 func createAndLoadRole(s *roleBlackBoxTest) *role.Role {
@@ -3,7 +3,10 @@ package configuration
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 
 	"github.com/goadesign/goa"
 	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
@@ -70,9 +74,46 @@ const (
 	varServiceAccountPrivateKeyIDDeprecated = "serviceaccount.privatekeyid.deprecated"
 	varServiceAccountPrivateKey             = "serviceaccount.privatekey"
 	varServiceAccountPrivateKeyID           = "serviceaccount.privatekeyid"
+	varServiceAccountKeyRingKeys            = "serviceaccount.keyring.keys"
+	varServiceAccountKeyRingDir             = "serviceaccount.keyring.dir"
+	varServiceAccountKeyRingReloadInterval  = "serviceaccount.keyring.reloadinterval"
+	varServiceAccountPrivateKeyRetireAfter  = "serviceaccount.privatekey.retireafter"
+	varServiceAccountRetireAfterDeprecated  = "serviceaccount.privatekey.retireafter.deprecated"
+	varUserAccessTokenExpiresIn             = "user.accesstoken.expiresin"
+	varUserRefreshTokenExpiresIn            = "user.refreshtoken.expiresin"
+	varOutboxPollInterval                   = "outbox.pollinterval"
+	varOutboxBatchSize                      = "outbox.batchsize"
+	varOutboxMaxAttempts                    = "outbox.maxattempts"
+	varOutboxRetryBackoff                   = "outbox.retrybackoff"
+	varWebhookTimeout                       = "webhook.timeout"
+	varHealthCheckTimeout                   = "health.timeout"
+	varHealthCheckCacheTTL                  = "health.cachettl"
+	varTracingExporter                      = "tracing.exporter"
+	varTracingJaegerAgentHostPort           = "tracing.jaeger.agent"
+	varTracingSamplingRate                  = "tracing.samplingrate"
+	varRateLimitEnabled                     = "ratelimit.enabled"
+	varRateLimitStore                       = "ratelimit.store"
+	varRateLimitClientIPRate                = "ratelimit.clientip.rate"
+	varRateLimitClientIPBurst               = "ratelimit.clientip.burst"
+	varRateLimitClientIDRate                = "ratelimit.clientid.rate"
+	varRateLimitClientIDBurst               = "ratelimit.clientid.burst"
+	varRateLimitIdentityRate                = "ratelimit.identity.rate"
+	varRateLimitIdentityBurst               = "ratelimit.identity.burst"
+	varExternalTokenKey                     = "externaltoken.encryptionkey"
+	varExternalTokenKeyID                   = "externaltoken.encryptionkeyid"
+	varExternalTokenKeyDeprecated           = "externaltoken.encryptionkey.deprecated"
+	varExternalTokenKeyIDDeprecated         = "externaltoken.encryptionkeyid.deprecated"
+	varExternalProviders                    = "externalproviders"
 	varGitHubClientID                       = "github.client.id"
 	varGitHubClientSecret                   = "github.client.secret"
 	varGitHubClientDefaultScopes            = "github.client.defaultscopes"
+	varGitLabURL                            = "gitlab.url"
+	varGitLabClientID                       = "gitlab.client.id"
+	varGitLabClientSecret                   = "gitlab.client.secret"
+	varGitLabClientDefaultScopes            = "gitlab.client.defaultscopes"
+	varBitbucketClientID                    = "bitbucket.client.id"
+	varBitbucketClientSecret                = "bitbucket.client.secret"
+	varBitbucketClientDefaultScopes         = "bitbucket.client.defaultscopes"
 	varOSOClientApiUrl                      = "oso.client.apiurl"
 	varTLSInsecureSkipVerify                = "tls.insecureskipverify"
 	varNotApprovedRedirect                  = "notapproved.redirect"
@@ -101,6 +142,30 @@ type osoClusterConfig struct {
 	Clusters []OSOCluster
 }
 
+type authorizationModelConfig struct {
+	ResourceTypes []ResourceTypeConfig `mapstructure:"resource_types"`
+}
+
+// ResourceTypeConfig represents the declaration of a resource type with its scopes and roles
+type ResourceTypeConfig struct {
+	Name        string        `mapstructure:"name"`
+	Description string        `mapstructure:"description"`
+	Scopes      []ScopeConfig `mapstructure:"scopes"`
+	Roles       []RoleConfig  `mapstructure:"roles"`
+}
+
+// ScopeConfig represents the declaration of a resource type scope
+type ScopeConfig struct {
+	Name        string `mapstructure:"name"`
+	Description string `mapstructure:"description"`
+}
+
+// RoleConfig represents the declaration of a role with the names of the scopes it grants
+type RoleConfig struct {
+	Name   string   `mapstructure:"name"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
 // ServiceAccount represents a service account configuration
 type ServiceAccount struct {
 	Name    string   `mapstructure:"name"`
@@ -108,6 +173,66 @@ type ServiceAccount struct {
 	Secrets []string `mapstructure:"secrets"`
 }
 
+// serviceAccountKeyConfig represents a key of the service account key ring as it's configured.
+// The times are in the RFC 3339 format and are optional.
+type serviceAccountKeyConfig struct {
+	KeyID       string `mapstructure:"kid"`
+	PrivateKey  string `mapstructure:"private_key"`
+	NotBefore   string `mapstructure:"not_before"`
+	RetireAfter string `mapstructure:"retire_after"`
+}
+
+// ServiceAccountKey represents a key of the service account key ring.
+// The key is used to sign tokens from NotBefore (if not zero) unless a newer key is active,
+// and is published to verify tokens until RetireAfter (if not zero).
+type ServiceAccountKey struct {
+	KeyID       string
+	PrivateKey  []byte
+	NotBefore   time.Time
+	RetireAfter time.Time
+}
+
+const (
+	// ExternalProviderTypeOAuth2 is the type of the generic OAuth2 external providers, configured with all their endpoints
+	ExternalProviderTypeOAuth2 = "generic-oauth2"
+	// ExternalProviderTypeOIDC is the type of the generic OpenID Connect external providers,
+	// whose endpoints are discovered from their issuer unless they are configured
+	ExternalProviderTypeOIDC = "generic-oidc"
+)
+
+// builtInProviderIDs are the IDs of the built-in providers (see the token/link package) which are not
+// configured per cluster, so they can't be used by the generic external providers
+var builtInProviderIDs = []string{
+	"2f6b7176-8f4b-4204-962d-606033275397", // GitHub
+	"7134f7fd-ab9f-4f16-a89e-2c072b241b35", // GitLab
+	"051d7a5e-521b-4423-840a-6e5fbaa6f85d", // Bitbucket
+}
+
+// ExternalProvider represents a generic external provider the accounts can be linked to.
+// The provider is used for the resources whose URL matches the resource URL pattern (a regular expression).
+// The username is extracted from the profile with the username path, a JSONPath such as "$.user.login".
+type ExternalProvider struct {
+	// ID is the ID of the provider stored with the tokens, so it must not change
+	ID                 string `mapstructure:"id"`
+	Name               string `mapstructure:"name"`
+	Type               string `mapstructure:"type"`
+	ResourceURLPattern string `mapstructure:"resource_url_pattern"`
+	Issuer             string `mapstructure:"issuer"`
+	AuthURL            string `mapstructure:"auth_url"`
+	TokenURL           string `mapstructure:"token_url"`
+	ProfileURL         string `mapstructure:"profile_url"`
+	ClientID           string `mapstructure:"client_id"`
+	ClientSecret       string `mapstructure:"client_secret"`
+	Scopes             string `mapstructure:"scopes"`
+	UsernamePath       string `mapstructure:"username_path"`
+	resourceURLPattern *regexp.Regexp
+}
+
+// MatchesResource returns true if the provider is used for the given resource URL
+func (p ExternalProvider) MatchesResource(resourceURL string) bool {
+	return p.resourceURLPattern != nil && p.resourceURLPattern.MatchString(resourceURL)
+}
+
 // OSOCluster represents an OSO cluster configuration
 type OSOCluster struct {
 	Name                   string `mapstructure:"name"`
@@ -130,11 +255,32 @@ type ConfigurationData struct {
 	// OSO Cluster Configuration is a map of clusters where the key == the OSO cluster API URL
 	clusters map[string]OSOCluster
 
+	// Authorization Model Configuration is the list of the declared resource types
+	resourceTypes []ResourceTypeConfig
+
+	// Service Account Key Ring Configuration is the list of the keys listed in the main configuration
+	// followed by the keys stored in the key ring directory
+	keyRing []ServiceAccountKey
+
+	// Retirement times of the service account private key and of the deprecated one (zero if they are not retired)
+	privateKeyRetireAfter           time.Time
+	deprecatedPrivateKeyRetireAfter time.Time
+
+	// External Provider Configuration is the list of the generic external providers listed in the main configuration
+	externalProviders []ExternalProvider
+
 	defaultConfigurationError error
 }
 
 // NewConfigurationData creates a configuration reader object using configurable configuration file paths
+// and the default authorization model configuration
 func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string, osoClusterConfigFile string) (*ConfigurationData, error) {
+	return NewConfigurationDataWithAuthorizationModel(mainConfigFile, serviceAccountConfigFile, osoClusterConfigFile, "")
+}
+
+// NewConfigurationDataWithAuthorizationModel creates a configuration reader object using configurable configuration file paths,
+// including the path of the authorization model configuration
+func NewConfigurationDataWithAuthorizationModel(mainConfigFile string, serviceAccountConfigFile string, osoClusterConfigFile string, authorizationModelConfigFile string) (*ConfigurationData, error) {
 	c := ConfigurationData{
 		v: viper.New(),
 	}
@@ -156,7 +302,7 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 	}
 
 	// Set up the service account configuration (stored in a separate config file)
-	saViper, defaultConfigErrorMsg, err := readFromJSONFile(serviceAccountConfigFile, defaultServiceAccountConfigPath, serviceAccountConfigFileName)
+	saViper, defaultConfigErrorMsg, err := readFromFile(serviceAccountConfigFile, defaultServiceAccountConfigPath, serviceAccountConfigFileName, "json")
 	c.appendDefaultConfigErrorMessage(defaultConfigErrorMsg)
 
 	var saConf serviceAccountConfig
@@ -170,7 +316,7 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 	}
 
 	// Set up the OSO cluster configuration (stored in a separate config file)
-	clusterViper, defaultConfigErrorMsg, err := readFromJSONFile(osoClusterConfigFile, defaultOsoClusterConfigPath, osoClusterConfigFileName)
+	clusterViper, defaultConfigErrorMsg, err := readFromFile(osoClusterConfigFile, defaultOsoClusterConfigPath, osoClusterConfigFileName, "json")
 	c.appendDefaultConfigErrorMessage(defaultConfigErrorMsg)
 
 	var clusterConf osoClusterConfig
@@ -183,6 +329,51 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 		c.clusters[cluster.URL] = cluster
 	}
 
+	// Set up the authorization model configuration (stored in a separate config file)
+	// The default model is not a sensitive configuration so no default config error is reported for it
+	modelViper, _, err := readFromFile(authorizationModelConfigFile, defaultAuthorizationModelConfigPath, authorizationModelConfigFileName, "yaml")
+	if err != nil {
+		return nil, err
+	}
+	var modelConf authorizationModelConfig
+	err = modelViper.UnmarshalExact(&modelConf)
+	if err != nil {
+		return nil, err
+	}
+	if !modelViper.IsSet("resource_types") {
+		// the configuration doesn't declare the resource types, so the built-in ones are used.
+		// An empty list of resource types is kept as is
+		modelConf.ResourceTypes, err = builtInResourceTypes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = validateAuthorizationModel(modelConf.ResourceTypes)
+	if err != nil {
+		return nil, err
+	}
+	c.resourceTypes = modelConf.ResourceTypes
+
+	// Set up the service account key ring (listed in the main configuration and/or stored in a directory)
+	c.keyRing, err = c.LoadServiceAccountKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	c.privateKeyRetireAfter, err = c.parseTime(varServiceAccountPrivateKeyRetireAfter)
+	if err != nil {
+		return nil, err
+	}
+	c.deprecatedPrivateKeyRetireAfter, err = c.parseTime(varServiceAccountRetireAfterDeprecated)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up the generic external providers (listed in the main configuration)
+	c.externalProviders, err = c.loadExternalProviders()
+	if err != nil {
+		return nil, err
+	}
+
 	// Check sensitive default configuration
 	if c.IsPostgresDeveloperModeEnabled() {
 		msg := "developer Mode is enabled"
@@ -197,6 +388,15 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 		msg := "default service account private key ID is used"
 		c.appendDefaultConfigErrorMessage(&msg)
 	}
+	externalTokenKey, externalTokenKeyID := c.GetExternalTokenEncryptionKey()
+	if string(externalTokenKey) == defaultExternalTokenKey {
+		msg := "default external token encryption key is used"
+		c.appendDefaultConfigErrorMessage(&msg)
+	}
+	if externalTokenKeyID == defaultExternalTokenKeyID {
+		msg := "default external token encryption key ID is used"
+		c.appendDefaultConfigErrorMessage(&msg)
+	}
 	if c.GetPostgresPassword() == defaultDBPassword {
 		msg := "default DB password is used"
 		c.appendDefaultConfigErrorMessage(&msg)
@@ -226,50 +426,245 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 	return &c, nil
 }
 
-func readFromJSONFile(configFilePath string, defaultConfigFilePath string, configFileName string) (*viper.Viper, *string, error) {
-	jsonViper := viper.New()
-	jsonViper.SetTypeByDefaultValue(true)
+func readFromFile(configFilePath string, defaultConfigFilePath string, configFileName string, configType string) (*viper.Viper, *string, error) {
+	fileViper := viper.New()
+	fileViper.SetTypeByDefaultValue(true)
 
 	var err error
-	var etcJSONConfigUsed bool
+	var etcConfigUsed bool
 	var defaultConfigErrorMsg *string
 	if configFilePath != "" {
-		// If a JSON configuration file has been specified, check if it exists
+		// If a configuration file has been specified, check if it exists
 		if _, err := os.Stat(configFilePath); err != nil {
 			return nil, nil, err
 		}
 	} else {
-		// If the JSON configuration file has not been specified
+		// If the configuration file has not been specified
 		// then we default to <defaultConfigFile>
 		configFilePath, err = pathExists(defaultConfigFilePath)
 		if err != nil {
 			return nil, nil, err
 		}
-		etcJSONConfigUsed = configFilePath != ""
+		etcConfigUsed = configFilePath != ""
 	}
 
-	if !etcJSONConfigUsed {
+	if !etcConfigUsed {
 		errMsg := fmt.Sprintf("%s is not used", defaultConfigFilePath)
 		defaultConfigErrorMsg = &errMsg
 	}
 
-	jsonViper.SetConfigType("json")
+	fileViper.SetConfigType(configType)
 	if configFilePath == "" {
 		// Load the default config
 		data, err := Asset(configFileName)
 		if err != nil {
 			return nil, nil, err
 		}
-		jsonViper.ReadConfig(bytes.NewBuffer(data))
+		fileViper.ReadConfig(bytes.NewBuffer(data))
 	} else {
-		jsonViper.SetConfigFile(configFilePath)
-		err := jsonViper.ReadInConfig()
+		fileViper.SetConfigFile(configFilePath)
+		err := fileViper.ReadInConfig()
 		if err != nil {
-			return nil, nil, errors.Errorf("failed to load the JSON config file (%s): %s \n", configFilePath, err)
+			return nil, nil, errors.Errorf("failed to load the %s config file (%s): %s \n", configType, configFilePath, err)
+		}
+	}
+
+	return fileViper, defaultConfigErrorMsg, nil
+}
+
+// builtInResourceTypes returns the resource types declared in the default authorization model configuration
+func builtInResourceTypes() ([]ResourceTypeConfig, error) {
+	data, err := Asset(authorizationModelConfigFileName)
+	if err != nil {
+		return nil, err
+	}
+	modelViper := viper.New()
+	modelViper.SetConfigType("yaml")
+	err = modelViper.ReadConfig(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	var modelConf authorizationModelConfig
+	err = modelViper.UnmarshalExact(&modelConf)
+	if err != nil {
+		return nil, err
+	}
+	return modelConf.ResourceTypes, nil
+}
+
+// validateAuthorizationModel checks that the names of the declared resource types, scopes and roles are unique
+// and that the roles only grant scopes declared for their resource type
+func validateAuthorizationModel(resourceTypes []ResourceTypeConfig) error {
+	typeNames := map[string]bool{}
+	for _, resourceType := range resourceTypes {
+		if resourceType.Name == "" {
+			return errors.New("invalid authorization model: a resource type has no name")
+		}
+		if typeNames[resourceType.Name] {
+			return errors.Errorf("invalid authorization model: resource type %s is declared more than once", resourceType.Name)
+		}
+		typeNames[resourceType.Name] = true
+		scopeNames := map[string]bool{}
+		for _, scope := range resourceType.Scopes {
+			if scope.Name == "" || scopeNames[scope.Name] {
+				return errors.Errorf("invalid authorization model: scope '%s' of resource type %s is empty or declared more than once", scope.Name, resourceType.Name)
+			}
+			scopeNames[scope.Name] = true
+		}
+		roleNames := map[string]bool{}
+		for _, role := range resourceType.Roles {
+			if role.Name == "" || roleNames[role.Name] {
+				return errors.Errorf("invalid authorization model: role '%s' of resource type %s is empty or declared more than once", role.Name, resourceType.Name)
+			}
+			roleNames[role.Name] = true
+			for _, scope := range role.Scopes {
+				if !scopeNames[scope] {
+					return errors.Errorf("invalid authorization model: role %s of resource type %s grants the undeclared scope %s", role.Name, resourceType.Name, scope)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// loadExternalProviders loads and validates the generic external providers listed in the main configuration.
+// The OpenID Connect providers get the default scopes and username path of OpenID Connect if they are not configured.
+func (c *ConfigurationData) loadExternalProviders() ([]ExternalProvider, error) {
+	var providers []ExternalProvider
+	err := c.v.UnmarshalKey(varExternalProviders, &providers)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid external providers")
+	}
+	// the names and the IDs of the built-in providers can't be used
+	names := map[string]bool{"github": true, "gitlab": true, "bitbucket": true, "openshift-v3": true}
+	ids := map[string]bool{}
+	for _, id := range builtInProviderIDs {
+		ids[id] = true
+	}
+	for _, cluster := range c.clusters {
+		ids[cluster.TokenProviderID] = true
+	}
+	for i := range providers {
+		provider := &providers[i]
+		if provider.Name == "" || names[provider.Name] {
+			return nil, errors.Errorf("invalid external provider: name '%s' is empty, reserved or declared more than once", provider.Name)
+		}
+		names[provider.Name] = true
+		if _, err := uuid.FromString(provider.ID); err != nil || ids[provider.ID] {
+			return nil, errors.Errorf("invalid external provider %s: ID '%s' is not a UUID or is used by another provider", provider.Name, provider.ID)
+		}
+		ids[provider.ID] = true
+		if provider.ResourceURLPattern == "" {
+			return nil, errors.Errorf("invalid external provider %s: no resource URL pattern", provider.Name)
+		}
+		provider.resourceURLPattern, err = regexp.Compile(provider.ResourceURLPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid resource URL pattern of the external provider %s", provider.Name)
+		}
+		if provider.ClientID == "" {
+			return nil, errors.Errorf("invalid external provider %s: no client ID", provider.Name)
+		}
+		switch provider.Type {
+		case ExternalProviderTypeOAuth2:
+			if provider.AuthURL == "" || provider.TokenURL == "" || provider.ProfileURL == "" || provider.UsernamePath == "" {
+				return nil, errors.Errorf("invalid external provider %s: the auth URL, the token URL, the profile URL and the username path are required", provider.Name)
+			}
+		case ExternalProviderTypeOIDC:
+			if provider.Issuer == "" && (provider.AuthURL == "" || provider.TokenURL == "" || provider.ProfileURL == "") {
+				return nil, errors.Errorf("invalid external provider %s: the issuer is required unless all the endpoints are configured", provider.Name)
+			}
+			if provider.Scopes == "" {
+				provider.Scopes = "openid profile"
+			}
+			if provider.UsernamePath == "" {
+				provider.UsernamePath = "$.preferred_username"
+			}
+		default:
+			return nil, errors.Errorf("invalid external provider %s: unknown type '%s', expected %s or %s", provider.Name, provider.Type, ExternalProviderTypeOAuth2, ExternalProviderTypeOIDC)
+		}
+	}
+	return providers, nil
+}
+
+// LoadServiceAccountKeyRing loads the keys listed in the main configuration and the keys stored in the key ring directory.
+// Each file of the directory with a .yaml, .yml or .json extension contains a single key.
+// The directory is read again on every call, so the keys added to or removed from it are taken into account
+// without restarting the service.
+func (c *ConfigurationData) LoadServiceAccountKeyRing() ([]ServiceAccountKey, error) {
+	var keyConfigs []serviceAccountKeyConfig
+	err := c.v.UnmarshalKey(varServiceAccountKeyRingKeys, &keyConfigs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid service account key ring")
+	}
+	if dir := c.v.GetString(varServiceAccountKeyRingDir); dir != "" {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read the service account key ring directory")
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+				continue
+			}
+			keyViper := viper.New()
+			keyViper.SetConfigFile(filepath.Join(dir, file.Name()))
+			err = keyViper.ReadInConfig()
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to read the service account key file %s", file.Name())
+			}
+			var keyConfig serviceAccountKeyConfig
+			err = keyViper.UnmarshalExact(&keyConfig)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid service account key file %s", file.Name())
+			}
+			keyConfigs = append(keyConfigs, keyConfig)
+		}
+	}
+
+	_, legacyKeyID := c.GetServiceAccountPrivateKey()
+	_, deprecatedKeyID := c.GetDeprecatedServiceAccountPrivateKey()
+	keyIDs := map[string]bool{legacyKeyID: true, deprecatedKeyID: true}
+	var keys []ServiceAccountKey
+	for _, keyConfig := range keyConfigs {
+		if keyConfig.KeyID == "" || keyConfig.PrivateKey == "" {
+			return nil, errors.New("invalid service account key ring: a key has no ID or no private key")
+		}
+		if keyIDs[keyConfig.KeyID] {
+			return nil, errors.Errorf("invalid service account key ring: key %s is declared more than once", keyConfig.KeyID)
+		}
+		keyIDs[keyConfig.KeyID] = true
+		key := ServiceAccountKey{KeyID: keyConfig.KeyID, PrivateKey: []byte(keyConfig.PrivateKey)}
+		if keyConfig.NotBefore != "" {
+			key.NotBefore, err = time.Parse(time.RFC3339, keyConfig.NotBefore)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid not_before time of the service account key %s", keyConfig.KeyID)
+			}
+		}
+		if keyConfig.RetireAfter != "" {
+			key.RetireAfter, err = time.Parse(time.RFC3339, keyConfig.RetireAfter)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid retire_after time of the service account key %s", keyConfig.KeyID)
+			}
+			if !key.RetireAfter.After(key.NotBefore) {
+				return nil, errors.Errorf("invalid service account key ring: key %s is retired before it's used", keyConfig.KeyID)
+			}
 		}
+		keys = append(keys, key)
 	}
+	return keys, nil
+}
 
-	return jsonViper, defaultConfigErrorMsg, nil
+// parseTime parses the optional time in the RFC 3339 format set for the given key. Returns the zero time if it's not set.
+func (c *ConfigurationData) parseTime(key string) (time.Time, error) {
+	value := c.v.GetString(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid %s time", key)
+	}
+	return t, nil
 }
 
 func (c *ConfigurationData) appendDefaultConfigErrorMessage(message *string) {
@@ -309,6 +704,11 @@ func getOSOClusterConfigFile() string {
 	return envOSOClusterConfigFile
 }
 
+func getAuthorizationModelConfigFile() string {
+	envAuthorizationModelConfigFile, _ := os.LookupEnv("AUTH_AUTHORIZATION_MODEL_CONFIG_FILE")
+	return envAuthorizationModelConfigFile
+}
+
 // DefaultConfigurationError returns an error if the default values is used
 // for sensitive configuration like service account secrets or private keys.
 // Error contains all the details.
@@ -327,6 +727,11 @@ func (c *ConfigurationData) GetOSOClusters() map[string]OSOCluster {
 	return c.clusters
 }
 
+// GetAuthorizationResourceTypes returns the resource types declared in the authorization model
+func (c *ConfigurationData) GetAuthorizationResourceTypes() []ResourceTypeConfig {
+	return c.resourceTypes
+}
+
 // GetDefaultConfigurationFile returns the default configuration file.
 func (c *ConfigurationData) GetDefaultConfigurationFile() string {
 	return defaultConfigFile
@@ -335,7 +740,7 @@ func (c *ConfigurationData) GetDefaultConfigurationFile() string {
 // GetConfigurationData is a wrapper over NewConfigurationData which reads configuration file path
 // from the environment variable.
 func GetConfigurationData() (*ConfigurationData, error) {
-	return NewConfigurationData(getMainConfigFile(), getServiceAccountConfigFile(), getOSOClusterConfigFile())
+	return NewConfigurationDataWithAuthorizationModel(getMainConfigFile(), getServiceAccountConfigFile(), getOSOClusterConfigFile(), getAuthorizationModelConfigFile())
 }
 
 func (c *ConfigurationData) setConfigDefaults() {
@@ -369,6 +774,68 @@ func (c *ConfigurationData) setConfigDefaults() {
 	c.v.SetDefault(varMetricsHTTPAddress, "0.0.0.0:8089")
 	c.v.SetDefault(varHeaderMaxLength, defaultHeaderMaxLength)
 
+	//-----
+	// User tokens
+	//-----
+	c.v.SetDefault(varUserAccessTokenExpiresIn, time.Duration(24*time.Hour))
+	c.v.SetDefault(varUserRefreshTokenExpiresIn, time.Duration(30*24*time.Hour))
+	c.v.SetDefault(varServiceAccountKeyRingReloadInterval, time.Duration(time.Minute))
+
+	//-----
+	// Outbox
+	//-----
+	c.v.SetDefault(varOutboxPollInterval, time.Duration(5*time.Second))
+	c.v.SetDefault(varOutboxBatchSize, 100)
+	c.v.SetDefault(varOutboxMaxAttempts, 20)
+	// Delay before the first retry of a failed delivery. The delay is doubled after every failed attempt.
+	c.v.SetDefault(varOutboxRetryBackoff, time.Duration(10*time.Second))
+
+	//-----
+	// Webhooks
+	//-----
+	// The deliveries to the webhooks are retried with the same backoff and maximum number of attempts as the outbox events
+	c.v.SetDefault(varWebhookTimeout, time.Duration(10*time.Second))
+
+	//-----
+	// Health checks
+	//-----
+	c.v.SetDefault(varHealthCheckTimeout, time.Duration(2*time.Second))
+	// The results of the checks are reused for this duration, so frequent probes don't overload the dependencies
+	c.v.SetDefault(varHealthCheckCacheTTL, time.Duration(5*time.Second))
+
+	//-----
+	// Tracing
+	//-----
+	// One of "none", "jaeger" or "memory"
+	c.v.SetDefault(varTracingExporter, "none")
+	c.v.SetDefault(varTracingJaegerAgentHostPort, "localhost:6831")
+	// The proportion of the traces which are reported, between 0 and 1
+	c.v.SetDefault(varTracingSamplingRate, 1.0)
+
+	//-----
+	// Rate limiting
+	//-----
+	// The token exchanges, the user searches and the logins are throttled with token buckets:
+	// a client can send up to "burst" requests at once, then "rate" requests per second
+	c.v.SetDefault(varRateLimitEnabled, true)
+	// One of "memory" or "postgres". The limits are shared by all the replicas of the service with "postgres"
+	c.v.SetDefault(varRateLimitStore, "memory")
+	c.v.SetDefault(varRateLimitClientIPRate, 5.0)
+	c.v.SetDefault(varRateLimitClientIPBurst, 50)
+	c.v.SetDefault(varRateLimitClientIDRate, 1.0)
+	c.v.SetDefault(varRateLimitClientIDBurst, 20)
+	c.v.SetDefault(varRateLimitIdentityRate, 2.0)
+	c.v.SetDefault(varRateLimitIdentityBurst, 30)
+
+	//-----
+	// External token encryption
+	//-----
+	// The tokens of the external providers are encrypted with a random data key per token,
+	// and the data keys are encrypted with the key-encryption key (a base64-encoded 256-bit AES key).
+	// When the key is rotated, the previous key is configured as the deprecated one until the stored tokens are re-encrypted.
+	c.v.SetDefault(varExternalTokenKey, defaultExternalTokenKey)
+	c.v.SetDefault(varExternalTokenKeyID, defaultExternalTokenKeyID)
+
 	//-----
 	// Misc
 	//-----
@@ -393,6 +860,10 @@ func (c *ConfigurationData) setConfigDefaults() {
 	c.v.SetDefault(varGitHubClientID, "c6a3a6280e9650ba27d8")
 	c.v.SetDefault(varGitHubClientSecret, defaultGitHubClientSecret)
 	c.v.SetDefault(varGitHubClientDefaultScopes, "admin:repo_hook read:org repo user gist")
+	// GitLab and Bitbucket accounts can't be linked unless their client IDs are set
+	c.v.SetDefault(varGitLabURL, "https://gitlab.com")
+	c.v.SetDefault(varGitLabClientDefaultScopes, "api read_user")
+	c.v.SetDefault(varBitbucketClientDefaultScopes, "account repository pullrequest")
 	c.v.SetDefault(varOSOClientApiUrl, "https://api.starter-us-east-2.openshift.com")
 	c.v.SetDefault(varTLSInsecureSkipVerify, false) // Do not set to true in production! True can be used only for testing.
 
@@ -537,12 +1008,152 @@ func (c *ConfigurationData) GetDeprecatedServiceAccountPrivateKey() ([]byte, str
 	return []byte(c.v.GetString(varServiceAccountPrivateKeyDeprecated)), c.v.GetString(varServiceAccountPrivateKeyIDDeprecated)
 }
 
+// GetServiceAccountKeyRing returns the keys of the service account key ring in addition to
+// the service account private key and the deprecated one, as they were loaded when the service started
+func (c *ConfigurationData) GetServiceAccountKeyRing() []ServiceAccountKey {
+	return c.keyRing
+}
+
+// GetServiceAccountKeyRingReloadInterval returns the interval between two reloads of the service account key ring
+func (c *ConfigurationData) GetServiceAccountKeyRingReloadInterval() time.Duration {
+	return c.v.GetDuration(varServiceAccountKeyRingReloadInterval)
+}
+
+// GetServiceAccountPrivateKeyRetireAfter returns the time after which the service account private key
+// no longer signs nor verifies the tokens, or the zero time if the key is not retired
+func (c *ConfigurationData) GetServiceAccountPrivateKeyRetireAfter() time.Time {
+	return c.privateKeyRetireAfter
+}
+
+// GetDeprecatedServiceAccountPrivateKeyRetireAfter returns the time after which the deprecated service account private key
+// no longer verifies the tokens, or the zero time if the key is not retired
+func (c *ConfigurationData) GetDeprecatedServiceAccountPrivateKeyRetireAfter() time.Time {
+	return c.deprecatedPrivateKeyRetireAfter
+}
+
 // GetServiceAccountPrivateKey returns the service account private key and its ID
 // that is used to sign the service account authentication tokens.
 func (c *ConfigurationData) GetServiceAccountPrivateKey() ([]byte, string) {
 	return []byte(c.v.GetString(varServiceAccountPrivateKey)), c.v.GetString(varServiceAccountPrivateKeyID)
 }
 
+// GetUserAccessTokenExpiresIn returns the lifetime of the user access tokens issued by the Auth service
+func (c *ConfigurationData) GetUserAccessTokenExpiresIn() time.Duration {
+	return c.v.GetDuration(varUserAccessTokenExpiresIn)
+}
+
+// GetUserRefreshTokenExpiresIn returns the lifetime of the user refresh tokens issued by the Auth service
+func (c *ConfigurationData) GetUserRefreshTokenExpiresIn() time.Duration {
+	return c.v.GetDuration(varUserRefreshTokenExpiresIn)
+}
+
+// GetOutboxPollInterval returns the interval between two lookups of the events to deliver
+func (c *ConfigurationData) GetOutboxPollInterval() time.Duration {
+	return c.v.GetDuration(varOutboxPollInterval)
+}
+
+// GetOutboxBatchSize returns the maximum number of events delivered at every lookup
+func (c *ConfigurationData) GetOutboxBatchSize() int {
+	return c.v.GetInt(varOutboxBatchSize)
+}
+
+// GetOutboxMaxAttempts returns the number of attempts to deliver an event before giving up
+func (c *ConfigurationData) GetOutboxMaxAttempts() int {
+	return c.v.GetInt(varOutboxMaxAttempts)
+}
+
+// GetOutboxRetryBackoff returns the delay before the first retry of a failed event delivery
+func (c *ConfigurationData) GetOutboxRetryBackoff() time.Duration {
+	return c.v.GetDuration(varOutboxRetryBackoff)
+}
+
+// GetWebhookTimeout returns the timeout of the requests delivering the events to the webhooks
+func (c *ConfigurationData) GetWebhookTimeout() time.Duration {
+	return c.v.GetDuration(varWebhookTimeout)
+}
+
+// GetHealthCheckTimeout returns the timeout of every check of the health of the service and its dependencies
+func (c *ConfigurationData) GetHealthCheckTimeout() time.Duration {
+	return c.v.GetDuration(varHealthCheckTimeout)
+}
+
+// GetHealthCheckCacheTTL returns how long the result of a health check is reused before the check runs again
+func (c *ConfigurationData) GetHealthCheckCacheTTL() time.Duration {
+	return c.v.GetDuration(varHealthCheckCacheTTL)
+}
+
+// GetTracingExporter returns the exporter reporting the spans of the traces: "none", "jaeger" or "memory"
+func (c *ConfigurationData) GetTracingExporter() string {
+	return c.v.GetString(varTracingExporter)
+}
+
+// GetTracingJaegerAgentHostPort returns the host and port of the Jaeger agent the spans are reported to
+func (c *ConfigurationData) GetTracingJaegerAgentHostPort() string {
+	return c.v.GetString(varTracingJaegerAgentHostPort)
+}
+
+// GetTracingSamplingRate returns the proportion of the traces which are reported, between 0 and 1
+func (c *ConfigurationData) GetTracingSamplingRate() float64 {
+	return c.v.GetFloat64(varTracingSamplingRate)
+}
+
+// IsRateLimitEnabled returns true if the throttled endpoints are rate limited
+func (c *ConfigurationData) IsRateLimitEnabled() bool {
+	return c.v.GetBool(varRateLimitEnabled)
+}
+
+// GetRateLimitStore returns the store of the rate limit buckets: "memory" or "postgres"
+func (c *ConfigurationData) GetRateLimitStore() string {
+	return c.v.GetString(varRateLimitStore)
+}
+
+// GetRateLimitClientIPRate returns the number of requests per second a client IP can send to a throttled endpoint
+func (c *ConfigurationData) GetRateLimitClientIPRate() float64 {
+	return c.v.GetFloat64(varRateLimitClientIPRate)
+}
+
+// GetRateLimitClientIPBurst returns the number of requests a client IP can send at once to a throttled endpoint
+func (c *ConfigurationData) GetRateLimitClientIPBurst() int {
+	return c.v.GetInt(varRateLimitClientIPBurst)
+}
+
+// GetRateLimitClientIDRate returns the number of token exchanges per second which can be requested with a client ID
+func (c *ConfigurationData) GetRateLimitClientIDRate() float64 {
+	return c.v.GetFloat64(varRateLimitClientIDRate)
+}
+
+// GetRateLimitClientIDBurst returns the number of token exchanges which can be requested at once with a client ID
+func (c *ConfigurationData) GetRateLimitClientIDBurst() int {
+	return c.v.GetInt(varRateLimitClientIDBurst)
+}
+
+// GetRateLimitIdentityRate returns the number of requests per second an identity can send to a throttled endpoint
+func (c *ConfigurationData) GetRateLimitIdentityRate() float64 {
+	return c.v.GetFloat64(varRateLimitIdentityRate)
+}
+
+// GetRateLimitIdentityBurst returns the number of requests an identity can send at once to a throttled endpoint
+func (c *ConfigurationData) GetRateLimitIdentityBurst() int {
+	return c.v.GetInt(varRateLimitIdentityBurst)
+}
+
+// GetExternalTokenEncryptionKey returns the key-encryption key (base64-encoded) and its ID
+// that is used to encrypt the data keys of the external tokens.
+func (c *ConfigurationData) GetExternalTokenEncryptionKey() ([]byte, string) {
+	return []byte(c.v.GetString(varExternalTokenKey)), c.v.GetString(varExternalTokenKeyID)
+}
+
+// GetDeprecatedExternalTokenEncryptionKey returns the deprecated key-encryption key (if any) and its ID
+// that is used to decrypt the external tokens which have not been re-encrypted since the key rotation.
+func (c *ConfigurationData) GetDeprecatedExternalTokenEncryptionKey() ([]byte, string) {
+	return []byte(c.v.GetString(varExternalTokenKeyDeprecated)), c.v.GetString(varExternalTokenKeyIDDeprecated)
+}
+
+// GetExternalProviders returns the generic external providers the accounts can be linked to, in addition to GitHub, GitLab, Bitbucket and OpenShift
+func (c *ConfigurationData) GetExternalProviders() []ExternalProvider {
+	return c.externalProviders
+}
+
 // GetGitHubClientID return GitHub client ID used to link GitHub accounts
 func (c *ConfigurationData) GetGitHubClientID() string {
 	return c.v.GetString(varGitHubClientID)
@@ -558,6 +1169,42 @@ func (c *ConfigurationData) GetGitHubClientDefaultScopes() string {
 	return c.v.GetString(varGitHubClientDefaultScopes)
 }
 
+// GetGitLabURL returns the URL of the GitLab instance (gitlab.com or a self-hosted instance) the GitLab accounts are linked to
+func (c *ConfigurationData) GetGitLabURL() string {
+	return strings.TrimSuffix(c.v.GetString(varGitLabURL), "/")
+}
+
+// GetGitLabClientID returns GitLab client ID used to link GitLab accounts. GitLab accounts can't be linked if it's empty.
+func (c *ConfigurationData) GetGitLabClientID() string {
+	return c.v.GetString(varGitLabClientID)
+}
+
+// GetGitLabClientSecret returns GitLab client secret used to link GitLab accounts
+func (c *ConfigurationData) GetGitLabClientSecret() string {
+	return c.v.GetString(varGitLabClientSecret)
+}
+
+// GetGitLabClientDefaultScopes returns default scopes used to link GitLab accounts
+func (c *ConfigurationData) GetGitLabClientDefaultScopes() string {
+	return c.v.GetString(varGitLabClientDefaultScopes)
+}
+
+// GetBitbucketClientID returns Bitbucket client ID (the key of the OAuth consumer) used to link Bitbucket accounts.
+// Bitbucket accounts can't be linked if it's empty.
+func (c *ConfigurationData) GetBitbucketClientID() string {
+	return c.v.GetString(varBitbucketClientID)
+}
+
+// GetBitbucketClientSecret returns Bitbucket client secret used to link Bitbucket accounts
+func (c *ConfigurationData) GetBitbucketClientSecret() string {
+	return c.v.GetString(varBitbucketClientSecret)
+}
+
+// GetBitbucketClientDefaultScopes returns default scopes used to link Bitbucket accounts
+func (c *ConfigurationData) GetBitbucketClientDefaultScopes() string {
+	return c.v.GetString(varBitbucketClientDefaultScopes)
+}
+
 // GetOpenShiftClientApiUrl return the default OpenShift cluster client API URL used to link OpenShift accounts
 func (c *ConfigurationData) GetOpenShiftClientApiUrl() string {
 	return c.v.GetString(varOSOClientApiUrl)
@@ -760,6 +1407,7 @@ func (c *ConfigurationData) GetWITDomainPrefix() string {
 
 // GetWITURL returns the WIT URL where WIT is running
 // If AUTH_WIT_URL is not set and Auth in not in Dev Mode then we calculate the URL from the domain
+// of the request, so an error is returned if there is no request.
 func (c *ConfigurationData) GetWITURL(req *goa.RequestData) (string, error) {
 	if c.v.IsSet(varWITURL) {
 		return c.v.GetString(varWITURL), nil
@@ -767,6 +1415,9 @@ func (c *ConfigurationData) GetWITURL(req *goa.RequestData) (string, error) {
 	if c.IsPostgresDeveloperModeEnabled() {
 		return devModeWITURL, nil
 	}
+	if req == nil {
+		return "", errors.New("the WIT URL can't be calculated without a request")
+	}
 	return c.calculateWITURL(req)
 }
 
@@ -916,6 +1567,9 @@ OCCAgsB8g8yTB4qntAYyfofEoDiseKrngQT5DSdxd51A/jw7B8WyBK8=
 
 	defaultDBPassword = "mysecretpassword"
 
+	defaultExternalTokenKey   = "E97pLHXHSzLyfNXqylXumECr3tVvaOOB224huwvLOoY="
+	defaultExternalTokenKeyID = "dev-external-token-key"
+
 	defaultGitHubClientSecret = "48d1498c849616dfecf83cf74f22dfb361ee2511"
 
 	defaultLogLevel = "info"
@@ -951,4 +1605,7 @@ OCCAgsB8g8yTB4qntAYyfofEoDiseKrngQT5DSdxd51A/jw7B8WyBK8=
 
 	osoClusterConfigFileName    = "oso-clusters.conf"
 	defaultOsoClusterConfigPath = "/etc/fabric8/" + osoClusterConfigFileName
+
+	authorizationModelConfigFileName    = "authorization-model.conf"
+	defaultAuthorizationModelConfigPath = "/etc/fabric8/" + authorizationModelConfigFileName
 )
@@ -2,6 +2,7 @@ package configuration_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/token/link"
 	"github.com/goadesign/goa"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -430,6 +432,469 @@ func checkCluster(t *testing.T, clusters map[string]configuration.OSOCluster, ex
 	require.Nil(t, err)
 }
 
+func TestLoadDefaultAuthorizationModel(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	checkAuthorizationModel(t, config.GetAuthorizationResourceTypes())
+}
+
+func TestLoadAuthorizationModelFromFile(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	modelConfig, err := configuration.NewConfigurationDataWithAuthorizationModel("", "", "", "./conf-files/authorization-model.conf")
+	require.Nil(t, err)
+	checkAuthorizationModel(t, modelConfig.GetAuthorizationResourceTypes())
+}
+
+func TestLoadInvalidAuthorizationModelFails(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	invalidModels := map[string]string{
+		"duplicate resource type": `
+resource_types:
+  - name: openshift.io/resource/space
+  - name: openshift.io/resource/space
+`,
+		"duplicate scope": `
+resource_types:
+  - name: openshift.io/resource/space
+    scopes:
+      - name: view
+      - name: view
+`,
+		"undeclared role scope": `
+resource_types:
+  - name: openshift.io/resource/space
+    scopes:
+      - name: view
+    roles:
+      - name: contributor
+        scopes: [view, contribute]
+`,
+	}
+	for name, model := range invalidModels {
+		t.Run(name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "authorization-model")
+			require.Nil(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(model)
+			require.Nil(t, err)
+			require.Nil(t, f.Close())
+
+			_, err = configuration.NewConfigurationDataWithAuthorizationModel("", "", "", f.Name())
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestLoadAuthorizationModelWithoutResourceTypes(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	f, err := ioutil.TempFile("", "authorization-model")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# no resource types declared\n")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	modelConfig, err := configuration.NewConfigurationDataWithAuthorizationModel("", "", "", f.Name())
+	require.Nil(t, err)
+	checkAuthorizationModel(t, modelConfig.GetAuthorizationResourceTypes())
+}
+
+func TestLoadAuthorizationModelWithEmptyResourceTypes(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	f, err := ioutil.TempFile("", "authorization-model")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("resource_types: []\n")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	modelConfig, err := configuration.NewConfigurationDataWithAuthorizationModel("", "", "", f.Name())
+	require.Nil(t, err)
+	assert.Empty(t, modelConfig.GetAuthorizationResourceTypes())
+}
+
+func checkAuthorizationModel(t *testing.T, resourceTypes []configuration.ResourceTypeConfig) {
+	var space *configuration.ResourceTypeConfig
+	for i := range resourceTypes {
+		if resourceTypes[i].Name == "openshift.io/resource/space" {
+			space = &resourceTypes[i]
+		}
+	}
+	require.NotNil(t, space)
+	require.Len(t, space.Scopes, 3)
+	assert.Equal(t, "view", space.Scopes[0].Name)
+	assert.Contains(t, space.Roles, configuration.RoleConfig{Name: "contributor", Scopes: []string{"view", "contribute"}})
+}
+
+func TestLoadDefaultServiceAccountKeyRing(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	assert.Empty(t, config.GetServiceAccountKeyRing())
+}
+
+func TestLoadServiceAccountKeyRingFromMainConfiguration(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+serviceaccount.keyring.keys:
+  - kid: key-2018-04
+    private_key: private key of April
+    not_before: 2018-04-01T00:00:00Z
+    retire_after: 2018-10-01T00:00:00Z
+  - kid: key-2018-07
+    private_key: private key of July
+    not_before: 2018-07-01T00:00:00Z
+`)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	keyRingConfig, err := configuration.NewConfigurationData(f.Name(), "", "")
+	require.Nil(t, err)
+	keys := keyRingConfig.GetServiceAccountKeyRing()
+	require.Len(t, keys, 2)
+	assert.Equal(t, configuration.ServiceAccountKey{
+		KeyID:       "key-2018-04",
+		PrivateKey:  []byte("private key of April"),
+		NotBefore:   time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC),
+		RetireAfter: time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC),
+	}, keys[0])
+	assert.Equal(t, "key-2018-07", keys[1].KeyID)
+	assert.True(t, keys[1].RetireAfter.IsZero())
+}
+
+func TestLoadServiceAccountPrivateKeyRetirement(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	assert.True(t, config.GetServiceAccountPrivateKeyRetireAfter().IsZero())
+	assert.True(t, config.GetDeprecatedServiceAccountPrivateKeyRetireAfter().IsZero())
+
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+serviceaccount.privatekey.retireafter: 2018-10-01T00:00:00Z
+serviceaccount.privatekey.retireafter.deprecated: 2018-07-01T00:00:00Z
+`)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	retirementConfig, err := configuration.NewConfigurationData(f.Name(), "", "")
+	require.Nil(t, err)
+	assert.Equal(t, time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC), retirementConfig.GetServiceAccountPrivateKeyRetireAfter())
+	assert.Equal(t, time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC), retirementConfig.GetDeprecatedServiceAccountPrivateKeyRetireAfter())
+}
+
+func TestLoadServiceAccountKeyRingFromDirectory(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	dir, err := ioutil.TempDir("", "keyring")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(dir+"/key-2018-04.yaml", []byte(`
+kid: key-2018-04
+private_key: private key of April
+not_before: 2018-04-01T00:00:00Z
+`), 0600)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(dir+"/README", []byte("not a key"), 0600)
+	require.Nil(t, err)
+
+	envKey := generateEnvKey("serviceaccount.keyring.dir")
+	realEnvValue := os.Getenv(envKey)
+	defer func() {
+		os.Setenv(envKey, realEnvValue)
+		resetConfiguration()
+	}()
+	os.Setenv(envKey, dir)
+	resetConfiguration()
+
+	keys := config.GetServiceAccountKeyRing()
+	require.Len(t, keys, 1)
+	assert.Equal(t, "key-2018-04", keys[0].KeyID)
+	assert.Equal(t, []byte("private key of April"), keys[0].PrivateKey)
+	assert.Equal(t, time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC), keys[0].NotBefore)
+
+	// the keys added to the directory are loaded without restarting the service
+	err = ioutil.WriteFile(dir+"/key-2018-07.json", []byte(`{"kid": "key-2018-07", "private_key": "private key of July"}`), 0600)
+	require.Nil(t, err)
+	keys, err = config.LoadServiceAccountKeyRing()
+	require.Nil(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "key-2018-07", keys[1].KeyID)
+}
+
+func TestLoadInvalidServiceAccountKeyRingFails(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	invalidKeyRings := map[string]string{
+		"missing private key": `
+serviceaccount.keyring.keys:
+  - kid: key-2018-04
+`,
+		"duplicate key": `
+serviceaccount.keyring.keys:
+  - kid: key-2018-04
+    private_key: private key of April
+  - kid: key-2018-04
+    private_key: private key of April
+`,
+		"invalid time": `
+serviceaccount.keyring.keys:
+  - kid: key-2018-04
+    private_key: private key of April
+    not_before: April 2018
+`,
+		"retired before used": `
+serviceaccount.keyring.keys:
+  - kid: key-2018-04
+    private_key: private key of April
+    not_before: 2018-04-01T00:00:00Z
+    retire_after: 2018-03-01T00:00:00Z
+`,
+	}
+	for name, keyRing := range invalidKeyRings {
+		t.Run(name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "config")
+			require.Nil(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(keyRing)
+			require.Nil(t, err)
+			require.Nil(t, f.Close())
+
+			_, err = configuration.NewConfigurationData(f.Name(), "", "")
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestGitLabAndBitbucketNotConfiguredByDefault(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	assert.Equal(t, "https://gitlab.com", config.GetGitLabURL())
+	assert.Empty(t, config.GetGitLabClientID())
+	assert.Equal(t, "api read_user", config.GetGitLabClientDefaultScopes())
+	assert.Empty(t, config.GetBitbucketClientID())
+	assert.Equal(t, "account repository pullrequest", config.GetBitbucketClientDefaultScopes())
+}
+
+func TestLoadDefaultExternalProviders(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	assert.Empty(t, config.GetExternalProviders())
+}
+
+func TestLoadExternalProvidersFromFile(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	f, err := ioutil.TempFile("", "config")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: gitea
+    type: generic-oauth2
+    resource_url_pattern: ^https://gitea\.example\.com/
+    auth_url: https://gitea.example.com/login/oauth/authorize
+    token_url: https://gitea.example.com/login/oauth/access_token
+    profile_url: https://gitea.example.com/api/v1/user
+    client_id: gitea-client
+    client_secret: gitea-secret
+    scopes: read:user
+    username_path: $.login
+  - id: 8b8a0a4e-1f55-4b36-8a57-3d6f0c9c2e44
+    name: corporate-sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	providersConfig, err := configuration.NewConfigurationData(f.Name(), "", "")
+	require.Nil(t, err)
+	providers := providersConfig.GetExternalProviders()
+	require.Len(t, providers, 2)
+	assert.Equal(t, "gitea", providers[0].Name)
+	assert.Equal(t, configuration.ExternalProviderTypeOAuth2, providers[0].Type)
+	assert.Equal(t, "https://gitea.example.com/api/v1/user", providers[0].ProfileURL)
+	assert.Equal(t, "gitea-secret", providers[0].ClientSecret)
+	assert.Equal(t, "read:user", providers[0].Scopes)
+	assert.Equal(t, "$.login", providers[0].UsernamePath)
+	assert.True(t, providers[0].MatchesResource("https://gitea.example.com/org/repo"))
+	assert.False(t, providers[0].MatchesResource("https://github.com/org/repo"))
+	// the defaults of OpenID Connect are used
+	assert.Equal(t, "https://sso.example.com", providers[1].Issuer)
+	assert.Equal(t, "openid profile", providers[1].Scopes)
+	assert.Equal(t, "$.preferred_username", providers[1].UsernamePath)
+	assert.True(t, providers[1].MatchesResource("https://apps.example.com/"))
+}
+
+func TestLoadInvalidExternalProvidersFails(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	invalidProviders := map[string]string{
+		"reserved name": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: github
+    type: generic-oidc
+    resource_url_pattern: ^https://github\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"reserved ID": fmt.Sprintf(`
+externalproviders:
+  - id: %s
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`, link.GitHubProviderID),
+		"reserved GitLab ID": fmt.Sprintf(`
+externalproviders:
+  - id: %s
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`, link.GitLabProviderID),
+		"reserved Bitbucket ID": fmt.Sprintf(`
+externalproviders:
+  - id: %s
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`, link.BitbucketProviderID),
+		"reserved GitLab name": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: gitlab
+    type: generic-oidc
+    resource_url_pattern: ^https://gitlab\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"reserved Bitbucket name": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: bitbucket
+    type: generic-oidc
+    resource_url_pattern: ^https://bitbucket\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"duplicate name": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+  - id: 8b8a0a4e-1f55-4b36-8a57-3d6f0c9c2e44
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://other\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"invalid ID": `
+externalproviders:
+  - id: sso
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"duplicate ID": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: other-sso
+    type: generic-oidc
+    resource_url_pattern: ^https://other\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"invalid resource URL pattern": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://(apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"missing client ID": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+`,
+		"unknown type": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: saml
+    resource_url_pattern: ^https://apps\.example\.com/
+    issuer: https://sso.example.com
+    client_id: sso-client
+`,
+		"OAuth2 without endpoints": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: gitea
+    type: generic-oauth2
+    resource_url_pattern: ^https://gitea\.example\.com/
+    auth_url: https://gitea.example.com/login/oauth/authorize
+    client_id: gitea-client
+    username_path: $.login
+`,
+		"OpenID Connect without issuer": `
+externalproviders:
+  - id: 2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11
+    name: sso
+    type: generic-oidc
+    resource_url_pattern: ^https://apps\.example\.com/
+    client_id: sso-client
+`,
+	}
+	for name, providers := range invalidProviders {
+		t.Run(name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "config")
+			require.Nil(t, err)
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(providers)
+			require.Nil(t, err)
+			require.Nil(t, f.Close())
+
+			_, err = configuration.NewConfigurationData(f.Name(), "", "")
+			require.NotNil(t, err)
+		})
+	}
+}
+
 func TestIsTLSInsecureSkipVerifySetToFalse(t *testing.T) {
 	resource.Require(t, resource.UnitTest)
 	require.False(t, config.IsTLSInsecureSkipVerify())
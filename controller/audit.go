@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token"
+
+	"github.com/goadesign/goa"
+)
+
+// AuditController implements the audit resource.
+type AuditController struct {
+	*goa.Controller
+	db application.DB
+}
+
+// NewAuditController creates an audit controller.
+func NewAuditController(service *goa.Service, db application.DB) *AuditController {
+	return &AuditController{Controller: service.NewController("AuditController"), db: db}
+}
+
+// ListEvents returns the events of the audit log matching the filters, most recent first.
+func (c *AuditController) ListEvents(ctx *app.ListEventsAuditContext) error {
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, nil, "the audit log can only be queried by service accounts")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	filter := audit.Filter{
+		From: ctx.From,
+		To:   ctx.To,
+	}
+	if ctx.Actor != nil {
+		filter.ActorID = *ctx.Actor
+	}
+	if ctx.Action != nil {
+		filter.Action = *ctx.Action
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("to", filter.To.String()).Expected("a time after 'from'"))
+	}
+	offset, limit := computePagingLimits(ctx.PageOffset, ctx.PageLimit)
+	var events []audit.Event
+	err := application.Transactional(c.db, func(appl application.Application) error {
+		var err error
+		events, err = appl.AuditEvents().List(ctx, filter, offset, limit)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	res := app.AuditEventCollection{}
+	for _, event := range events {
+		res = append(res, convertAuditEvent(event))
+	}
+	return ctx.OK(res)
+}
+
+func convertAuditEvent(event audit.Event) *app.AuditEvent {
+	res := &app.AuditEvent{
+		ID:        event.ID,
+		Subject:   &event.Subject,
+		Action:    event.Action,
+		Outcome:   event.Outcome,
+		ClientIP:  &event.ClientIP,
+		RequestID: &event.RequestID,
+		Details:   event.Details,
+		CreatedAt: event.CreatedAt,
+	}
+	if event.ActorID.Valid {
+		res.ActorID = &event.ActorID.UUID
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+package controller_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	"github.com/fabric8-services/fabric8-auth/audit"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestAuditREST struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunAuditREST(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &TestAuditREST{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (rest *TestAuditREST) SecuredController() (*goa.Service, *AuditController) {
+	svc := testsupport.ServiceAsServiceAccountUser("Audit-Service", account.Identity{ID: uuid.NewV4(), Username: "fabric8-tenant"})
+	return svc, NewAuditController(svc, rest.Application)
+}
+
+func (rest *TestAuditREST) TestListEventsOK() {
+	// given
+	actorID := uuid.NewV4()
+	repo := rest.Application.AuditEvents()
+	require.Nil(rest.T(), audit.Record(rest.Ctx, repo, audit.Login, actorID, "jdoe", audit.Success, audit.Details{"result": "success"}))
+	require.Nil(rest.T(), audit.Record(rest.Ctx, repo, audit.ExternalTokenDelete, actorID, "github", audit.Failure, nil))
+	svc, ctrl := rest.SecuredController()
+	action := audit.Login
+	// when
+	_, events := test.ListEventsAuditOK(rest.T(), svc.Context, svc, ctrl, &action, &actorID, nil, nil, nil, nil)
+	// then
+	require.Len(rest.T(), events, 1)
+	assert.Equal(rest.T(), actorID, *events[0].ActorID)
+	assert.Equal(rest.T(), audit.Login, events[0].Action)
+	assert.Equal(rest.T(), audit.Success, events[0].Outcome)
+	assert.Equal(rest.T(), "jdoe", *events[0].Subject)
+	assert.Equal(rest.T(), "success", events[0].Details["result"])
+
+	// all the actions of the actor
+	_, events = test.ListEventsAuditOK(rest.T(), svc.Context, svc, ctrl, nil, &actorID, nil, nil, nil, nil)
+	assert.Len(rest.T(), events, 2)
+
+	// no event recorded in the future
+	from := time.Now().Add(time.Hour)
+	_, events = test.ListEventsAuditOK(rest.T(), svc.Context, svc, ctrl, nil, &actorID, &from, nil, nil, nil)
+	assert.Empty(rest.T(), events)
+}
+
+func (rest *TestAuditREST) TestListEventsWithInvalidTimeRangeBadRequest() {
+	svc, ctrl := rest.SecuredController()
+	from := time.Now()
+	to := from.Add(-time.Hour)
+	test.ListEventsAuditBadRequest(rest.T(), svc.Context, svc, ctrl, nil, nil, &from, nil, nil, &to)
+}
+
+func (rest *TestAuditREST) TestListEventsNotServiceAccountUnauthorized() {
+	identity, err := testsupport.CreateTestIdentity(rest.DB, "TestListAuditEvents-"+uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	svc := testsupport.ServiceAsUser("Audit-Service", identity)
+	ctrl := NewAuditController(svc, rest.Application)
+	test.ListEventsAuditUnauthorized(rest.T(), svc.Context, svc, ctrl, nil, nil, nil, nil, nil, nil)
+}
@@ -2,23 +2,29 @@ package controller
 
 import (
 	"context"
-	"errors"
-	"strings"
 
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
-	autherrors "github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
-	"github.com/fabric8-services/fabric8-auth/space/authz"
+	"github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
 
 	"github.com/goadesign/goa"
 	uuid "github.com/satori/go.uuid"
 )
 
 // CollaboratorsController implements the collaborators resource.
+// The collaborators are stored as contributor role assignments. The collaborators of a space which have not been
+// imported from Keycloak yet are imported from the Keycloak policy of the space on first access.
+// The changes are recorded in the outbox, which keeps the Keycloak policies in sync as long as WIT
+// authorizes the space operations with the RPTs issued by Keycloak.
 type CollaboratorsController struct {
 	*goa.Controller
 	db            application.DB
@@ -27,7 +33,6 @@ type CollaboratorsController struct {
 }
 
 type collaboratorsConfiguration interface {
-	GetKeycloakEndpointEntitlement(*goa.RequestData) (string, error)
 	GetCacheControlCollaborators() string
 }
 
@@ -43,64 +48,63 @@ func NewCollaboratorsController(service *goa.Service, db application.DB, config
 
 // List collaborators for the given space ID.
 func (c *CollaboratorsController) List(ctx *app.ListCollaboratorsContext) error {
-	policy, _, err := c.getPolicy(ctx, ctx.RequestData, ctx.SpaceID)
-	if err != nil {
-		return jsonapi.JSONErrorResponse(ctx, err)
-	}
-	userIDs := policy.Config.UserIDs
-	//UsersIDs format : "[\"<ID>\",\"<ID>\"]"
-	s := strings.Split(userIDs, ",")
-	count := len(s)
-
 	offset, limit := computePagingLimits(ctx.PageOffset, ctx.PageLimit)
 
-	pageOffset := offset
-	pageLimit := offset + limit
-	if offset > len(s) {
-		pageOffset = len(s)
-	}
-	if offset+limit > len(s) {
-		pageLimit = len(s)
+	err := collaborator.ImportPolicy(ctx, c.db, c.policyManager, ctx.RequestData, ctx.SpaceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
 	}
-	page := s[pageOffset:pageLimit]
-	resultIdentities := make([]account.Identity, len(page))
-	resultUsers := make([]account.User, len(page))
-	for i, id := range page {
-		id = strings.Trim(id, "[]\"")
-		uID, err := uuid.FromString(id)
+	var count int
+	var resultIdentities []account.Identity
+	var resultUsers []account.User
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		res, err := collaborator.LoadSpaceResource(ctx, appl, ctx.SpaceID)
 		if err != nil {
-			log.Error(ctx, map[string]interface{}{
-				"identity_id": id,
-				"users-ids":   userIDs,
-			}, "unable to convert the identity ID to uuid v4")
-			return jsonapi.JSONErrorResponse(ctx, goa.ErrInternal(err.Error()))
+			return err
 		}
-		err = application.Transactional(c.db, func(appl application.Application) error {
-			identities, err := appl.Identities().Query(account.IdentityFilterByID(uID), account.IdentityWithUser())
+		identityIDs, err := collaborator.List(ctx, appl, res)
+		if err != nil {
+			return err
+		}
+		count = len(identityIDs)
+
+		pageOffset := offset
+		pageLimit := offset + limit
+		if offset > count {
+			pageOffset = count
+		}
+		if offset+limit > count {
+			pageLimit = count
+		}
+		page := identityIDs[pageOffset:pageLimit]
+		resultIdentities = make([]account.Identity, len(page))
+		resultUsers = make([]account.User, len(page))
+		for i, id := range page {
+			identities, err := appl.Identities().Query(account.IdentityFilterByID(id), account.IdentityWithUser())
 			if err != nil {
 				log.Error(ctx, map[string]interface{}{
 					"identity_id": id,
 					"err":         err,
-				}, "unable to find the identity listed in the space policy")
-				return err
+				}, "unable to find the identity listed in the space collaborators")
+				return errors.NewInternalError(ctx, err)
 			}
 			if len(identities) == 0 {
 				log.Error(ctx, map[string]interface{}{
 					"identity_id": id,
-				}, "unable to find the identity listed in the space policy")
-				return errors.New("Identity listed in the space policy not found")
+				}, "unable to find the identity listed in the space collaborators")
+				return errors.NewInternalErrorFromString(ctx, "identity listed in the space collaborators not found")
 			}
 			resultIdentities[i] = identities[0]
 			resultUsers[i] = identities[0].User
-			return nil
-		})
-		if err != nil {
-			return jsonapi.JSONErrorResponse(ctx, goa.ErrInternal(err.Error()))
 		}
+		return nil
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
 	}
 
 	return ctx.ConditionalEntities(resultUsers, c.config.GetCacheControlCollaborators, func() error {
-		data := make([]*app.UserData, len(page))
+		data := make([]*app.UserData, len(resultUsers))
 		for i := range resultUsers {
 			appUser := ConvertToAppUser(ctx.RequestData, &resultUsers[i], &resultIdentities[i])
 			data[i] = appUser.Data
@@ -110,7 +114,7 @@ func (c *CollaboratorsController) List(ctx *app.ListCollaboratorsContext) error
 			Meta:  &app.UserListMeta{TotalCount: count},
 			Data:  data,
 		}
-		setPagingLinks(response.Links, buildAbsoluteURL(ctx.RequestData), len(page), offset, limit, count)
+		setPagingLinks(response.Links, buildAbsoluteURL(ctx.RequestData), len(resultUsers), offset, limit, count)
 		return ctx.OK(&response)
 	})
 }
@@ -118,7 +122,7 @@ func (c *CollaboratorsController) List(ctx *app.ListCollaboratorsContext) error
 // Add user's identity to the list of space collaborators.
 func (c *CollaboratorsController) Add(ctx *app.AddCollaboratorsContext) error {
 	identityIDs := []*app.UpdateUserID{{ID: ctx.IdentityID}}
-	err := c.updatePolicy(ctx, ctx.RequestData, ctx.SpaceID, identityIDs, c.policyManager.AddUserToPolicy)
+	err := c.updateCollaborators(ctx, ctx.RequestData, ctx.SpaceID, identityIDs, addCollaborator, audit.CollaboratorAdd)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -128,7 +132,7 @@ func (c *CollaboratorsController) Add(ctx *app.AddCollaboratorsContext) error {
 // AddMany adds user's identities to the list of space collaborators.
 func (c *CollaboratorsController) AddMany(ctx *app.AddManyCollaboratorsContext) error {
 	if ctx.Payload != nil && ctx.Payload.Data != nil {
-		err := c.updatePolicy(ctx, ctx.RequestData, ctx.SpaceID, ctx.Payload.Data, c.policyManager.AddUserToPolicy)
+		err := c.updateCollaborators(ctx, ctx.RequestData, ctx.SpaceID, ctx.Payload.Data, addCollaborator, audit.CollaboratorAdd)
 		if err != nil {
 			return jsonapi.JSONErrorResponse(ctx, err)
 		}
@@ -139,7 +143,7 @@ func (c *CollaboratorsController) AddMany(ctx *app.AddManyCollaboratorsContext)
 // Remove user from the list of space collaborators.
 func (c *CollaboratorsController) Remove(ctx *app.RemoveCollaboratorsContext) error {
 	identityIDs := []*app.UpdateUserID{{ID: ctx.IdentityID}}
-	err := c.updatePolicy(ctx, ctx.RequestData, ctx.SpaceID, identityIDs, c.policyManager.RemoveUserFromPolicy)
+	err := c.updateCollaborators(ctx, ctx.RequestData, ctx.SpaceID, identityIDs, removeCollaborator, audit.CollaboratorRemove)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -149,7 +153,7 @@ func (c *CollaboratorsController) Remove(ctx *app.RemoveCollaboratorsContext) er
 // RemoveMany removes users from the list of space collaborators.
 func (c *CollaboratorsController) RemoveMany(ctx *app.RemoveManyCollaboratorsContext) error {
 	if ctx.Payload != nil && ctx.Payload.Data != nil {
-		err := c.updatePolicy(ctx, ctx.RequestData, ctx.SpaceID, ctx.Payload.Data, c.policyManager.RemoveUserFromPolicy)
+		err := c.updateCollaborators(ctx, ctx.RequestData, ctx.SpaceID, ctx.Payload.Data, removeCollaborator, audit.CollaboratorRemove)
 		if err != nil {
 			return jsonapi.JSONErrorResponse(ctx, err)
 		}
@@ -158,116 +162,145 @@ func (c *CollaboratorsController) RemoveMany(ctx *app.RemoveManyCollaboratorsCon
 	return ctx.OK([]byte{})
 }
 
-func (c *CollaboratorsController) updatePolicy(ctx collaboratorContext, req *goa.RequestData, spaceID uuid.UUID, identityIDs []*app.UpdateUserID, update func(policy *auth.KeycloakPolicy, identityID string) bool) error {
-	// Authorize current user
-	authorized, err := authz.Authorize(ctx, spaceID.String())
+// addCollaborator adds the identity to the space collaborators and records the change in the outbox
+func addCollaborator(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error) {
+	added, err := collaborator.Add(ctx, appl, res, identityID)
+	if err != nil || !added {
+		return added, err
+	}
+	err = outbox.RecordEvent(ctx, appl.OutboxEvents(), outbox.SpaceCollaboratorAdded, identityID, outbox.SpaceCollaborator{
+		SpaceID:    res.ResourceID,
+		IdentityID: identityID,
+	})
 	if err != nil {
-		return goa.ErrUnauthorized(err.Error())
+		return false, errors.NewInternalError(ctx, err)
+	}
+	return true, nil
+}
+
+// removeCollaborator removes the identity from the space collaborators unless it is the owner of the space,
+// and records the change in the outbox
+func removeCollaborator(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error) {
+	if uuid.Equal(res.OwnerID, identityID) {
+		return false, errors.NewBadParameterError("identity", identityID.String()).Expected("not the space owner")
 	}
-	if !authorized {
-		return goa.ErrUnauthorized("User not among space collaborators")
+	removed, err := collaborator.Remove(ctx, appl, res, identityID)
+	if err != nil || !removed {
+		return removed, err
 	}
+	err = outbox.RecordEvent(ctx, appl.OutboxEvents(), outbox.SpaceCollaboratorRemoved, identityID, outbox.SpaceCollaborator{
+		SpaceID:    res.ResourceID,
+		IdentityID: identityID,
+	})
+	if err != nil {
+		return false, errors.NewInternalError(ctx, err)
+	}
+	return true, nil
+}
+
+type collaboratorsUpdate func(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error)
 
-	// Update policy
-	policy, pat, err := c.getPolicy(ctx, req, spaceID)
+// updateCollaborators applies the update to all the given identities in a single transaction, once the collaborators
+// of the space have been imported from Keycloak. The transaction is retried once if a collaborator has been added concurrently.
+// The outcome of the update is recorded in the audit log for each identity with the given action.
+func (c *CollaboratorsController) updateCollaborators(ctx collaboratorContext, req *goa.RequestData, spaceID uuid.UUID, identityIDs []*app.UpdateUserID, update collaboratorsUpdate, action string) error {
+	currentIdentity, err := login.ContextIdentity(ctx)
 	if err != nil {
-		return err
+		return errors.NewUnauthorizedError(err.Error())
 	}
-	updated := false
+
+	// Parse all the identity IDs before touching the DB
+	var identityUUIDs []uuid.UUID
 	for _, identityIDData := range identityIDs {
 		if identityIDData != nil {
-			identityID := identityIDData.ID
-			identityUUID, err := uuid.FromString(identityID)
+			identityUUID, err := uuid.FromString(identityIDData.ID)
 			if err != nil {
 				log.Error(ctx, map[string]interface{}{
-					"identity_id": identityID,
+					"identity_id": identityIDData.ID,
 				}, "unable to convert the identity ID to uuid v4")
-				return goa.ErrBadRequest(err.Error())
-			}
-			var identity *account.Identity
-			var ownerID uuid.UUID
-			err = application.Transactional(c.db, func(appl application.Application) error {
-				identities, err := appl.Identities().Query(account.IdentityFilterByID(identityUUID), account.IdentityWithUser())
-				if err != nil {
-					log.Error(ctx, map[string]interface{}{
-						"identity_id": identityID,
-						"err":         err,
-					}, "unable to query for the identity")
-					return err
-				}
-				if len(identities) == 0 {
-					log.Error(ctx, map[string]interface{}{
-						"identity_id": identityID,
-					}, "unable to find the identity")
-					return autherrors.NewNotFoundError("identity", identityID)
-				}
-				identity = &identities[0]
-				resource, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
-				if err != nil {
-					return err
-				}
-				ownerID = resource.OwnerID
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-			updated = update(policy, identityID) || updated
-			if !strings.Contains(policy.Config.UserIDs, ownerID.String()) {
-				// Updated policy has no User IDs
-				return autherrors.NewBadParameterError("identity", identityID).Expected("not the space owner")
+				return errors.NewBadParameterError("identity", identityIDData.ID).Expected("a valid identity ID")
 			}
+			identityUUIDs = append(identityUUIDs, identityUUID)
 		}
 	}
-	if !updated {
-		// Nothing changed. No need to update
-		return nil
-	}
 
-	err = c.policyManager.UpdatePolicy(ctx, req, *policy, *pat)
-	if err != nil {
-		return goa.ErrInternal(err.Error())
+	err = collaborator.ImportPolicy(ctx, c.db, c.policyManager, req, spaceID)
+	if err == nil {
+		err = c.applyCollaboratorsUpdate(ctx, spaceID, *currentIdentity, identityUUIDs, update)
 	}
+	if conflict, _ := errors.IsVersionConflictError(err); conflict {
+		log.Warn(ctx, map[string]interface{}{
+			"space_id": spaceID,
+		}, "space collaborators updated concurrently. Retrying")
+		err = c.applyCollaboratorsUpdate(ctx, spaceID, *currentIdentity, identityUUIDs, update)
+	}
+	for _, identityID := range identityUUIDs {
+		// a failure to record the event must not change the response, so the error is only logged by the repository
+		audit.Record(ctx, c.db.AuditEvents(), action, *currentIdentity, identityID.String(), audit.OutcomeOf(err == nil), audit.Details{
+			"space_id": spaceID,
+		})
+	}
+	return err
+}
 
-	// We need to update the resource to triger RPT token refreshing when users try to access this space
-	err = application.Transactional(c.db, func(appl application.Application) error {
-		resource, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
-		_, err = appl.SpaceResources().Save(ctx, resource)
+// applyCollaboratorsUpdate updates the collaborators of the space in a single transaction
+func (c *CollaboratorsController) applyCollaboratorsUpdate(ctx collaboratorContext, spaceID uuid.UUID, currentIdentity uuid.UUID, identityIDs []uuid.UUID, update collaboratorsUpdate) error {
+	return application.Transactional(c.db, func(appl application.Application) error {
+		spaceResource, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
+		if err != nil {
+			return err
+		}
+		res, err := collaborator.LoadSpaceResource(ctx, appl, spaceID)
 		if err != nil {
-			log.Error(ctx, map[string]interface{}{
-				"resource":   resource,
-				"space_uuid": spaceID.String(),
-				"err":        err,
-			}, "unable to update the space resource")
 			return err
 		}
-		return nil
-	})
-	if err != nil {
-		return goa.ErrInternal(err.Error())
-	}
 
-	return nil
-}
+		// Authorize current user
+		authorized, err := collaborator.IsCollaborator(ctx, appl, res, currentIdentity)
+		if err != nil {
+			return err
+		}
+		if !authorized {
+			return errors.NewUnauthorizedError("user not among space collaborators")
+		}
+
+		updated := false
+		for _, identityID := range identityIDs {
+			identities, err := appl.Identities().Query(account.IdentityFilterByID(identityID))
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"identity_id": identityID,
+					"err":         err,
+				}, "unable to query for the identity")
+				return errors.NewInternalError(ctx, err)
+			}
+			if len(identities) == 0 {
+				log.Error(ctx, map[string]interface{}{
+					"identity_id": identityID,
+				}, "unable to find the identity")
+				return errors.NewNotFoundError("identity", identityID.String())
+			}
+			changed, err := update(ctx, appl, res, identityID)
+			if err != nil {
+				return err
+			}
+			updated = changed || updated
+		}
+		if !updated {
+			// Nothing changed. No need to update
+			return nil
+		}
 
-func (c *CollaboratorsController) getPolicy(ctx collaboratorContext, req *goa.RequestData, spaceID uuid.UUID) (*auth.KeycloakPolicy, *string, error) {
-	var policyID string
-	err := application.Transactional(c.db, func(appl application.Application) error {
-		// Load associated space resource
-		resource, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
+		// Touch the space resource so its update time is the time of the last change of the collaborators
+		_, err = appl.SpaceResources().Save(ctx, spaceResource)
 		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"resource":   spaceResource,
+				"space_uuid": spaceID.String(),
+				"err":        err,
+			}, "unable to update the space resource")
 			return err
 		}
-		policyID = resource.PolicyID
 		return nil
 	})
-
-	if err != nil {
-		return nil, nil, goa.ErrNotFound(err.Error())
-	}
-	policy, pat, err := c.policyManager.GetPolicy(ctx, req, policyID)
-	if err != nil {
-		return nil, nil, goa.ErrInternal(err.Error())
-	}
-	return policy, pat, nil
 }
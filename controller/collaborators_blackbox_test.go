@@ -2,7 +2,6 @@ package controller_test
 
 import (
 	"net/http"
-	"strings"
 	"testing"
 	"time"
 
@@ -12,13 +11,18 @@ import (
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/app/test"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormapplication"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/space"
 	"github.com/fabric8-services/fabric8-auth/space/authz"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
 	"github.com/goadesign/goa"
 	goajwt "github.com/goadesign/goa/middleware/security/jwt"
@@ -32,52 +36,14 @@ const (
 	idnType = "identities"
 )
 
-type DummyPolicyManager struct {
-	rest *TestCollaboratorsREST
-}
-
-type DummySpaceAuthzService struct {
-	rest *TestCollaboratorsREST
-}
-
-func (s *DummySpaceAuthzService) Authorize(ctx context.Context, endpoint string, spaceID string) (bool, error) {
-	jwtToken := goajwt.ContextJWT(ctx)
-	if jwtToken == nil {
-		return false, errors.NewUnauthorizedError("Missing token")
-	}
-	id := jwtToken.Claims.(token.MapClaims)["sub"].(string)
-	return strings.Contains(s.rest.policy.Config.UserIDs, id), nil
-}
-
-func (s *DummySpaceAuthzService) Configuration() authz.AuthzConfiguration {
-	return nil
-}
-
-func (m *DummyPolicyManager) GetPolicy(ctx context.Context, request *goa.RequestData, policyID string) (*auth.KeycloakPolicy, *string, error) {
-	pat := ""
-	return m.rest.policy, &pat, nil
-}
-
-func (m *DummyPolicyManager) UpdatePolicy(ctx context.Context, request *goa.RequestData, policy auth.KeycloakPolicy, pat string) error {
-	return nil
-}
-
-func (m *DummyPolicyManager) AddUserToPolicy(p *auth.KeycloakPolicy, userID string) bool {
-	return p.AddUserToPolicy(userID)
-}
-
-func (m *DummyPolicyManager) RemoveUserFromPolicy(p *auth.KeycloakPolicy, userID string) bool {
-	return p.RemoveUserFromPolicy(userID)
-}
-
 type TestCollaboratorsREST struct {
 	gormtestsupport.DBTestSuite
 
-	policy        *auth.KeycloakPolicy
 	testIdentity1 account.Identity
 	testIdentity2 account.Identity
 	testIdentity3 account.Identity
 	spaceID       uuid.UUID
+	policyManager *DummyPolicyManager
 }
 
 func TestRunCollaboratorsREST(t *testing.T) {
@@ -87,12 +53,6 @@ func TestRunCollaboratorsREST(t *testing.T) {
 
 func (rest *TestCollaboratorsREST) SetupTest() {
 	rest.DBTestSuite.SetupTest()
-	rest.policy = &auth.KeycloakPolicy{
-		Name:             "TestCollaborators-" + uuid.NewV4().String(),
-		Type:             auth.PolicyTypeUser,
-		Logic:            auth.PolicyLogicPossitive,
-		DecisionStrategy: auth.PolicyDecisionStrategyUnanimous,
-	}
 	testIdentity, err := testsupport.CreateTestIdentity(rest.DB, "TestCollaborators-"+uuid.NewV4().String(), "TestCollaborators")
 	require.Nil(rest.T(), err)
 	rest.testIdentity1 = testIdentity
@@ -102,17 +62,22 @@ func (rest *TestCollaboratorsREST) SetupTest() {
 	testIdentity, err = testsupport.CreateTestIdentity(rest.DB, "TestCollaborators-"+uuid.NewV4().String(), "TestCollaborators")
 	require.Nil(rest.T(), err)
 	rest.testIdentity3 = testIdentity
+	rest.policyManager = &DummyPolicyManager{policies: map[string]*auth.KeycloakPolicy{}}
 	rest.spaceID = rest.createSpace()
 }
 
 func (rest *TestCollaboratorsREST) SecuredController() (*goa.Service, *CollaboratorsController) {
-	svc := testsupport.ServiceAsSpaceUser("Collaborators-Service", rest.testIdentity1, &DummySpaceAuthzService{rest})
-	return svc, NewCollaboratorsController(svc, rest.Application, rest.Configuration, &DummyPolicyManager{rest: rest})
+	return rest.SecuredControllerWithIdentity(rest.testIdentity1)
+}
+
+func (rest *TestCollaboratorsREST) SecuredControllerWithIdentity(identity account.Identity) (*goa.Service, *CollaboratorsController) {
+	svc := testsupport.ServiceAsUser("Collaborators-Service", identity)
+	return svc, NewCollaboratorsController(svc, rest.Application, rest.Configuration, rest.policyManager)
 }
 
 func (rest *TestCollaboratorsREST) UnSecuredController() (*goa.Service, *CollaboratorsController) {
 	svc := goa.New("Collaborators-Service")
-	return svc, NewCollaboratorsController(svc, rest.Application, rest.Configuration, &DummyPolicyManager{rest: rest})
+	return svc, NewCollaboratorsController(svc, rest.Application, rest.Configuration, rest.policyManager)
 }
 
 func (rest *TestCollaboratorsREST) TestListCollaboratorsWithRandomSpaceIDNotFound() {
@@ -121,18 +86,70 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsWithRandomSpaceIDNotFoun
 	test.ListCollaboratorsNotFound(rest.T(), svc.Context, svc, ctrl, uuid.NewV4(), nil, nil, nil, nil)
 }
 
+func (rest *TestCollaboratorsREST) TestListCollaboratorsOfNotImportedSpaceOK() {
+	// given a space whose collaborators have not been imported from Keycloak yet
+	svc, ctrl := rest.UnSecuredController()
+	spaceID := rest.createNotImportedSpace(rest.testIdentity2.ID)
+	// when
+	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, spaceID, nil, nil, nil, nil)
+	// then the collaborators are imported from the Keycloak policy
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
+}
+
+func (rest *TestCollaboratorsREST) TestAddCollaboratorsToNotImportedSpaceOK() {
+	// given a space whose collaborators have not been imported from Keycloak yet
+	svc, ctrl := rest.SecuredController()
+	spaceID := rest.createNotImportedSpace(rest.testIdentity2.ID)
+	// when
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, spaceID, rest.testIdentity3.ID.String())
+	// then
+	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID, rest.testIdentity3.ID}, actualUsers)
+}
+
+func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsFromNotImportedSpaceOK() {
+	// given a space whose collaborators have not been imported from Keycloak yet
+	svc, ctrl := rest.SecuredController()
+	spaceID := rest.createNotImportedSpace(rest.testIdentity2.ID)
+	// when
+	test.RemoveCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, spaceID, rest.testIdentity2.ID.String())
+	// then
+	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
+}
+
+// createNotImportedSpace creates a space owned by the first test identity whose collaborators are only stored in its Keycloak policy
+func (rest *TestCollaboratorsREST) createNotImportedSpace(collaboratorIDs ...uuid.UUID) uuid.UUID {
+	policyID := uuid.NewV4().String()
+	policy := &auth.KeycloakPolicy{ID: &policyID}
+	policy.AddUserToPolicy(rest.testIdentity1.ID.String())
+	for _, collaboratorID := range collaboratorIDs {
+		policy.AddUserToPolicy(collaboratorID.String())
+	}
+	rest.policyManager.policies[policyID] = policy
+	spaceResource := &space.Resource{
+		ResourceID:   uuid.NewV4().String(),
+		PolicyID:     policyID,
+		PermissionID: uuid.NewV4().String(),
+		SpaceID:      uuid.NewV4(),
+		OwnerID:      rest.testIdentity1.ID,
+	}
+	_, err := rest.Application.SpaceResources().Create(rest.Ctx, spaceResource)
+	require.Nil(rest.T(), err)
+	return spaceResource.SpaceID
+}
+
 func (rest *TestCollaboratorsREST) TestListCollaboratorsOK() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	res, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
 	assertResponseHeaders(rest.T(), res)
 	// given
-	rest.policy.RemoveUserFromPolicy(rest.testIdentity2.ID.String())
+	rest.removeCollaborator(rest.testIdentity2.ID)
 	// when
 	res, actualUsers = test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
@@ -143,9 +160,8 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsOK() {
 func (rest *TestCollaboratorsREST) TestListCollaboratorsByPagesOK() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity3.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
+	rest.addCollaborator(rest.testIdentity3.ID)
 	offset := "0"
 	limit := 3
 	// when
@@ -203,8 +219,7 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsByPagesOK() {
 func (rest *TestCollaboratorsREST) TestListCollaboratorsOKUsingExpiredIfModifiedSinceHeader() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	ifModifiedSince := app.ToHTTPTime(rest.testIdentity1.User.UpdatedAt.Add(-1 * time.Hour))
 	res, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, &ifModifiedSince, nil)
@@ -216,8 +231,7 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsOKUsingExpiredIfModified
 func (rest *TestCollaboratorsREST) TestListCollaboratorsOKUsingExpiredIfNoneMatchHeader() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	ifNoneMatch := "foo"
 	res, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, &ifNoneMatch)
@@ -229,8 +243,7 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsOKUsingExpiredIfNoneMatc
 func (rest *TestCollaboratorsREST) TestListCollaboratorsNotModifiedUsingIfModifiedSinceHeader() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	ifModifiedSince := app.ToHTTPTime(rest.testIdentity1.UpdatedAt)
 	res := test.ListCollaboratorsNotModified(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, &ifModifiedSince, nil)
@@ -241,8 +254,7 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsNotModifiedUsingIfModifi
 func (rest *TestCollaboratorsREST) TestListCollaboratorsNotModifiedUsingIfNoneMatchHeader() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	ifNoneMatch := app.GenerateEntitiesTag([]app.ConditionalRequestEntity{
 		rest.testIdentity1.User,
@@ -255,14 +267,12 @@ func (rest *TestCollaboratorsREST) TestListCollaboratorsNotModifiedUsingIfNoneMa
 
 func (rest *TestCollaboratorsREST) TestAddCollaboratorsWithRandomSpaceIDNotFound() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	test.AddCollaboratorsNotFound(rest.T(), svc.Context, svc, ctrl, uuid.NewV4(), uuid.NewV4().String())
 }
 
 func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsWithRandomSpaceIDNotFound() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	payload := &app.AddManyCollaboratorsPayload{Data: []*app.UpdateUserID{}}
 	test.AddManyCollaboratorsNotFound(rest.T(), svc.Context, svc, ctrl, uuid.NewV4(), payload)
@@ -270,7 +280,6 @@ func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsWithRandomSpaceIDNotF
 
 func (rest *TestCollaboratorsREST) TestAddCollaboratorsWithWrongUserIDFormatReturnsBadRequest() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	// when/then
 	test.AddCollaboratorsBadRequest(rest.T(), svc.Context, svc, ctrl, rest.spaceID, "wrongFormatID")
@@ -278,7 +287,6 @@ func (rest *TestCollaboratorsREST) TestAddCollaboratorsWithWrongUserIDFormatRetu
 
 func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsWithWrongUserIDFormatReturnsBadRequest() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	payload := &app.AddManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: "wrongFormatID", Type: idnType}}}
 	// when/then
@@ -291,15 +299,12 @@ func (rest *TestCollaboratorsREST) TestAddCollaboratorsOk() {
 	require.Nil(rest.T(), err)
 
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	// when
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 	// given
 	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
 	// when
 	_, actualUsers = test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
@@ -308,6 +313,8 @@ func (rest *TestCollaboratorsREST) TestAddCollaboratorsOk() {
 	updatedResource, err := appl.SpaceResources().LoadBySpace(context.Background(), &rest.spaceID)
 	require.Nil(rest.T(), err)
 	require.True(rest.T(), resource.UpdatedAt.Before(updatedResource.UpdatedAt))
+	// the change is recorded in the audit log
+	rest.checkAuditEvent(rest.testIdentity1.ID, audit.CollaboratorAdd, rest.testIdentity2.ID, audit.Success)
 }
 
 func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsOk() {
@@ -316,7 +323,6 @@ func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsOk() {
 	resource, err := appl.SpaceResources().LoadBySpace(context.Background(), &rest.spaceID)
 	require.Nil(rest.T(), err)
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	// when
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
@@ -324,9 +330,6 @@ func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsOk() {
 	// given
 	payload := &app.AddManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity1.ID.String(), Type: idnType}, {ID: rest.testIdentity2.ID.String(), Type: idnType}, {ID: rest.testIdentity3.ID.String(), Type: idnType}}}
 	test.AddManyCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, payload)
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity3.ID.String())
 	// when
 	_, actualUsers = test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
@@ -353,23 +356,34 @@ func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsUnauthorizedIfNoToken
 
 func (rest *TestCollaboratorsREST) TestAddCollaboratorsUnauthorizedIfCurrentUserIsNotCollaborator() {
 	// given
-	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	svc, ctrl := rest.SecuredControllerWithIdentity(rest.testIdentity3)
+	rest.addCollaborator(rest.testIdentity2.ID)
 	// when
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	// then
-	rest.checkCollaborators([]uuid.UUID{rest.testIdentity2.ID}, actualUsers)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
 	// when/then
-	test.AddCollaboratorsUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity1.ID.String())
+	test.AddCollaboratorsUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity3.ID.String())
+	rest.checkAuditEvent(rest.testIdentity3.ID, audit.CollaboratorAdd, rest.testIdentity3.ID, audit.Failure)
+}
+
+// checkAuditEvent checks that the latest event of the actor is the given change of the collaborators of the space
+func (rest *TestCollaboratorsREST) checkAuditEvent(actorID uuid.UUID, action string, identityID uuid.UUID, outcome string) {
+	events, err := rest.Application.AuditEvents().List(rest.Ctx, audit.Filter{ActorID: actorID, Action: action}, 0, 1)
+	require.Nil(rest.T(), err)
+	require.Len(rest.T(), events, 1)
+	assert.Equal(rest.T(), identityID.String(), events[0].Subject)
+	assert.Equal(rest.T(), outcome, events[0].Outcome)
+	assert.Equal(rest.T(), rest.spaceID.String(), events[0].Details["space_id"])
 }
 
 func (rest *TestCollaboratorsREST) TestAddManyCollaboratorsUnauthorizedIfCurrentUserIsNotCollaborator() {
 	// given
-	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	svc, ctrl := rest.SecuredControllerWithIdentity(rest.testIdentity3)
+	rest.addCollaborator(rest.testIdentity2.ID)
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
-	rest.checkCollaborators([]uuid.UUID{rest.testIdentity2.ID}, actualUsers)
-	payload := &app.AddManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity1.ID.String(), Type: idnType}}}
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
+	payload := &app.AddManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity3.ID.String(), Type: idnType}}}
 	// when/then
 	test.AddManyCollaboratorsUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.spaceID, payload)
 }
@@ -391,9 +405,7 @@ func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsUnauthorizedIfNoTo
 
 func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsUnauthorizedIfCurrentUserIsNotCollaborator() {
 	// given
-	svc := testsupport.ServiceAsSpaceUser("Collaborators-Service", rest.testIdentity2, &DummySpaceAuthzService{rest})
-	ctrl := NewCollaboratorsController(svc, rest.Application, rest.Configuration, &DummyPolicyManager{rest: rest})
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
+	svc, ctrl := rest.SecuredControllerWithIdentity(rest.testIdentity2)
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 	// when/then
@@ -402,9 +414,7 @@ func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsUnauthorizedIfCurrentU
 
 func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsUnauthorizedIfCurrentUserIsNotCollaborator() {
 	// given
-	svc := testsupport.ServiceAsSpaceUser("Collaborators-Service", rest.testIdentity2, &DummySpaceAuthzService{rest})
-	ctrl := NewCollaboratorsController(svc, rest.Application, rest.Configuration, &DummyPolicyManager{rest: rest})
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
+	svc, ctrl := rest.SecuredControllerWithIdentity(rest.testIdentity2)
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 	payload := &app.RemoveManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity2.ID.String(), Type: idnType}}}
@@ -415,7 +425,6 @@ func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsUnauthorizedIfCurr
 func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsFailsIfTryToRemoveSpaceOwner() {
 	// given
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 	// when/then
@@ -425,7 +434,6 @@ func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsFailsIfTryToRemoveSpac
 func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsFailsIfTryToRemoveSpaceOwner() {
 	// given
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 	payload := &app.RemoveManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity1.ID.String(), Type: idnType}}}
@@ -435,14 +443,12 @@ func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsFailsIfTryToRemove
 
 func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsWithRandomSpaceIDNotFound() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	test.RemoveCollaboratorsNotFound(rest.T(), svc.Context, svc, ctrl, uuid.NewV4(), uuid.NewV4().String())
 }
 
 func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsWithRandomSpaceIDNotFound() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	payload := &app.RemoveManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: uuid.NewV4().String(), Type: idnType}}}
 
@@ -451,7 +457,6 @@ func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsWithRandomSpaceIDN
 
 func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsWithWrongUserIDFormatReturnsBadRequest() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	// when/then
 	test.RemoveCollaboratorsBadRequest(rest.T(), svc.Context, svc, ctrl, rest.spaceID, "wrongFormatID")
@@ -459,7 +464,6 @@ func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsWithWrongUserIDFormatR
 
 func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsWithWrongUserIDFormatReturnsBadRequest() {
 	// given
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
 	svc, ctrl := rest.SecuredController()
 	payload := &app.RemoveManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: "wrongFormatID", Type: idnType}}}
 	// when/then
@@ -491,12 +495,13 @@ func (rest *TestCollaboratorsREST) TestRemoveCollaboratorsOk() {
 	require.Nil(rest.T(), err)
 
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
 	// when/then
 	test.RemoveCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	_, actualUsers = test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 
 	updatedResource, err := appl.SpaceResources().LoadBySpace(context.Background(), &rest.spaceID)
 	require.Nil(rest.T(), err)
@@ -510,20 +515,128 @@ func (rest *TestCollaboratorsREST) TestRemoveManyCollaboratorsOk() {
 	require.Nil(rest.T(), err)
 
 	svc, ctrl := rest.SecuredController()
-	rest.policy.AddUserToPolicy(rest.testIdentity1.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity2.ID.String())
-	rest.policy.AddUserToPolicy(rest.testIdentity3.ID.String())
+	rest.addCollaborator(rest.testIdentity2.ID)
+	rest.addCollaborator(rest.testIdentity3.ID)
 	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
 	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID, rest.testIdentity3.ID}, actualUsers)
 	payload := &app.RemoveManyCollaboratorsPayload{Data: []*app.UpdateUserID{{ID: rest.testIdentity2.ID.String(), Type: idnType}, {ID: rest.testIdentity3.ID.String(), Type: idnType}}}
 	// when/then
 	test.RemoveManyCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, payload)
+	_, actualUsers = test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID}, actualUsers)
 
 	updatedResource, err := appl.SpaceResources().LoadBySpace(context.Background(), &rest.spaceID)
 	require.Nil(rest.T(), err)
 	require.True(rest.T(), resource.UpdatedAt.Before(updatedResource.UpdatedAt))
 }
 
+func (rest *TestCollaboratorsREST) TestAddCollaboratorsTwiceOK() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// when
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// then
+	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
+}
+
+func (rest *TestCollaboratorsREST) TestAddCollaboratorsWithUnknownIdentityNotFound() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	// when/then
+	test.AddCollaboratorsNotFound(rest.T(), svc.Context, svc, ctrl, rest.spaceID, uuid.NewV4().String())
+}
+
+func (rest *TestCollaboratorsREST) TestCollaboratorsStoredAsContributorRoles() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	// when
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// then
+	identityRoles, err := rest.Application.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(rest.Ctx, rest.testIdentity2.ID, rest.spaceID.String())
+	require.Nil(rest.T(), err)
+	require.Len(rest.T(), identityRoles, 1)
+	assert.Equal(rest.T(), collaborator.ContributorRole, identityRoles[0].Role.Name)
+}
+
+func (rest *TestCollaboratorsREST) TestCollaboratorsUpdateKeycloakPolicy() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	// when
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// then the policy is updated when the change is delivered from the outbox
+	rest.deliverPolicyEvents(rest.testIdentity2.ID)
+	assert.Contains(rest.T(), rest.spacePolicy().Config.UserIDs, rest.testIdentity2.ID.String())
+	// when
+	test.RemoveCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// then
+	rest.deliverPolicyEvents(rest.testIdentity2.ID)
+	assert.NotContains(rest.T(), rest.spacePolicy().Config.UserIDs, rest.testIdentity2.ID.String())
+	assert.Contains(rest.T(), rest.spacePolicy().Config.UserIDs, rest.testIdentity1.ID.String())
+}
+
+func (rest *TestCollaboratorsREST) TestAddCollaboratorsOKIfKeycloakPolicyUpdateFails() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	rest.policyManager.failUpdate = true
+	// when
+	test.AddCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, rest.testIdentity2.ID.String())
+	// then the collaborator is added and the update of the policy is left to the retries of the outbox
+	_, actualUsers := test.ListCollaboratorsOK(rest.T(), svc.Context, svc, ctrl, rest.spaceID, nil, nil, nil, nil)
+	rest.checkCollaborators([]uuid.UUID{rest.testIdentity1.ID, rest.testIdentity2.ID}, actualUsers)
+	events, err := rest.Application.OutboxEvents().ListByIdentity(rest.Ctx, rest.testIdentity2.ID)
+	require.Nil(rest.T(), err)
+	require.NotEmpty(rest.T(), events)
+	event := events[len(events)-1]
+	require.Equal(rest.T(), outbox.SpaceCollaboratorAdded, event.Type)
+	err = collaborator.NewPolicySink(rest.Application, rest.policyManager).Deliver(rest.Ctx, event)
+	assert.NotNil(rest.T(), err)
+}
+
+// deliverPolicyEvents delivers the events recorded in the outbox for the identity to the Keycloak space policies
+func (rest *TestCollaboratorsREST) deliverPolicyEvents(identityID uuid.UUID) {
+	events, err := rest.Application.OutboxEvents().ListByIdentity(rest.Ctx, identityID)
+	require.Nil(rest.T(), err)
+	sink := collaborator.NewPolicySink(rest.Application, rest.policyManager)
+	for _, event := range events {
+		err = sink.Deliver(rest.Ctx, event)
+		require.Nil(rest.T(), err)
+	}
+}
+
+func (rest *TestCollaboratorsREST) spacePolicy() *auth.KeycloakPolicy {
+	spaceResource, err := rest.Application.SpaceResources().LoadBySpace(rest.Ctx, &rest.spaceID)
+	require.Nil(rest.T(), err)
+	policy, found := rest.policyManager.policies[spaceResource.PolicyID]
+	require.True(rest.T(), found)
+	return policy
+}
+
+func (rest *TestCollaboratorsREST) addCollaborator(identityID uuid.UUID) {
+	err := application.Transactional(rest.Application, func(appl application.Application) error {
+		res, err := collaborator.LoadSpaceResource(rest.Ctx, appl, rest.spaceID)
+		if err != nil {
+			return err
+		}
+		_, err = collaborator.Add(rest.Ctx, appl, res, identityID)
+		return err
+	})
+	require.Nil(rest.T(), err)
+}
+
+func (rest *TestCollaboratorsREST) removeCollaborator(identityID uuid.UUID) {
+	err := application.Transactional(rest.Application, func(appl application.Application) error {
+		res, err := collaborator.LoadSpaceResource(rest.Ctx, appl, rest.spaceID)
+		if err != nil {
+			return err
+		}
+		_, err = collaborator.Remove(rest.Ctx, appl, res, identityID)
+		return err
+	})
+	require.Nil(rest.T(), err)
+}
+
 func (rest *TestCollaboratorsREST) createSpace() uuid.UUID {
 	// given
 	svc, _ := rest.SecuredController()
@@ -562,6 +675,39 @@ func assertResponseHeaders(t *testing.T, res http.ResponseWriter) (string, strin
 	return eTag[0], lastModified[0], cacheControl[0]
 }
 
+// DummyPolicyManager keeps the policies in memory. Unknown policies are created empty.
+type DummyPolicyManager struct {
+	policies   map[string]*auth.KeycloakPolicy
+	failUpdate bool
+}
+
+func (m *DummyPolicyManager) GetPolicy(ctx context.Context, request *goa.RequestData, policyID string) (*auth.KeycloakPolicy, *string, error) {
+	pat := "pat"
+	policy, found := m.policies[policyID]
+	if !found {
+		policy = &auth.KeycloakPolicy{ID: &policyID}
+		m.policies[policyID] = policy
+	}
+	result := *policy
+	return &result, &pat, nil
+}
+
+func (m *DummyPolicyManager) UpdatePolicy(ctx context.Context, request *goa.RequestData, policy auth.KeycloakPolicy, pat string) error {
+	if m.failUpdate {
+		return errors.NewInternalErrorFromString(ctx, "unable to update the policy")
+	}
+	m.policies[*policy.ID] = &policy
+	return nil
+}
+
+func (m *DummyPolicyManager) AddUserToPolicy(p *auth.KeycloakPolicy, userID string) bool {
+	return p.AddUserToPolicy(userID)
+}
+
+func (m *DummyPolicyManager) RemoveUserFromPolicy(p *auth.KeycloakPolicy, userID string) bool {
+	return p.RemoveUserFromPolicy(userID)
+}
+
 type DummyResourceManager struct {
 	ResourceID   *string
 	PermissionID *string
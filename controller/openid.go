@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"encoding/json"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/token"
+
+	"github.com/goadesign/goa"
+)
+
+// OpenidController implements the openid resource.
+type OpenidController struct {
+	*goa.Controller
+	TokenManager token.Manager
+}
+
+// NewOpenidController creates an openid controller.
+func NewOpenidController(service *goa.Service, tokenManager token.Manager) *OpenidController {
+	return &OpenidController{
+		Controller:   service.NewController("OpenidController"),
+		TokenManager: tokenManager,
+	}
+}
+
+// Configuration returns the metadata of the Auth service as the issuer of the tokens.
+// Only the endpoints and the values actually implemented by the Auth service are listed: it issues no ID token
+// and has no user info endpoint, so it doesn't advertise itself as a complete OpenID Provider.
+// The issuer is the same as the "iss" claim of the tokens issued by the Auth service.
+// The authorization codes issued at login to the public clients are not advertised either, as the login endpoint
+// is not an OAuth 2.0 authorization endpoint: the flow is specific to the Auth service (see the reference documentation).
+func (c *OpenidController) Configuration(ctx *app.ConfigurationOpenidContext) error {
+	return ctx.OK(&app.OpenIDConfiguration{
+		Issuer:                            rest.AbsoluteURL(ctx.RequestData, ""),
+		TokenEndpoint:                     rest.AbsoluteURL(ctx.RequestData, client.ExchangeTokenPath()),
+		JwksURI:                           rest.AbsoluteURL(ctx.RequestData, client.KeysOpenidPath()),
+		GrantTypesSupported:               []string{"client_credentials", token.TokenExchangeGrantType},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_post"},
+	})
+}
+
+// Keys returns the JSON Web Key Set of the public keys which should be used to verify the tokens
+func (c *OpenidController) Keys(ctx *app.KeysOpenidContext) error {
+	// the JSON Web Keys are converted to the media type through their JSON representation
+	keyData, err := json.Marshal(c.TokenManager.JsonWebKeys().Keys)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	keys := []*app.JSONWebKey{}
+	err = json.Unmarshal(keyData, &keys)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	return ctx.OK(&app.JSONWebKeySet{Keys: keys})
+}
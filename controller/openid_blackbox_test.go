@@ -0,0 +1,61 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
+	"github.com/fabric8-services/fabric8-auth/token"
+
+	"github.com/goadesign/goa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestOpenidREST struct {
+	suite.Suite
+}
+
+func TestRunOpenidREST(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	suite.Run(t, &TestOpenidREST{})
+}
+
+func (rest *TestOpenidREST) UnSecuredController() (*goa.Service, *OpenidController) {
+	svc := goa.New("Openid-Service")
+	return svc, NewOpenidController(svc, testtoken.TokenManager)
+}
+
+func (rest *TestOpenidREST) TestConfigurationOK() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+	_, configuration := test.ConfigurationOpenidOK(t, svc.Context, svc, ctrl)
+
+	// the endpoints are absolute URLs based on the issuer
+	issuer := configuration.Issuer
+	assert.Equal(t, issuer+"/api/token", configuration.TokenEndpoint)
+	assert.Equal(t, issuer+"/.well-known/jwks.json", configuration.JwksURI)
+	// the authorization code flow of the public clients is specific to the Auth service and is not advertised
+	assert.Equal(t, []string{"client_credentials", token.TokenExchangeGrantType}, configuration.GrantTypesSupported)
+	assert.Equal(t, []string{"client_secret_post"}, configuration.TokenEndpointAuthMethodsSupported)
+}
+
+func (rest *TestOpenidREST) TestKeysOK() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+	_, jwks := test.KeysOpenidOK(t, svc.Context, svc, ctrl)
+
+	publicKeys := testtoken.TokenManager.PublicKeys()
+	require.Len(t, jwks.Keys, len(publicKeys))
+	for _, key := range jwks.Keys {
+		assert.Equal(t, "RSA", key.Kty)
+		assert.Equal(t, "RS256", key.Alg)
+		assert.Equal(t, "sig", key.Use)
+		assert.NotEmpty(t, key.N)
+		assert.NotEmpty(t, key.E)
+		assert.NotNil(t, testtoken.TokenManager.PublicKey(key.Kid), "unknown key %s", key.Kid)
+	}
+}
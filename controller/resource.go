@@ -1,14 +1,17 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/authorization/resource"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/login"
 	"github.com/fabric8-services/fabric8-auth/token"
 
 	"github.com/goadesign/goa"
@@ -28,13 +31,88 @@ func NewResourceController(service *goa.Service, db application.DB) *ResourceCon
 }
 
 // Delete runs the delete action.
+// All the descendants of the resource are deleted as well as the identity roles assigned for the deleted resources.
 func (c *ResourceController) Delete(ctx *app.DeleteResourceContext) error {
-	return ctx.MethodNotAllowed()
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to delete resource. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		// Make sure the resource exists before deleting anything
+		err := appl.ResourceRepository().CheckExists(ctx, ctx.ResourceID)
+		if err != nil {
+			return err
+		}
+		return deleteResourceTree(ctx, appl, ctx.ResourceID)
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"resource_id": ctx.ResourceID,
+	}, "resource deleted")
+
+	return ctx.NoContent()
+}
+
+// deleteResourceTree deletes the resource with the given ID, all its descendants
+// and the identity roles assigned for them
+func deleteResourceTree(ctx context.Context, appl application.Application, resourceID string) error {
+	children, err := appl.ResourceRepository().LoadChildren(ctx, resourceID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, child := range children {
+		err = deleteResourceTree(ctx, appl, child.ResourceID)
+		if err != nil {
+			return err
+		}
+	}
+	err = appl.IdentityRoleRepository().DeleteForResource(ctx, resourceID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	return appl.ResourceRepository().Delete(ctx, resourceID)
 }
 
 // Read runs the read action.
 func (c *ResourceController) Read(ctx *app.ReadResourceContext) error {
-	return ctx.MethodNotAllowed()
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to read resource. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	var res *resource.Resource
+	var parentChain []string
+
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		var err error
+		res, err = appl.ResourceRepository().Load(ctx, ctx.ResourceID)
+		if err != nil {
+			return err
+		}
+		parentChain, err = loadParentChain(ctx, appl, res)
+		return err
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	return ctx.OK(convertResourceDetail(res, parentChain))
 }
 
 // Register runs the register action.
@@ -49,9 +127,15 @@ func (c *ResourceController) Register(ctx *app.RegisterResourceContext) error {
 
 	err := application.Transactional(c.db, func(appl application.Application) error {
 
-		// Lookup or create the resource type
-		resourceType, err := appl.ResourceTypeRepository().LookupOrCreate(ctx, ctx.Payload.Type)
+		// Lookup the resource type, which must be declared in the authorization model
+		resourceType, err := appl.ResourceTypeRepository().Lookup(ctx, ctx.Payload.Type)
 		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				log.Error(ctx, map[string]interface{}{
+					"resource_type": ctx.Payload.Type,
+				}, "Resource type is not declared in the authorization model")
+				return errors.NewBadParameterError("type", ctx.Payload.Type).Expected("a resource type declared in the authorization model")
+			}
 			return errors.NewInternalError(ctx, err)
 		}
 
@@ -98,21 +182,28 @@ func (c *ResourceController) Register(ctx *app.RegisterResourceContext) error {
 			resourceID = uuid.NewV4().String()
 		}
 
+		var parentResourceID *string
+		if parentResource != nil {
+			parentResourceID = &parentResource.ResourceID
+		}
+
 		// Create the new resource instance
 		res = &resource.Resource{
-			ResourceID:     resourceID,
-			ParentResource: parentResource,
-			Owner:          *identity,
-			OwnerID:        identity.ID,
-			ResourceType:   *resourceType,
-			ResourceTypeID: resourceType.ResourceTypeID,
-			Description:    *ctx.Payload.Description,
+			ResourceID:       resourceID,
+			ParentResource:   parentResource,
+			ParentResourceID: parentResourceID,
+			Owner:            *identity,
+			OwnerID:          identity.ID,
+			ResourceType:     *resourceType,
+			ResourceTypeID:   resourceType.ResourceTypeID,
+			Description:      *ctx.Payload.Description,
 		}
 
 		// Persist the resource
 		return appl.ResourceRepository().Create(ctx, res)
 	})
 
+	c.recordRegistration(ctx, res, err)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -133,7 +224,166 @@ func (c *ResourceController) Register(ctx *app.RegisterResourceContext) error {
 	return ctx.Created(&app.RegisterResource{ID: &res.ResourceID})
 }
 
+// recordRegistration records the registration of the resource by the service account in the audit log
+func (c *ResourceController) recordRegistration(ctx *app.RegisterResourceContext, res *resource.Resource, registrationErr error) {
+	var actorID uuid.UUID
+	if identityID, err := login.ContextIdentity(ctx); err == nil {
+		actorID = *identityID
+	}
+	var subject string
+	if registrationErr == nil {
+		subject = res.ResourceID
+	} else if ctx.Payload.ResourceID != nil {
+		subject = *ctx.Payload.ResourceID
+	}
+	// a failure to record the event must not change the response, so the error is only logged by the repository
+	audit.Record(ctx, c.db.AuditEvents(), audit.ResourceRegister, actorID, subject, audit.OutcomeOf(registrationErr == nil), audit.Details{
+		"resource_type":     ctx.Payload.Type,
+		"resource_owner_id": ctx.Payload.ResourceOwnerID,
+	})
+}
+
 // Update runs the update action.
 func (c *ResourceController) Update(ctx *app.UpdateResourceContext) error {
-	return ctx.MethodNotAllowed()
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to update resource. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	var res *resource.Resource
+	var parentChain []string
+
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		var err error
+		res, err = appl.ResourceRepository().Load(ctx, ctx.ResourceID)
+		if err != nil {
+			return err
+		}
+
+		if ctx.Payload.Description != nil {
+			res.Description = *ctx.Payload.Description
+		}
+
+		if ctx.Payload.ParentResourceID != nil {
+			if *ctx.Payload.ParentResourceID == "" {
+				// Detach the resource from its parent
+				res.ParentResource = nil
+				res.ParentResourceID = nil
+			} else {
+				parentResource, err := appl.ResourceRepository().Load(ctx, *ctx.Payload.ParentResourceID)
+				if err != nil {
+					log.Error(ctx, map[string]interface{}{
+						"err":                err,
+						"parent_resource_id": *ctx.Payload.ParentResourceID,
+					}, "Parent resource could not be found.")
+
+					return errors.NewBadParameterError("invalid parent resource ID specified", err)
+				}
+				// The new parent must not be the resource itself or one of its descendants
+				parentResourceChain, err := loadParentChain(ctx, appl, parentResource)
+				if err != nil {
+					return err
+				}
+				for _, ancestorID := range append([]string{parentResource.ResourceID}, parentResourceChain...) {
+					if ancestorID == res.ResourceID {
+						return errors.NewBadParameterError("parent_resource_id", parentResource.ResourceID).Expected("not the resource itself or one of its descendants")
+					}
+				}
+				res.ParentResource = parentResource
+				res.ParentResourceID = &parentResource.ResourceID
+			}
+		}
+
+		if ctx.Payload.ResourceOwnerID != nil {
+			resourceOwnerID, err := uuid.FromString(*ctx.Payload.ResourceOwnerID)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"err":               err,
+					"resource_owner_id": *ctx.Payload.ResourceOwnerID,
+				}, "Resource owner ID is not valid")
+
+				return errors.NewConversionError(fmt.Sprintf("resource owner ID is not a valid UUID %v", err.Error()))
+			}
+			identity, err := appl.Identities().Load(ctx, resourceOwnerID)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"err":               err,
+					"resource_owner_id": resourceOwnerID,
+				}, "Resource owner could not be found")
+
+				if notFound, _ := errors.IsNotFoundError(err); notFound {
+					return errors.NewBadParameterError("resource_owner_id", resourceOwnerID.String()).Expected("ID of an existing identity")
+				}
+				return err
+			}
+			res.Owner = *identity
+			res.OwnerID = identity.ID
+		}
+
+		err = appl.ResourceRepository().Save(ctx, res)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		parentChain, err = loadParentChain(ctx, appl, res)
+		return err
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"resource_id":  res.ResourceID,
+		"parent_chain": parentChain,
+		"owner_id":     res.OwnerID,
+		"description":  res.Description,
+	}, "resource updated")
+
+	return ctx.OK(convertResourceDetail(res, parentChain))
+}
+
+// loadParentChain returns the IDs of all the ancestors of the given resource,
+// starting with its direct parent and ending with the root resource
+func loadParentChain(ctx context.Context, appl application.Application, res *resource.Resource) ([]string, error) {
+	chain := []string{}
+	visited := map[string]bool{res.ResourceID: true}
+	parentID := res.ParentResourceID
+	for parentID != nil {
+		if visited[*parentID] {
+			log.Error(ctx, map[string]interface{}{
+				"resource_id":        res.ResourceID,
+				"parent_resource_id": *parentID,
+			}, "cycle detected in the resource hierarchy")
+			return nil, errors.NewInternalErrorFromString(ctx, "cycle detected in the resource hierarchy")
+		}
+		visited[*parentID] = true
+		parent, err := appl.ResourceRepository().Load(ctx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, parent.ResourceID)
+		parentID = parent.ParentResourceID
+	}
+	return chain, nil
+}
+
+// convertResourceDetail converts the given resource to its app representation
+func convertResourceDetail(res *resource.Resource, parentChain []string) *app.ResourceDetail {
+	createdAt := res.CreatedAt
+	updatedAt := res.UpdatedAt
+	return &app.ResourceDetail{
+		ResourceID:          res.ResourceID,
+		Description:         &res.Description,
+		Type:                res.ResourceType.Name,
+		ResourceOwnerID:     res.OwnerID.String(),
+		ParentResourceID:    res.ParentResourceID,
+		ParentResourceChain: parentChain,
+		CreatedAt:           &createdAt,
+		UpdatedAt:           &updatedAt,
+	}
 }
@@ -71,7 +71,7 @@ func (rest *TestResourceREST) TestFailRegisterResourceNonServiceAccount() {
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	test.RegisterResourceUnauthorized(rest.T(), service.Context, service, controller, payload)
@@ -95,7 +95,7 @@ func (rest *TestResourceREST) TestFailRegisterResourceInvalidParentResource() {
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	test.RegisterResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
@@ -114,7 +114,7 @@ func (rest *TestResourceREST) TestRegisterResourceCreated() {
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	_, created := test.RegisterResourceCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
@@ -136,7 +136,7 @@ func (rest *TestResourceREST) TestRegisterResourceWithResourceIDSetCreated() {
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	_, created := test.RegisterResourceCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
@@ -160,7 +160,7 @@ func (rest *TestResourceREST) TestRegisterResourceWithParentResourceSetCreated()
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	_, parentCreated := test.RegisterResourceCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
@@ -178,7 +178,7 @@ func (rest *TestResourceREST) TestRegisterResourceWithParentResourceSetCreated()
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	_, childCreated := test.RegisterResourceCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
@@ -202,8 +202,153 @@ func (rest *TestResourceREST) TestFailRegisterResourceUnknownOwner() {
 		ResourceScopes:   resourceScopes,
 		ResourceID:       &resourceID,
 		ResourceOwnerID:  resourceOwnerID.String(),
-		Type:             "Area",
+		Type:             "openshift.io/resource/area",
 	}
 
 	test.RegisterResourceNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
 }
+
+func (rest *TestResourceREST) TestFailRegisterResourceUndeclaredType() {
+	resourceDescription := "Resource description"
+	resourceID := ""
+
+	payload := &app.RegisterResourcePayload{
+		Description:      &resourceDescription,
+		Name:             "My new resource",
+		ParentResourceID: nil,
+		ResourceScopes:   []string{},
+		ResourceID:       &resourceID,
+		ResourceOwnerID:  rest.testIdentity.ID.String(),
+		Type:             "resource_blackbox_test_Undeclared" + uuid.NewV4().String(),
+	}
+
+	test.RegisterResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
+}
+
+func (rest *TestResourceREST) registerResource(parentResourceID *string) string {
+	resourceDescription := "Resource description"
+	resourceID := ""
+	payload := &app.RegisterResourcePayload{
+		Description:      &resourceDescription,
+		Name:             "My new resource",
+		ParentResourceID: parentResourceID,
+		ResourceScopes:   []string{},
+		ResourceID:       &resourceID,
+		ResourceOwnerID:  rest.testIdentity.ID.String(),
+		Type:             "openshift.io/resource/area",
+	}
+	_, created := test.RegisterResourceCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, payload)
+	require.NotNil(rest.T(), created.ID)
+	return *created.ID
+}
+
+func (rest *TestResourceREST) TestReadResourceOK() {
+	parentID := rest.registerResource(nil)
+	childID := rest.registerResource(&parentID)
+	grandChildID := rest.registerResource(&childID)
+
+	_, res := test.ReadResourceOK(rest.T(), rest.service.Context, rest.service, rest.securedController, grandChildID)
+
+	require.Equal(rest.T(), grandChildID, res.ResourceID)
+	require.Equal(rest.T(), "openshift.io/resource/area", res.Type)
+	require.Equal(rest.T(), rest.testIdentity.ID.String(), res.ResourceOwnerID)
+	require.NotNil(rest.T(), res.ParentResourceID)
+	require.Equal(rest.T(), childID, *res.ParentResourceID)
+	require.Equal(rest.T(), []string{childID, parentID}, res.ParentResourceChain)
+}
+
+func (rest *TestResourceREST) TestFailReadResourceNonServiceAccount() {
+	resourceID := rest.registerResource(nil)
+	service, controller := rest.SecuredController(rest.testIdentity)
+
+	test.ReadResourceUnauthorized(rest.T(), service.Context, service, controller, resourceID)
+}
+
+func (rest *TestResourceREST) TestFailReadResourceNotFound() {
+	test.ReadResourceNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, uuid.NewV4().String())
+}
+
+func (rest *TestResourceREST) TestUpdateResourceOK() {
+	parentID := rest.registerResource(nil)
+	resourceID := rest.registerResource(nil)
+	newOwner, err := testsupport.CreateTestIdentity(rest.DB, "TestUpdateResourceOK-"+uuid.NewV4().String(), "TestUpdateResourceOK")
+	require.Nil(rest.T(), err)
+
+	description := "Updated description"
+	newOwnerID := newOwner.ID.String()
+	payload := &app.UpdateResourcePayload{
+		Description:      &description,
+		ParentResourceID: &parentID,
+		ResourceOwnerID:  &newOwnerID,
+	}
+	_, updated := test.UpdateResourceOK(rest.T(), rest.service.Context, rest.service, rest.securedController, resourceID, payload)
+
+	require.Equal(rest.T(), description, *updated.Description)
+	require.Equal(rest.T(), newOwnerID, updated.ResourceOwnerID)
+	require.Equal(rest.T(), []string{parentID}, updated.ParentResourceChain)
+
+	// Detach the resource from its parent
+	noParent := ""
+	_, updated = test.UpdateResourceOK(rest.T(), rest.service.Context, rest.service, rest.securedController, resourceID, &app.UpdateResourcePayload{ParentResourceID: &noParent})
+	require.Nil(rest.T(), updated.ParentResourceID)
+	require.Empty(rest.T(), updated.ParentResourceChain)
+	require.Equal(rest.T(), description, *updated.Description)
+}
+
+func (rest *TestResourceREST) TestFailUpdateResourceCyclicParent() {
+	parentID := rest.registerResource(nil)
+	childID := rest.registerResource(&parentID)
+
+	payload := &app.UpdateResourcePayload{
+		ParentResourceID: &childID,
+	}
+	test.UpdateResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, parentID, payload)
+}
+
+func (rest *TestResourceREST) TestFailUpdateResourceUnknownOwner() {
+	resourceID := rest.registerResource(nil)
+	unknownOwnerID := uuid.NewV4().String()
+
+	payload := &app.UpdateResourcePayload{
+		ResourceOwnerID: &unknownOwnerID,
+	}
+	test.UpdateResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, resourceID, payload)
+}
+
+func (rest *TestResourceREST) TestFailResourceInvalidID() {
+	description := "Updated description"
+	test.ReadResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid")
+	test.UpdateResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid", &app.UpdateResourcePayload{Description: &description})
+	test.DeleteResourceBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid")
+}
+
+func (rest *TestResourceREST) TestFailUpdateResourceNonServiceAccount() {
+	resourceID := rest.registerResource(nil)
+	service, controller := rest.SecuredController(rest.testIdentity)
+	description := "Updated description"
+
+	test.UpdateResourceUnauthorized(rest.T(), service.Context, service, controller, resourceID, &app.UpdateResourcePayload{Description: &description})
+}
+
+func (rest *TestResourceREST) TestDeleteResourceWithChildren() {
+	parentID := rest.registerResource(nil)
+	childID := rest.registerResource(&parentID)
+	otherID := rest.registerResource(nil)
+
+	test.DeleteResourceNoContent(rest.T(), rest.service.Context, rest.service, rest.securedController, parentID)
+
+	test.ReadResourceNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, parentID)
+	test.ReadResourceNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, childID)
+	test.ReadResourceOK(rest.T(), rest.service.Context, rest.service, rest.securedController, otherID)
+}
+
+func (rest *TestResourceREST) TestFailDeleteResourceNotFound() {
+	test.DeleteResourceNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, uuid.NewV4().String())
+}
+
+func (rest *TestResourceREST) TestFailDeleteResourceNonServiceAccount() {
+	resourceID := rest.registerResource(nil)
+	service, controller := rest.SecuredController(rest.testIdentity)
+
+	test.DeleteResourceUnauthorized(rest.T(), service.Context, service, controller, resourceID)
+}
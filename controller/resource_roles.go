@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+)
+
+// ResourceRolesController implements the resource_roles resource.
+type ResourceRolesController struct {
+	*goa.Controller
+	db application.DB
+}
+
+// NewResourceRolesController creates a resource_roles controller.
+func NewResourceRolesController(service *goa.Service, db application.DB) *ResourceRolesController {
+	return &ResourceRolesController{Controller: service.NewController("ResourceRolesController"), db: db}
+}
+
+// List runs the list action.
+func (c *ResourceRolesController) List(ctx *app.ListResourceRolesContext) error {
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to list resource roles. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	var identityRoles []role.IdentityRole
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		err := appl.ResourceRepository().CheckExists(ctx, ctx.ResourceID)
+		if err != nil {
+			return err
+		}
+		identityRoles, err = appl.IdentityRoleRepository().FindIdentityRolesByResource(ctx, ctx.ResourceID)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	data := make([]*app.IdentityRole, len(identityRoles))
+	for i := range identityRoles {
+		data[i] = convertIdentityRole(&identityRoles[i])
+	}
+	return ctx.OK(&app.IdentityRoleArray{Data: data})
+}
+
+// Assign runs the assign action.
+func (c *ResourceRolesController) Assign(ctx *app.AssignResourceRolesContext) error {
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to assign resource role. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	var identityRole *role.IdentityRole
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		res, err := appl.ResourceRepository().Load(ctx, ctx.ResourceID)
+		if err != nil {
+			return err
+		}
+
+		if !appl.Identities().IsValid(ctx, ctx.Payload.IdentityID) {
+			log.Error(ctx, map[string]interface{}{
+				"identity_id": ctx.Payload.IdentityID,
+			}, "Identity could not be found")
+			return errors.NewBadParameterError("identity_id", ctx.Payload.IdentityID.String()).Expected("an existing identity")
+		}
+
+		// The role must be defined for the type of the resource
+		r, err := appl.RoleRepository().Lookup(ctx, ctx.Payload.RoleName, res.ResourceTypeID)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"err":           err,
+				"role_name":     ctx.Payload.RoleName,
+				"resource_type": res.ResourceType.Name,
+			}, "Role is not defined for the resource type")
+			return errors.NewBadParameterError("role_name", ctx.Payload.RoleName).Expected("a role defined for the resource type " + res.ResourceType.Name)
+		}
+
+		assigned, err := appl.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(ctx, ctx.Payload.IdentityID, res.ResourceID)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		for _, existing := range assigned {
+			if existing.RoleID == r.RoleID {
+				return errors.NewVersionConflictError("the role is already assigned to the identity")
+			}
+		}
+
+		identityRole = &role.IdentityRole{
+			IdentityID: ctx.Payload.IdentityID,
+			ResourceID: res.ResourceID,
+			RoleID:     r.RoleID,
+		}
+		err = appl.IdentityRoleRepository().Create(ctx, identityRole)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		identityRole.Role = *r
+		return nil
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"identity_role_id": identityRole.IdentityRoleID,
+		"identity_id":      identityRole.IdentityID,
+		"resource_id":      identityRole.ResourceID,
+		"role_name":        identityRole.Role.Name,
+	}, "role assigned")
+
+	return ctx.Created(convertIdentityRole(identityRole))
+}
+
+// Revoke runs the revoke action.
+func (c *ResourceRolesController) Revoke(ctx *app.RevokeResourceRolesContext) error {
+
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to revoke resource role. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	err := validateResourceID(ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		identityRole, err := appl.IdentityRoleRepository().Load(ctx, ctx.AssignmentID)
+		if err != nil {
+			return err
+		}
+		if identityRole.ResourceID != ctx.ResourceID {
+			// Do not disclose role assignments of other resources
+			return errors.NewNotFoundError("identity_role", ctx.AssignmentID.String())
+		}
+		return appl.IdentityRoleRepository().Delete(ctx, identityRole.IdentityRoleID)
+	})
+
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"identity_role_id": ctx.AssignmentID,
+		"resource_id":      ctx.ResourceID,
+	}, "role revoked")
+
+	return ctx.NoContent()
+}
+
+// validateResourceID checks that the resource ID is a UUID, so that it can be looked up
+func validateResourceID(resourceID string) error {
+	_, err := uuid.FromString(resourceID)
+	if err != nil {
+		return errors.NewBadParameterError("resourceId", resourceID).Expected("resource ID as a UUID")
+	}
+	return nil
+}
+
+// convertIdentityRole converts the given identity role to its app representation
+func convertIdentityRole(identityRole *role.IdentityRole) *app.IdentityRole {
+	return &app.IdentityRole{
+		AssignmentID: identityRole.IdentityRoleID,
+		IdentityID:   identityRole.IdentityID,
+		RoleName:     identityRole.Role.Name,
+		ResourceID:   identityRole.ResourceID,
+	}
+}
@@ -0,0 +1,147 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestResourceRolesREST struct {
+	gormtestsupport.DBTestSuite
+	testIdentity      account.Identity
+	service           *goa.Service
+	securedController *ResourceRolesController
+	resourceType      *resource.ResourceType
+	resource          *resource.Resource
+}
+
+func TestRunResourceRolesREST(t *testing.T) {
+	suite.Run(t, &TestResourceRolesREST{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (rest *TestResourceRolesREST) SetupSuite() {
+	rest.DBTestSuite.SetupSuite()
+	sa := account.Identity{
+		Username: "fabric8-wit",
+	}
+	rest.service = testsupport.ServiceAsServiceAccountUser("ResourceRoles-Service", sa)
+	rest.securedController = NewResourceRolesController(rest.service, rest.Application)
+}
+
+func (rest *TestResourceRolesREST) SetupTest() {
+	rest.DBTestSuite.SetupTest()
+	var err error
+	rest.testIdentity, err = testsupport.CreateTestIdentity(rest.DB, "TestResourceRolesREST-"+uuid.NewV4().String(), "TestResourceRolesREST")
+	require.Nil(rest.T(), err)
+
+	rest.resourceType = &resource.ResourceType{Name: "TestResourceRolesREST-" + uuid.NewV4().String()}
+	err = rest.Application.ResourceTypeRepository().Create(rest.Ctx, rest.resourceType)
+	require.Nil(rest.T(), err)
+
+	err = rest.Application.RoleRepository().Create(rest.Ctx, &role.Role{ResourceTypeID: rest.resourceType.ResourceTypeID, Name: "contributor"})
+	require.Nil(rest.T(), err)
+
+	rest.resource = &resource.Resource{
+		ResourceID:     uuid.NewV4().String(),
+		OwnerID:        rest.testIdentity.ID,
+		ResourceTypeID: rest.resourceType.ResourceTypeID,
+	}
+	err = rest.Application.ResourceRepository().Create(rest.Ctx, rest.resource)
+	require.Nil(rest.T(), err)
+}
+
+func (rest *TestResourceRolesREST) TestAssignListAndRevokeRole() {
+	payload := &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "contributor",
+	}
+	_, assigned := test.AssignResourceRolesCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, payload)
+	require.Equal(rest.T(), rest.testIdentity.ID, assigned.IdentityID)
+	require.Equal(rest.T(), "contributor", assigned.RoleName)
+	require.Equal(rest.T(), rest.resource.ResourceID, assigned.ResourceID)
+
+	_, list := test.ListResourceRolesOK(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID)
+	require.Len(rest.T(), list.Data, 1)
+	require.Equal(rest.T(), assigned.AssignmentID, list.Data[0].AssignmentID)
+
+	test.RevokeResourceRolesNoContent(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, assigned.AssignmentID)
+
+	_, list = test.ListResourceRolesOK(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID)
+	require.Empty(rest.T(), list.Data)
+}
+
+func (rest *TestResourceRolesREST) TestFailAssignRoleTwice() {
+	payload := &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "contributor",
+	}
+	test.AssignResourceRolesCreated(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, payload)
+	test.AssignResourceRolesConflict(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, payload)
+}
+
+func (rest *TestResourceRolesREST) TestFailAssignRoleOfOtherResourceType() {
+	otherType := &resource.ResourceType{Name: "TestResourceRolesREST-" + uuid.NewV4().String()}
+	err := rest.Application.ResourceTypeRepository().Create(rest.Ctx, otherType)
+	require.Nil(rest.T(), err)
+	err = rest.Application.RoleRepository().Create(rest.Ctx, &role.Role{ResourceTypeID: otherType.ResourceTypeID, Name: "admin"})
+	require.Nil(rest.T(), err)
+
+	payload := &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "admin",
+	}
+	test.AssignResourceRolesBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, payload)
+}
+
+func (rest *TestResourceRolesREST) TestFailAssignRoleUnknownIdentity() {
+	payload := &app.AssignResourceRolesPayload{
+		IdentityID: uuid.NewV4(),
+		RoleName:   "contributor",
+	}
+	test.AssignResourceRolesBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, payload)
+}
+
+func (rest *TestResourceRolesREST) TestFailAssignRoleUnknownResource() {
+	payload := &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "contributor",
+	}
+	test.AssignResourceRolesNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, uuid.NewV4().String(), payload)
+}
+
+func (rest *TestResourceRolesREST) TestFailInvalidResourceID() {
+	test.ListResourceRolesBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid")
+	test.AssignResourceRolesBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid", &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "contributor",
+	})
+	test.RevokeResourceRolesBadRequest(rest.T(), rest.service.Context, rest.service, rest.securedController, "not-a-uuid", uuid.NewV4())
+}
+
+func (rest *TestResourceRolesREST) TestFailRevokeUnknownAssignment() {
+	test.RevokeResourceRolesNotFound(rest.T(), rest.service.Context, rest.service, rest.securedController, rest.resource.ResourceID, uuid.NewV4())
+}
+
+func (rest *TestResourceRolesREST) TestFailNonServiceAccount() {
+	svc := testsupport.ServiceAsUser("ResourceRoles-Service", rest.testIdentity)
+	ctrl := NewResourceRolesController(svc, rest.Application)
+
+	test.ListResourceRolesUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.resource.ResourceID)
+	test.AssignResourceRolesUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.resource.ResourceID, &app.AssignResourceRolesPayload{
+		IdentityID: rest.testIdentity.ID,
+		RoleName:   "contributor",
+	})
+	test.RevokeResourceRolesUnauthorized(rest.T(), svc.Context, svc, ctrl, rest.resource.ResourceID, uuid.NewV4())
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login"
 	"github.com/fabric8-services/fabric8-auth/space"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
 	"github.com/goadesign/goa"
 	uuid "github.com/satori/go.uuid"
 )
@@ -65,6 +66,11 @@ func (c *SpaceController) Create(ctx *app.CreateSpaceContext) error {
 	err = application.Transactional(c.db, func(appl application.Application) error {
 		// Create space resource which will represent the keyclok resource associated with this space
 		_, err = appl.SpaceResources().Create(ctx, spaceResource)
+		if err != nil {
+			return err
+		}
+		// Create the resource holding the roles of the space collaborators. The owner is the first collaborator
+		_, err = collaborator.CreateSpaceResource(ctx, appl, ctx.SpaceID, *currentUser)
 		return err
 	})
 	if err != nil {
@@ -112,7 +118,19 @@ func (c *SpaceController) Delete(ctx *app.DeleteSpaceContext) error {
 		permissionID = resource.PermissionID
 		policyID = resource.PolicyID
 
-		return appl.SpaceResources().Delete(ctx, resource.ID)
+		err = appl.SpaceResources().Delete(ctx, resource.ID)
+		if err != nil {
+			return err
+		}
+		// Delete the resource holding the roles of the space collaborators, if their import already happened
+		err = appl.ResourceRepository().CheckExists(ctx, ctx.SpaceID.String())
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return nil
+			}
+			return err
+		}
+		return deleteResourceTree(ctx, appl, ctx.SpaceID.String())
 	})
 
 	if err != nil {
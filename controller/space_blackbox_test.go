@@ -8,6 +8,7 @@ import (
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
 	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
 
 	"github.com/goadesign/goa"
@@ -22,6 +23,8 @@ type TestSpaceREST struct {
 	resourceID   string
 	permissionID string
 	policyID     string
+	owner        account.Identity
+	notOwner     account.Identity
 }
 
 func TestRunSpaceREST(t *testing.T) {
@@ -34,6 +37,11 @@ func (rest *TestSpaceREST) SetupTest() {
 	rest.resourceID = uuid.NewV4().String()
 	rest.permissionID = uuid.NewV4().String()
 	rest.policyID = uuid.NewV4().String()
+	var err error
+	rest.owner, err = testsupport.CreateTestIdentity(rest.DB, "TestSpaceREST-"+uuid.NewV4().String(), "TestSpaceREST")
+	require.Nil(rest.T(), err)
+	rest.notOwner, err = testsupport.CreateTestIdentity(rest.DB, "TestSpaceREST-"+uuid.NewV4().String(), "TestSpaceREST")
+	require.Nil(rest.T(), err)
 }
 
 func (rest *TestSpaceREST) SecuredController(identity account.Identity) (*goa.Service, *SpaceController) {
@@ -63,7 +71,7 @@ func (rest *TestSpaceREST) TestFailCreateSpaceUnauthorized() {
 
 func (rest *TestSpaceREST) TestCreateSpaceOK() {
 	// given
-	svc, ctrl := rest.SecuredController(testsupport.TestIdentity)
+	svc, ctrl := rest.SecuredController(rest.owner)
 	// when
 	_, created := test.CreateSpaceOK(rest.T(), svc.Context, svc, ctrl, uuid.NewV4())
 	// then
@@ -73,6 +81,23 @@ func (rest *TestSpaceREST) TestCreateSpaceOK() {
 	assert.Equal(rest.T(), rest.policyID, created.Data.PolicyID)
 }
 
+func (rest *TestSpaceREST) TestCreateSpaceMakesOwnerCollaborator() {
+	// given
+	svc, ctrl := rest.SecuredController(rest.owner)
+	id := uuid.NewV4()
+	// when
+	test.CreateSpaceOK(rest.T(), svc.Context, svc, ctrl, id)
+	// then
+	res, err := rest.Application.ResourceRepository().Load(rest.Ctx, id.String())
+	require.Nil(rest.T(), err)
+	assert.Equal(rest.T(), collaborator.SpaceResourceType, res.ResourceType.Name)
+	assert.Equal(rest.T(), rest.owner.ID, res.OwnerID)
+	identityRoles, err := rest.Application.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(rest.Ctx, rest.owner.ID, id.String())
+	require.Nil(rest.T(), err)
+	require.Len(rest.T(), identityRoles, 1)
+	assert.Equal(rest.T(), collaborator.ContributorRole, identityRoles[0].Role.Name)
+}
+
 func (rest *TestSpaceREST) TestFailDeleteSpaceUnauthorized() {
 	// given
 	svc, ctrl := rest.UnSecuredController()
@@ -82,18 +107,23 @@ func (rest *TestSpaceREST) TestFailDeleteSpaceUnauthorized() {
 
 func (rest *TestSpaceREST) TestDeleteSpaceOK() {
 	// given
-	svc, ctrl := rest.SecuredController(testsupport.TestIdentity)
+	svc, ctrl := rest.SecuredController(rest.owner)
 	id := uuid.NewV4()
 	// when
 	test.CreateSpaceOK(rest.T(), svc.Context, svc, ctrl, id)
 	// then
 	test.DeleteSpaceOK(rest.T(), svc.Context, svc, ctrl, id)
+	err := rest.Application.ResourceRepository().CheckExists(rest.Ctx, id.String())
+	require.NotNil(rest.T(), err)
+	identityRoles, err := rest.Application.IdentityRoleRepository().FindIdentityRolesByResource(rest.Ctx, id.String())
+	require.Nil(rest.T(), err)
+	assert.Empty(rest.T(), identityRoles)
 }
 
 func (rest *TestSpaceREST) TestDeleteSpaceIfUserIsNotSpaceOwnerForbidden() {
 	// given
-	svcOwner, ctrlOwner := rest.SecuredController(testsupport.TestIdentity)
-	svcNotOwner, ctrlNotOwner := rest.SecuredController(testsupport.TestIdentity2)
+	svcOwner, ctrlOwner := rest.SecuredController(rest.owner)
+	svcNotOwner, ctrlNotOwner := rest.SecuredController(rest.notOwner)
 	id := uuid.NewV4()
 	// when
 	test.CreateSpaceOK(rest.T(), svcOwner.Context, svcOwner, ctrlOwner, id)
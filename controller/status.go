@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"context"
 	"time"
 
 	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/health"
 
 	"fmt"
 	"github.com/goadesign/goa"
@@ -33,14 +35,18 @@ type DBChecker interface {
 type StatusController struct {
 	*goa.Controller
 	dbChecker DBChecker
+	health    *health.Registry
 	config    statusConfiguration
 }
 
 // NewStatusController creates a status controller.
-func NewStatusController(service *goa.Service, dbChecker DBChecker, config statusConfiguration) *StatusController {
+// The liveness and readiness actions run the checks of the given registry,
+// and the show action reports the results of its informational checks.
+func NewStatusController(service *goa.Service, dbChecker DBChecker, healthRegistry *health.Registry, config statusConfiguration) *StatusController {
 	return &StatusController{
 		Controller: service.NewController("StatusController"),
 		dbChecker:  dbChecker,
+		health:     healthRegistry,
 		config:     config,
 	}
 }
@@ -72,12 +78,64 @@ func (c *StatusController) Show(ctx *app.ShowStatusContext) error {
 		res.ConfigurationStatus = "OK"
 	}
 
+	// the dependencies are reported without failing the status
+	results, _ := c.health.Check(ctx, health.Informational)
+	res.Dependencies = convertHealthChecks(results)
+
 	if dbErr != nil || (configErr != nil && !devMode) {
 		return ctx.ServiceUnavailable(res)
 	}
 	return ctx.OK(res)
 }
 
+// Liveness runs the liveness action.
+func (c *StatusController) Liveness(ctx *app.LivenessStatusContext) error {
+	res, ok := c.check(ctx, health.Liveness)
+	if !ok {
+		return ctx.ServiceUnavailable(res)
+	}
+	return ctx.OK(res)
+}
+
+// Readiness runs the readiness action.
+func (c *StatusController) Readiness(ctx *app.ReadinessStatusContext) error {
+	res, ok := c.check(ctx, health.Readiness)
+	if !ok {
+		return ctx.ServiceUnavailable(res)
+	}
+	return ctx.OK(res)
+}
+
+func (c *StatusController) check(ctx context.Context, probe health.Probe) (*app.Health, bool) {
+	results, ok := c.health.Check(ctx, probe)
+	res := &app.Health{
+		Status: "OK",
+		Checks: convertHealthChecks(results),
+	}
+	if !ok {
+		res.Status = "failed"
+	}
+	return res, ok
+}
+
+func convertHealthChecks(results []health.Result) []*app.HealthCheck {
+	checks := make([]*app.HealthCheck, len(results))
+	for i, result := range results {
+		check := &app.HealthCheck{
+			Name:      result.Name,
+			Status:    "OK",
+			LatencyMs: int(result.Latency / time.Millisecond),
+			CheckedAt: result.CheckedAt,
+		}
+		if !result.OK {
+			check.Status = "failed"
+			check.Error = &results[i].Error
+		}
+		checks[i] = check
+	}
+	return checks
+}
+
 // GormDBChecker implements DB checker
 type GormDBChecker struct {
 	db *gorm.DB
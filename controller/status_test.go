@@ -1,6 +1,7 @@
 package controller_test
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/health"
 	"github.com/fabric8-services/fabric8-auth/resource"
 
 	"github.com/goadesign/goa"
@@ -34,12 +36,28 @@ func TestRunStatusREST(t *testing.T) {
 
 func (rest *TestStatusREST) UnSecuredController() (*goa.Service, *StatusController) {
 	svc := goa.New("Status-Service")
-	return svc, NewStatusController(svc, NewGormDBChecker(rest.DB), rest.Configuration)
+	return svc, NewStatusController(svc, NewGormDBChecker(rest.DB), rest.healthRegistry(NewGormDBChecker(rest.DB)), rest.Configuration)
 }
 
 func (rest *TestStatusREST) UnSecuredControllerWithUnreachableDB() (*goa.Service, *StatusController) {
 	svc := goa.New("Status-Service")
-	return svc, NewStatusController(svc, &dummyDBChecker{}, rest.Configuration)
+	return svc, NewStatusController(svc, &dummyDBChecker{}, rest.healthRegistry(&dummyDBChecker{}), rest.Configuration)
+}
+
+// healthRegistry returns a registry with a liveness check which always succeeds, a readiness check of the DB
+// and an informational check which always fails
+func (rest *TestStatusREST) healthRegistry(dbChecker DBChecker) *health.Registry {
+	registry := health.NewRegistry(time.Second, 0)
+	registry.Register("signing_keys", health.Liveness, health.CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	registry.Register("database", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		return dbChecker.Ping()
+	}))
+	registry.Register("keycloak", health.Informational, health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New("Keycloak is unreachable")
+	}))
+	return registry
 }
 
 func (rest *TestStatusREST) TestShowStatusInDevModeOK() {
@@ -57,6 +75,13 @@ func (rest *TestStatusREST) TestShowStatusInDevModeOK() {
 
 	require.NotNil(t, res.DevMode)
 	assert.True(t, *res.DevMode)
+
+	// the failure of a dependency is reported without failing the status
+	require.Len(t, res.Dependencies, 1)
+	assert.Equal(t, "keycloak", res.Dependencies[0].Name)
+	assert.Equal(t, "failed", res.Dependencies[0].Status)
+	require.NotNil(t, res.Dependencies[0].Error)
+	assert.Equal(t, "Keycloak is unreachable", *res.Dependencies[0].Error)
 }
 
 func (rest *TestStatusREST) TestShowStatusWithoutDBFails() {
@@ -88,6 +113,41 @@ func (rest *TestStatusREST) TestShowStatusWithDefaultConfigInProdModeFails() {
 	assert.Equal(rest.T(), "Error: DB is unreachable", res.DatabaseStatus)
 }
 
+func (rest *TestStatusREST) TestLivenessOK() {
+	svc, ctrl := rest.UnSecuredControllerWithUnreachableDB()
+	_, res := test.LivenessStatusOK(rest.T(), svc.Context, svc, ctrl)
+
+	assert.Equal(rest.T(), "OK", res.Status)
+	require.Len(rest.T(), res.Checks, 1)
+	assert.Equal(rest.T(), "signing_keys", res.Checks[0].Name)
+	assert.Equal(rest.T(), "OK", res.Checks[0].Status)
+	assert.Nil(rest.T(), res.Checks[0].Error)
+}
+
+func (rest *TestStatusREST) TestReadinessOK() {
+	svc, ctrl := rest.UnSecuredController()
+	_, res := test.ReadinessStatusOK(rest.T(), svc.Context, svc, ctrl)
+
+	assert.Equal(rest.T(), "OK", res.Status)
+	require.Len(rest.T(), res.Checks, 2)
+	assert.Equal(rest.T(), "signing_keys", res.Checks[0].Name)
+	assert.Equal(rest.T(), "database", res.Checks[1].Name)
+	assert.Equal(rest.T(), "OK", res.Checks[1].Status)
+}
+
+func (rest *TestStatusREST) TestReadinessWithoutDBFails() {
+	svc, ctrl := rest.UnSecuredControllerWithUnreachableDB()
+	_, res := test.ReadinessStatusServiceUnavailable(rest.T(), svc.Context, svc, ctrl)
+
+	assert.Equal(rest.T(), "failed", res.Status)
+	require.Len(rest.T(), res.Checks, 2)
+	assert.Equal(rest.T(), "OK", res.Checks[0].Status)
+	assert.Equal(rest.T(), "database", res.Checks[1].Name)
+	assert.Equal(rest.T(), "failed", res.Checks[1].Status)
+	require.NotNil(rest.T(), res.Checks[1].Error)
+	assert.Equal(rest.T(), "DB is unreachable", *res.Checks[1].Error)
+}
+
 func (rest *TestStatusREST) resetConfiguration() {
 	config, err := configuration.GetConfigurationData()
 	require.Nil(rest.T(), err)
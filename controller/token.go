@@ -12,17 +12,23 @@ import (
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/metric"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/test"
 	"github.com/fabric8-services/fabric8-auth/token"
 	"github.com/fabric8-services/fabric8-auth/token/keycloak"
 	"github.com/fabric8-services/fabric8-auth/token/link"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
+	"github.com/fabric8-services/fabric8-auth/token/session"
 	"github.com/fabric8-services/fabric8-auth/wit"
 
 	"github.com/goadesign/goa"
@@ -32,6 +38,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// externalTokenRefreshWindow is how long before its expiry a token of an external provider is refreshed when it's retrieved
+const externalTokenRefreshWindow = 5 * time.Minute
+
+// externalTokenRefreshTimeout is how long the provider is waited for when a token is refreshed, as the token is locked meanwhile
+const externalTokenRefreshTimeout = 10 * time.Second
+
 // TokenController implements the login resource.
 type TokenController struct {
 	*goa.Controller
@@ -71,47 +83,106 @@ func (c *TokenController) Keys(ctx *app.KeysTokenContext) error {
 }
 
 // Refresh obtains a new access token using the refresh token.
+// A refresh token issued by the Auth service is rotated: a new access token and a new refresh token are issued
+// and the refresh token can't be used anymore. Reusing it revokes the whole session.
+// Other refresh tokens are refreshed by Keycloak and exchanged for tokens issued by the Auth service.
 func (c *TokenController) Refresh(ctx *app.RefreshTokenContext) error {
 	refreshToken := ctx.Payload.RefreshToken
 	if refreshToken == nil {
 		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("refresh_token", nil).Expected("not nil"))
 	}
 
+	var t *token.TokenSet
+	claims, err := c.TokenManager.ParseRefreshToken(ctx, *refreshToken)
+	if err == nil {
+		t, err = session.Refresh(ctx, c.db, c.TokenManager, ctx.RequestData, *refreshToken, claims)
+	} else {
+		log.Debug(ctx, map[string]interface{}{
+			"err": err,
+		}, "not a refresh token issued by the Auth service. Refreshing it with Keycloak")
+		t, err = c.refreshKeycloakToken(ctx, *refreshToken)
+	}
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	ctx.ResponseData.Header().Set("Cache-Control", "no-cache")
+	return ctx.OK(convertToken(*t))
+}
+
+// refreshKeycloakToken refreshes the token with Keycloak and returns the tokens of a new session
+// for the identity of the refreshed token. The Keycloak tokens are returned if the identity doesn't exist.
+func (c *TokenController) refreshKeycloakToken(ctx *app.RefreshTokenContext, refreshToken string) (*token.TokenSet, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	endpoint, err := c.Configuration.GetKeycloakEndpointToken(ctx.RequestData)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"err": err,
 		}, "Unable to get Keycloak token endpoint URL")
-		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, errs.Wrap(err, "unable to get Keycloak token endpoint URL")))
+		return nil, errors.NewInternalError(ctx, errs.Wrap(err, "unable to get Keycloak token endpoint URL"))
 	}
 	res, err := client.PostForm(endpoint, url.Values{
 		"client_id":     {c.Configuration.GetKeycloakClientID()},
 		"client_secret": {c.Configuration.GetKeycloakSecret()},
-		"refresh_token": {*refreshToken},
+		"refresh_token": {refreshToken},
 		"grant_type":    {"refresh_token"},
 	})
 	if err != nil {
-		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, errs.Wrap(err, "error when obtaining token")))
+		return nil, errors.NewInternalError(ctx, errs.Wrap(err, "error when obtaining token"))
 	}
 	defer res.Body.Close()
 	switch res.StatusCode {
 	case 200:
 		// OK
 	case 401:
-		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(res.Status+" "+rest.ReadBody(res.Body)))
+		return nil, errors.NewUnauthorizedError(res.Status + " " + rest.ReadBody(res.Body))
 	case 400:
-		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(res.Status+" "+rest.ReadBody(res.Body)))
+		return nil, errors.NewUnauthorizedError(res.Status + " " + rest.ReadBody(res.Body))
 	default:
-		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, errs.New(res.Status+" "+rest.ReadBody(res.Body))))
+		return nil, errors.NewInternalError(ctx, errs.New(res.Status+" "+rest.ReadBody(res.Body)))
 	}
 
 	t, err := token.ReadTokenSet(ctx, res)
 	if err != nil {
-		return jsonapi.JSONErrorResponse(ctx, err)
+		return nil, err
 	}
-	ctx.ResponseData.Header().Set("Cache-Control", "no-cache")
-	return ctx.OK(convertToken(*t))
+	if t.AccessToken == nil {
+		return t, nil
+	}
+	claims, err := c.TokenManager.ParseToken(ctx, *t.AccessToken)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError(err.Error())
+	}
+	identityID, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError(err.Error())
+	}
+	identity, err := c.loadIdentityWithUser(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+	if identity == nil {
+		log.Info(ctx, map[string]interface{}{
+			"identity_id": identityID,
+		}, "no identity found for the refreshed Keycloak token. Returning the Keycloak token")
+		return t, nil
+	}
+	return session.Start(ctx, c.db, c.TokenManager, ctx.RequestData, *identity, claims.SessionState, "")
+}
+
+// loadIdentityWithUser returns the identity with its user or nil if the identity doesn't exist
+func (c *TokenController) loadIdentityWithUser(ctx context.Context, identityID uuid.UUID) (*account.Identity, error) {
+	var identity *account.Identity
+	err := application.Transactional(c.db, func(appl application.Application) error {
+		identities, err := appl.Identities().Query(account.IdentityFilterByID(identityID), account.IdentityWithUser())
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		if len(identities) > 0 {
+			identity = &identities[0]
+		}
+		return nil
+	})
+	return identity, err
 }
 
 func convertToken(t token.TokenSet) *app.AuthToken {
@@ -232,6 +303,9 @@ func (c *TokenController) Retrieve(ctx *app.RetrieveTokenContext) error {
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
+	defer func() {
+		metric.RecordExternalTokenOperation(metric.ExternalTokenRetrieve, providerConfig.TypeName(), ctx.ResponseData.Status == http.StatusOK)
+	}()
 
 	osConfig, ok := providerConfig.(*link.OpenShiftIdentityProvider)
 	if ok && token.IsSpecificServiceAccount(ctx, []string{"fabric8-oso-proxy", "fabric8-tenant"}) {
@@ -247,24 +321,42 @@ func (c *TokenController) Retrieve(ctx *app.RetrieveTokenContext) error {
 		return ctx.OK(&clusterToken)
 	}
 
+	providerName := providerConfig.TypeName()
 	externalToken, err := c.retrieveToken(ctx, providerConfig, *currentIdentity)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
+	reason := "missing"
 	if externalToken != nil {
-		updatedToken, err := c.updateProfileIfEmpty(ctx, providerConfig, externalToken, ctx.ForcePull)
-		if err != nil {
+		refreshedToken, err := c.refreshTokenIfExpiring(ctx, providerConfig, externalToken)
+		if err == nil {
+			updatedToken, err := c.updateProfileIfEmpty(ctx, providerConfig, refreshedToken, ctx.ForcePull)
+			if err != nil {
+				return jsonapi.JSONErrorResponse(ctx, err)
+			}
+			appResponse = modelToAppExternalToken(updatedToken)
+			return ctx.OK(&appResponse)
+		}
+		if unauthorized, _ := errors.IsUnauthorizedError(err); !unauthorized {
+			// the provider couldn't be reached, the account doesn't need to be linked again
 			return jsonapi.JSONErrorResponse(ctx, err)
 		}
-		appResponse = modelToAppExternalToken(updatedToken)
-		return ctx.OK(&appResponse)
+		if externalToken.RefreshToken != "" {
+			return c.linkRequired(ctx, providerName, "expired")
+		}
+		// the tokens obtained from Keycloak have no refresh token, but Keycloak can provide a new one
+		reason = "expired"
+		log.Info(ctx, map[string]interface{}{
+			"provider_name":     providerName,
+			"identity_id":       currentIdentity,
+			"external_token_id": externalToken.ID,
+		}, "External token expired and can't be refreshed. Will try to load from Keycloak.")
+	} else {
+		log.Info(ctx, map[string]interface{}{
+			"provider_name": providerName,
+			"identity_id":   currentIdentity,
+		}, "External token not found. Will try to load from Keycloak.")
 	}
-
-	providerName := providerConfig.TypeName()
-	log.Info(ctx, map[string]interface{}{
-		"provider_name": providerName,
-		"identity_id":   currentIdentity,
-	}, "External token not found. Will try to load from Keycloak.")
 	keycloakTokenResponse, err := c.keycloakExternalTokenService.Get(ctx, tokenString, c.getKeycloakExternalTokenURL(providerName))
 	if err != nil {
 		log.Warn(ctx, map[string]interface{}{
@@ -272,15 +364,10 @@ func (c *TokenController) Retrieve(ctx *app.RetrieveTokenContext) error {
 			"for":           ctx.For,
 			"provider_name": providerName,
 		}, "Unable to obtain external token from Keycloak. Account linking may be required.")
-
-		linkURL := rest.AbsoluteURL(ctx.RequestData, client.LinkTokenPath())
-		errorResponse := fmt.Sprintf("LINK url=%s, description=\"%s token is missing. Link %s account\"", linkURL, providerName, providerName)
-		ctx.ResponseData.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
-		ctx.ResponseData.Header().Set("WWW-Authenticate", errorResponse)
-		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("token is missing"))
+		return c.linkRequired(ctx, providerName, reason)
 	}
 
-	externalToken, err = c.saveKeycloakToken(ctx, *keycloakTokenResponse, providerConfig, *currentIdentity)
+	externalToken, err = c.saveKeycloakToken(ctx, *keycloakTokenResponse, providerConfig, *currentIdentity, externalToken)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -293,6 +380,16 @@ func (c *TokenController) Retrieve(ctx *app.RetrieveTokenContext) error {
 	return ctx.OK(&appResponse)
 }
 
+// linkRequired responds with an unauthorized error and a WWW-Authenticate header telling the client to link the account
+// because the token is missing or expired
+func (c *TokenController) linkRequired(ctx *app.RetrieveTokenContext, providerName string, reason string) error {
+	linkURL := rest.AbsoluteURL(ctx.RequestData, client.LinkTokenPath())
+	errorResponse := fmt.Sprintf("LINK url=%s, description=\"%s token is %s. Link %s account\"", linkURL, providerName, reason, providerName)
+	ctx.ResponseData.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
+	ctx.ResponseData.Header().Set("WWW-Authenticate", errorResponse)
+	return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("token is "+reason))
+}
+
 // Delete deletes the stored external provider token.
 func (c *TokenController) Delete(ctx *app.DeleteTokenContext) error {
 	currentIdentity, err := login.ContextIdentity(ctx)
@@ -306,6 +403,13 @@ func (c *TokenController) Delete(ctx *app.DeleteTokenContext) error {
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
+	defer func() {
+		deleted := ctx.ResponseData.Status == http.StatusOK
+		metric.RecordExternalTokenOperation(metric.ExternalTokenDelete, providerConfig.TypeName(), deleted)
+		audit.Record(ctx, c.db.AuditEvents(), audit.ExternalTokenDelete, *currentIdentity, providerConfig.TypeName(), audit.OutcomeOf(deleted), audit.Details{
+			"provider_id": providerConfig.ID(),
+		})
+	}()
 
 	// Delete from Keycloak
 	err = c.keycloakExternalTokenService.Delete(ctx, c.getKeycloakIdentityProviderURL(currentIdentity.String(), providerConfig.TypeName()))
@@ -335,6 +439,12 @@ func (c *TokenController) Delete(ctx *app.DeleteTokenContext) error {
 					return err
 				}
 			}
+			return outbox.RecordEvent(ctx, appl.OutboxEvents(), outbox.TokenDeleted, *currentIdentity, outbox.ExternalAccount{
+				IdentityID:   *currentIdentity,
+				ProviderID:   providerConfig.ID(),
+				ProviderName: providerConfig.TypeName(),
+				Username:     tokens[0].Username,
+			})
 		}
 		return nil
 	})
@@ -345,70 +455,252 @@ func (c *TokenController) Delete(ctx *app.DeleteTokenContext) error {
 	return ctx.OK([]byte{})
 }
 
-// Exchange provides OAuth2 token exchange. Currently only grant_type="client_credentials" is supported
-// allowing clients to authenticate using a service account ID and secret value.
+// RevokeSession revokes the refresh tokens of a login session of the current user.
+// The access tokens already issued for the session remain valid until they expire.
+func (c *TokenController) RevokeSession(ctx *app.RevokeSessionTokenContext) error {
+	currentIdentity, err := login.ContextIdentity(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(err.Error()))
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return session.Revoke(ctx, appl, *currentIdentity, ctx.ID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// Exchange provides OAuth2 token exchange. Two grant types are supported:
+// grant_type="client_credentials" allows clients to authenticate using a service account ID and secret value.
 // A service account token is returned as the result of successful exchange.
-// May be expanded in the future to support other exchange types.
+// grant_type="urn:ietf:params:oauth:grant-type:token-exchange" (RFC 8693) allows an authenticated service account
+// to exchange the access token of a user for a token restricted to the requested audience, which the service account
+// uses to act on behalf of the user.
+// grant_type="authorization_code" allows a public client which started the login with a code challenge (RFC 7636)
+// to exchange the authorization code and its code verifier for the tokens of the user.
 func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 	payload := ctx.Payload
 	if payload == nil {
 		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("not empty payload"))
 	}
+	if payload.GrantType == oauth.AuthorizationCodeGrantType {
+		return c.exchangeAuthorizationCode(ctx, payload)
+	}
 	if payload.ClientID == nil {
 		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("client_id", "nil").Expected("Service Account ID"))
 	}
 	if payload.ClientSecret == nil {
 		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("client_secret", "nil").Expected("Service Account secret"))
 	}
+	clientID := metric.UnknownClientID
+	actorID := uuid.Nil
+	if sa, found := c.Configuration.GetServiceAccounts()[*payload.ClientID]; found {
+		clientID = *payload.ClientID
+		actorID = uuid.FromStringOrNil(sa.ID)
+	}
+	defer func() {
+		metric.RecordServiceAccountExchange(clientID, payload.GrantType, ctx.ResponseData.Status == http.StatusOK)
+		if ctx.ResponseData.Status != http.StatusOK {
+			// the actor is the service account the client ID belongs to, if any, even though it could not be authenticated
+			audit.Record(ctx, c.db.AuditEvents(), audit.ServiceAccountExchange, actorID, *payload.ClientID, audit.Failure, audit.Details{
+				"grant_type": payload.GrantType,
+				"status":     ctx.ResponseData.Status,
+			})
+		}
+	}()
+	if payload.GrantType == token.TokenExchangeGrantType {
+		err := checkTokenExchangePayload(payload)
+		if err != nil {
+			return jsonapi.JSONErrorResponse(ctx, err)
+		}
+	}
 
-	sa, found := c.Configuration.GetServiceAccounts()[*payload.ClientID]
+	sa, err := c.authenticateServiceAccount(ctx, *payload.ClientID, *payload.ClientSecret)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	if payload.GrantType == token.TokenExchangeGrantType {
+		return c.exchangeSubjectToken(ctx, sa, *payload.SubjectToken, *payload.Audience)
+	}
+
+	tokenType := "bearer"
+	accessToken, err := c.TokenManager.GenerateServiceAccountToken(ctx.RequestData, sa.ID, sa.Name)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	pat := &app.OauthToken{
+		AccessToken: &accessToken,
+		TokenType:   &tokenType,
+	}
+	return ctx.OK(pat)
+}
+
+// checkTokenExchangePayload checks that the payload contains the parameters required by a RFC 8693 token exchange
+func checkTokenExchangePayload(payload *app.TokenExchange) error {
+	if payload.SubjectToken == nil || *payload.SubjectToken == "" {
+		return errors.NewBadParameterError("subject_token", "nil").Expected("user access token")
+	}
+	if payload.SubjectTokenType == nil || *payload.SubjectTokenType != token.AccessTokenType {
+		return errors.NewBadParameterError("subject_token_type", payload.SubjectTokenType).Expected(token.AccessTokenType)
+	}
+	if payload.RequestedTokenType != nil && *payload.RequestedTokenType != token.AccessTokenType {
+		return errors.NewBadParameterError("requested_token_type", *payload.RequestedTokenType).Expected(token.AccessTokenType)
+	}
+	if payload.Audience == nil || *payload.Audience == "" {
+		return errors.NewBadParameterError("audience", "nil").Expected("name of the service account of the target service")
+	}
+	return nil
+}
+
+// authenticateServiceAccount returns the service account with the given ID if the secret matches one of its secrets
+func (c *TokenController) authenticateServiceAccount(ctx context.Context, clientID string, clientSecret string) (*configuration.ServiceAccount, error) {
+	sa, found := c.Configuration.GetServiceAccounts()[clientID]
 	if !found {
 		log.Error(ctx, map[string]interface{}{
-			"client_id":     *payload.ClientID,
-			"client_secret": *payload.ClientSecret,
+			"client_id": clientID,
 		}, "Unknown Service Account ID")
-		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("invalid Service Account ID or secret"))
+		return nil, errors.NewUnauthorizedError("invalid Service Account ID or secret")
 	}
-	secret := []byte(*payload.ClientSecret)
+	secret := []byte(clientSecret)
 	for _, hash := range sa.Secrets {
 		if bcrypt.CompareHashAndPassword([]byte(hash), secret) == nil {
-			tokenType := "bearer"
-			accessToken, err := c.TokenManager.GenerateServiceAccountToken(ctx.RequestData, sa.ID, sa.Name)
-			if err != nil {
-				return jsonapi.JSONErrorResponse(ctx, err)
-			}
-			pat := &app.OauthToken{
-				AccessToken: &accessToken,
-				TokenType:   &tokenType,
-			}
-			return ctx.OK(pat)
+			return &sa, nil
 		}
 	}
 	log.Error(ctx, map[string]interface{}{
-		"client_id":     *payload.ClientID,
-		"client_secret": *payload.ClientSecret,
+		"client_id": clientID,
 	}, "Service Account secret doesn't match")
-	return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("invalid Service Account ID or secret"))
+	return nil, errors.NewUnauthorizedError("invalid Service Account ID or secret")
+}
+
+// exchangeSubjectToken issues a token for the service account to act on behalf of the subject of the subject token.
+// The audience must be the name of a configured service account.
+func (c *TokenController) exchangeSubjectToken(ctx *app.ExchangeTokenContext, sa *configuration.ServiceAccount, subjectToken string, audience string) error {
+	audienceFound := false
+	for _, target := range c.Configuration.GetServiceAccounts() {
+		if target.Name == audience {
+			audienceFound = true
+			break
+		}
+	}
+	if !audienceFound {
+		log.Error(ctx, map[string]interface{}{
+			"service_account_name": sa.Name,
+			"audience":             audience,
+		}, "unknown token exchange audience")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("audience", audience).Expected("name of the service account of the target service"))
+	}
+	tokenSet, err := c.TokenManager.ExchangeToken(ctx, ctx.RequestData, subjectToken, sa.ID, sa.Name, audience)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	issuedTokenType := token.AccessTokenType
+	expiresIn := int(*tokenSet.ExpiresIn)
+	ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+	return ctx.OK(&app.OauthToken{
+		AccessToken:     tokenSet.AccessToken,
+		TokenType:       tokenSet.TokenType,
+		IssuedTokenType: &issuedTokenType,
+		ExpiresIn:       &expiresIn,
+	})
 }
 
-func (c *TokenController) saveKeycloakToken(ctx context.Context, keycloakTokenResponse keycloak.KeycloakExternalTokenResponse, providerConfig link.ProviderConfig, currentIdentity uuid.UUID) (*provider.ExternalToken, error) {
+// exchangeAuthorizationCode starts a session for the user the authorization code was issued to at login,
+// if the code verifier matches the code challenge sent by the public client
+func (c *TokenController) exchangeAuthorizationCode(ctx *app.ExchangeTokenContext, payload *app.TokenExchange) error {
+	if payload.Code == nil || *payload.Code == "" {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("code", "nil").Expected("authorization code"))
+	}
+	if payload.CodeVerifier == nil || *payload.CodeVerifier == "" {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("code_verifier", "nil").Expected("code verifier of the code challenge"))
+	}
+	ref, err := oauth.LoadAuthorizationCode(ctx, c.db, *payload.Code, *payload.CodeVerifier)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	identity, err := c.loadIdentityWithUser(ctx, *ref.IdentityID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if identity == nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": ref.IdentityID,
+		}, "the identity of the authorization code doesn't exist")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("invalid authorization code"))
+	}
+	var apiClient string
+	referrerURL, err := url.Parse(ref.Referrer)
+	if err == nil {
+		apiClient = referrerURL.Query().Get("api_client")
+	}
+	tokenSet, err := session.Start(ctx, c.db, c.TokenManager, ctx.RequestData, *identity, ref.SessionState, apiClient)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	oauthToken := &app.OauthToken{
+		AccessToken:  tokenSet.AccessToken,
+		RefreshToken: tokenSet.RefreshToken,
+		TokenType:    tokenSet.TokenType,
+	}
+	if tokenSet.ExpiresIn != nil {
+		expiresIn := int(*tokenSet.ExpiresIn)
+		oauthToken.ExpiresIn = &expiresIn
+	}
+	if tokenSet.RefreshExpiresIn != nil {
+		refreshExpiresIn := int(*tokenSet.RefreshExpiresIn)
+		oauthToken.RefreshExpiresIn = &refreshExpiresIn
+	}
+	ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+	return ctx.OK(oauthToken)
+}
+
+// saveKeycloakToken saves the token obtained from Keycloak. The expired token is replaced if there is one,
+// otherwise the account is linked.
+func (c *TokenController) saveKeycloakToken(ctx context.Context, keycloakTokenResponse keycloak.KeycloakExternalTokenResponse, providerConfig link.ProviderConfig, currentIdentity uuid.UUID, expiredToken *provider.ExternalToken) (*provider.ExternalToken, error) {
 	var externalToken provider.ExternalToken
 	err := application.Transactional(c.db, func(appl application.Application) error {
 		externalToken = provider.ExternalToken{
 			Token:      keycloakTokenResponse.AccessToken,
+			TokenType:  keycloakTokenResponse.TokenType,
 			IdentityID: currentIdentity,
 			Scope:      providerConfig.Scopes(),
 			ProviderID: providerConfig.ID(),
 		}
-		err := appl.ExternalTokens().Create(ctx, &externalToken)
-		if err == nil {
+		if keycloakTokenResponse.ExpiresIn > 0 {
+			expiresAt := time.Now().Add(time.Duration(keycloakTokenResponse.ExpiresIn) * time.Second)
+			externalToken.ExpiresAt = &expiresAt
+		}
+		if expiredToken != nil {
+			externalToken.ID = expiredToken.ID
+			externalToken.Username = expiredToken.Username
+			err := appl.ExternalTokens().Save(ctx, &externalToken)
+			if err != nil {
+				return err
+			}
 			log.Info(ctx, map[string]interface{}{
 				"provider_name":     providerConfig.TypeName(),
 				"identity_id":       currentIdentity,
 				"external_token_id": externalToken.ID,
-			}, "no old token found. account linked & new token saved.")
+			}, "expired token replaced by the token obtained from Keycloak")
+			return nil
+		}
+		err := appl.ExternalTokens().Create(ctx, &externalToken)
+		if err != nil {
+			return err
 		}
-		return err
+		log.Info(ctx, map[string]interface{}{
+			"provider_name":     providerConfig.TypeName(),
+			"identity_id":       currentIdentity,
+			"external_token_id": externalToken.ID,
+		}, "no old token found. account linked & new token saved.")
+		return outbox.RecordEvent(ctx, appl.OutboxEvents(), outbox.IdentityLinked, currentIdentity, outbox.ExternalAccount{
+			IdentityID:   currentIdentity,
+			ProviderID:   providerConfig.ID(),
+			ProviderName: providerConfig.TypeName(),
+			Scope:        providerConfig.Scopes(),
+		})
 	})
 	return &externalToken, err
 }
@@ -431,6 +723,85 @@ func (c *TokenController) updateProfileIfEmpty(ctx context.Context, providerConf
 	return externalToken, nil
 }
 
+// refreshTokenIfExpiring refreshes the token through the provider if it expires within the refresh window, and saves
+// the new token. The token is returned as is if it can't be refreshed and has not expired yet, since it's still usable.
+// If the token has expired, an unauthorized error is returned when the provider rejects the refresh token
+// and an internal error when the provider can't be reached.
+func (c *TokenController) refreshTokenIfExpiring(ctx context.Context, providerConfig link.ProviderConfig, token *provider.ExternalToken) (*provider.ExternalToken, error) {
+	if !token.ExpiresWithin(externalTokenRefreshWindow) {
+		return token, nil
+	}
+	refreshed, err := c.refreshToken(ctx, providerConfig, token)
+	if err != nil {
+		log.Warn(ctx, map[string]interface{}{
+			"err":               err,
+			"provider_name":     providerConfig.TypeName(),
+			"identity_id":       token.IdentityID,
+			"external_token_id": token.ID,
+			"expires_at":        *token.ExpiresAt,
+		}, "unable to refresh the external token")
+		if token.ExpiresWithin(0) {
+			return nil, err
+		}
+		return token, nil
+	}
+	return refreshed, nil
+}
+
+// refreshToken obtains a new token from the provider with the refresh token, and saves it. The token is locked while
+// it is refreshed, so the concurrent requests don't refresh it again with a refresh token which may have been
+// invalidated by the provider: they return the token refreshed in the meantime instead.
+// Returns an unauthorized error if the token has no refresh token or if the provider rejects it.
+func (c *TokenController) refreshToken(ctx context.Context, providerConfig link.ProviderConfig, token *provider.ExternalToken) (*provider.ExternalToken, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.NewUnauthorizedError("the token has no refresh token")
+	}
+	// the provider is not waited for longer than the timeout, so the token is not locked until the client gives up
+	providerCtx := context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: externalTokenRefreshTimeout})
+	var refreshed *provider.ExternalToken
+	err := application.Transactional(c.db, func(appl application.Application) error {
+		current, err := appl.ExternalTokens().LoadForUpdate(ctx, token.ID)
+		if err != nil {
+			return err
+		}
+		if current.RefreshToken != token.RefreshToken || !current.ExpiresWithin(externalTokenRefreshWindow) {
+			refreshed = current
+			return nil
+		}
+		// the access token is not passed to the token source, so the token is refreshed even if it has not expired yet
+		providerToken, err := providerConfig.TokenSource(providerCtx, &oauth2.Token{RefreshToken: current.RefreshToken}).Token()
+		if err != nil {
+			return refreshError(ctx, err)
+		}
+		current.UpdateFromOAuth2Token(providerToken)
+		err = appl.ExternalTokens().Save(ctx, current)
+		if err != nil {
+			return err
+		}
+		log.Info(ctx, map[string]interface{}{
+			"provider_name":     providerConfig.TypeName(),
+			"identity_id":       current.IdentityID,
+			"external_token_id": current.ID,
+		}, "external token refreshed")
+		refreshed = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// refreshError returns an unauthorized error if the provider rejected the refresh token, because it is invalid or
+// has been revoked, and an internal error if the provider can't be reached or fails to respond
+func refreshError(ctx context.Context, err error) error {
+	if retrieveErr, ok := err.(*oauth2.RetrieveError); ok && retrieveErr.Response != nil &&
+		retrieveErr.Response.StatusCode >= http.StatusBadRequest && retrieveErr.Response.StatusCode < http.StatusInternalServerError {
+		return errors.NewUnauthorizedError(fmt.Sprintf("the refresh token is rejected by the provider: %s", retrieveErr.Response.Status))
+	}
+	return errors.NewInternalError(ctx, errs.Wrap(err, "unable to refresh the token"))
+}
+
 func (c *TokenController) retrieveToken(ctx context.Context, providerConfig link.ProviderConfig, currentIdentity uuid.UUID) (*provider.ExternalToken, error) {
 	var externalToken *provider.ExternalToken
 	err := application.Transactional(c.db, func(appl application.Application) error {
@@ -451,12 +822,25 @@ func (c *TokenController) retrieveToken(ctx context.Context, providerConfig link
 }
 
 func modelToAppExternalToken(externalToken provider.ExternalToken) app.ExternalToken {
-	return app.ExternalToken{
+	tokenType := externalToken.TokenType
+	if tokenType == "" {
+		// the type of the tokens stored before it was saved in the database
+		tokenType = "bearer"
+	}
+	appToken := app.ExternalToken{
 		Scope:       externalToken.Scope,
 		AccessToken: externalToken.Token,
-		TokenType:   "bearer", // We aren't saving the token_type in the database
+		TokenType:   tokenType,
 		Username:    &externalToken.Username,
 	}
+	if externalToken.ExpiresAt != nil {
+		expiresIn := int(time.Until(*externalToken.ExpiresAt).Seconds())
+		if expiresIn < 0 {
+			expiresIn = 0
+		}
+		appToken.ExpiresIn = &expiresIn
+	}
+	return appToken
 }
 
 // GenerateUserToken obtains the access token from Keycloak for the user
@@ -525,7 +909,12 @@ func (c *TokenController) Link(ctx *app.LinkTokenContext) error {
 		redirectURL = *ctx.Redirect
 	}
 
-	redirectLocation, err := c.LinkService.ProviderLocation(ctx, ctx.RequestData, currentIdentity.String(), ctx.For, redirectURL)
+	codeChallenge, err := oauth.NewCodeChallenge(ctx.CodeChallenge, ctx.CodeChallengeMethod)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	redirectLocation, err := c.LinkService.ProviderLocation(ctx, ctx.RequestData, currentIdentity.String(), ctx.For, redirectURL, codeChallenge)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -543,3 +932,13 @@ func (c *TokenController) Callback(ctx *app.CallbackTokenContext) error {
 	ctx.ResponseData.Header().Set("Location", redirectLocation)
 	return ctx.TemporaryRedirect()
 }
+
+// CompleteLink completes the account linking of a public client with the code verifier of the code challenge sent to the link request
+func (c *TokenController) CompleteLink(ctx *app.CompleteLinkTokenContext) error {
+	payload := ctx.Payload
+	redirectLocation, err := c.LinkService.CompleteLink(ctx, ctx.RequestData, payload.State, payload.Code, payload.CodeVerifier)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.RedirectLocation{RedirectLocation: redirectLocation})
+}
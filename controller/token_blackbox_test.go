@@ -2,6 +2,8 @@ package controller_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/fabric8-services/fabric8-auth/account"
@@ -9,9 +11,13 @@ import (
 	"github.com/fabric8-services/fabric8-auth/app/test"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
 	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+	"github.com/fabric8-services/fabric8-auth/token/session"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/goadesign/goa"
@@ -22,6 +28,12 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
+// codeVerifier and s256CodeChallenge are the example of RFC 7636 Appendix B
+const (
+	codeVerifier      = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	s256CodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
 type TestTokenREST struct {
 	gormtestsupport.DBTestSuite
 }
@@ -58,29 +70,195 @@ func (rest *TestTokenREST) TestRefreshTokenUsingNilTokenFails() {
 	assert.NotNil(t, err)
 }
 
+func (rest *TestTokenREST) TestRefreshSelfIssuedTokenRotatesRefreshToken() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	sessionState := uuid.NewV4().String()
+	tokenSet, sessionID := rest.startSession(identity, sessionState)
+
+	payload := &app.RefreshToken{RefreshToken: tokenSet.RefreshToken}
+	resp, newToken := test.RefreshTokenOK(t, service.Context, service, controller, payload)
+
+	require.Equal(t, "no-cache", resp.Header().Get("Cache-Control"))
+	validateToken(t, newToken, controller)
+	assert.NotEqual(t, *tokenSet.RefreshToken, *newToken.Token.RefreshToken)
+	claims, err := testtoken.TokenManager.ParseToken(context.Background(), *newToken.Token.AccessToken)
+	require.Nil(t, err)
+	assert.Equal(t, identity.ID.String(), claims.Subject)
+	assert.Equal(t, identity.Username, claims.Username)
+	assert.Equal(t, sessionState, claims.SessionState)
+	assert.Equal(t, sessionID.String(), claims.SessionID)
+	refreshClaims, err := testtoken.TokenManager.ParseRefreshToken(context.Background(), *newToken.Token.RefreshToken)
+	require.Nil(t, err)
+	assert.Equal(t, identity.ID.String(), refreshClaims.Subject)
+
+	// the rotated refresh token is stored as a child of the refresh token of the session
+	refreshTokens, err := rest.Application.RefreshTokens().ListBySession(context.Background(), sessionID)
+	require.Nil(t, err)
+	require.Len(t, refreshTokens, 2)
+	assert.NotNil(t, refreshTokens[0].RotatedAt)
+	require.NotNil(t, refreshTokens[1].ParentID)
+	assert.Equal(t, refreshTokens[0].ID, *refreshTokens[1].ParentID)
+	assert.Equal(t, refresh.Hash(*newToken.Token.RefreshToken), refreshTokens[1].TokenHash)
+}
+
+func (rest *TestTokenREST) TestRefreshReusedTokenRevokesSession() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	tokenSet, _ := rest.startSession(identity, "")
+	_, newToken := test.RefreshTokenOK(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: tokenSet.RefreshToken})
+
+	// when the rotated refresh token is reused
+	test.RefreshTokenUnauthorized(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: tokenSet.RefreshToken})
+
+	// then the refresh token obtained by rotation is revoked too
+	test.RefreshTokenUnauthorized(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: newToken.Token.RefreshToken})
+}
+
+func (rest *TestTokenREST) TestRefreshUnknownSelfIssuedTokenFails() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	// the refresh token is signed by the Auth service but has not been stored
+	tokenSet, err := testtoken.TokenManager.GenerateUserTokenSet(context.Background(), &goa.RequestData{Request: &http.Request{Host: "example.com"}}, identity, "", uuid.NewV4())
+	require.Nil(t, err)
+
+	payload := &app.RefreshToken{RefreshToken: tokenSet.RefreshToken}
+	test.RefreshTokenUnauthorized(t, service.Context, service, controller, payload)
+}
+
+func (rest *TestTokenREST) TestRevokeSessionNoContent() {
+	t := rest.T()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	service, controller := rest.SecuredControllerWithIdentity(identity)
+	tokenSet, sessionID := rest.startSession(identity, "")
+	otherTokenSet, _ := rest.startSession(identity, "")
+
+	test.RevokeSessionTokenNoContent(t, service.Context, service, controller, sessionID)
+
+	test.RefreshTokenUnauthorized(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: tokenSet.RefreshToken})
+	// the other sessions of the user are not revoked
+	test.RefreshTokenOK(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: otherTokenSet.RefreshToken})
+}
+
+func (rest *TestTokenREST) TestRevokeSessionOfAnotherUserNotFound() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	tokenSet, sessionID := rest.startSession(identity, "")
+
+	test.RevokeSessionTokenNotFound(t, service.Context, service, controller, sessionID)
+	test.RevokeSessionTokenNotFound(t, service.Context, service, controller, uuid.NewV4())
+
+	test.RefreshTokenOK(t, service.Context, service, controller, &app.RefreshToken{RefreshToken: tokenSet.RefreshToken})
+}
+
+func (rest *TestTokenREST) TestRevokeSessionUnauthorized() {
+	svc := goa.New("Token-Service")
+	controller := NewTokenController(svc, rest.Application, nil, nil, nil, testtoken.TokenManager, nil, rest.Configuration)
+	test.RevokeSessionTokenUnauthorized(rest.T(), svc.Context, svc, controller, uuid.NewV4())
+}
+
+func (rest *TestTokenREST) TestRevokeSessionWithRefreshTokenUnauthorized() {
+	t := rest.T()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	tokenSet, sessionID := rest.startSession(identity, "")
+	svc := rest.jwtSecuredService()
+
+	// the refresh token is signed by the Auth service but is not an access token
+	rw := revokeSession(svc, sessionID, *tokenSet.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	rw = revokeSession(svc, sessionID, *tokenSet.AccessToken)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+}
+
+func (rest *TestTokenREST) TestRevokeSessionWithExchangedTokenUnauthorized() {
+	t := rest.T()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	tokenSet, sessionID := rest.startSession(identity, "")
+	svc := rest.jwtSecuredService()
+	req := &goa.RequestData{Request: &http.Request{Host: "example.com"}}
+
+	// the exchanged tokens are only intended for the service accounts acting on behalf of the user
+	exchanged, err := testtoken.TokenManager.ExchangeToken(context.Background(), req, *tokenSet.AccessToken, "5dec5fdb-09e3-4453-b73f-5c828832b28e", "fabric8-wit", "fabric8-tenant")
+	require.Nil(t, err)
+	rw := revokeSession(svc, sessionID, *exchanged.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	exchanged, err = testtoken.TokenManager.ExchangeToken(context.Background(), req, *tokenSet.AccessToken, "5dec5fdb-09e3-4453-b73f-5c828832b28e", "fabric8-wit", rest.Configuration.GetKeycloakClientID())
+	require.Nil(t, err)
+	rw = revokeSession(svc, sessionID, *exchanged.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	// a token intended for another audience
+	foreign, err := testtoken.UpdateToken(*tokenSet.AccessToken, map[string]interface{}{"aud": "fabric8-tenant"})
+	require.Nil(t, err)
+	rw = revokeSession(svc, sessionID, foreign)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+// jwtSecuredService creates a service with the token controller mounted behind the JWT middleware
+func (rest *TestTokenREST) jwtSecuredService() *goa.Service {
+	svc := goa.New("Token-Service")
+	svc.Use(jsonapi.ErrorHandler(svc, true))
+	app.UseJWTMiddleware(svc, goajwt.New(testtoken.TokenManager, token.AccessTokenValidation(rest.Configuration.GetKeycloakClientID()), app.NewJWTSecurity()))
+	app.MountTokenController(svc, NewTokenController(svc, rest.Application, nil, nil, nil, testtoken.TokenManager, nil, rest.Configuration))
+	return svc
+}
+
+// revokeSession sends the request revoking the session through the middlewares of the service
+func revokeSession(svc *goa.Service, sessionID uuid.UUID, bearerToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("DELETE", "/api/token/sessions/"+sessionID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	rw := httptest.NewRecorder()
+	svc.Mux.ServeHTTP(rw, req)
+	return rw
+}
+
+// startSession starts a new session for the identity and returns its tokens and its ID
+func (rest *TestTokenREST) startSession(identity account.Identity, sessionState string) (*token.TokenSet, uuid.UUID) {
+	tokenSet, err := session.Start(context.Background(), rest.Application, testtoken.TokenManager, &goa.RequestData{Request: &http.Request{Host: "example.com"}}, identity, sessionState, "")
+	require.Nil(rest.T(), err)
+	claims, err := testtoken.TokenManager.ParseRefreshToken(context.Background(), *tokenSet.RefreshToken)
+	require.Nil(rest.T(), err)
+	sessionID, err := uuid.FromString(claims.SessionID)
+	require.Nil(rest.T(), err)
+	return tokenSet, sessionID
+}
+
 func (rest *TestTokenREST) TestLinkForNonExistentUserFails() {
 	service, controller := rest.SecuredControllerWithNonExistentIdentity()
 
 	redirect := "https://openshift.io"
-	test.LinkTokenUnauthorized(rest.T(), service.Context, service, controller, "https://github.com/org/repo", &redirect)
+	test.LinkTokenUnauthorized(rest.T(), service.Context, service, controller, nil, nil, "https://github.com/org/repo", &redirect)
 }
 
 func (rest *TestTokenREST) TestLinkNoRedirectNoReferrerFails() {
 	service, controller := rest.SecuredController()
 
-	test.LinkTokenBadRequest(rest.T(), service.Context, service, controller, "https://github.com/org/repo", nil)
+	test.LinkTokenBadRequest(rest.T(), service.Context, service, controller, nil, nil, "https://github.com/org/repo", nil)
 }
 
 func (rest *TestTokenREST) TestLinkOK() {
 	service, controller := rest.SecuredController()
 
 	redirect := "https://openshift.io"
-	_, redirectLocation := test.LinkTokenOK(rest.T(), service.Context, service, controller, "https://github.com/org/repo", &redirect)
+	_, redirectLocation := test.LinkTokenOK(rest.T(), service.Context, service, controller, nil, nil, "https://github.com/org/repo", &redirect)
 	require.NotNil(rest.T(), redirectLocation)
 	require.Equal(rest.T(), "providerLocation", redirectLocation.RedirectLocation)
 
 	// Multiple "for" resources
-	_, redirectLocation = test.LinkTokenOK(rest.T(), service.Context, service, controller, "https://github.com/org/repo,"+rest.Configuration.GetOpenShiftClientApiUrl(), &redirect)
+	_, redirectLocation = test.LinkTokenOK(rest.T(), service.Context, service, controller, nil, nil, "https://github.com/org/repo,"+rest.Configuration.GetOpenShiftClientApiUrl(), &redirect)
 	require.NotNil(rest.T(), redirectLocation)
 	require.Equal(rest.T(), "providerLocation", redirectLocation.RedirectLocation)
 }
@@ -95,6 +273,14 @@ func (rest *TestTokenREST) TestLinkCallbackRedirects() {
 	require.Equal(rest.T(), "originalLocation", location[0])
 }
 
+func (rest *TestTokenREST) TestCompleteLinkOK() {
+	service, controller := rest.SecuredController()
+
+	_, redirectLocation := test.CompleteLinkTokenOK(rest.T(), service.Context, service, controller, &app.LinkCompletion{Code: "code", State: uuid.NewV4().String(), CodeVerifier: codeVerifier})
+	require.NotNil(rest.T(), redirectLocation)
+	require.Equal(rest.T(), "originalLocation", redirectLocation.RedirectLocation)
+}
+
 func (rest *TestTokenREST) TestExchangeFailsWithIncompletePayload() {
 	service, controller := rest.SecuredController()
 
@@ -135,6 +321,156 @@ func (rest *TestTokenREST) checkServiceAccountCredentials(name string, id string
 	assert.True(rest.T(), token.IsSpecificServiceAccount(ctx, []string{name}))
 }
 
+func (rest *TestTokenREST) TestTokenExchangeOK() {
+	service, controller := rest.SecuredController()
+	subjectToken, err := testtoken.GenerateTokenWithClaims(nil)
+	require.Nil(rest.T(), err)
+	subjectClaims, err := testtoken.TokenManager.ParseToken(context.Background(), subjectToken)
+	require.Nil(rest.T(), err)
+
+	_, exchanged := test.ExchangeTokenOK(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", subjectToken, "fabric8-tenant"))
+	require.NotNil(rest.T(), exchanged.AccessToken)
+	assert.Equal(rest.T(), "bearer", *exchanged.TokenType)
+	assert.Equal(rest.T(), token.AccessTokenType, *exchanged.IssuedTokenType)
+	require.NotNil(rest.T(), exchanged.ExpiresIn)
+	assert.True(rest.T(), *exchanged.ExpiresIn > 0)
+
+	claims, err := testtoken.TokenManager.ParseToken(context.Background(), *exchanged.AccessToken)
+	require.Nil(rest.T(), err)
+	assert.Equal(rest.T(), subjectClaims.Subject, claims.Subject)
+	assert.Equal(rest.T(), subjectClaims.Username, claims.Username)
+	assert.Equal(rest.T(), subjectClaims.Email, claims.Email)
+	assert.Equal(rest.T(), subjectClaims.ExpiresAt, claims.ExpiresAt)
+	assert.Equal(rest.T(), "fabric8-tenant", claims.Audience)
+	require.NotNil(rest.T(), claims.Actor)
+	assert.Equal(rest.T(), "5dec5fdb-09e3-4453-b73f-5c828832b28e", claims.Actor.Subject)
+	assert.Equal(rest.T(), "fabric8-wit", claims.Actor.ServiceAccountName)
+	assert.Nil(rest.T(), claims.Actor.Actor)
+
+	// The exchanged token does not authenticate the service account itself
+	mapClaims, err := testtoken.TokenManager.ParseTokenWithMapClaims(context.Background(), *exchanged.AccessToken)
+	require.Nil(rest.T(), err)
+	ctx := goajwt.WithJWT(context.Background(), jwt.NewWithClaims(jwt.SigningMethodRS512, mapClaims))
+	assert.False(rest.T(), token.IsServiceAccount(ctx))
+}
+
+func (rest *TestTokenREST) TestTokenExchangeOfExchangedTokenOK() {
+	service, controller := rest.SecuredController()
+	subjectToken, err := testtoken.GenerateTokenWithClaims(nil)
+	require.Nil(rest.T(), err)
+	_, exchanged := test.ExchangeTokenOK(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", subjectToken, "fabric8-tenant"))
+
+	// The exchanged token can only be exchanged again by the service it is intended for
+	test.ExchangeTokenUnauthorized(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", *exchanged.AccessToken, "fabric8-oso-proxy"))
+	_, chained := test.ExchangeTokenOK(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("c211f1bd-17a7-4f8c-9f80-0917d167889d", "tenantsecretNew", *exchanged.AccessToken, "fabric8-oso-proxy"))
+
+	claims, err := testtoken.TokenManager.ParseToken(context.Background(), *chained.AccessToken)
+	require.Nil(rest.T(), err)
+	assert.Equal(rest.T(), "fabric8-oso-proxy", claims.Audience)
+	require.NotNil(rest.T(), claims.Actor)
+	assert.Equal(rest.T(), "fabric8-tenant", claims.Actor.ServiceAccountName)
+	require.NotNil(rest.T(), claims.Actor.Actor)
+	assert.Equal(rest.T(), "fabric8-wit", claims.Actor.Actor.ServiceAccountName)
+}
+
+func (rest *TestTokenREST) TestTokenExchangeFailsWithInvalidPayload() {
+	service, controller := rest.SecuredController()
+	subjectToken, err := testtoken.GenerateTokenWithClaims(nil)
+	require.Nil(rest.T(), err)
+
+	// missing subject token
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", "", "fabric8-tenant"))
+	// missing subject token type
+	payload := rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", subjectToken, "fabric8-tenant")
+	payload.SubjectTokenType = nil
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, payload)
+	// missing audience
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", subjectToken, ""))
+	// unknown audience
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", subjectToken, "unknown-service"))
+	// invalid subject token
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", "invalid", "fabric8-tenant"))
+	// service account token as subject token
+	saToken, err := testtoken.TokenManager.GenerateServiceAccountToken(&goa.RequestData{Request: &http.Request{Host: "example.com"}}, "c211f1bd-17a7-4f8c-9f80-0917d167889d", "fabric8-tenant")
+	require.Nil(rest.T(), err)
+	test.ExchangeTokenBadRequest(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "witsecret", saToken, "fabric8-tenant"))
+}
+
+func (rest *TestTokenREST) TestTokenExchangeWithWrongCredentialsFails() {
+	service, controller := rest.SecuredController()
+	subjectToken, err := testtoken.GenerateTokenWithClaims(nil)
+	require.Nil(rest.T(), err)
+
+	test.ExchangeTokenUnauthorized(rest.T(), service.Context, service, controller, rest.tokenExchangePayload("5dec5fdb-09e3-4453-b73f-5c828832b28e", "wrongsecret", subjectToken, "fabric8-tenant"))
+}
+
+func (rest *TestTokenREST) TestExchangeAuthorizationCodeOK() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	code, err := oauth.SaveAuthorizationCode(context.Background(), rest.Application, "https://openshift.io/home", oauth.CodeChallenge{Challenge: s256CodeChallenge, Method: oauth.CodeChallengeMethodS256}, identity.ID, uuid.NewV4().String())
+	require.Nil(t, err)
+
+	_, tokens := test.ExchangeTokenOK(t, service.Context, service, controller, rest.authorizationCodePayload(code, codeVerifier))
+	require.NotNil(t, tokens.AccessToken)
+	require.NotNil(t, tokens.RefreshToken)
+	require.NotNil(t, tokens.ExpiresIn)
+	require.NotNil(t, tokens.RefreshExpiresIn)
+	claims, err := testtoken.TokenManager.ParseToken(context.Background(), *tokens.AccessToken)
+	require.Nil(t, err)
+	assert.Equal(t, identity.ID.String(), claims.Subject)
+
+	// the authorization code can be exchanged only once
+	test.ExchangeTokenUnauthorized(t, service.Context, service, controller, rest.authorizationCodePayload(code, codeVerifier))
+}
+
+func (rest *TestTokenREST) TestExchangeAuthorizationCodeWithWrongCodeVerifierFails() {
+	t := rest.T()
+	service, controller := rest.SecuredController()
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(t, err)
+	code, err := oauth.SaveAuthorizationCode(context.Background(), rest.Application, "https://openshift.io/home", oauth.CodeChallenge{Challenge: s256CodeChallenge, Method: oauth.CodeChallengeMethodS256}, identity.ID, "")
+	require.Nil(t, err)
+
+	test.ExchangeTokenUnauthorized(t, service.Context, service, controller, rest.authorizationCodePayload(code, s256CodeChallenge))
+	// the authorization code is deleted after a failed attempt
+	test.ExchangeTokenUnauthorized(t, service.Context, service, controller, rest.authorizationCodePayload(code, codeVerifier))
+	// unknown authorization code
+	test.ExchangeTokenUnauthorized(t, service.Context, service, controller, rest.authorizationCodePayload(uuid.NewV4().String(), codeVerifier))
+	// missing code or code verifier
+	test.ExchangeTokenBadRequest(t, service.Context, service, controller, rest.authorizationCodePayload("", codeVerifier))
+	test.ExchangeTokenBadRequest(t, service.Context, service, controller, rest.authorizationCodePayload(uuid.NewV4().String(), ""))
+}
+
+func (rest *TestTokenREST) authorizationCodePayload(code string, codeVerifier string) *app.TokenExchange {
+	payload := &app.TokenExchange{GrantType: oauth.AuthorizationCodeGrantType}
+	if code != "" {
+		payload.Code = &code
+	}
+	if codeVerifier != "" {
+		payload.CodeVerifier = &codeVerifier
+	}
+	return payload
+}
+
+func (rest *TestTokenREST) tokenExchangePayload(clientID string, clientSecret string, subjectToken string, audience string) *app.TokenExchange {
+	subjectTokenType := token.AccessTokenType
+	payload := &app.TokenExchange{
+		GrantType:        token.TokenExchangeGrantType,
+		ClientID:         &clientID,
+		ClientSecret:     &clientSecret,
+		SubjectTokenType: &subjectTokenType,
+	}
+	if subjectToken != "" {
+		payload.SubjectToken = &subjectToken
+	}
+	if audience != "" {
+		payload.Audience = &audience
+	}
+	return payload
+}
+
 func validateToken(t *testing.T, token *app.AuthToken, controler *TokenController) {
 	assert.NotNil(t, token, "Token data is nil")
 	assert.NotEmpty(t, token.Token.AccessToken, "Access token is empty")
@@ -148,10 +484,14 @@ func validateToken(t *testing.T, token *app.AuthToken, controler *TokenControlle
 type DummyLinkService struct {
 }
 
-func (s *DummyLinkService) ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string) (string, error) {
+func (s *DummyLinkService) ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string, codeChallenge *oauth.CodeChallenge) (string, error) {
 	return "providerLocation", nil
 }
 
 func (s *DummyLinkService) Callback(ctx context.Context, req *goa.RequestData, state string, code string) (string, error) {
 	return "originalLocation", nil
 }
+
+func (s *DummyLinkService) CompleteLink(ctx context.Context, req *goa.RequestData, state string, code string, codeVerifier string) (string, error) {
+	return "originalLocation", nil
+}
@@ -154,6 +154,11 @@ func (m *MockIdentityRepository) Delete(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// HardDelete removes a single record from the database.
+func (m *MockIdentityRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
 // Query expose an open ended Query model
 func (m *MockIdentityRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]account.Identity, error) {
 	var identities []account.Identity
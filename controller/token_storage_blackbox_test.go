@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
@@ -47,7 +48,7 @@ func (rest *TestTokenStorageREST) SetupTest() {
 	rest.DBTestSuite.SetupTest()
 	rest.mockKeycloakExternalTokenServiceClient = newMockKeycloakExternalTokenServiceClient()
 	rest.identityRepository = account.NewIdentityRepository(rest.DB)
-	rest.externalTokenRepository = provider.NewExternalTokenRepository(rest.DB)
+	rest.externalTokenRepository = provider.NewExternalTokenRepository(rest.DB, rest.TokenCipher)
 	rest.userRepository = account.NewUserRepository(rest.DB)
 	rest.providerConfigFactory = link.NewOauthProviderFactory(rest.Configuration)
 	rest.dummyProviderConfigFactory = &testsupport.DummyProviderFactory{Token: uuid.NewV4().String(), Config: rest.Configuration}
@@ -243,6 +244,201 @@ func (rest *TestTokenStorageREST) retrieveExternalTokenFromDBSuccess(scenario st
 	return identity, expectedToken
 }
 
+func (rest *TestTokenStorageREST) TestRetrieveExternalTokenGitLabAndBitbucketPresentInDB() {
+	for providerID, forResource := range map[string]string{
+		link.GitLabProviderID:    "https://gitlab.com/a/b",
+		link.BitbucketProviderID: "https://bitbucket.org/a/b",
+	} {
+		// given
+		identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+		require.Nil(rest.T(), err)
+		rest.mockKeycloakExternalTokenServiceClient.scenario = "unlinked"
+		storedToken := provider.ExternalToken{
+			ProviderID: uuid.FromStringOrNil(providerID),
+			Scope:      "testscope",
+			IdentityID: identity.ID,
+			Token:      "1234-from-db",
+			Username:   "1234-from-dbtestuser",
+		}
+		err = rest.externalTokenRepository.Create(context.Background(), &storedToken)
+		require.Nil(rest.T(), err)
+		service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+		// when
+		_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, forResource, nil)
+		// then
+		assert.Equal(rest.T(), storedToken.Token, tokenResponse.AccessToken)
+		assert.Equal(rest.T(), storedToken.Username, *tokenResponse.Username)
+	}
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExternalTokenRefreshedBeforeExpiry() {
+	// given a token expiring in a minute
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(time.Minute)
+	storedToken := rest.createGitHubToken(identity, "refresh-1234", &expiresAt)
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the token issued by the provider is returned and saved
+	assert.Equal(rest.T(), rest.dummyProviderConfigFactory.Token, tokenResponse.AccessToken)
+	assert.Equal(rest.T(), "bearer", tokenResponse.TokenType)
+	require.NotNil(rest.T(), tokenResponse.ExpiresIn)
+	assert.InDelta(rest.T(), 3600, *tokenResponse.ExpiresIn, 5)
+	loadedToken, err := rest.externalTokenRepository.Load(context.Background(), storedToken.ID)
+	require.Nil(rest.T(), err)
+	assert.Equal(rest.T(), rest.dummyProviderConfigFactory.Token, loadedToken.Token)
+	assert.Equal(rest.T(), "refresh-1234", loadedToken.RefreshToken)
+	require.NotNil(rest.T(), loadedToken.ExpiresAt)
+	assert.True(rest.T(), loadedToken.ExpiresAt.After(time.Now().Add(55*time.Minute)))
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExternalTokenNotExpiringNotRefreshed() {
+	// given
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(time.Hour)
+	storedToken := rest.createGitHubToken(identity, "refresh-1234", &expiresAt)
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then
+	assert.Equal(rest.T(), storedToken.Token, tokenResponse.AccessToken)
+	require.NotNil(rest.T(), tokenResponse.ExpiresIn)
+	assert.InDelta(rest.T(), 3600, *tokenResponse.ExpiresIn, 5)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExternalTokenWithoutExpiry() {
+	// given
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	storedToken := rest.createGitHubToken(identity, "", nil)
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then
+	assert.Equal(rest.T(), storedToken.Token, tokenResponse.AccessToken)
+	assert.Nil(rest.T(), tokenResponse.ExpiresIn)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExternalTokenExpiringNotRefreshable() {
+	// given a token expiring in a minute which can't be refreshed
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(time.Minute)
+	storedToken := rest.createGitHubToken(identity, "", &expiresAt)
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the token is still usable
+	assert.Equal(rest.T(), storedToken.Token, tokenResponse.AccessToken)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExpiredExternalTokenRefreshFails() {
+	// given an expired token
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(-time.Minute)
+	rest.createGitHubToken(identity, "refresh-1234", &expiresAt)
+	rest.dummyProviderConfigFactory.RefreshFail = true
+	defer func() {
+		rest.dummyProviderConfigFactory.RefreshFail = false // reset to default
+	}()
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	rw, _ := test.RetrieveTokenUnauthorized(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the account must be linked again
+	assert.Contains(rest.T(), rw.Header().Get("WWW-Authenticate"), "github token is expired. Link github account")
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExpiredExternalTokenRefreshUnavailable() {
+	// given an expired token
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(-time.Minute)
+	storedToken := rest.createGitHubToken(identity, "refresh-1234", &expiresAt)
+	rest.dummyProviderConfigFactory.RefreshUnavailable = true
+	defer func() {
+		rest.dummyProviderConfigFactory.RefreshUnavailable = false // reset to default
+	}()
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	rw, _ := test.RetrieveTokenInternalServerError(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the account doesn't need to be linked again and the token can be refreshed later
+	assert.Empty(rest.T(), rw.Header().Get("WWW-Authenticate"))
+	loadedToken, err := rest.externalTokenRepository.Load(context.Background(), storedToken.ID)
+	require.Nil(rest.T(), err)
+	assert.Equal(rest.T(), "refresh-1234", loadedToken.RefreshToken)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExpiringExternalTokenRefreshUnavailable() {
+	// given a token expiring in a minute
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(time.Minute)
+	storedToken := rest.createGitHubToken(identity, "refresh-1234", &expiresAt)
+	rest.dummyProviderConfigFactory.RefreshUnavailable = true
+	defer func() {
+		rest.dummyProviderConfigFactory.RefreshUnavailable = false // reset to default
+	}()
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the token is still usable
+	assert.Equal(rest.T(), storedToken.Token, tokenResponse.AccessToken)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExpiredExternalTokenWithoutRefreshTokenLoadedFromKeycloak() {
+	// given an expired token obtained from Keycloak, which has no refresh token
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(-time.Minute)
+	storedToken := rest.createGitHubToken(identity, "", &expiresAt)
+	rest.mockKeycloakExternalTokenServiceClient.scenario = "positive"
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	_, tokenResponse := test.RetrieveTokenOK(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the token obtained from Keycloak is returned and replaces the expired one
+	assert.Equal(rest.T(), positiveKCResponseGithub().AccessToken, tokenResponse.AccessToken)
+	tokens, err := rest.externalTokenRepository.LoadByProviderIDAndIdentityID(context.Background(), storedToken.ProviderID, identity.ID)
+	require.Nil(rest.T(), err)
+	require.Len(rest.T(), tokens, 1)
+	assert.Equal(rest.T(), storedToken.ID, tokens[0].ID)
+	assert.Equal(rest.T(), positiveKCResponseGithub().AccessToken, tokens[0].Token)
+	assert.Nil(rest.T(), tokens[0].ExpiresAt)
+}
+
+func (rest *TestTokenStorageREST) TestRetrieveExpiredExternalTokenWithoutRefreshTokenUnlinkedInKeycloak() {
+	// given an expired token without refresh token, which Keycloak can't provide anymore
+	identity, err := testsupport.CreateTestIdentity(rest.DB, uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	expiresAt := time.Now().Add(-time.Minute)
+	rest.createGitHubToken(identity, "", &expiresAt)
+	rest.mockKeycloakExternalTokenServiceClient.scenario = "unlinked"
+	service, controller := rest.SecuredControllerWithIdentityAndDummyProviderFactory(identity)
+	// when
+	rw, _ := test.RetrieveTokenUnauthorized(rest.T(), service.Context, service, controller, "https://github.com/a/b", nil)
+	// then the account must be linked again
+	assert.Contains(rest.T(), rw.Header().Get("WWW-Authenticate"), "github token is expired. Link github account")
+}
+
+// createGitHubToken stores a GitHub token of the identity with the given refresh token and expiry
+func (rest *TestTokenStorageREST) createGitHubToken(identity account.Identity, refreshToken string, expiresAt *time.Time) provider.ExternalToken {
+	externalToken := provider.ExternalToken{
+		ProviderID:   uuid.FromStringOrNil(link.GitHubProviderID),
+		Scope:        "testscope",
+		IdentityID:   identity.ID,
+		Token:        "1234-from-db",
+		Username:     "1234-from-dbtestuser",
+		RefreshToken: refreshToken,
+		TokenType:    "bearer",
+		ExpiresAt:    expiresAt,
+	}
+	err := rest.externalTokenRepository.Create(context.Background(), &externalToken)
+	require.Nil(rest.T(), err)
+	return externalToken
+}
+
 func (rest *TestTokenStorageREST) TestRetrieveExternalTokenBadRequest() {
 	identity := testsupport.TestIdentity
 	service, controller := rest.SecuredControllerWithIdentity(identity)
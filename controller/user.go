@@ -3,10 +3,13 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/export"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	autherrors "github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/token"
@@ -74,3 +77,89 @@ func (c *UserController) Show(ctx *app.ShowUserContext) error {
 		})
 	})
 }
+
+// Export returns all the data stored about the authorized user
+func (c *UserController) Export(ctx *app.ExportUserContext) error {
+	id, err := c.tokenManager.Locate(ctx)
+	if err != nil {
+		jerrors, _ := jsonapi.ErrorToJSONAPIErrors(ctx, goa.ErrBadRequest(err.Error()))
+		return ctx.BadRequest(jerrors)
+	}
+	var data *export.Data
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		data, err = export.Collect(ctx, appl, id)
+		return err
+	})
+	if err != nil {
+		if notFound, _ := autherrors.IsNotFoundError(err); notFound {
+			return jsonapi.JSONErrorResponse(ctx, autherrors.NewUnauthorizedError(fmt.Sprintf("auth token contains id %s of unknown Identity", id)))
+		}
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(ConvertToAppUserExport(data))
+}
+
+// ConvertToAppUserExport converts the data stored about a user to a response resource
+func ConvertToAppUserExport(data *export.Data) *app.UserExport {
+	res := &app.UserExport{
+		ExportedAt:          time.Now(),
+		Identities:          []*app.UserExportIdentity{},
+		ExternalAccounts:    []*app.UserExportExternalAccount{},
+		RoleAssignments:     []*app.UserExportRoleAssignment{},
+		SpaceCollaborations: []*app.UserExportSpaceCollaboration{},
+	}
+	if data.User != nil {
+		res.User = &app.UserExportUser{
+			ID:                 data.User.ID,
+			CreatedAt:          data.User.CreatedAt,
+			UpdatedAt:          data.User.UpdatedAt,
+			Email:              data.User.Email,
+			FullName:           data.User.FullName,
+			ImageURL:           data.User.ImageURL,
+			Bio:                data.User.Bio,
+			URL:                data.User.URL,
+			Company:            data.User.Company,
+			Cluster:            data.User.Cluster,
+			ContextInformation: data.User.ContextInformation,
+			Deactivated:        data.User.Deactivated,
+			ApprovalState:      data.User.ApprovalState,
+		}
+	}
+	for _, identity := range data.Identities {
+		res.Identities = append(res.Identities, &app.UserExportIdentity{
+			ID:                    identity.ID,
+			CreatedAt:             identity.CreatedAt,
+			UpdatedAt:             identity.UpdatedAt,
+			Username:              identity.Username,
+			ProviderType:          identity.ProviderType,
+			ProfileURL:            identity.ProfileURL,
+			RegistrationCompleted: identity.RegistrationCompleted,
+		})
+	}
+	for _, externalAccount := range data.ExternalAccounts {
+		res.ExternalAccounts = append(res.ExternalAccounts, &app.UserExportExternalAccount{
+			IdentityID: externalAccount.IdentityID,
+			ProviderID: externalAccount.ProviderID,
+			Username:   externalAccount.Username,
+			Scope:      externalAccount.Scope,
+			LinkedAt:   externalAccount.LinkedAt,
+		})
+	}
+	for _, roleAssignment := range data.RoleAssignments {
+		res.RoleAssignments = append(res.RoleAssignments, &app.UserExportRoleAssignment{
+			IdentityID:   roleAssignment.IdentityID,
+			ResourceID:   roleAssignment.ResourceID,
+			ResourceType: roleAssignment.ResourceType,
+			Role:         roleAssignment.Role,
+			AssignedAt:   roleAssignment.AssignedAt,
+		})
+	}
+	for _, spaceCollaboration := range data.SpaceCollaborations {
+		res.SpaceCollaborations = append(res.SpaceCollaborations, &app.UserExportSpaceCollaboration{
+			IdentityID: spaceCollaboration.IdentityID,
+			SpaceID:    spaceCollaboration.SpaceID,
+			AddedAt:    spaceCollaboration.AddedAt,
+		})
+	}
+	return res
+}
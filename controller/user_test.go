@@ -11,15 +11,20 @@ import (
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/app/test"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
 	res "github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/resource"
 	"github.com/fabric8-services/fabric8-auth/space"
 	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+	"github.com/fabric8-services/fabric8-auth/webhook"
 
 	token "github.com/dgrijalva/jwt-go"
 	"github.com/goadesign/goa"
@@ -224,6 +229,11 @@ func (m TestIdentityRepository) Delete(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+// HardDelete removes a single record from the database.
+func (m TestIdentityRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	return m.Delete(ctx, id)
+}
+
 // Query expose an open ended Query model
 func (m TestIdentityRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]account.Identity, error) {
 	return []account.Identity{*m.Identity}, nil
@@ -273,11 +283,21 @@ func (m TestUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// HardDelete removes a single record from the database.
+func (m TestUserRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
+	return m.Delete(ctx, id)
+}
+
 // List return all users
 func (m TestUserRepository) List(ctx context.Context) ([]account.User, error) {
 	return []account.User{*m.User}, nil
 }
 
+// ListByApprovalState returns the users in the given approval state
+func (m TestUserRepository) ListByApprovalState(ctx context.Context, approvalState string, start int, limit int) ([]account.User, error) {
+	return []account.User{*m.User}, nil
+}
+
 // Query expose an open ended Query model
 func (m TestUserRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]account.User, error) {
 	return []account.User{*m.User}, nil
@@ -310,6 +330,26 @@ func (g *GormTestBase) ExternalTokens() provider.ExternalTokenRepository {
 	return nil
 }
 
+func (g *GormTestBase) RefreshTokens() refresh.RefreshTokenRepository {
+	return nil
+}
+
+func (g *GormTestBase) OutboxEvents() outbox.EventRepository {
+	return nil
+}
+
+func (g *GormTestBase) WebhookSubscriptions() webhook.SubscriptionRepository {
+	return nil
+}
+
+func (g *GormTestBase) WebhookDeliveries() webhook.DeliveryRepository {
+	return nil
+}
+
+func (g *GormTestBase) AuditEvents() audit.EventRepository {
+	return nil
+}
+
 func (g *GormTestBase) ResourceRepository() res.ResourceRepository {
 	return nil
 }
@@ -318,6 +358,18 @@ func (g *GormTestBase) ResourceTypeRepository() res.ResourceTypeRepository {
 	return nil
 }
 
+func (g *GormTestBase) ResourceTypeScopeRepository() res.ResourceTypeScopeRepository {
+	return nil
+}
+
+func (g *GormTestBase) RoleRepository() role.RoleRepository {
+	return nil
+}
+
+func (g *GormTestBase) IdentityRoleRepository() role.IdentityRoleRepository {
+	return nil
+}
+
 func (g *GormTestBase) DB() *gorm.DB {
 	return nil
 }
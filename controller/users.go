@@ -7,17 +7,20 @@ import (
 	"time"
 
 	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/admin"
+	"github.com/fabric8-services/fabric8-auth/account/export"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login"
 	linkAPI "github.com/fabric8-services/fabric8-auth/login/link"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/token"
-	"github.com/fabric8-services/fabric8-auth/wit"
 
 	"github.com/goadesign/goa"
 	goajwt "github.com/goadesign/goa/middleware/security/jwt"
@@ -32,7 +35,6 @@ type UsersController struct {
 	db                  application.DB
 	config              UsersControllerConfiguration
 	userProfileService  login.UserProfileService
-	RemoteWITService    wit.RemoteWITService
 	keycloakLinkService linkAPI.KeycloakIDPService
 }
 
@@ -41,7 +43,6 @@ type UsersControllerConfiguration interface {
 	GetCacheControlUsers() string
 	GetCacheControlUser() string
 	GetKeycloakAccountEndpoint(*goa.RequestData) (string, error)
-	GetWITURL(*goa.RequestData) (string, error)
 	GetKeycloakEndpointToken(*goa.RequestData) (string, error)
 	GetKeycloakEndpointUsers(*goa.RequestData) (string, error)
 	GetKeycloakClientID() string
@@ -56,7 +57,6 @@ func NewUsersController(service *goa.Service, db application.DB, config UsersCon
 		db:                  db,
 		config:              config,
 		userProfileService:  userProfileService,
-		RemoteWITService:    &wit.RemoteWITServiceCaller{},
 		keycloakLinkService: linkService,
 	}
 }
@@ -145,26 +145,6 @@ func (c *UsersController) Create(ctx *app.CreateUsersContext) error {
 		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
 	}
 
-	// finally, if all works, we create a user in WIT too.
-	witURL, err := c.config.GetWITURL(ctx.RequestData)
-	if err != nil {
-		log.Error(ctx, map[string]interface{}{
-			"err":              err,
-			"keycloak_user_id": *keycloakUserID,
-		}, "failed to create user in WIT")
-
-		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
-	}
-
-	err = c.RemoteWITService.CreateWITUser(ctx.Context, ctx.RequestData, identity, witURL, identityID.String())
-	if err != nil {
-		log.Error(ctx, map[string]interface{}{
-			"err":              err,
-			"keycloak_user_id": *keycloakUserID,
-		}, "failed to create user in WIT")
-		// Not a blocker. Log the error and proceed.
-	}
-
 	return ctx.OK(ConvertToAppUser(ctx.RequestData, user, identity))
 }
 
@@ -262,9 +242,10 @@ func (c *UsersController) createUserInDB(ctx *app.CreateUsersContext, identityID
 	// "username", "email", "cluster"
 
 	user = &account.User{
-		ID:      userID,
-		Email:   ctx.Payload.Data.Attributes.Email,
-		Cluster: ctx.Payload.Data.Attributes.Cluster,
+		ID:            userID,
+		Email:         ctx.Payload.Data.Attributes.Email,
+		Cluster:       ctx.Payload.Data.Attributes.Cluster,
+		ApprovalState: account.KeycloakApprovalState(true), // Approved by default
 	}
 	identity = &account.Identity{
 		ID:           identityID,
@@ -277,6 +258,11 @@ func (c *UsersController) createUserInDB(ctx *app.CreateUsersContext, identityID
 
 	// Optional Attributes
 
+	approved := ctx.Payload.Data.Attributes.Approved
+	if approved != nil {
+		user.ApprovalState = account.KeycloakApprovalState(*approved)
+	}
+
 	registrationCompleted := ctx.Payload.Data.Attributes.RegistrationCompleted
 	if registrationCompleted != nil {
 		identity.RegistrationCompleted = true
@@ -326,7 +312,10 @@ func (c *UsersController) createUserInDB(ctx *app.CreateUsersContext, identityID
 		if err != nil {
 			return err
 		}
-		return nil
+		// the user is created in WIT and the other services from the outbox
+		eventIdentity := *identity
+		eventIdentity.User = *user
+		return outbox.RecordUserEvent(ctx, appl.OutboxEvents(), outbox.UserCreated, eventIdentity)
 	})
 
 	if returnErrorResponse != nil {
@@ -434,6 +423,8 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 
 	var identity *account.Identity
 	var user *account.User
+	// the changes of the email and the username are recorded in the audit log, whether they succeed or not
+	var auditedChanges []auditedProfileChange
 
 	err = application.Transactional(c.db, func(appl application.Application) error {
 		identity, err = appl.Identities().Load(ctx, *id)
@@ -450,6 +441,7 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 
 		updatedEmail := ctx.Payload.Data.Attributes.Email
 		if updatedEmail != nil && *updatedEmail != user.Email {
+			auditedChanges = append(auditedChanges, auditedProfileChange{action: audit.ProfileEmailChange, from: user.Email, to: *updatedEmail})
 			isValid := isEmailValid(*updatedEmail)
 			if !isValid {
 				return errors.NewBadParameterError("email", *updatedEmail).Expected("valid email")
@@ -469,6 +461,7 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 
 		updatedUserName := ctx.Payload.Data.Attributes.Username
 		if updatedUserName != nil && *updatedUserName != identity.Username {
+			auditedChanges = append(auditedChanges, auditedProfileChange{action: audit.ProfileUsernameChange, from: identity.Username, to: *updatedUserName})
 			isValid := isUsernameValid(*updatedUserName)
 			if !isValid {
 				return errs.Wrap(errors.NewBadParameterError("username", "required"), fmt.Sprintf("invalid value assigned to username for identity with id %s and user with id %s", identity.ID, identity.UserID.UUID))
@@ -577,8 +570,18 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 			return err
 		}
 
-		return nil
+		// the user is updated in WIT and the other services from the outbox
+		eventIdentity := *identity
+		eventIdentity.User = *user
+		return outbox.RecordUserEvent(ctx, appl.OutboxEvents(), outbox.UserUpdated, eventIdentity)
 	})
+	for _, change := range auditedChanges {
+		// a failure to record the event must not change the response, so the error is only logged by the repository
+		audit.Record(ctx, c.db.AuditEvents(), change.action, *id, id.String(), audit.OutcomeOf(err == nil), audit.Details{
+			"from": change.from,
+			"to":   change.to,
+		})
+	}
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -618,42 +621,14 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 			}
 		}
 	}
-	err = c.updateWITUser(ctx, ctx.RequestData, identity.ID.String())
-	if err != nil {
-		log.Error(ctx, map[string]interface{}{
-			"user_id":     user.ID,
-			"identity_id": identity.ID,
-			"username":    identity.Username,
-			"err":         err,
-		}, "failed to update WIT user/identity")
-		// Let's not disrupt the response if there was an issue with updating WIT.
-	}
-
 	return ctx.OK(ConvertToAppUser(ctx.RequestData, user, identity))
 }
 
-func (c *UsersController) updateWITUser(ctx *app.UpdateUsersContext, request *goa.RequestData, identityID string) error {
-	updateUserPayload := &app.UpdateUsersPayload{
-		Data: &app.UpdateUserData{
-			Attributes: &app.UpdateIdentityDataAttributes{
-				Bio:                   ctx.Payload.Data.Attributes.Bio,
-				Company:               ctx.Payload.Data.Attributes.Company,
-				ContextInformation:    ctx.Payload.Data.Attributes.ContextInformation,
-				Email:                 ctx.Payload.Data.Attributes.Email,
-				FullName:              ctx.Payload.Data.Attributes.FullName,
-				ImageURL:              ctx.Payload.Data.Attributes.ImageURL,
-				RegistrationCompleted: ctx.Payload.Data.Attributes.RegistrationCompleted,
-				URL:      ctx.Payload.Data.Attributes.URL,
-				Username: ctx.Payload.Data.Attributes.Username,
-			},
-			Type: ctx.Payload.Data.Type,
-		},
-	}
-	witURL, err := c.config.GetWITURL(ctx.RequestData)
-	if err != nil {
-		return err
-	}
-	return c.RemoteWITService.UpdateWITUser(ctx, request, updateUserPayload, witURL, identityID)
+// auditedProfileChange is a change of the profile of a user which is recorded in the audit log
+type auditedProfileChange struct {
+	action string
+	from   string
+	to     string
 }
 
 func isEmailValid(email string) bool {
@@ -723,6 +698,169 @@ func (c *UsersController) List(ctx *app.ListUsersContext) error {
 	})
 }
 
+// Deactivate deactivates the user of the given identity when requested using a service account
+func (c *UsersController) Deactivate(ctx *app.DeactivateUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return admin.Deactivate(ctx, appl, identityID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// Reactivate reactivates the user of the given identity when requested using a service account
+func (c *UsersController) Reactivate(ctx *app.ReactivateUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return admin.Reactivate(ctx, appl, identityID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// Purge removes the user of the given identity and all the data about it when requested using a service account
+func (c *UsersController) Purge(ctx *app.PurgeUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	var report *admin.PurgeReport
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		report, err = admin.Purge(ctx, appl, identityID)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := &app.UserPurgeReport{
+		UserID:              report.UserID,
+		IdentityIds:         report.IdentityIDs,
+		ExternalTokens:      report.ExternalTokens,
+		IdentityRoles:       int(report.IdentityRoles),
+		SpaceCollaborations: report.SpaceCollaborations,
+		OutboxEvents:        int(report.OutboxEvents),
+		WebhookDeliveries:   int(report.WebhookDeliveries),
+	}
+	if res.IdentityIds == nil {
+		res.IdentityIds = []uuid.UUID{}
+	}
+	if res.SpaceCollaborations == nil {
+		res.SpaceCollaborations = []string{}
+	}
+	return ctx.OK(res)
+}
+
+// ListPending returns the users waiting to be approved when requested using a service account
+func (c *UsersController) ListPending(ctx *app.ListPendingUsersContext) error {
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, nil, "the users can only be administrated by service accounts")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	offset, limit := computePagingLimits(ctx.PageOffset, ctx.PageLimit)
+	var users []account.User
+	err := application.Transactional(c.db, func(appl application.Application) error {
+		var err error
+		users, err = appl.Users().ListByApprovalState(ctx, account.ApprovalStatePending, offset, limit)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	res := app.UserApprovalCollection{}
+	for _, user := range users {
+		if len(user.Identities) == 0 {
+			continue
+		}
+		identity := user.Identities[0]
+		for _, userIdentity := range user.Identities {
+			if userIdentity.ProviderType == account.KeycloakIDP {
+				identity = userIdentity
+			}
+		}
+		res = append(res, &app.UserApproval{
+			IdentityID:    identity.ID,
+			UserID:        user.ID,
+			Username:      identity.Username,
+			Email:         user.Email,
+			FullName:      user.FullName,
+			Company:       user.Company,
+			ApprovalState: *user.ApprovalState,
+			RegisteredAt:  user.CreatedAt,
+		})
+	}
+	return ctx.OK(res)
+}
+
+// Approve approves the user of the given identity when requested using a service account
+func (c *UsersController) Approve(ctx *app.ApproveUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return admin.Approve(ctx, appl, identityID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// Reject rejects the registration of the user of the given identity when requested using a service account
+func (c *UsersController) Reject(ctx *app.RejectUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return admin.Reject(ctx, appl, identityID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// Export returns all the data stored about the user of the given identity when requested using a service account
+func (c *UsersController) Export(ctx *app.ExportUsersContext) error {
+	identityID, err := adminIdentityID(ctx, ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	var data *export.Data
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		data, err = export.Collect(ctx, appl, identityID)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(ConvertToAppUserExport(data))
+}
+
+// adminIdentityID checks that the request is done by a service account and parses the ID of the administrated identity
+func adminIdentityID(ctx context.Context, id string) (uuid.UUID, error) {
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, nil, "the users can only be administrated by service accounts")
+		return uuid.Nil, errors.NewUnauthorizedError("not a service account")
+	}
+	identityID, err := uuid.FromString(id)
+	if err != nil {
+		return uuid.Nil, errors.NewBadParameterError("id", id).Expected("an identity ID")
+	}
+	return identityID, nil
+}
+
 func filterUsers(appl application.Application, ctx *app.ListUsersContext) ([]account.User, []account.Identity, error) {
 	var err error
 	var resultUsers []account.User
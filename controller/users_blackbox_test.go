@@ -16,8 +16,10 @@ import (
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login"
 	"github.com/fabric8-services/fabric8-auth/login/link"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/resource"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 
 	"github.com/goadesign/goa"
 	"github.com/satori/go.uuid"
@@ -52,20 +54,17 @@ func (s *TestUsersSuite) SetupSuite() {
 	s.controller = NewUsersController(s.svc, s.Application, s.Configuration, s.profileService, s.linkAPIService)
 	s.userRepo = s.Application.Users()
 	s.identityRepo = s.Application.Identities()
-	s.controller.RemoteWITService = &dummyRemoteWITService{}
 }
 
 func (s *TestUsersSuite) SecuredController(identity account.Identity) (*goa.Service, *UsersController) {
 	svc := testsupport.ServiceAsUser("Users-Service", identity)
 	controller := NewUsersController(s.svc, s.Application, s.Configuration, s.profileService, s.linkAPIService)
-	controller.RemoteWITService = &dummyRemoteWITService{}
 	return svc, controller
 }
 
 func (s *TestUsersSuite) SecuredServiceAccountController(identity account.Identity) (*goa.Service, *UsersController) {
 	svc := testsupport.ServiceAsServiceAccountUser("Users-ServiceAccount-Service", identity)
 	controller := NewUsersController(s.svc, s.Application, s.Configuration, s.profileService, s.linkAPIService)
-	controller.RemoteWITService = &dummyRemoteWITService{}
 	return svc, controller
 }
 
@@ -119,6 +118,17 @@ func (s *TestUsersSuite) TestUpdateUserOK() {
 	assert.True(s.T(), ok)
 	assert.Equal(s.T(), contextInformation["count"], int(countValue))
 	assert.Equal(s.T(), contextInformation["rate"], updatedContextInformation["rate"])
+
+	// the change is recorded to be propagated to WIT and the other services
+	events, err := s.Application.OutboxEvents().ListByIdentity(s.Ctx, identity.ID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), events, 1)
+	assert.Equal(s.T(), outbox.UserUpdated, events[0].Type)
+	var payload outbox.User
+	require.Nil(s.T(), events[0].Unmarshal(&payload))
+	assert.Equal(s.T(), newFullName, payload.FullName)
+	assert.Equal(s.T(), newEmail, payload.Email)
+	assert.Equal(s.T(), "yesterday", payload.ContextInformation["last_visited"])
 }
 
 func (s *TestUsersSuite) TestUpdateUserNameMulitpleTimesForbidden() {
@@ -820,6 +830,144 @@ func (s *TestUsersSuite) TestListUsersByEmailNotModifiedUsingIfNoneMatchHeader()
 	assertResponseHeaders(s.T(), res)
 }
 
+func (s *TestUsersSuite) TestDeactivateAndReactivateUserNoContent() {
+	// given
+	user := s.createRandomUser("TestDeactivateUser")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	// when
+	test.DeactivateUsersNoContent(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	deactivated, err := s.userRepo.Load(s.Ctx, user.ID)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), deactivated.Deactivated)
+
+	// when
+	test.ReactivateUsersNoContent(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	reactivated, err := s.userRepo.Load(s.Ctx, user.ID)
+	require.Nil(s.T(), err)
+	assert.False(s.T(), reactivated.Deactivated)
+}
+
+func (s *TestUsersSuite) TestDeactivateUserNotServiceAccountUnauthorized() {
+	user := s.createRandomUser("TestDeactivateUserUnauthorized")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredController(identity)
+	test.DeactivateUsersUnauthorized(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	test.PurgeUsersUnauthorized(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+}
+
+func (s *TestUsersSuite) TestDeactivateUnknownUserNotFound() {
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	test.DeactivateUsersNotFound(s.T(), svc.Context, svc, ctrl, uuid.NewV4().String())
+	test.ReactivateUsersBadRequest(s.T(), svc.Context, svc, ctrl, "not-an-identity-id")
+}
+
+func (s *TestUsersSuite) TestPurgeUserOK() {
+	// given
+	user := s.createRandomUser("TestPurgeUser")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	// when
+	_, report := test.PurgeUsersOK(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	require.NotNil(s.T(), report.UserID)
+	assert.Equal(s.T(), user.ID, *report.UserID)
+	assert.Equal(s.T(), []uuid.UUID{identity.ID}, report.IdentityIds)
+	test.ShowUsersNotFound(s.T(), nil, nil, s.controller, identity.ID.String(), nil, nil)
+	test.PurgeUsersNotFound(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+}
+
+func (s *TestUsersSuite) TestListPendingAndApproveUserOK() {
+	// given
+	user := s.createRandomUser("TestApproveUser")
+	user.ApprovalState = account.KeycloakApprovalState(false)
+	require.Nil(s.T(), s.userRepo.Save(s.Ctx, &user))
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	// when
+	limit := 100
+	_, pending := test.ListPendingUsersOK(s.T(), svc.Context, svc, ctrl, nil, &limit)
+	// then
+	approval := findUserApproval(identity.ID, pending)
+	require.NotNil(s.T(), approval)
+	assert.Equal(s.T(), user.ID, approval.UserID)
+	assert.Equal(s.T(), identity.Username, approval.Username)
+	assert.Equal(s.T(), account.ApprovalStatePending, approval.ApprovalState)
+
+	// when
+	test.ApproveUsersNoContent(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	approved, err := s.userRepo.Load(s.Ctx, user.ID)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), approved.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStateApproved, *approved.ApprovalState)
+	_, pending = test.ListPendingUsersOK(s.T(), svc.Context, svc, ctrl, nil, &limit)
+	assert.Nil(s.T(), findUserApproval(identity.ID, pending))
+}
+
+func (s *TestUsersSuite) TestRejectUserNoContent() {
+	// given
+	user := s.createRandomUser("TestRejectUser")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	// when
+	test.RejectUsersNoContent(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	rejected, err := s.userRepo.Load(s.Ctx, user.ID)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), rejected.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStateRejected, *rejected.ApprovalState)
+}
+
+func (s *TestUsersSuite) TestListPendingUsersNotServiceAccountUnauthorized() {
+	user := s.createRandomUser("TestListPendingUsersUnauthorized")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredController(identity)
+	test.ListPendingUsersUnauthorized(s.T(), svc.Context, svc, ctrl, nil, nil)
+	test.ApproveUsersUnauthorized(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+}
+
+func (s *TestUsersSuite) TestExportUserOK() {
+	// given
+	user := s.createRandomUser("TestExportUser")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredServiceAccountController(testsupport.TestIdentity)
+	// when
+	_, result := test.ExportUsersOK(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+	// then
+	require.NotNil(s.T(), result.User)
+	assert.Equal(s.T(), user.ID, result.User.ID)
+	assert.Equal(s.T(), user.Email, result.User.Email)
+	require.Len(s.T(), result.Identities, 1)
+	assert.Equal(s.T(), identity.ID, result.Identities[0].ID)
+	assert.Equal(s.T(), identity.Username, result.Identities[0].Username)
+	assert.Empty(s.T(), result.ExternalAccounts)
+}
+
+func (s *TestUsersSuite) TestExportUserNotServiceAccountUnauthorized() {
+	user := s.createRandomUser("TestExportUserUnauthorized")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc, ctrl := s.SecuredController(identity)
+	test.ExportUsersUnauthorized(s.T(), svc.Context, svc, ctrl, identity.ID.String())
+}
+
+func (s *TestUsersSuite) TestExportCurrentUserOK() {
+	// given
+	user := s.createRandomUser("TestExportCurrentUser")
+	identity := s.createRandomIdentity(user, account.KeycloakIDP)
+	svc := testsupport.ServiceAsUser("User-Service", identity)
+	ctrl := NewUserController(svc, s.Application, testtoken.TokenManager, s.Configuration)
+	// when
+	_, result := test.ExportUserOK(s.T(), svc.Context, svc, ctrl)
+	// then
+	require.NotNil(s.T(), result.User)
+	assert.Equal(s.T(), user.ID, result.User.ID)
+	require.Len(s.T(), result.Identities, 1)
+	assert.Equal(s.T(), identity.ID, result.Identities[0].ID)
+}
+
 func (s *TestUsersSuite) createRandomUser(fullname string) account.User {
 	user := account.User{
 		Email:    uuid.NewV4().String() + "primaryForUpdat7e@example.com",
@@ -847,6 +995,15 @@ func (s *TestUsersSuite) createRandomIdentity(user account.User, providerType st
 	return identity
 }
 
+func findUserApproval(identityID uuid.UUID, approvals app.UserApprovalCollection) *app.UserApproval {
+	for _, approval := range approvals {
+		if approval.IdentityID == identityID {
+			return approval
+		}
+	}
+	return nil
+}
+
 func findUser(id uuid.UUID, userData []*app.UserData) *app.UserData {
 	for _, user := range userData {
 		if *user.ID == id.String() {
@@ -972,16 +1129,6 @@ func (s *TestUsersSuite) generateUsersTag(allUsers app.UserArray) string {
 	return app.GenerateEntitiesTag(entities)
 }
 
-type dummyRemoteWITService struct{}
-
-func (r *dummyRemoteWITService) UpdateWITUser(ctx context.Context, req *goa.RequestData, updatePayload *app.UpdateUsersPayload, witURL string, identityID string) error {
-	return nil
-}
-
-func (r *dummyRemoteWITService) CreateWITUser(ctx context.Context, req *goa.RequestData, identity *account.Identity, witURL string, identityID string) error {
-	return nil
-}
-
 type dummyKeycloakLinkService struct{}
 
 func (d *dummyKeycloakLinkService) Create(ctx context.Context, keycloakLinkIDPRequest *link.KeycloakLinkIDPRequest, protectedAccessToken string, keycloakIDPLinkURL string) error {
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/webhook"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+)
+
+const defaultWebhookDeliveriesLimit = 100
+
+// WebhooksController implements the webhooks resource.
+type WebhooksController struct {
+	*goa.Controller
+	db application.DB
+}
+
+// NewWebhooksController creates a webhooks controller.
+func NewWebhooksController(service *goa.Service, db application.DB) *WebhooksController {
+	return &WebhooksController{Controller: service.NewController("WebhooksController"), db: db}
+}
+
+// Create registers a webhook for the current service account.
+func (c *WebhooksController) Create(ctx *app.CreateWebhooksContext) error {
+	ownerID, err := serviceAccountIdentity(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	u, err := url.Parse(ctx.Payload.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("url", ctx.Payload.URL).Expected("an absolute http or https URL"))
+	}
+	subscription := webhook.Subscription{
+		OwnerID:    ownerID,
+		URL:        ctx.Payload.URL,
+		EventTypes: ctx.Payload.EventTypes,
+		Secret:     ctx.Payload.Secret,
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		return appl.WebhookSubscriptions().Create(ctx, &subscription)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	return ctx.Created(convertWebhook(subscription))
+}
+
+// List returns the webhooks registered by the current service account.
+func (c *WebhooksController) List(ctx *app.ListWebhooksContext) error {
+	ownerID, err := serviceAccountIdentity(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	var subscriptions []webhook.Subscription
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		subscriptions, err = appl.WebhookSubscriptions().ListByOwner(ctx, ownerID)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+	}
+	res := app.WebhookCollection{}
+	for _, subscription := range subscriptions {
+		res = append(res, convertWebhook(subscription))
+	}
+	return ctx.OK(res)
+}
+
+// Delete deletes a webhook of the current service account with its delivery log.
+func (c *WebhooksController) Delete(ctx *app.DeleteWebhooksContext) error {
+	ownerID, err := serviceAccountIdentity(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		_, err := loadOwnedSubscription(ctx, appl, ctx.WebhookID, ownerID)
+		if err != nil {
+			return err
+		}
+		return appl.WebhookSubscriptions().Delete(ctx, ctx.WebhookID)
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// ListDeliveries returns the latest deliveries to a webhook of the current service account.
+func (c *WebhooksController) ListDeliveries(ctx *app.ListDeliveriesWebhooksContext) error {
+	ownerID, err := serviceAccountIdentity(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	limit := defaultWebhookDeliveriesLimit
+	if ctx.Limit != nil {
+		limit = *ctx.Limit
+	}
+	var deliveries []webhook.Delivery
+	err = application.Transactional(c.db, func(appl application.Application) error {
+		_, err := loadOwnedSubscription(ctx, appl, ctx.WebhookID, ownerID)
+		if err != nil {
+			return err
+		}
+		deliveries, err = appl.WebhookDeliveries().ListBySubscription(ctx, ctx.WebhookID, limit)
+		return err
+	})
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := app.WebhookDeliveryCollection{}
+	for _, delivery := range deliveries {
+		res = append(res, convertWebhookDelivery(delivery))
+	}
+	return ctx.OK(res)
+}
+
+// serviceAccountIdentity returns the ID of the service account doing the request
+func serviceAccountIdentity(ctx context.Context) (uuid.UUID, error) {
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, nil, "the webhooks can only be managed by service accounts")
+		return uuid.Nil, errors.NewUnauthorizedError("not a service account")
+	}
+	identityID, err := login.ContextIdentity(ctx)
+	if err != nil {
+		return uuid.Nil, errors.NewUnauthorizedError(err.Error())
+	}
+	return *identityID, nil
+}
+
+// loadOwnedSubscription loads the subscription of the given service account.
+// Returns NotFoundError if the subscription belongs to another service account, so its existence is not disclosed.
+func loadOwnedSubscription(ctx context.Context, appl application.Application, id uuid.UUID, ownerID uuid.UUID) (*webhook.Subscription, error) {
+	subscription, err := appl.WebhookSubscriptions().Load(ctx, id)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return nil, err
+		}
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	if !uuid.Equal(subscription.OwnerID, ownerID) {
+		return nil, errors.NewNotFoundError("webhook", id.String())
+	}
+	return subscription, nil
+}
+
+func convertWebhook(subscription webhook.Subscription) *app.Webhook {
+	return &app.Webhook{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+func convertWebhookDelivery(delivery webhook.Delivery) *app.WebhookDelivery {
+	res := &app.WebhookDelivery{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+	switch {
+	case delivery.DeliveredAt != nil:
+		res.Status = "delivered"
+	case delivery.FailedAt != nil:
+		res.Status = "failed"
+	default:
+		res.Status = "pending"
+		res.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return res
+}
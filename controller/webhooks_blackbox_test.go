@@ -0,0 +1,126 @@
+package controller_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/webhook"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TestWebhooksREST struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunWebhooksREST(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &TestWebhooksREST{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (rest *TestWebhooksREST) SecuredController() (*goa.Service, *WebhooksController) {
+	svc := testsupport.ServiceAsServiceAccountUser("Webhooks-Service", account.Identity{ID: uuid.NewV4(), Username: "fabric8-wit"})
+	return svc, NewWebhooksController(svc, rest.Application)
+}
+
+func (rest *TestWebhooksREST) TestCreateAndListWebhooksOK() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	payload := newCreateWebhookPayload("https://wit.example.com/api/events", outbox.UserCreated, outbox.SpaceCollaboratorAdded)
+	// when
+	_, created := test.CreateWebhooksCreated(rest.T(), svc.Context, svc, ctrl, payload)
+	// then
+	assert.NotEqual(rest.T(), uuid.Nil, created.ID)
+	assert.Equal(rest.T(), payload.URL, created.URL)
+	assert.Equal(rest.T(), payload.EventTypes, created.EventTypes)
+	_, webhooks := test.ListWebhooksOK(rest.T(), svc.Context, svc, ctrl)
+	require.Len(rest.T(), webhooks, 1)
+	assert.Equal(rest.T(), created.ID, webhooks[0].ID)
+
+	// the webhooks of the other service accounts are not listed
+	otherSvc, otherCtrl := rest.SecuredController()
+	_, webhooks = test.ListWebhooksOK(rest.T(), otherSvc.Context, otherSvc, otherCtrl)
+	assert.Empty(rest.T(), webhooks)
+}
+
+func (rest *TestWebhooksREST) TestCreateWebhookWithInvalidURLBadRequest() {
+	svc, ctrl := rest.SecuredController()
+	test.CreateWebhooksBadRequest(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("ftp://wit.example.com/events", outbox.UserCreated))
+	test.CreateWebhooksBadRequest(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("/api/events", outbox.UserCreated))
+}
+
+func (rest *TestWebhooksREST) TestCreateWebhookNotServiceAccountUnauthorized() {
+	identity, err := testsupport.CreateTestIdentity(rest.DB, "TestCreateWebhook-"+uuid.NewV4().String(), "KC")
+	require.Nil(rest.T(), err)
+	svc := testsupport.ServiceAsUser("Webhooks-Service", identity)
+	ctrl := NewWebhooksController(svc, rest.Application)
+	test.CreateWebhooksUnauthorized(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("https://wit.example.com/api/events", outbox.UserCreated))
+}
+
+func (rest *TestWebhooksREST) TestDeleteWebhookNoContent() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	_, created := test.CreateWebhooksCreated(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("https://wit.example.com/api/events", outbox.UserCreated))
+	// when
+	test.DeleteWebhooksNoContent(rest.T(), svc.Context, svc, ctrl, created.ID)
+	// then
+	_, webhooks := test.ListWebhooksOK(rest.T(), svc.Context, svc, ctrl)
+	assert.Empty(rest.T(), webhooks)
+	test.DeleteWebhooksNotFound(rest.T(), svc.Context, svc, ctrl, created.ID)
+}
+
+func (rest *TestWebhooksREST) TestWebhookOfOtherServiceAccountNotFound() {
+	// given
+	svc, ctrl := rest.SecuredController()
+	_, created := test.CreateWebhooksCreated(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("https://wit.example.com/api/events", outbox.UserCreated))
+	otherSvc, otherCtrl := rest.SecuredController()
+	// when/then
+	test.DeleteWebhooksNotFound(rest.T(), otherSvc.Context, otherSvc, otherCtrl, created.ID)
+	test.ListDeliveriesWebhooksNotFound(rest.T(), otherSvc.Context, otherSvc, otherCtrl, created.ID, nil)
+}
+
+func (rest *TestWebhooksREST) TestListDeliveriesOK() {
+	// given a webhook and an event of its type
+	svc, ctrl := rest.SecuredController()
+	_, created := test.CreateWebhooksCreated(rest.T(), svc.Context, svc, ctrl, newCreateWebhookPayload("https://wit.example.com/api/events", outbox.TokenDeleted))
+	event := outbox.Event{
+		ID:         uuid.NewV4(),
+		Type:       outbox.TokenDeleted,
+		IdentityID: uuid.NewV4(),
+		Payload:    outbox.Payload(`{"provider_name":"github"}`),
+	}
+	event.CreatedAt = time.Now()
+	sink := webhook.NewSink(rest.DB, rest.TokenCipher)
+	require.Nil(rest.T(), sink.Deliver(rest.Ctx, event))
+	// delivering the same event again does not create another delivery
+	require.Nil(rest.T(), sink.Deliver(rest.Ctx, event))
+	// when
+	_, deliveries := test.ListDeliveriesWebhooksOK(rest.T(), svc.Context, svc, ctrl, created.ID, nil)
+	// then
+	require.Len(rest.T(), deliveries, 1)
+	assert.Equal(rest.T(), event.ID, deliveries[0].EventID)
+	assert.Equal(rest.T(), outbox.TokenDeleted, deliveries[0].EventType)
+	assert.Equal(rest.T(), "pending", deliveries[0].Status)
+	assert.Equal(rest.T(), 0, deliveries[0].Attempts)
+	assert.NotNil(rest.T(), deliveries[0].NextAttemptAt)
+}
+
+func newCreateWebhookPayload(url string, eventTypes ...string) *app.CreateWebhooksPayload {
+	return &app.CreateWebhooksPayload{
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     "0123456789abcdef0123456789abcdef",
+	}
+}
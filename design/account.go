@@ -109,6 +109,18 @@ var _ = a.Resource("user", func() {
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.Unauthorized, JSONAPIErrors)
 	})
+
+	a.Action("export", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/export"),
+		)
+		a.Description("Export all the data stored about the authenticated user")
+		a.Response(d.OK, userExport)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
 })
 
 var _ = a.Resource("users", func() {
@@ -181,6 +193,250 @@ var _ = a.Resource("users", func() {
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 	})
+
+	a.Action("deactivate", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/:id/deactivate"),
+		)
+		a.Description("Deactivate the user of the given identity ID using a service account. A deactivated user can't log in nor refresh its tokens")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("reactivate", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/:id/reactivate"),
+		)
+		a.Description("Reactivate the user of the given identity ID using a service account")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("purge", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:id"),
+		)
+		a.Description("Purge the user of the given identity ID using a service account: the user, its identities, their tokens, roles and space collaborations are removed")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.OK, userPurgeReport)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("listPending", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/pending"),
+		)
+		a.Description("List the users waiting to be approved, in the order they registered, using a service account")
+		a.Params(func() {
+			a.Param("page[offset]", d.String, "Paging start position")
+			a.Param("page[limit]", d.Integer, "Paging size")
+		})
+		a.Response(d.OK, func() {
+			a.Media(a.CollectionOf(userApproval))
+		})
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("approve", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/:id/approve"),
+		)
+		a.Description("Approve the user of the given identity ID using a service account, so the user can log in")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("reject", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/:id/reject"),
+		)
+		a.Description("Reject the registration of the user of the given identity ID using a service account")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("export", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:id/export"),
+		)
+		a.Description("Export all the data stored about the user of the given identity ID using a service account")
+		a.Params(func() {
+			a.Param("id", d.String, "id")
+		})
+		a.Response(d.OK, userExport)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+// userApproval represents the approval state of a user
+var userApproval = a.MediaType("application/vnd.user-approval+json", func() {
+	a.TypeName("UserApproval")
+	a.Description("The approval state of a user")
+	a.Attributes(func() {
+		a.Attribute("identity_id", d.UUID, "ID of the Keycloak identity of the user")
+		a.Attribute("user_id", d.UUID, "ID of the user")
+		a.Attribute("username", d.String, "The username")
+		a.Attribute("email", d.String, "The email")
+		a.Attribute("full_name", d.String, "The user's full name")
+		a.Attribute("company", d.String, "The company")
+		a.Attribute("approval_state", d.String, "The approval state of the user", func() {
+			a.Enum("approved", "pending", "rejected")
+		})
+		a.Attribute("registered_at", d.DateTime, "When the user registered")
+		a.Required("identity_id", "user_id", "username", "email", "full_name", "company", "approval_state", "registered_at")
+	})
+	a.View("default", func() {
+		a.Attribute("identity_id")
+		a.Attribute("user_id")
+		a.Attribute("username")
+		a.Attribute("email")
+		a.Attribute("full_name")
+		a.Attribute("company")
+		a.Attribute("approval_state")
+		a.Attribute("registered_at")
+	})
+})
+
+// userExport contains all the data stored about a user. The values of the tokens of the external providers are not exported
+var userExport = a.MediaType("application/vnd.user-export+json", func() {
+	a.TypeName("UserExport")
+	a.Description("All the data stored about a user")
+	a.Attributes(func() {
+		a.Attribute("exported_at", d.DateTime, "When the data was exported")
+		a.Attribute("user", userExportUser, "The user, if the identity has one")
+		a.Attribute("identities", a.ArrayOf(userExportIdentity), "The identities of the user")
+		a.Attribute("external_accounts", a.ArrayOf(userExportExternalAccount), "The accounts of the external providers linked to the identities")
+		a.Attribute("role_assignments", a.ArrayOf(userExportRoleAssignment), "The roles assigned to the identities")
+		a.Attribute("space_collaborations", a.ArrayOf(userExportSpaceCollaboration), "The spaces the identities are collaborators of")
+		a.Required("exported_at", "identities", "external_accounts", "role_assignments", "space_collaborations")
+	})
+	a.View("default", func() {
+		a.Attribute("exported_at")
+		a.Attribute("user")
+		a.Attribute("identities")
+		a.Attribute("external_accounts")
+		a.Attribute("role_assignments")
+		a.Attribute("space_collaborations")
+	})
+})
+
+var userExportUser = a.Type("UserExportUser", func() {
+	a.Attribute("id", d.UUID, "ID of the user")
+	a.Attribute("created_at", d.DateTime, "When the user was created")
+	a.Attribute("updated_at", d.DateTime, "When the user was updated")
+	a.Attribute("email", d.String, "The email")
+	a.Attribute("full_name", d.String, "The user's full name")
+	a.Attribute("image_url", d.String, "The avatar image for the user")
+	a.Attribute("bio", d.String, "The bio")
+	a.Attribute("url", d.String, "The url")
+	a.Attribute("company", d.String, "The company")
+	a.Attribute("cluster", d.String, "The OpenShift API URL of the cluster where the user is provisioned to")
+	a.Attribute("context_information", a.HashOf(d.String, d.Any), "User context information of any type as a json")
+	a.Attribute("deactivated", d.Boolean, "Whether the user has been deactivated")
+	a.Attribute("approval_state", d.String, "Whether the user has been approved, is pending or has been rejected. Not set if the user has not logged in since the approval state is stored by the Auth service")
+	a.Required("id", "created_at", "updated_at", "email", "full_name", "image_url", "bio", "url", "company", "cluster", "deactivated")
+})
+
+var userExportIdentity = a.Type("UserExportIdentity", func() {
+	a.Attribute("id", d.UUID, "ID of the identity")
+	a.Attribute("created_at", d.DateTime, "When the identity was created")
+	a.Attribute("updated_at", d.DateTime, "When the identity was updated")
+	a.Attribute("username", d.String, "The username")
+	a.Attribute("provider_type", d.String, "The IDP provided this identity")
+	a.Attribute("profile_url", d.String, "The URL of the profile of the identity")
+	a.Attribute("registration_completed", d.Boolean, "Whether the registration has been completed")
+	a.Required("id", "created_at", "updated_at", "username", "provider_type", "registration_completed")
+})
+
+var userExportExternalAccount = a.Type("UserExportExternalAccount", func() {
+	a.Attribute("identity_id", d.UUID, "ID of the identity the account is linked to")
+	a.Attribute("provider_id", d.UUID, "ID of the external provider")
+	a.Attribute("username", d.String, "The username of the account")
+	a.Attribute("scope", d.String, "The scopes granted by the account")
+	a.Attribute("linked_at", d.DateTime, "When the account was linked")
+	a.Required("identity_id", "provider_id", "username", "scope", "linked_at")
+})
+
+var userExportRoleAssignment = a.Type("UserExportRoleAssignment", func() {
+	a.Attribute("identity_id", d.UUID, "ID of the identity the role is assigned to")
+	a.Attribute("resource_id", d.String, "ID of the resource")
+	a.Attribute("resource_type", d.String, "Name of the type of the resource")
+	a.Attribute("role", d.String, "Name of the role")
+	a.Attribute("assigned_at", d.DateTime, "When the role was assigned")
+	a.Required("identity_id", "resource_id", "resource_type", "role", "assigned_at")
+})
+
+var userExportSpaceCollaboration = a.Type("UserExportSpaceCollaboration", func() {
+	a.Attribute("identity_id", d.UUID, "ID of the collaborator identity")
+	a.Attribute("space_id", d.String, "ID of the space")
+	a.Attribute("added_at", d.DateTime, "When the identity was added to the collaborators")
+	a.Required("identity_id", "space_id", "added_at")
+})
+
+// userPurgeReport describes what was removed when a user was purged
+var userPurgeReport = a.MediaType("application/vnd.user-purge-report+json", func() {
+	a.TypeName("UserPurgeReport")
+	a.Description("What was removed when a user was purged")
+	a.Attributes(func() {
+		a.Attribute("user_id", d.UUID, "ID of the removed user, if the identity had one")
+		a.Attribute("identity_ids", a.ArrayOf(d.UUID), "IDs of the removed identities")
+		a.Attribute("external_tokens", d.Integer, "Number of removed tokens of the external providers")
+		a.Attribute("identity_roles", d.Integer, "Number of removed roles, including the space collaborations")
+		a.Attribute("space_collaborations", a.ArrayOf(d.String), "IDs of the spaces the user was a collaborator of")
+		a.Attribute("outbox_events", d.Integer, "Number of removed events about the identities")
+		a.Attribute("webhook_deliveries", d.Integer, "Number of removed deliveries of these events to the webhooks")
+		a.Required("identity_ids", "external_tokens", "identity_roles", "space_collaborations", "outbox_events", "webhook_deliveries")
+	})
+	a.View("default", func() {
+		a.Attribute("user_id")
+		a.Attribute("identity_ids")
+		a.Attribute("external_tokens")
+		a.Attribute("identity_roles")
+		a.Attribute("space_collaborations")
+		a.Attribute("outbox_events")
+		a.Attribute("webhook_deliveries")
+	})
 })
 
 // userData represents an identified user object
@@ -0,0 +1,63 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("audit", func() {
+	a.BasePath("/audit")
+
+	a.Action("listEvents", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/events"),
+		)
+		a.Description("List the events of the audit log, most recent first. Only available for service accounts")
+		a.Params(func() {
+			a.Param("actor", d.UUID, "ID of the identity which performed the action")
+			a.Param("action", d.String, "The action of the events, e.g. 'login' or 'collaborator.add'")
+			a.Param("from", d.DateTime, "Only the events recorded at or after this time are listed")
+			a.Param("to", d.DateTime, "Only the events recorded before this time are listed")
+			a.Param("page[offset]", d.String, "Paging start position")
+			a.Param("page[limit]", d.Integer, "Paging size")
+		})
+		a.Response(d.OK, func() {
+			a.Media(a.CollectionOf(auditEventMedia))
+		})
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+// auditEventMedia represents an event of the audit log
+var auditEventMedia = a.MediaType("application/vnd.audit-event+json", func() {
+	a.TypeName("AuditEvent")
+	a.Description("A security-relevant event recorded in the audit log")
+	a.Attributes(func() {
+		a.Attribute("id", d.UUID, "ID of the event")
+		a.Attribute("actor_id", d.UUID, "ID of the identity which performed the action, if known")
+		a.Attribute("subject", d.String, "What the action was performed on, e.g. the ID of an identity or the name of a provider")
+		a.Attribute("action", d.String, "The action")
+		a.Attribute("outcome", d.String, "The outcome of the action", func() {
+			a.Enum("success", "failure")
+		})
+		a.Attribute("client_ip", d.String, "IP of the client which sent the request")
+		a.Attribute("request_id", d.String, "ID of the request")
+		a.Attribute("details", a.HashOf(d.String, d.Any), "Additional data specific to the action")
+		a.Attribute("created_at", d.DateTime, "When the event was recorded")
+		a.Required("id", "action", "outcome", "created_at")
+	})
+	a.View("default", func() {
+		a.Attribute("id")
+		a.Attribute("actor_id")
+		a.Attribute("subject")
+		a.Attribute("action")
+		a.Attribute("outcome")
+		a.Attribute("client_ip")
+		a.Attribute("request_id")
+		a.Attribute("details")
+		a.Attribute("created_at")
+	})
+})
@@ -21,6 +21,11 @@ var _ = a.Resource("login", func() {
 				a.Description("If scope=offline_access then an offline token will be issued instead of a regular refresh token")
 			})
 			a.Param("api_client", d.String, "The name of the api client which is requesting a token")
+			a.Param("code_challenge", d.String, "RFC 7636 code challenge of a public client. If set then the client is redirected with an authorization code instead of the tokens, which is exchanged for the tokens with the code verifier")
+			a.Param("code_challenge_method", d.String, func() {
+				a.Enum("S256", "plain")
+				a.Description("RFC 7636 code challenge method. Defaults to plain")
+			})
 		})
 		a.Description("Login user")
 		a.Response(d.Unauthorized, JSONAPIErrors)
@@ -0,0 +1,84 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+// openIDConfiguration represents the subset of the OpenID Provider Metadata defined in OpenID Connect Discovery 1.0
+// which is actually implemented by the Auth service. The Auth service is not an OpenID Provider: it issues no ID token
+// and its login endpoint is not an OAuth 2.0 authorization endpoint, so the related metadata are not advertised,
+// nor are the authorization codes and the code challenges of the public clients.
+var openIDConfiguration = a.MediaType("application/vnd.openid-configuration+json", func() {
+	a.TypeName("OpenIDConfiguration")
+	a.Description("Metadata of the issuer of the tokens")
+	a.ContentType("application/json")
+	a.Attributes(func() {
+		a.Attribute("issuer", d.String, "URL the Auth service asserts as its issuer identifier in the 'iss' claim of the tokens")
+		a.Attribute("token_endpoint", d.String, "URL of the token endpoint")
+		a.Attribute("jwks_uri", d.String, "URL of the JSON Web Key Set used to verify the tokens")
+		a.Attribute("grant_types_supported", a.ArrayOf(d.String), "OAuth 2.0 grant types supported by the token endpoint")
+		a.Attribute("token_endpoint_auth_methods_supported", a.ArrayOf(d.String), "Client authentication methods supported by the token endpoint")
+		a.Required("issuer", "token_endpoint", "jwks_uri", "grant_types_supported")
+	})
+	a.View("default", func() {
+		a.Attribute("issuer")
+		a.Attribute("token_endpoint")
+		a.Attribute("jwks_uri")
+		a.Attribute("grant_types_supported")
+		a.Attribute("token_endpoint_auth_methods_supported")
+	})
+})
+
+// jsonWebKeySet represents a JSON Web Key Set as defined in RFC 7517
+var jsonWebKeySet = a.MediaType("application/jwk-set+json", func() {
+	a.TypeName("JSONWebKeySet")
+	a.Description("JSON Web Key Set")
+	a.ContentType("application/json")
+	a.Attributes(func() {
+		a.Attribute("keys", a.ArrayOf(jsonWebKey))
+		a.Required("keys")
+	})
+	a.View("default", func() {
+		a.Attribute("keys")
+	})
+})
+
+var jsonWebKey = a.Type("JSONWebKey", func() {
+	a.Description("JSON Web Key of a public key used to verify the tokens issued by the Auth service")
+	a.Attribute("kid", d.String, "ID of the key, as found in the 'kid' header of the tokens")
+	a.Attribute("kty", d.String, "Key type", func() {
+		a.Example("RSA")
+	})
+	a.Attribute("alg", d.String, "Algorithm the key is used with", func() {
+		a.Example("RS256")
+	})
+	a.Attribute("use", d.String, "Intended use of the key", func() {
+		a.Example("sig")
+	})
+	a.Attribute("n", d.String, "Modulus of the RSA key")
+	a.Attribute("e", d.String, "Exponent of the RSA key")
+	a.Required("kid", "kty", "alg", "use", "n", "e")
+})
+
+var _ = a.Resource("openid", func() {
+
+	a.BasePath("//.well-known")
+
+	a.Action("configuration", func() {
+		a.Routing(
+			a.GET("openid-configuration"),
+		)
+		a.Description("Returns the metadata of the Auth service as the issuer of the tokens")
+		a.Response(d.OK, openIDConfiguration)
+	})
+
+	a.Action("keys", func() {
+		a.Routing(
+			a.GET("jwks.json"),
+		)
+		a.Description("Returns the JSON Web Key Set which should be used to verify the tokens issued by the Auth service")
+		a.Response(d.OK, jsonWebKeySet)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
@@ -32,12 +32,11 @@ var _ = a.Resource("resource", func() {
 			a.Param("resourceId", d.String, "The identifier of the resource to read")
 		})
 		a.Description("Read a specific resource")
+		a.Response(d.OK, ResourceDetailMedia)
 		a.Response(d.Unauthorized, JSONAPIErrors)
-		a.Response(d.TemporaryRedirect)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.NotFound, JSONAPIErrors)
-		a.Response(d.MethodNotAllowed)
 	})
 
 	a.Action("update", func() {
@@ -47,14 +46,14 @@ var _ = a.Resource("resource", func() {
 		a.Params(func() {
 			a.Param("resourceId", d.String, "Identifier of the resource to update")
 		})
-		a.Description("Update the details of the specified resource")
+		a.Description("Update the description, parent resource or owner of the specified resource")
+		a.Payload(updateResource)
+		a.Response(d.OK, ResourceDetailMedia)
 		a.Response(d.Unauthorized, JSONAPIErrors)
 		a.Response(d.Forbidden, JSONAPIErrors)
-		a.Response(d.TemporaryRedirect)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.NotFound, JSONAPIErrors)
-		a.Response(d.MethodNotAllowed)
 	})
 
 	a.Action("delete", func() {
@@ -64,13 +63,12 @@ var _ = a.Resource("resource", func() {
 		a.Params(func() {
 			a.Param("resourceId", d.String, "Identifier of the resource to delete")
 		})
-		a.Description("Delete a resource")
+		a.Description("Delete a resource. All the child resources and the roles assigned for the deleted resources are deleted as well")
+		a.Response(d.NoContent)
 		a.Response(d.Unauthorized, JSONAPIErrors)
-		a.Response(d.TemporaryRedirect)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.NotFound, JSONAPIErrors)
-		a.Response(d.MethodNotAllowed)
 	})
 
 })
@@ -107,3 +105,37 @@ var RegisterResourceMedia = a.MediaType("application/vnd.register_resource+json"
 		a.Attribute("_id")
 	})
 })
+
+// ResourceDetailMedia represents a registered resource with its owner and parent chain
+var ResourceDetailMedia = a.MediaType("application/vnd.resource_detail+json", func() {
+	a.TypeName("ResourceDetail")
+	a.Description("A registered protected resource")
+	a.Attributes(func() {
+		a.Attribute("resource_id", d.String, "The identifier of the resource")
+		a.Attribute("description", d.String, "Description of the resource")
+		a.Attribute("type", d.String, "The type of the resource")
+		a.Attribute("resource_owner_id", d.String, "Identifier for the owner of the resource")
+		a.Attribute("parent_resource_id", d.String, "The parent resource to which this resource belongs")
+		a.Attribute("parent_resource_chain", a.ArrayOf(d.String), "The identifiers of all the ancestors of this resource, starting with its parent and ending with the root resource")
+		a.Attribute("created_at", d.DateTime, "When the resource was registered")
+		a.Attribute("updated_at", d.DateTime, "When the resource was last updated")
+		a.Required("resource_id", "type", "resource_owner_id", "parent_resource_chain")
+	})
+	a.View("default", func() {
+		a.Attribute("resource_id")
+		a.Attribute("description")
+		a.Attribute("type")
+		a.Attribute("resource_owner_id")
+		a.Attribute("parent_resource_id")
+		a.Attribute("parent_resource_chain")
+		a.Attribute("created_at")
+		a.Attribute("updated_at")
+	})
+})
+
+var updateResource = a.Type("UpdateResource", func() {
+	a.Description("The resource attributes to update. Attributes which are not set are left unchanged")
+	a.Attribute("description", d.String, "Description of the resource")
+	a.Attribute("parent_resource_id", d.String, "The new parent resource. Set to an empty string to detach the resource from its parent")
+	a.Attribute("resource_owner_id", d.String, "Identifier for the new owner of the resource")
+})
@@ -0,0 +1,98 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("resource_roles", func() {
+
+	a.BasePath("/resources")
+
+	a.Action("list", func() {
+		a.Routing(
+			a.GET("/:resourceId/roles"),
+		)
+		a.Params(func() {
+			a.Param("resourceId", d.String, "The identifier of the resource")
+		})
+		a.Description("List the roles assigned to identities for the given resource")
+		a.Response(d.OK, identityRoleArray)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+	})
+
+	a.Action("assign", func() {
+		a.Routing(
+			a.POST("/:resourceId/roles"),
+		)
+		a.Params(func() {
+			a.Param("resourceId", d.String, "The identifier of the resource")
+		})
+		a.Description("Assign a role to an identity for the given resource")
+		a.Payload(assignRole)
+		a.Response(d.Created, identityRoleMedia)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
+	a.Action("revoke", func() {
+		a.Routing(
+			a.DELETE("/:resourceId/roles/:assignmentId"),
+		)
+		a.Params(func() {
+			a.Param("resourceId", d.String, "The identifier of the resource")
+			a.Param("assignmentId", d.UUID, "The identifier of the role assignment to revoke")
+		})
+		a.Description("Revoke a role assignment for the given resource")
+		a.Response(d.NoContent)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+	})
+})
+
+// identityRoleMedia represents a role assigned to an identity for a resource
+var identityRoleMedia = a.MediaType("application/vnd.identity_role+json", func() {
+	a.TypeName("IdentityRole")
+	a.Description("A role assigned to an identity for a resource")
+	a.Attributes(func() {
+		a.Attribute("assignment_id", d.UUID, "The identifier of the role assignment")
+		a.Attribute("identity_id", d.UUID, "The identity to which the role is assigned")
+		a.Attribute("role_name", d.String, "The name of the assigned role")
+		a.Attribute("resource_id", d.String, "The resource for which the role is assigned")
+		a.Required("assignment_id", "identity_id", "role_name", "resource_id")
+	})
+	a.View("default", func() {
+		a.Attribute("assignment_id")
+		a.Attribute("identity_id")
+		a.Attribute("role_name")
+		a.Attribute("resource_id")
+	})
+})
+
+// identityRoleArray represents the roles assigned for a resource
+var identityRoleArray = a.MediaType("application/vnd.identity_role_array+json", func() {
+	a.TypeName("IdentityRoleArray")
+	a.Description("Roles assigned to identities for a resource")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(identityRoleMedia))
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+	})
+})
+
+var assignRole = a.Type("AssignRole", func() {
+	a.Description("The role to assign to an identity. The role must be defined for the type of the resource")
+	a.Attribute("identity_id", d.UUID, "The identity to which the role is assigned")
+	a.Attribute("role_name", d.String, "The name of the role to assign")
+	a.Required("identity_id", "role_name")
+})
@@ -15,6 +15,7 @@ var AuthStatus = a.MediaType("application/vnd.status+json", func() {
 		a.Attribute("devMode", d.Boolean, "'True' if the Developer Mode is enabled")
 		a.Attribute("databaseStatus", d.String, "The status of Database connection. 'OK' or an error message is displayed.")
 		a.Attribute("configurationStatus", d.String, "The status of the used configuration. 'OK' or an error message if there is something wrong with the configuration used by service.")
+		a.Attribute("dependencies", a.ArrayOf(healthCheck), "The status of the services only some requests depend on (Keycloak, WIT, etc.). Their failures don't fail the status nor the readiness probe.")
 		a.Required("commit", "buildTime", "startTime", "databaseStatus", "configurationStatus")
 	})
 	a.View("default", func() {
@@ -24,9 +25,34 @@ var AuthStatus = a.MediaType("application/vnd.status+json", func() {
 		a.Attribute("devMode")
 		a.Attribute("databaseStatus")
 		a.Attribute("configurationStatus")
+		a.Attribute("dependencies")
 	})
 })
 
+// health defines the result of the checks run by a liveness or readiness probe
+var health = a.MediaType("application/vnd.health+json", func() {
+	a.TypeName("Health")
+	a.Description("The result of the checks of the health of the running instance and of the services it depends on")
+	a.Attributes(func() {
+		a.Attribute("status", d.String, "'OK' if all the checks succeeded, 'failed' otherwise")
+		a.Attribute("checks", a.ArrayOf(healthCheck), "The result of every check")
+		a.Required("status", "checks")
+	})
+	a.View("default", func() {
+		a.Attribute("status")
+		a.Attribute("checks")
+	})
+})
+
+var healthCheck = a.Type("HealthCheck", func() {
+	a.Attribute("name", d.String, "The name of the check, e.g. 'database' or 'keycloak'")
+	a.Attribute("status", d.String, "'OK' if the check succeeded, 'failed' otherwise")
+	a.Attribute("latency_ms", d.Integer, "How long the check took, in milliseconds")
+	a.Attribute("error", d.String, "Why the check failed")
+	a.Attribute("checked_at", d.DateTime, "When the check was run. The result of a check is reused for a few seconds.")
+	a.Required("name", "status", "latency_ms", "checked_at")
+})
+
 var _ = a.Resource("status", func() {
 
 	a.DefaultMedia(AuthStatus)
@@ -40,4 +66,22 @@ var _ = a.Resource("status", func() {
 		a.Response(d.OK)
 		a.Response(d.ServiceUnavailable, AuthStatus)
 	})
+
+	a.Action("liveness", func() {
+		a.Routing(
+			a.GET("/liveness"),
+		)
+		a.Description("Check if the running instance works, to be used by the liveness probe")
+		a.Response(d.OK, health)
+		a.Response(d.ServiceUnavailable, health)
+	})
+
+	a.Action("readiness", func() {
+		a.Routing(
+			a.GET("/readiness"),
+		)
+		a.Description("Check if the running instance and the services it depends on work, to be used by the readiness probe")
+		a.Response(d.OK, health)
+		a.Response(d.ServiceUnavailable, health)
+	})
 })
@@ -14,6 +14,7 @@ var externalToken = a.MediaType("application/vnd.externalToken+json", func() {
 		a.Attribute("scope", d.String, "The scope associated with the token")
 		a.Attribute("token_type", d.String, "The type of the toke, example : bearer")
 		a.Attribute("username", d.String, "The username of the identity loaded from the specific external provider. Optional attribute.")
+		a.Attribute("expires_in", d.Integer, "The number of seconds the token is still valid for. Not set if the token doesn't expire or its expiry is unknown.")
 		a.Required("access_token", "scope", "token_type")
 	})
 
@@ -22,6 +23,7 @@ var externalToken = a.MediaType("application/vnd.externalToken+json", func() {
 		a.Attribute("scope")
 		a.Attribute("token_type")
 		a.Attribute("username")
+		a.Attribute("expires_in")
 		a.Required("access_token", "scope", "token_type")
 	})
 
@@ -64,6 +66,22 @@ var _ = a.Resource("token", func() {
 		a.Response(d.Unauthorized, JSONAPIErrors)
 	})
 
+	a.Action("revokeSession", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/sessions/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "ID of the session, as found in the 'sid' claim of the tokens issued by the Auth service")
+		})
+		a.Description("Revoke the refresh tokens of a login session of the current user")
+		a.Response(d.NoContent)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+
 	a.Action("Exchange", func() {
 		a.Routing(
 			a.POST(""),
@@ -130,6 +148,11 @@ var _ = a.Resource("token", func() {
 				a.Example("https://github.com,https://api.starter-us-east-2.openshift.com")
 			})
 			a.Param("redirect", d.String, "URL to be redirected to after successful account linking. If not set then will redirect to the referrer instead.")
+			a.Param("code_challenge", d.String, "RFC 7636 code challenge of a public client. If set then the account linking is completed when the client sends the code verifier to the callback")
+			a.Param("code_challenge_method", d.String, func() {
+				a.Enum("S256", "plain")
+				a.Description("RFC 7636 code challenge method. Defaults to plain")
+			})
 			a.Required("for")
 		})
 		a.Description("Get a redirect location which should be used to initiate account linking between the user account and an external resource provider such as GitHub")
@@ -150,8 +173,23 @@ var _ = a.Resource("token", func() {
 			a.Param("state", d.String, "State generated by the link request")
 			a.Required("code", "state")
 		})
-		a.Description("Callback from an external oauth2 resource provider such as GitHub as part of user's account linking")
+		a.Description("Callback from an external oauth2 resource provider such as GitHub as part of user's account linking. If the link request had a code challenge then the client is redirected with the code and a new state, and completes the linking by posting them to the callback with the code verifier.")
 		a.Response(d.TemporaryRedirect)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("complete_link", func() {
+		a.Routing(
+			a.POST("/link/callback"),
+		)
+		a.Payload(linkCompletion)
+		a.Description("Complete the account linking of a public client which sent a code challenge to the link request. The client is given the location to be redirected to. If other resources are left to link then they are listed in the link_next parameter of the location, and the client sends a new link request with a new code challenge for them.")
+		a.Response(d.OK, func() {
+			a.Media(redirectLocation)
+		})
+		a.Response(d.Unauthorized, JSONAPIErrors)
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 	})
@@ -174,13 +212,32 @@ var refreshToken = a.Type("RefreshToken", func() {
 	a.Attribute("refresh_token", d.String, "Refresh token")
 })
 
+var linkCompletion = a.Type("LinkCompletion", func() {
+	a.Attribute("code", d.String, "The code the public client was redirected with by the callback")
+	a.Attribute("state", d.String, "The state the public client was redirected with by the callback")
+	a.Attribute("code_verifier", d.String, "The RFC 7636 code verifier of the code challenge sent to the link request")
+	a.Required("code", "state", "code_verifier")
+})
+
 var tokenExchange = a.Type("TokenExchange", func() {
 	a.Attribute("grant_type", d.String, func() {
-		a.Enum("client_credentials")
-		a.Description("Grant type. If set to \"client_credentials\" then this token exchange request is for a Protection API Token (PAT). PAT can be used to authenticate the corresponding Service Account.")
+		a.Enum("client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange", "authorization_code")
+		a.Description("Grant type. If set to \"client_credentials\" then this token exchange request is for a Protection API Token (PAT). PAT can be used to authenticate the corresponding Service Account. If set to \"urn:ietf:params:oauth:grant-type:token-exchange\" then this request is a RFC 8693 token exchange: the service account obtains a token to act on behalf of the subject of the subject token. If set to \"authorization_code\" then the authorization code issued to a public client at login is exchanged for the user tokens with the RFC 7636 code verifier.")
+	})
+	a.Attribute("client_id", d.String, "Service Account ID. Used to obtain a PAT for this service account or to authenticate the service account requesting a token exchange.")
+	a.Attribute("client_secret", d.String, "Service Account secret. Used to obtain a PAT for this service account or to authenticate the service account requesting a token exchange.")
+	a.Attribute("subject_token", d.String, "The access token of the user on behalf of whom the service account will act. Required for token exchange.")
+	a.Attribute("subject_token_type", d.String, func() {
+		a.Enum("urn:ietf:params:oauth:token-type:access_token")
+		a.Description("The type of the subject token. Required for token exchange.")
+	})
+	a.Attribute("requested_token_type", d.String, func() {
+		a.Enum("urn:ietf:params:oauth:token-type:access_token")
+		a.Description("The type of the requested token. Only access tokens can be requested.")
 	})
-	a.Attribute("client_id", d.String, "Service Account ID. Used to obtain a PAT for this service account.")
-	a.Attribute("client_secret", d.String, "Service Account secret. Used to obtain a PAT for this service account.")
+	a.Attribute("audience", d.String, "The name of the service account of the service the exchanged token is intended for. Required for token exchange.")
+	a.Attribute("code", d.String, "The authorization code issued at login. Required for the authorization code grant.")
+	a.Attribute("code_verifier", d.String, "The RFC 7636 code verifier of the code challenge sent at login. Required for the authorization code grant.")
 	a.Required("grant_type")
 })
 
@@ -216,10 +273,18 @@ var OauthToken = a.MediaType("application/vnd.oauthtoken+json", func() {
 	a.Attributes(func() {
 		a.Attribute("access_token", d.String, "Access token")
 		a.Attribute("token_type", d.String, "Token type")
+		a.Attribute("issued_token_type", d.String, "The type of the issued token. Only set for token exchange")
+		a.Attribute("expires_in", d.Integer, "Access token expires in seconds. Only set for token exchange and the authorization code grant")
+		a.Attribute("refresh_token", d.String, "Refresh token. Only set for the authorization code grant")
+		a.Attribute("refresh_expires_in", d.Integer, "Refresh token expires in seconds. Only set for the authorization code grant")
 	})
 	a.View("default", func() {
 		a.Attribute("access_token")
 		a.Attribute("token_type")
+		a.Attribute("issued_token_type")
+		a.Attribute("expires_in")
+		a.Attribute("refresh_token")
+		a.Attribute("refresh_expires_in")
 	})
 })
 
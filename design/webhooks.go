@@ -0,0 +1,143 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("webhooks", func() {
+	a.BasePath("/webhooks")
+
+	a.Action("create", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST(""),
+		)
+		a.Description("Register a webhook receiving the events of the given types. Only available for service accounts")
+		a.Payload(createWebhook)
+		a.Response(d.Created, webhookMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET(""),
+		)
+		a.Description("List the webhooks registered by the current service account")
+		a.Response(d.OK, func() {
+			a.Media(a.CollectionOf(webhookMedia))
+		})
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:webhookID"),
+		)
+		a.Params(func() {
+			a.Param("webhookID", d.UUID, "ID of the webhook")
+		})
+		a.Description("Delete a webhook of the current service account and its delivery log")
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("listDeliveries", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:webhookID/deliveries"),
+		)
+		a.Params(func() {
+			a.Param("webhookID", d.UUID, "ID of the webhook")
+			a.Param("limit", d.Integer, "Maximum number of deliveries to return, 100 by default", func() {
+				a.Minimum(1)
+				a.Maximum(1000)
+			})
+		})
+		a.Description("List the latest deliveries of the events to a webhook of the current service account, most recent first")
+		a.Response(d.OK, func() {
+			a.Media(a.CollectionOf(webhookDeliveryMedia))
+		})
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+var webhookEventTypes = a.ArrayOf(d.String, func() {
+	a.Enum("user.created", "user.updated", "identity.linked", "token.deleted", "space.collaborator.added", "space.collaborator.removed")
+})
+
+var createWebhook = a.Type("CreateWebhook", func() {
+	a.Attribute("url", d.String, "The URL the events are POSTed to", func() {
+		a.Format("uri")
+	})
+	a.Attribute("event_types", webhookEventTypes, "The types of the events delivered to the webhook", func() {
+		a.MinLength(1)
+	})
+	a.Attribute("secret", d.String, "The shared secret used to sign the deliveries with HMAC-SHA256. The signature is sent in the X-Fabric8-Signature header", func() {
+		a.MinLength(16)
+	})
+	a.Required("url", "event_types", "secret")
+})
+
+// webhookMedia represents a webhook registered by a service account. The secret is never returned.
+var webhookMedia = a.MediaType("application/vnd.webhook+json", func() {
+	a.TypeName("Webhook")
+	a.Description("A webhook registered by a service account")
+	a.Attributes(func() {
+		a.Attribute("id", d.UUID, "ID of the webhook")
+		a.Attribute("url", d.String, "The URL the events are POSTed to")
+		a.Attribute("event_types", a.ArrayOf(d.String), "The types of the events delivered to the webhook")
+		a.Attribute("created_at", d.DateTime, "When the webhook was registered")
+		a.Required("id", "url", "event_types", "created_at")
+	})
+	a.View("default", func() {
+		a.Attribute("id")
+		a.Attribute("url")
+		a.Attribute("event_types")
+		a.Attribute("created_at")
+	})
+})
+
+// webhookDeliveryMedia represents a delivery of an event to a webhook
+var webhookDeliveryMedia = a.MediaType("application/vnd.webhook_delivery+json", func() {
+	a.TypeName("WebhookDelivery")
+	a.Description("A delivery of an event to a webhook")
+	a.Attributes(func() {
+		a.Attribute("id", d.UUID, "ID of the delivery, sent in the X-Fabric8-Delivery header")
+		a.Attribute("event_id", d.UUID, "ID of the delivered event")
+		a.Attribute("event_type", d.String, "Type of the delivered event")
+		a.Attribute("attempts", d.Integer, "Number of attempts to deliver the event")
+		a.Attribute("status", d.String, "Status of the delivery", func() {
+			a.Enum("pending", "delivered", "failed")
+		})
+		a.Attribute("response_status", d.Integer, "HTTP status returned by the webhook at the last attempt")
+		a.Attribute("last_error", d.String, "Error of the last failed attempt")
+		a.Attribute("created_at", d.DateTime, "When the event was scheduled for delivery")
+		a.Attribute("next_attempt_at", d.DateTime, "When the next attempt is due, if the delivery is pending")
+		a.Attribute("delivered_at", d.DateTime, "When the event was delivered")
+		a.Required("id", "event_id", "event_type", "attempts", "status", "created_at")
+	})
+	a.View("default", func() {
+		a.Attribute("id")
+		a.Attribute("event_id")
+		a.Attribute("event_type")
+		a.Attribute("attempts")
+		a.Attribute("status")
+		a.Attribute("response_status")
+		a.Attribute("last_error")
+		a.Attribute("created_at")
+		a.Attribute("next_attempt_at")
+		a.Attribute("delivered_at")
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	errs "github.com/pkg/errors"
 )
@@ -199,3 +200,25 @@ func IsNotFoundError(err error) (bool, error) {
 	}
 	return true, e
 }
+
+// TooManyRequestsError means that the client sent too many requests and must wait before retrying
+type TooManyRequestsError struct {
+	simpleError
+	// RetryAfter is how long the client must wait before sending another request
+	RetryAfter time.Duration
+}
+
+// NewTooManyRequestsError returns the custom defined error of type TooManyRequestsError.
+func NewTooManyRequestsError(msg string, retryAfter time.Duration) TooManyRequestsError {
+	return TooManyRequestsError{simpleError: simpleError{msg}, RetryAfter: retryAfter}
+}
+
+// IsTooManyRequestsError returns true if the cause of the given error can be
+// converted to a TooManyRequestsError, which is returned as the second result.
+func IsTooManyRequestsError(err error) (bool, error) {
+	e, ok := errs.Cause(err).(TooManyRequestsError)
+	if !ok {
+		return false, nil
+	}
+	return true, e
+}
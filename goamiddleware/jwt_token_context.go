@@ -19,11 +19,14 @@ import (
 // Authorization header when possible. If the Authorization header is missing in the request,
 // no error is returned. However, if the Authorization header contains a
 // token, it will be stored it in the context.
+// When the validation keys are a KeyResolver, the keys are selected for every request.
+// The tokens rejected by the validation function are not stored in the context.
 func TokenContext(validationKeys interface{}, validationFunc goa.Middleware, scheme *goa.JWTSecurity) goa.Middleware {
 	var rsaKeys []*rsa.PublicKey
 	var hmacKeys [][]byte
 
 	rsaKeys, ecdsaKeys, hmacKeys := partitionKeys(validationKeys)
+	resolver, _ := validationKeys.(goajwt.KeyResolver)
 
 	return func(nextHandler goa.Handler) goa.Handler {
 		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
@@ -38,6 +41,11 @@ func TokenContext(validationKeys interface{}, validationFunc goa.Middleware, sch
 				incomingToken := strings.Split(val, " ")[1]
 				log.Debug(ctx, nil, "extracted the incoming token %v ", incomingToken)
 
+				rsaKeys, ecdsaKeys, hmacKeys := rsaKeys, ecdsaKeys, hmacKeys
+				if resolver != nil {
+					rsaKeys, ecdsaKeys, hmacKeys = partitionKeys(resolver.SelectKeys(req))
+				}
+
 				var (
 					token  *jwt.Token
 					err    error
@@ -69,6 +77,14 @@ func TokenContext(validationKeys interface{}, validationFunc goa.Middleware, sch
 					log.Warn(ctx, nil, "unable to parse JWT token: %v", err)
 				}
 
+				if parsed && validationFunc != nil {
+					err = validate(ctx, validationFunc, token, rw, req)
+					if err != nil {
+						log.Warn(ctx, nil, "the JWT token is rejected: %v", err)
+						token = nil
+					}
+				}
+
 				ctx = goajwt.WithJWT(ctx, token)
 			}
 
@@ -77,6 +93,14 @@ func TokenContext(validationKeys interface{}, validationFunc goa.Middleware, sch
 	}
 }
 
+// validate runs the validation function on the token without calling the next handler.
+func validate(ctx context.Context, validationFunc goa.Middleware, token *jwt.Token, rw http.ResponseWriter, req *http.Request) error {
+	noop := func(context.Context, http.ResponseWriter, *http.Request) error {
+		return nil
+	}
+	return validationFunc(noop)(goajwt.WithJWT(ctx, token), rw, req)
+}
+
 // partitionKeys sorts keys by their type.
 func partitionKeys(k interface{}) ([]*rsa.PublicKey, []*ecdsa.PublicKey, [][]byte) {
 	var (
@@ -104,6 +128,13 @@ func partitionKeys(k interface{}) ([]*rsa.PublicKey, []*ecdsa.PublicKey, [][]byt
 		ecdsaKeys = append(ecdsaKeys, typed)
 	case []*ecdsa.PublicKey:
 		ecdsaKeys = typed
+	case []goajwt.Key:
+		for _, key := range typed {
+			r, e, h := partitionKeys(key)
+			rsaKeys = append(rsaKeys, r...)
+			ecdsaKeys = append(ecdsaKeys, e...)
+			hmacKeys = append(hmacKeys, h...)
+		}
 	}
 
 	return rsaKeys, ecdsaKeys, hmacKeys
@@ -6,10 +6,16 @@ import (
 
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
 	"github.com/fabric8-services/fabric8-auth/auth"
 	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/space"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+	"github.com/fabric8-services/fabric8-auth/webhook"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 )
@@ -43,12 +49,18 @@ var x application.Application = &GormDB{}
 var y application.Application = &GormTransaction{}
 
 func NewGormDB(db *gorm.DB) *GormDB {
-	return &GormDB{GormBase{db}, ""}
+	return &GormDB{GormBase{db: db}, ""}
+}
+
+// NewGormDBWithTokenCipher returns a gorm DB which encrypts the external tokens with the given cipher
+func NewGormDBWithTokenCipher(db *gorm.DB, tokenCipher *encryption.Cipher) *GormDB {
+	return &GormDB{GormBase{db: db, tokenCipher: tokenCipher}, ""}
 }
 
 // GormBase is a base struct for gorm implementations of db & transaction
 type GormBase struct {
-	db *gorm.DB
+	db          *gorm.DB
+	tokenCipher *encryption.Cipher
 }
 
 type GormTransaction struct {
@@ -81,7 +93,32 @@ func (g *GormBase) OauthStates() auth.OauthStateReferenceRepository {
 
 // ExternalTokens returns an ExternalTokens repository
 func (g *GormBase) ExternalTokens() provider.ExternalTokenRepository {
-	return provider.NewExternalTokenRepository(g.db)
+	return provider.NewExternalTokenRepository(g.db, g.tokenCipher)
+}
+
+// RefreshTokens returns a RefreshTokens repository
+func (g *GormBase) RefreshTokens() refresh.RefreshTokenRepository {
+	return refresh.NewRefreshTokenRepository(g.db)
+}
+
+// OutboxEvents returns an outbox Event repository
+func (g *GormBase) OutboxEvents() outbox.EventRepository {
+	return outbox.NewEventRepository(g.db)
+}
+
+// WebhookSubscriptions returns a webhook Subscription repository
+func (g *GormBase) WebhookSubscriptions() webhook.SubscriptionRepository {
+	return webhook.NewSubscriptionRepository(g.db, g.tokenCipher)
+}
+
+// WebhookDeliveries returns a webhook Delivery repository
+func (g *GormBase) WebhookDeliveries() webhook.DeliveryRepository {
+	return webhook.NewDeliveryRepository(g.db)
+}
+
+// AuditEvents returns an audit Event repository
+func (g *GormBase) AuditEvents() audit.EventRepository {
+	return audit.NewEventRepository(g.db)
 }
 
 func (g *GormBase) ResourceRepository() resource.ResourceRepository {
@@ -92,6 +129,18 @@ func (g *GormBase) ResourceTypeRepository() resource.ResourceTypeRepository {
 	return resource.NewResourceTypeRepository(g.db)
 }
 
+func (g *GormBase) ResourceTypeScopeRepository() resource.ResourceTypeScopeRepository {
+	return resource.NewResourceTypeScopeRepository(g.db)
+}
+
+func (g *GormBase) RoleRepository() role.RoleRepository {
+	return role.NewRoleRepository(g.db)
+}
+
+func (g *GormBase) IdentityRoleRepository() role.IdentityRoleRepository {
+	return role.NewIdentityRoleRepository(g.db)
+}
+
 func (g *GormBase) DB() *gorm.DB {
 	return g.db
 }
@@ -125,9 +174,9 @@ func (g *GormDB) BeginTransaction() (application.Transaction, error) {
 		if tx.Error != nil {
 			return nil, tx.Error
 		}
-		return &GormTransaction{GormBase{tx}}, nil
+		return &GormTransaction{GormBase{db: tx, tokenCipher: g.tokenCipher}}, nil
 	}
-	return &GormTransaction{GormBase{tx}}, nil
+	return &GormTransaction{GormBase{db: tx, tokenCipher: g.tokenCipher}}, nil
 }
 
 // Commit implements TransactionSupport
@@ -11,6 +11,11 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+// appendOnlyTables are the tables whose rows can't be deleted, e.g. the audit events
+var appendOnlyTables = map[string]bool{
+	"audit_event": true,
+}
+
 // DeleteCreatedEntities records all created entities on the gorm.DB connection
 // and returns a function which can be called on defer to delete created
 // entities in reverse order on function exit.
@@ -52,6 +57,9 @@ func DeleteCreatedEntities(db *gorm.DB) func() {
 	}
 	db.Callback().Create().After("gorm:create").Register(hookName, func(scope *gorm.Scope) {
 		log.Logger().Debugln(fmt.Sprintf("Inserted entities from %s with %s=%v", scope.TableName(), scope.PrimaryKey(), scope.PrimaryKeyValue()))
+		if appendOnlyTables[scope.TableName()] {
+			return
+		}
 		entires = append(entires, entity{table: scope.TableName(), keyname: scope.PrimaryKey(), key: scope.PrimaryKeyValue()})
 	})
 	return func() {
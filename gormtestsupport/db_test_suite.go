@@ -3,10 +3,12 @@ package gormtestsupport
 import (
 	"os"
 
+	"github.com/fabric8-services/fabric8-auth/authorization/model"
 	config "github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/migration"
 	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
 
 	"context"
 
@@ -32,6 +34,7 @@ type DBTestSuite struct {
 	Configuration *config.ConfigurationData
 	DB            *gorm.DB
 	Application   application.DB
+	TokenCipher   *encryption.Cipher
 	clean         func()
 	Ctx           context.Context
 }
@@ -55,7 +58,13 @@ func (s *DBTestSuite) SetupSuite() {
 			}, "failed to connect to the database")
 		}
 	}
-	s.Application = gormapplication.NewGormDB(s.DB)
+	s.TokenCipher, err = encryption.NewCipher(s.Configuration)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"err": err,
+		}, "failed to create the external token cipher")
+	}
+	s.Application = gormapplication.NewGormDBWithTokenCipher(s.DB, s.TokenCipher)
 	s.Ctx = migration.NewMigrationContext(context.Background())
 	s.PopulateDBTestSuite(s.Ctx)
 }
@@ -72,6 +81,14 @@ func (s *DBTestSuite) TearDownTest() {
 
 // PopulateDBTestSuite populates the DB with common values
 func (s *DBTestSuite) PopulateDBTestSuite(ctx context.Context) {
+	if _, c := os.LookupEnv(resource.Database); c != false {
+		err := model.Reconcile(ctx, s.DB, s.Configuration)
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to reconcile the authorization model")
+		}
+	}
 }
 
 // TearDownSuite implements suite.TearDownAllSuite
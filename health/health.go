@@ -0,0 +1,167 @@
+// Package health checks the health of the service and of the services it depends on.
+// The checks are registered in a registry for the liveness probe, which tells if the service itself works,
+// for the readiness probe, which tells if the service and the dependencies it can't serve any request without work,
+// or as informational checks of the other dependencies, which are reported without failing any probe.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/rest"
+
+	errs "github.com/pkg/errors"
+)
+
+// Probe is the kind of probe a check is run for
+type Probe string
+
+const (
+	// Liveness checks fail if the service itself doesn't work and must be restarted
+	Liveness Probe = "liveness"
+	// Readiness checks fail if the service or one of its dependencies doesn't work, so it can't serve requests.
+	// The readiness probe runs the liveness checks too.
+	Readiness Probe = "readiness"
+	// Informational checks report the state of the dependencies which only some requests need. They don't fail
+	// the readiness probe, so an outage of one of these dependencies doesn't take every instance out of service.
+	Informational Probe = "informational"
+)
+
+// Checker checks the health of a dependency
+type Checker interface {
+	// Check returns an error if the dependency doesn't work. The check must give up when the context is done.
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a function used as a Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls the function
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the result of a check
+type Result struct {
+	Name      string
+	OK        bool
+	Latency   time.Duration
+	Error     string
+	CheckedAt time.Time
+}
+
+// Registry runs the registered checks with a timeout and caches their results
+type Registry struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+	mu       sync.RWMutex
+	checks   []*check
+}
+
+type check struct {
+	name    string
+	probe   Probe
+	checker Checker
+	mu      sync.Mutex
+	result  *Result
+}
+
+// NewRegistry creates a registry running every check with the given timeout.
+// The result of a check is reused until it's older than cacheTTL.
+func NewRegistry(timeout time.Duration, cacheTTL time.Duration) *Registry {
+	return &Registry{
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds the check with the given name to the probe
+func (r *Registry) Register(name string, probe Probe, checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &check{name: name, probe: probe, checker: checker})
+}
+
+// Check runs the checks of the probe concurrently and returns their results in the order they were registered,
+// and whether they all succeeded.
+func (r *Registry) Check(ctx context.Context, probe Probe) ([]Result, bool) {
+	r.mu.RLock()
+	var checks []*check
+	for _, c := range r.checks {
+		if c.probe == probe || (probe == Readiness && c.probe == Liveness) {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+	ok := true
+	for _, result := range results {
+		ok = ok && result.OK
+	}
+	return results, ok
+}
+
+// run returns the cached result of the check if it's recent enough, or runs the check.
+// The check is abandoned after the timeout of the registry even if the checker ignores the context.
+func (r *Registry) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result != nil && time.Since(c.result.CheckedAt) < r.cacheTTL {
+		return *c.result
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = errs.Errorf("timed out after %s", r.timeout)
+	}
+	result := Result{
+		Name:      c.name,
+		OK:        err == nil,
+		Latency:   time.Since(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	c.result = &result
+	return result
+}
+
+// NewHTTPChecker returns a checker GETting the URL, which fails if the response status is not 2xx
+func NewHTTPChecker(url string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return errs.WithStack(err)
+		}
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return errs.WithStack(err)
+		}
+		defer rest.CloseResponse(res)
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return errs.Errorf("%s responded with status %d", url, res.StatusCode)
+		}
+		return nil
+	})
+}
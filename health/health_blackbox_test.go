@@ -0,0 +1,124 @@
+package health_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/health"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessRunsAllChecks(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	registry := health.NewRegistry(time.Second, 0)
+	registry.Register("signing_keys", health.Liveness, health.CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	registry.Register("keycloak", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+	// when
+	results, ok := registry.Check(context.Background(), health.Readiness)
+	// then
+	assert.False(t, ok)
+	require.Len(t, results, 2)
+	assert.Equal(t, "signing_keys", results[0].Name)
+	assert.True(t, results[0].OK)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, "keycloak", results[1].Name)
+	assert.False(t, results[1].OK)
+	assert.Equal(t, "connection refused", results[1].Error)
+
+	// when
+	results, ok = registry.Check(context.Background(), health.Liveness)
+	// then the readiness checks are not run
+	assert.True(t, ok)
+	require.Len(t, results, 1)
+	assert.Equal(t, "signing_keys", results[0].Name)
+}
+
+func TestInformationalChecksDoNotFailReadiness(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	registry := health.NewRegistry(time.Second, 0)
+	registry.Register("database", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	registry.Register("keycloak", health.Informational, health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+	// when
+	results, ok := registry.Check(context.Background(), health.Readiness)
+	// then
+	assert.True(t, ok)
+	require.Len(t, results, 1)
+	assert.Equal(t, "database", results[0].Name)
+	// when
+	results, ok = registry.Check(context.Background(), health.Informational)
+	// then
+	assert.False(t, ok)
+	require.Len(t, results, 1)
+	assert.Equal(t, "keycloak", results[0].Name)
+	assert.Equal(t, "connection refused", results[0].Error)
+}
+
+func TestCheckTimesOut(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given a check ignoring its context
+	registry := health.NewRegistry(50*time.Millisecond, 0)
+	registry.Register("database", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	// when
+	start := time.Now()
+	results, ok := registry.Check(context.Background(), health.Readiness)
+	// then
+	assert.True(t, time.Since(start) < time.Second)
+	assert.False(t, ok)
+	require.Len(t, results, 1)
+	assert.Equal(t, "timed out after 50ms", results[0].Error)
+	assert.True(t, results[0].Latency >= 50*time.Millisecond)
+}
+
+func TestCheckResultsCached(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	calls := 0
+	registry := health.NewRegistry(time.Second, time.Minute)
+	registry.Register("wit", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		calls++
+		return nil
+	}))
+	// when
+	first, _ := registry.Check(context.Background(), health.Readiness)
+	second, _ := registry.Check(context.Background(), health.Readiness)
+	// then
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, first, second)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	checker := health.NewHTTPChecker(server.URL)
+	// when/then
+	assert.Nil(t, checker.Check(context.Background()))
+	status = http.StatusServiceUnavailable
+	err := checker.Check(context.Background())
+	require.NotNil(t, err)
+	assert.Equal(t, server.URL+" responded with status 503", err.Error())
+}
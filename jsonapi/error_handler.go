@@ -5,7 +5,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"context"
 	"github.com/fabric8-services/fabric8-auth/errors"
@@ -19,6 +22,15 @@ const (
 	ErrorMediaIdentifier = "application/vnd.api+json"
 )
 
+// retryAfterSeconds returns the value of the Retry-After header for the given delay, rounded up to the next second
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
 func shortID() string {
 	b := make([]byte, 6)
 	io.ReadFull(rand.Reader, b)
@@ -43,6 +55,9 @@ func ErrorHandler(service *goa.Service, verbose bool) goa.Middleware {
 			var respBody interface{}
 			respBody, status = ErrorToJSONAPIErrors(ctx, e)
 			rw.Header().Set("Content-Type", ErrorMediaIdentifier)
+			if err, ok := cause.(errors.TooManyRequestsError); ok {
+				rw.Header().Set("Retry-After", retryAfterSeconds(err.RetryAfter))
+			}
 			if err, ok := cause.(goa.ServiceError); ok {
 				status = err.ResponseStatus()
 				//respBody = err
@@ -23,6 +23,7 @@ const (
 	ErrorCodeUnauthorizedError = "unauthorized_error"
 	ErrorCodeForbiddenError    = "forbidden_error"
 	ErrorCodeJWTSecurityError  = "jwt_security_error"
+	ErrorCodeTooManyRequests   = "too_many_requests"
 )
 
 // ErrorToJSONAPIError returns the JSONAPI representation
@@ -65,6 +66,10 @@ func ErrorToJSONAPIError(ctx context.Context, err error) (app.JSONAPIError, int)
 		code = ErrorCodeForbiddenError
 		title = "Forbidden error"
 		statusCode = http.StatusForbidden
+	case errors.TooManyRequestsError:
+		code = ErrorCodeTooManyRequests
+		title = "Too many requests"
+		statusCode = http.StatusTooManyRequests
 	default:
 		code = ErrorCodeUnknownError
 		title = "Unknown error"
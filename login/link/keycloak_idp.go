@@ -9,6 +9,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	errs "github.com/pkg/errors"
 )
 
@@ -36,7 +37,7 @@ type KeycloakIDPServiceClient struct {
 // NewKeycloakIDPServiceClient creates a new Keycloakc
 func NewKeycloakIDPServiceClient() *KeycloakIDPServiceClient {
 	return &KeycloakIDPServiceClient{
-		client: http.DefaultClient,
+		client: tracing.NewHTTPClient("keycloak"),
 	}
 }
 
@@ -54,7 +55,7 @@ func (c *KeycloakIDPServiceClient) Create(ctx context.Context, keycloakLinkIDPRe
 	req.Header.Add("Authorization", "Bearer "+protectedAccessToken)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -10,6 +10,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	errs "github.com/pkg/errors"
 )
 
@@ -94,7 +95,7 @@ type KeycloakUserProfileClient struct {
 // NewKeycloakUserProfileClient creates a new KeycloakUserProfileClient
 func NewKeycloakUserProfileClient() *KeycloakUserProfileClient {
 	return &KeycloakUserProfileClient{
-		client: http.DefaultClient,
+		client: tracing.NewHTTPClient("keycloak"),
 	}
 }
 
@@ -112,7 +113,7 @@ func (userProfileClient *KeycloakUserProfileClient) Create(ctx context.Context,
 	req.Header.Add("Authorization", "Bearer "+protectedAccessToken)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := userProfileClient.client.Do(req)
+	resp, err := userProfileClient.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -192,7 +193,7 @@ func (userProfileClient *KeycloakUserProfileClient) Update(ctx context.Context,
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := userProfileClient.client.Do(req)
+	resp, err := userProfileClient.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -245,7 +246,7 @@ func (userProfileClient *KeycloakUserProfileClient) Get(ctx context.Context, acc
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json, text/plain, */*")
 
-	resp, err := userProfileClient.client.Do(req)
+	resp, err := userProfileClient.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -16,14 +16,19 @@ import (
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
+	"github.com/fabric8-services/fabric8-auth/auth"
 	autherrors "github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login/tokencontext"
+	"github.com/fabric8-services/fabric8-auth/metric"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/token"
 	"github.com/fabric8-services/fabric8-auth/token/oauth"
-	"github.com/fabric8-services/fabric8-auth/wit"
+	"github.com/fabric8-services/fabric8-auth/token/session"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/goadesign/goa"
@@ -37,28 +42,25 @@ type LoginServiceConfiguration interface {
 	GetKeycloakEndpointBroker(*goa.RequestData) (string, error)
 	GetValidRedirectURLs() string
 	GetNotApprovedRedirect() string
-	GetWITURL(*goa.RequestData) (string, error)
 	GetOpenShiftClientApiUrl() string
 }
 
 // NewKeycloakOAuthProvider creates a new login.Service capable of using keycloak for authorization
 func NewKeycloakOAuthProvider(identities account.IdentityRepository, users account.UserRepository, tokenManager token.Manager, db application.DB) *KeycloakOAuthProvider {
 	return &KeycloakOAuthProvider{
-		Identities:       identities,
-		Users:            users,
-		TokenManager:     tokenManager,
-		db:               db,
-		remoteWITService: &wit.RemoteWITServiceCaller{},
+		Identities:   identities,
+		Users:        users,
+		TokenManager: tokenManager,
+		db:           db,
 	}
 }
 
 // KeycloakOAuthProvider represents a keycloak IDP
 type KeycloakOAuthProvider struct {
-	Identities       account.IdentityRepository
-	Users            account.UserRepository
-	TokenManager     token.Manager
-	db               application.DB
-	remoteWITService wit.RemoteWITService
+	Identities   account.IdentityRepository
+	Users        account.UserRepository
+	TokenManager token.Manager
+	db           application.DB
 }
 
 // KeycloakOAuthService represents keycloak OAuth service interface
@@ -84,6 +86,8 @@ const (
 	apiClientParam       = "api_client"
 	apiTokenParam        = "api_token"
 	tokenJSONParam       = "token_json"
+	// authorizationCodeParam is the parameter of the authorization code returned to the public clients
+	authorizationCodeParam = "code"
 )
 
 // Perform performs authentication
@@ -99,11 +103,6 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 	}
 	validRedirectURL := serviceConfig.GetValidRedirectURLs()
 
-	witURL, err := serviceConfig.GetWITURL(ctx.RequestData)
-	if err != nil {
-		return jsonapi.JSONErrorResponse(ctx, autherrors.NewInternalError(ctx, err))
-	}
-
 	state := ctx.Params.Get("state")
 	code := ctx.Params.Get("code")
 
@@ -118,9 +117,22 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			"code":  code,
 			"state": state,
 		}, "Redirected from oauth provider")
+		outcome := metric.LoginFailed
+		var loggedIn *account.Identity
+		defer func() {
+			metric.RecordLogin(outcome)
+			actorID, subject := uuid.Nil, ""
+			if loggedIn != nil {
+				actorID, subject = loggedIn.ID, loggedIn.Username
+			}
+			// a failure to record the event must not change the response, so the error is only logged by the repository
+			audit.Record(ctx, keycloak.db.AuditEvents(), audit.Login, actorID, subject, audit.OutcomeOf(outcome == metric.LoginSucceeded), audit.Details{
+				"result": outcome,
+			})
+		}()
 
 		// validate known state
-		knownReferrer, err := keycloak.getReferrer(ctx, state)
+		stateReference, err := keycloak.getStateReference(ctx, state)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"state": state,
@@ -129,6 +141,8 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			jerrors, _ := jsonapi.ErrorToJSONAPIErrors(ctx, goa.ErrUnauthorized("unknown state. "+err.Error()))
 			return ctx.Unauthorized(jerrors)
 		}
+		knownReferrer := stateReference.Referrer
+		codeChallenge := oauth.StateCodeChallenge(*stateReference)
 
 		log.Debug(ctx, map[string]interface{}{
 			"code":           code,
@@ -136,7 +150,8 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			"known_referrer": knownReferrer,
 		}, "referrer found")
 
-		keycloakToken, err := config.Exchange(ctx, code)
+		// the code is exchanged with the client of the context, which sends the trace context to Keycloak
+		keycloakToken, err := config.Exchange(context.WithValue(ctx, oauth2.HTTPClient, tracing.NewHTTPClient("keycloak")), code)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"code": code,
@@ -164,14 +179,16 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 
 		apiClient := referrerURL.Query().Get(apiClientParam)
 
-		identity, newUser, err := keycloak.CreateOrUpdateIdentity(ctx, keycloakToken.AccessToken, serviceConfig)
+		identity, _, err := keycloak.CreateOrUpdateIdentity(ctx, keycloakToken.AccessToken, serviceConfig)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"err": err,
 			}, "failed to create a user and keycloak identity ")
 			switch err.(type) {
 			case autherrors.UnauthorizedError:
-				if apiClient != "" {
+				outcome = metric.LoginNotApproved
+				// the Keycloak token is not returned to the public clients in the redirect URL
+				if apiClient != "" && codeChallenge == nil {
 					// Return the api token
 					err = encodeToken(ctx, referrerURL, keycloakToken, apiClient)
 					if err != nil {
@@ -199,6 +216,15 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			}
 			return jsonapi.JSONErrorResponse(ctx, err)
 		}
+		loggedIn = identity
+		if identity.User.Deactivated {
+			log.Warn(ctx, map[string]interface{}{
+				"identity_id": identity.ID,
+				"user_name":   identity.Username,
+			}, "login of a deactivated user refused")
+			outcome = metric.LoginDeactivated
+			return redirectWithError(ctx, knownReferrer, "account_deactivated")
+		}
 
 		log.Debug(ctx, map[string]interface{}{
 			"code":           code,
@@ -207,37 +233,31 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			"user_name":      identity.Username,
 		}, "local user created/updated")
 
-		// new user for WIT
-		if newUser {
-			err = keycloak.remoteWITService.CreateWITUser(ctx, ctx.RequestData, identity, witURL, identity.ID.String())
+		if codeChallenge != nil {
+			// Return an authorization code to the public client, which exchanges it for the tokens with its code verifier
+			err = keycloak.encodeAuthorizationCode(ctx, referrerURL, knownReferrer, *codeChallenge, identity, keycloakToken)
 			if err != nil {
 				log.Error(ctx, map[string]interface{}{
-					"err":         err,
-					"identity_id": identity.ID,
-					"username":    identity.Username,
-					"wit_url":     witURL,
-				}, "unable to create user in WIT ")
-				// let's carry on instead of erroring out
+					"err": err,
+				}, "failed to issue authorization code")
+				return redirectWithError(ctx, knownReferrer, err.Error())
 			}
 		} else {
-			err = keycloak.updateWITUser(ctx, ctx.RequestData, identity, witURL, identity.ID.String())
+			// Return the tokens issued by the Auth service instead of the Keycloak ones
+			userToken, err := keycloak.generateUserToken(ctx, ctx.RequestData, identity, keycloakToken, apiClient)
 			if err != nil {
 				log.Error(ctx, map[string]interface{}{
-					"identity_id": identity.ID,
-					"username":    identity.Username,
-					"err":         err,
-					"wit_url":     witURL,
-				}, "unable to update user in WIT ")
-				// let's carry on instead of erroring out
+					"err": err,
+				}, "failed to generate token")
+				return redirectWithError(ctx, knownReferrer, err.Error())
+			}
+			err = encodeToken(ctx, referrerURL, userToken, apiClient)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"err": err,
+				}, "failed to encode token")
+				return redirectWithError(ctx, knownReferrer, err.Error())
 			}
-		}
-
-		err = encodeToken(ctx, referrerURL, keycloakToken, apiClient)
-		if err != nil {
-			log.Error(ctx, map[string]interface{}{
-				"err": err,
-			}, "failed to encode token")
-			return redirectWithError(ctx, knownReferrer, err.Error())
 		}
 		log.Debug(ctx, map[string]interface{}{
 			"code":           code,
@@ -245,6 +265,7 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 			"known_referrer": knownReferrer,
 			"user_name":      identity.Username,
 		}, "token encoded")
+		outcome = metric.LoginSucceeded
 
 		if s, err := strconv.ParseBool(referrerURL.Query().Get(initiateLinkingParam)); err != nil || !s {
 			ctx.ResponseData.Header().Set("Location", referrerURL.String())
@@ -315,12 +336,17 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 
 	stateID := uuid.NewV4()
 
+	codeChallenge, err := oauth.NewCodeChallenge(ctx.CodeChallenge, ctx.CodeChallengeMethod)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
 	redirect, err = keycloak.saveParams(ctx, *redirect)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
 
-	err = keycloak.saveReferrer(ctx, stateID, *redirect, validRedirectURL)
+	err = keycloak.saveReferrer(ctx, stateID, *redirect, validRedirectURL, codeChallenge)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"state":    stateID,
@@ -337,6 +363,50 @@ func (keycloak *KeycloakOAuthProvider) Perform(ctx *app.LoginLoginContext, confi
 	return ctx.TemporaryRedirect()
 }
 
+// generateUserToken starts a new session for the identity which has been authenticated by Keycloak
+// and returns the access and refresh tokens issued by the Auth service. The Keycloak session state is kept in the generated tokens.
+func (keycloak *KeycloakOAuthProvider) generateUserToken(ctx context.Context, req *goa.RequestData, identity *account.Identity, keycloakToken *oauth2.Token, apiClient string) (*oauth2.Token, error) {
+	claims, err := keycloak.TokenManager.ParseToken(ctx, keycloakToken.AccessToken)
+	if err != nil {
+		return nil, autherrors.NewUnauthorizedError(err.Error())
+	}
+	tokenSet, err := session.Start(ctx, keycloak.db, keycloak.TokenManager, req, *identity, claims.SessionState, apiClient)
+	if err != nil {
+		return nil, err
+	}
+	return TokenSetToOauthToken(tokenSet), nil
+}
+
+// TokenSetToOauthToken converts a token set to an oauth2 token which can be marshaled with TokenToJson
+func TokenSetToOauthToken(tokenSet *token.TokenSet) *oauth2.Token {
+	oauthToken := &oauth2.Token{
+		AccessToken:  *tokenSet.AccessToken,
+		RefreshToken: *tokenSet.RefreshToken,
+		TokenType:    *tokenSet.TokenType,
+	}
+	return oauthToken.WithExtra(map[string]interface{}{
+		"expires_in":         *tokenSet.ExpiresIn,
+		"refresh_expires_in": *tokenSet.RefreshExpiresIn,
+	})
+}
+
+// encodeAuthorizationCode adds an authorization code to the referrer. The code is exchanged for the tokens of a new session
+// by the public client which sent the code challenge. The Keycloak session state is kept with the code.
+func (keycloak *KeycloakOAuthProvider) encodeAuthorizationCode(ctx context.Context, referrerURL *url.URL, knownReferrer string, codeChallenge oauth.CodeChallenge, identity *account.Identity, keycloakToken *oauth2.Token) error {
+	claims, err := keycloak.TokenManager.ParseToken(ctx, keycloakToken.AccessToken)
+	if err != nil {
+		return autherrors.NewUnauthorizedError(err.Error())
+	}
+	code, err := oauth.SaveAuthorizationCode(ctx, keycloak.db, knownReferrer, codeChallenge, identity.ID, claims.SessionState)
+	if err != nil {
+		return err
+	}
+	parameters := referrerURL.Query()
+	parameters.Set(authorizationCodeParam, code)
+	referrerURL.RawQuery = parameters.Encode()
+	return nil
+}
+
 func encodeToken(ctx context.Context, referrer *url.URL, outhToken *oauth2.Token, apiClient string) error {
 	tokenJson, err := TokenToJson(ctx, outhToken)
 	if err != nil {
@@ -422,7 +492,7 @@ func (keycloak *KeycloakOAuthProvider) checkFederatedIdentity(ctx context.Contex
 		return false, autherrors.NewInternalError(ctx, errs.Wrap(err, "unable to create http request"))
 	}
 	req.Header.Add("Authorization", "Bearer "+token)
-	res, err := http.DefaultClient.Do(req)
+	res, err := tracing.NewHTTPClient("keycloak").Do(req.WithContext(ctx))
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"provider": provider,
@@ -463,7 +533,7 @@ func (keycloak *KeycloakOAuthProvider) linkAccountToProviders(ctx linkInterface,
 	}
 
 	state := uuid.NewV4()
-	err := keycloak.saveReferrer(ctx, state, *rdr, validRedirectURL)
+	err := keycloak.saveReferrer(ctx, state, *rdr, validRedirectURL, nil)
 	if err != nil {
 		return err
 	}
@@ -541,8 +611,8 @@ func (keycloak *KeycloakOAuthProvider) linkProvider(ctx linkInterface, req *goa.
 	return ctx.TemporaryRedirect()
 }
 
-func (keycloak *KeycloakOAuthProvider) saveReferrer(ctx linkInterface, state uuid.UUID, referrer string, validReferrerURL string) error {
-	err := oauth.SaveReferrer(ctx, keycloak.db, state, referrer, validReferrerURL)
+func (keycloak *KeycloakOAuthProvider) saveReferrer(ctx linkInterface, state uuid.UUID, referrer string, validReferrerURL string, codeChallenge *oauth.CodeChallenge) error {
+	err := oauth.SaveReferrerWithCodeChallenge(ctx, keycloak.db, state, referrer, validReferrerURL, codeChallenge)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -553,6 +623,10 @@ func (keycloak *KeycloakOAuthProvider) getReferrer(ctx context.Context, state st
 	return oauth.LoadReferrer(ctx, keycloak.db, state)
 }
 
+func (keycloak *KeycloakOAuthProvider) getStateReference(ctx context.Context, state string) (*auth.OauthStateReference, error) {
+	return oauth.LoadStateReference(ctx, keycloak.db, state)
+}
+
 func getProviderURL(req *goa.RequestData, state string, sessionState string, provider string, nextProvider *string, brokerEndpoint string, clientID string) (string, error) {
 	var nextParam string
 	if nextProvider != nil {
@@ -605,10 +679,6 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 		return nil, false, errors.New("invalid keycloak token claims " + err.Error())
 	}
 
-	if !claims.Approved {
-		return nil, false, autherrors.NewUnauthorizedError(fmt.Sprintf("user '%s' is not approved", claims.Username))
-	}
-
 	keycloakIdentityID, _ := uuid.FromString(claims.Subject)
 
 	identity := &account.Identity{}
@@ -642,6 +712,9 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 		if identity.User.Cluster == "" {
 			identity.User.Cluster = configuration.GetOpenShiftClientApiUrl()
 		}
+		// the approval in Keycloak only sets the initial approval state of the new users.
+		// The approval state of the existing users is managed by the Auth service
+		identity.User.ApprovalState = account.KeycloakApprovalState(claims.Approved)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"keycloak_identity_id": keycloakIdentityID,
@@ -663,7 +736,10 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 			identity.User = *user
 
 			err = appl.Identities().Create(ctx, identity)
-			return err
+			if err != nil {
+				return err
+			}
+			return outbox.RecordUserEvent(ctx, appl.OutboxEvents(), outbox.UserCreated, *identity)
 		})
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
@@ -691,6 +767,11 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 		// in case the user changed them since the last time he/she logged in
 		isChanged, err := fillUser(claims, identity)
 		user := &identity.User
+		if user.ApprovalState == nil {
+			// the approval state of the users created before it was stored locally is initialised from Keycloak
+			user.ApprovalState = account.KeycloakApprovalState(claims.Approved)
+			isChanged = true
+		}
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"keycloak_identity_id": keycloakIdentityID,
@@ -715,7 +796,7 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 					}, "unable to update identity")
 					return errors.New("failed to update identity " + err.Error())
 				}
-				return err
+				return outbox.RecordUserEvent(ctx, appl.OutboxEvents(), outbox.UserUpdated, *identity)
 			})
 			if err != nil {
 				log.Error(ctx, map[string]interface{}{
@@ -727,26 +808,17 @@ func (keycloak *KeycloakOAuthProvider) CreateOrUpdateIdentity(ctx context.Contex
 			}
 		}
 	}
+	if !identity.User.Approved() {
+		log.Info(ctx, map[string]interface{}{
+			"identity_id":    identity.ID,
+			"username":       identity.Username,
+			"approval_state": identity.User.ApprovalState,
+		}, "user not approved")
+		return nil, false, autherrors.NewUnauthorizedError(fmt.Sprintf("user '%s' is not approved", claims.Username))
+	}
 	return identity, newIdentityCreated, err
 }
 
-func (keycloak *KeycloakOAuthProvider) updateWITUser(ctx context.Context, request *goa.RequestData, identity *account.Identity, witURL string, identityID string) error {
-	updateUserPayload := &app.UpdateUsersPayload{
-		Data: &app.UpdateUserData{
-			Attributes: &app.UpdateIdentityDataAttributes{
-				Bio:      &identity.User.Bio,
-				Company:  &identity.User.Company,
-				Email:    &identity.User.Email,
-				FullName: &identity.User.FullName,
-				ImageURL: &identity.User.ImageURL,
-				URL:      &identity.User.URL,
-				Username: &identity.Username,
-			},
-		},
-	}
-	return keycloak.remoteWITService.UpdateWITUser(ctx, request, updateUserPayload, witURL, identityID)
-}
-
 func redirectWithError(ctx *app.LoginLoginContext, knownReferrer string, errorString string) error {
 	ctx.ResponseData.Header().Set("Location", knownReferrer+"?error="+errorString)
 	return ctx.TemporaryRedirect()
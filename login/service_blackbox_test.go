@@ -16,9 +16,11 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
 	. "github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/resource"
 	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/goadesign/goa"
@@ -136,6 +138,7 @@ func (s *serviceBlackBoxTest) TestApprovedUserCreatedAndUpdated() {
 	assert.True(s.T(), ok)
 	s.checkIfTokenMatchesIdentity(token, *identity)
 	assert.Equal(s.T(), s.Configuration.GetOpenShiftClientApiUrl(), identity.User.Cluster)
+	s.checkOutboxEvents(*identity, outbox.UserCreated)
 
 	updatedClaims := make(map[string]interface{})
 	updatedClaims["company"] = "Updated company"
@@ -152,6 +155,7 @@ func (s *serviceBlackBoxTest) TestApprovedUserCreatedAndUpdated() {
 	require.NotNil(s.T(), identity)
 	assert.False(s.T(), ok)
 	s.checkIfTokenMatchesIdentity(token, *identity)
+	s.checkOutboxEvents(*identity, outbox.UserCreated, outbox.UserUpdated)
 }
 
 func (s *serviceBlackBoxTest) TestUnapprovedUserUnauthorized() {
@@ -165,6 +169,98 @@ func (s *serviceBlackBoxTest) TestUnapprovedUserUnauthorized() {
 	require.IsType(s.T(), errors.NewUnauthorizedError(""), err)
 }
 
+func (s *serviceBlackBoxTest) TestUnapprovedUserPendingUntilApproved() {
+	// given a user who is not approved in Keycloak
+	claims := make(map[string]interface{})
+	claims["approved"] = false
+	claims["preferred_username"] = "testUser-" + uuid.NewV4().String()
+	token, err := testtoken.GenerateTokenWithClaims(claims)
+	require.Nil(s.T(), err)
+	// when
+	_, _, err = s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	// then the user is created in the pending state
+	require.NotNil(s.T(), err)
+	require.IsType(s.T(), errors.NewUnauthorizedError(""), err)
+	identities, err := s.Application.Identities().Query(account.IdentityFilterByUsername(claims["preferred_username"].(string)), account.IdentityWithUser())
+	require.Nil(s.T(), err)
+	require.Len(s.T(), identities, 1)
+	require.NotNil(s.T(), identities[0].User.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStatePending, *identities[0].User.ApprovalState)
+
+	// when the user is approved locally
+	user := identities[0].User
+	user.ApprovalState = account.KeycloakApprovalState(true)
+	require.Nil(s.T(), s.Application.Users().Save(context.Background(), &user))
+	identity, _, err := s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	// then the user can log in, even though Keycloak doesn't approve it
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), identities[0].ID, identity.ID)
+
+	// when the user is rejected
+	rejected := account.ApprovalStateRejected
+	user.ApprovalState = &rejected
+	require.Nil(s.T(), s.Application.Users().Save(context.Background(), &user))
+	_, _, err = s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	// then
+	require.NotNil(s.T(), err)
+	require.IsType(s.T(), errors.NewUnauthorizedError(""), err)
+}
+
+func (s *serviceBlackBoxTest) TestUnknownApprovalStateInitialisedFromKeycloak() {
+	// given a user created before the approval state was stored locally
+	claims := make(map[string]interface{})
+	claims["sub"] = uuid.NewV4().String()
+	token, err := testtoken.GenerateTokenWithClaims(claims)
+	require.Nil(s.T(), err)
+	identity, _, err := s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	require.Nil(s.T(), err)
+	user := identity.User
+	user.ApprovalState = nil
+	require.Nil(s.T(), s.Application.Users().Save(context.Background(), &user))
+
+	// when the user, who is waiting to be approved in Keycloak, logs in
+	claims["approved"] = false
+	token, err = testtoken.GenerateTokenWithClaims(claims)
+	require.Nil(s.T(), err)
+	_, _, err = s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	// then the user is pending
+	require.NotNil(s.T(), err)
+	require.IsType(s.T(), errors.NewUnauthorizedError(""), err)
+	loaded, err := s.Application.Users().Load(context.Background(), user.ID)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), loaded.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStatePending, *loaded.ApprovalState)
+
+	// when the user, who is approved in Keycloak, logs in with an unknown approval state
+	loaded.ApprovalState = nil
+	require.Nil(s.T(), s.Application.Users().Save(context.Background(), loaded))
+	claims["approved"] = true
+	token, err = testtoken.GenerateTokenWithClaims(claims)
+	require.Nil(s.T(), err)
+	_, _, err = s.loginService.CreateOrUpdateIdentity(context.Background(), token, s.Configuration)
+	// then the user is approved
+	require.Nil(s.T(), err)
+	loaded, err = s.Application.Users().Load(context.Background(), user.ID)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), loaded.ApprovalState)
+	assert.Equal(s.T(), account.ApprovalStateApproved, *loaded.ApprovalState)
+}
+
+// checkOutboxEvents checks the types of the events recorded for the identity and the payload of the last one
+func (s *serviceBlackBoxTest) checkOutboxEvents(identity account.Identity, eventTypes ...string) {
+	events, err := s.Application.OutboxEvents().ListByIdentity(context.Background(), identity.ID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), events, len(eventTypes))
+	for i, eventType := range eventTypes {
+		assert.Equal(s.T(), eventType, events[i].Type)
+	}
+	var payload outbox.User
+	require.Nil(s.T(), events[len(events)-1].Unmarshal(&payload))
+	assert.Equal(s.T(), identity.Username, payload.Username)
+	assert.Equal(s.T(), identity.User.FullName, payload.FullName)
+	assert.Equal(s.T(), identity.User.Company, payload.Company)
+}
+
 func (s *serviceBlackBoxTest) checkIfTokenMatchesIdentity(tokenString string, identity account.Identity) {
 	claims, err := testtoken.TokenManager.ParseToken(context.Background(), tokenString)
 	require.Nil(s.T(), err)
@@ -525,7 +621,7 @@ func (s *serviceBlackBoxTest) TestInvalidOAuthAuthorizationCode() {
 
 func (s *serviceBlackBoxTest) TestValidOAuthAuthorizationCode() {
 	rw, authorizeCtx := s.loginCallback(make(map[string]string))
-	s.checkLoginCallback(s.dummyOauth, rw, authorizeCtx, "token_json")
+	s.checkLoginCallback(s.dummyOauth, rw, authorizeCtx, "token_json", true)
 }
 
 func (s *serviceBlackBoxTest) TestUnapprovedUserLoginUnauthorized() {
@@ -563,7 +659,7 @@ func (s *serviceBlackBoxTest) TestAPIClientForApprovedUsersReturnOK() {
 		accessToken: accessToken,
 	}
 
-	s.checkLoginCallback(dummyOauth, rw, authorizeCtx, "api_token")
+	s.checkLoginCallback(dummyOauth, rw, authorizeCtx, "api_token", true)
 }
 
 func (s *serviceBlackBoxTest) TestAPIClientForUnapprovedUsersReturnOK() {
@@ -581,7 +677,8 @@ func (s *serviceBlackBoxTest) TestAPIClientForUnapprovedUsersReturnOK() {
 		accessToken: accessToken,
 	}
 
-	s.checkLoginCallback(dummyOauth, rw, authorizeCtx, "api_token")
+	// Unapproved users get the Keycloak token
+	s.checkLoginCallback(dummyOauth, rw, authorizeCtx, "api_token", false)
 }
 
 func (s *serviceBlackBoxTest) loginCallback(extraParams map[string]string) (*httptest.ResponseRecorder, *app.LoginLoginContext) {
@@ -643,7 +740,7 @@ func (s *serviceBlackBoxTest) loginCallback(extraParams map[string]string) (*htt
 	return rw, authorizeCtx
 }
 
-func (s *serviceBlackBoxTest) checkLoginCallback(dummyOauth *dummyOauth2Config, rw *httptest.ResponseRecorder, authorizeCtx *app.LoginLoginContext, tokenParam string) {
+func (s *serviceBlackBoxTest) checkLoginCallback(dummyOauth *dummyOauth2Config, rw *httptest.ResponseRecorder, authorizeCtx *app.LoginLoginContext, tokenParam string, selfIssued bool) {
 
 	err := s.loginService.Perform(authorizeCtx, dummyOauth, s.Configuration)
 	require.Nil(s.T(), err)
@@ -663,8 +760,31 @@ func (s *serviceBlackBoxTest) checkLoginCallback(dummyOauth *dummyOauth2Config,
 
 	tokenSet, err := token.ReadTokenSetFromJson(context.Background(), tokenJson[0])
 	require.Nil(s.T(), err)
-	assert.Equal(s.T(), dummyOauth.accessToken, *tokenSet.AccessToken)
-	assert.Equal(s.T(), "someRefreshToken", *tokenSet.RefreshToken)
+	if selfIssued {
+		// The tokens issued by the Auth service are returned instead of the Keycloak ones
+		keycloakClaims, err := testtoken.TokenManager.ParseToken(context.Background(), dummyOauth.accessToken)
+		require.Nil(s.T(), err)
+		claims, err := testtoken.TokenManager.ParseToken(context.Background(), *tokenSet.AccessToken)
+		require.Nil(s.T(), err)
+		assert.NotEqual(s.T(), dummyOauth.accessToken, *tokenSet.AccessToken)
+		assert.Equal(s.T(), keycloakClaims.Subject, claims.Subject)
+		assert.Equal(s.T(), keycloakClaims.Username, claims.Username)
+		assert.Equal(s.T(), keycloakClaims.Email, claims.Email)
+		assert.Equal(s.T(), keycloakClaims.SessionState, claims.SessionState)
+		refreshClaims, err := testtoken.TokenManager.ParseRefreshToken(context.Background(), *tokenSet.RefreshToken)
+		require.Nil(s.T(), err)
+		assert.Equal(s.T(), keycloakClaims.Subject, refreshClaims.Subject)
+		assert.Equal(s.T(), int64(s.Configuration.GetUserAccessTokenExpiresIn().Seconds()), *tokenSet.ExpiresIn)
+		// The refresh token of the new session is stored
+		storedToken, err := s.Application.RefreshTokens().LoadByHash(context.Background(), refresh.Hash(*tokenSet.RefreshToken))
+		require.Nil(s.T(), err)
+		assert.Equal(s.T(), refreshClaims.SessionID, storedToken.SessionID.String())
+		assert.Equal(s.T(), keycloakClaims.Subject, storedToken.IdentityID.String())
+		assert.Nil(s.T(), storedToken.ParentID)
+	} else {
+		assert.Equal(s.T(), dummyOauth.accessToken, *tokenSet.AccessToken)
+		assert.Equal(s.T(), "someRefreshToken", *tokenSet.RefreshToken)
+	}
 
 	assert.NotContains(s.T(), locationString, "https://keycloak-url.example.org/path-of-login")
 	assert.Contains(s.T(), locationString, "https://openshift.io/somepath")
@@ -0,0 +1,139 @@
+package login
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/tracing"
+
+	"github.com/goadesign/goa"
+	errs "github.com/pkg/errors"
+)
+
+type keycloakUserAdminConfiguration interface {
+	GetKeycloakEndpointToken(*goa.RequestData) (string, error)
+	GetKeycloakEndpointUsers(*goa.RequestData) (string, error)
+	GetKeycloakClientID() string
+	GetKeycloakSecret() string
+}
+
+// KeycloakUserAdminClient updates the users in Keycloak with the admin REST API,
+// authenticated with the protection API token of the Auth service client.
+type KeycloakUserAdminClient struct {
+	config keycloakUserAdminConfiguration
+	client *http.Client
+}
+
+// NewKeycloakUserAdminClient creates a new KeycloakUserAdminClient
+func NewKeycloakUserAdminClient(config keycloakUserAdminConfiguration) *KeycloakUserAdminClient {
+	return &KeycloakUserAdminClient{
+		config: config,
+		client: tracing.NewHTTPClient("keycloak"),
+	}
+}
+
+// SetAttribute sets the values of an attribute of the Keycloak user. The admin REST API replaces all the attributes
+// of the user, so the user is loaded first and sent back with the other attributes unchanged.
+// Nothing is updated if the attribute already has the values.
+// Returns NotFoundError if the user doesn't exist in Keycloak.
+func (c *KeycloakUserAdminClient) SetAttribute(ctx context.Context, req *goa.RequestData, userID string, name string, values []string) error {
+	tokenEndpoint, err := c.config.GetKeycloakEndpointToken(req)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	protectedAccessToken, err := auth.GetProtectedAPIToken(ctx, tokenEndpoint, c.config.GetKeycloakClientID(), c.config.GetKeycloakSecret())
+	if err != nil {
+		return err
+	}
+	usersEndpoint, err := c.config.GetKeycloakEndpointUsers(req)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	userURL := usersEndpoint + "/" + userID
+
+	user := map[string]json.RawMessage{}
+	err = c.do(ctx, "GET", userURL, protectedAccessToken, nil, &user)
+	if err != nil {
+		return err
+	}
+	attributes := KeycloakUserProfileAttributes{}
+	if rawAttributes, found := user["attributes"]; found {
+		err = json.Unmarshal(rawAttributes, &attributes)
+		if err != nil {
+			return errors.NewInternalError(ctx, errs.Wrapf(err, "unable to decode the attributes of the Keycloak user %s", userURL))
+		}
+	}
+	if reflect.DeepEqual(attributes[name], values) {
+		return nil
+	}
+	attributes[name] = values
+	user["attributes"], err = json.Marshal(attributes)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	err = c.do(ctx, "PUT", userURL, protectedAccessToken, user, nil)
+	if err != nil {
+		return err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"keycloak_user_url": userURL,
+		"attribute":         name,
+		"values":            values,
+	}, "Keycloak user attribute updated")
+	return nil
+}
+
+// do sends the request to the admin REST API and decodes the response into the result, if any
+func (c *KeycloakUserAdminClient) do(ctx context.Context, method string, userURL string, protectedAccessToken string, payload interface{}, result interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		err := json.NewEncoder(&body).Encode(payload)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+	}
+	req, err := http.NewRequest(method, userURL, &body)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	req.Header.Add("Authorization", "Bearer "+protectedAccessToken)
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"keycloak_user_url": userURL,
+			"method":            method,
+			"err":               err,
+		}, "unable to send the request to the Keycloak admin REST API")
+		return errors.NewInternalError(ctx, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.NewNotFoundError("keycloak user", userURL)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		bodyString := rest.ReadBody(resp.Body)
+		log.Error(ctx, map[string]interface{}{
+			"keycloak_user_url": userURL,
+			"method":            method,
+			"response_status":   resp.Status,
+			"response_body":     bodyString,
+		}, "unexpected response of the Keycloak admin REST API")
+		return errors.NewInternalError(ctx, errs.Errorf("received a non-2xx response %s from %s %s", resp.Status, method, userURL))
+	}
+	if result == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return errors.NewInternalError(ctx, errs.Wrapf(err, "unable to decode the response of %s %s", method, userURL))
+	}
+	return nil
+}
@@ -1,30 +1,44 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/account/admin"
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
 	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/authorization/model"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/goamiddleware"
 	"github.com/fabric8-services/fabric8-auth/gormapplication"
+	"github.com/fabric8-services/fabric8-auth/health"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/login"
 	keycloakLinkAPI "github.com/fabric8-services/fabric8-auth/login/link"
+	"github.com/fabric8-services/fabric8-auth/login/tokencontext"
 	"github.com/fabric8-services/fabric8-auth/migration"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/ratelimit"
 	"github.com/fabric8-services/fabric8-auth/space/authz"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
 	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
 	"github.com/fabric8-services/fabric8-auth/token/keycloak"
 	"github.com/fabric8-services/fabric8-auth/token/link"
+	"github.com/fabric8-services/fabric8-auth/tracing"
+	"github.com/fabric8-services/fabric8-auth/webhook"
+	"github.com/fabric8-services/fabric8-auth/wit"
 
 	"github.com/goadesign/goa"
 	"github.com/goadesign/goa/logging/logrus"
@@ -42,13 +56,17 @@ func main() {
 	var configFile string
 	var serviceAccountConfigFile string
 	var osoClusterConfigFile string
+	var authorizationModelConfigFile string
 	var printConfig bool
 	var migrateDB bool
+	var importSpaceCollaborators bool
 	flag.StringVar(&configFile, "config", "", "Path to the config file to read")
 	flag.StringVar(&serviceAccountConfigFile, "serviceAccountConfig", "", "Path to the service account configuration file")
 	flag.StringVar(&osoClusterConfigFile, "osoClusterConfigFile", "", "Path to the OSO cluster configuration file")
+	flag.StringVar(&authorizationModelConfigFile, "authorizationModelConfigFile", "", "Path to the authorization model configuration file")
 	flag.BoolVar(&printConfig, "printConfig", false, "Prints the config (including merged environment variables) and exits")
 	flag.BoolVar(&migrateDB, "migrateDatabase", false, "Migrates the database to the newest version and exits.")
+	flag.BoolVar(&importSpaceCollaborators, "importSpaceCollaborators", false, "Imports the space collaborators from the Keycloak policies into the database and exits. The Keycloak URL must be configured.")
 	flag.Parse()
 
 	// Override default -config switch with environment variable only if -config switch was
@@ -56,13 +74,15 @@ func main() {
 	configFile = configFileFromFlags("config", "AUTH_CONFIG_FILE_PATH")
 	serviceAccountConfigFile = configFileFromFlags("serviceAccountConfig", "AUTH_SERVICE_ACCOUNT_CONFIG_FILE")
 	osoClusterConfigFile = configFileFromFlags("osoClusterConfigFile", "AUTH_OSO_CLUSTER_CONFIG_FILE")
+	authorizationModelConfigFile = configFileFromFlags("authorizationModelConfigFile", "AUTH_AUTHORIZATION_MODEL_CONFIG_FILE")
 
-	config, err := configuration.NewConfigurationData(configFile, serviceAccountConfigFile, osoClusterConfigFile)
+	config, err := configuration.NewConfigurationDataWithAuthorizationModel(configFile, serviceAccountConfigFile, osoClusterConfigFile, authorizationModelConfigFile)
 	if err != nil {
 		log.Panic(nil, map[string]interface{}{
-			"config_file":                 configFile,
-			"service_account_config_file": serviceAccountConfigFile,
-			"oso_cluster_config_file":     osoClusterConfigFile,
+			"config_file":                     configFile,
+			"service_account_config_file":     serviceAccountConfigFile,
+			"oso_cluster_config_file":         osoClusterConfigFile,
+			"authorization_model_config_file": authorizationModelConfigFile,
 			"err": err,
 		}, "failed to setup the configuration")
 	}
@@ -114,19 +134,47 @@ func main() {
 		}, "failed migration")
 	}
 
+	// Reconcile the declared authorization model
+	err = model.Reconcile(context.Background(), db, config)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"err": err,
+		}, "failed to reconcile the authorization model")
+	}
+
 	// Nothing to here except exit, since the migration is already performed.
 	if migrateDB {
 		os.Exit(0)
 	}
 
+	if importSpaceCollaborators {
+		err = collaborator.ImportPolicies(context.Background(), gormapplication.NewGormDB(db), auth.NewKeycloakPolicyManager(config))
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to import the space collaborators")
+		}
+		os.Exit(0)
+	}
+
 	// Load service accounts
 	//	application.s
 
+	// Set up the tracer reporting the spans of the traces
+	tracingCloser, err := tracing.Configure(config)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"err": err,
+		}, "failed to set up the tracing")
+	}
+	defer tracingCloser.Close()
+
 	// Create service
 	service := goa.New("auth")
 
 	// Mount middleware
 	service.Use(middleware.RequestID())
+	service.Use(tracing.Middleware())
 	// Use our own log request to inject identity id and modify other properties
 	service.Use(log.LogRequest(config.IsPostgresDeveloperModeEnabled()))
 	service.Use(gzip.Middleware(9))
@@ -139,7 +187,13 @@ func main() {
 	identityRepository := account.NewIdentityRepository(db)
 	userRepository := account.NewUserRepository(db)
 
-	appDB := gormapplication.NewGormDB(db)
+	tokenCipher, err := encryption.NewCipher(config)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"err": err,
+		}, "failed to create the external token cipher")
+	}
+	appDB := gormapplication.NewGormDBWithTokenCipher(db, tokenCipher)
 
 	tokenManager, err := token.NewManager(config)
 	if err != nil {
@@ -147,13 +201,26 @@ func main() {
 			"err": err,
 		}, "failed to create token manager")
 	}
-	// Middleware that extracts and stores the token in the context
-	jwtMiddlewareTokenContext := goamiddleware.TokenContext(tokenManager.PublicKeys(), nil, app.NewJWTSecurity())
+	// Middleware that extracts and stores the token in the context.
+	// The token manager selects the key of the key ring identified by the token for every request.
+	// Only the access tokens intended for the Auth service are accepted, not the refresh tokens signed
+	// with the same keys nor the tokens exchanged by the service accounts.
+	accessTokenValidation := token.AccessTokenValidation(config.GetKeycloakClientID())
+	jwtMiddlewareTokenContext := goamiddleware.TokenContext(tokenManager, accessTokenValidation, app.NewJWTSecurity())
 	service.Use(jwtMiddlewareTokenContext)
 
 	service.Use(login.InjectTokenManager(tokenManager))
+	if config.IsRateLimitEnabled() {
+		rateLimitStore, err := ratelimit.NewStore(config, db)
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to create rate limit store")
+		}
+		service.Use(ratelimit.Middleware(rateLimitStore, ratelimit.Rules(config)...))
+	}
 	service.Use(log.LogRequest(config.IsPostgresDeveloperModeEnabled()))
-	app.UseJWTMiddleware(service, jwt.New(tokenManager.PublicKeys(), nil, app.NewJWTSecurity()))
+	app.UseJWTMiddleware(service, jwt.New(tokenManager, accessTokenValidation, app.NewJWTSecurity()))
 
 	spaceAuthzService := authz.NewAuthzService(config)
 	service.Use(authz.InjectAuthzService(spaceAuthzService))
@@ -175,12 +242,33 @@ func main() {
 	tokenCtrl := controller.NewTokenController(service, appDB, loginService, linkService, providerFactory, tokenManager, &keycloakExternalTokenService, config)
 	app.MountTokenController(service, tokenCtrl)
 
+	// Mount "openid" controller
+	openidCtrl := controller.NewOpenidController(service, tokenManager)
+	app.MountOpenidController(service, openidCtrl)
+
 	// Mount "link" controller
 	linkCtrl := controller.NewLinkController(service, loginService, tokenManager, config)
 	app.MountLinkController(service, linkCtrl)
 
 	// Mount "status" controller
-	statusCtrl := controller.NewStatusController(service, controller.NewGormDBChecker(db), config)
+	dbChecker := controller.NewGormDBChecker(db)
+	healthRegistry := health.NewRegistry(config.GetHealthCheckTimeout(), config.GetHealthCheckCacheTTL())
+	healthRegistry.Register("signing_keys", health.Liveness, health.CheckerFunc(func(ctx context.Context) error {
+		return tokenManager.CheckSigningKeys()
+	}))
+	healthRegistry.Register("database", health.Readiness, health.CheckerFunc(func(ctx context.Context) error {
+		return dbChecker.Ping()
+	}))
+	// An outage of the other services must not take every instance out of service, so they are only reported in the status
+	healthRegistry.Register("keycloak", health.Informational, health.NewHTTPChecker(config.GetKeycloakURL()+"/auth/realms/"+config.GetKeycloakRealm()))
+	// The WIT URL can't be checked if it's calculated from the domain of every request
+	if witURL, err := config.GetWITURL(nil); err == nil {
+		healthRegistry.Register("wit", health.Informational, health.NewHTTPChecker(witURL+"/api/status"))
+	}
+	if config.GetTenantServiceURL() != "" {
+		healthRegistry.Register("tenant", health.Informational, health.NewHTTPChecker(config.GetTenantServiceURL()+"/api/status"))
+	}
+	statusCtrl := controller.NewStatusController(service, dbChecker, healthRegistry, config)
 	app.MountStatusController(service, statusCtrl)
 
 	// Mount "space" controller
@@ -207,9 +295,99 @@ func main() {
 	app.MountUsersController(service, usersCtrl)
 
 	// Mount "collaborators" controller
-	collaboratorsCtrl := controller.NewCollaboratorsController(service, appDB, config, auth.NewKeycloakPolicyManager(config))
+	policyManager := auth.NewKeycloakPolicyManager(config)
+	collaboratorsCtrl := controller.NewCollaboratorsController(service, appDB, config, policyManager)
 	app.MountCollaboratorsController(service, collaboratorsCtrl)
 
+	// Mount "resource" controller
+	resourceCtrl := controller.NewResourceController(service, appDB)
+	app.MountResourceController(service, resourceCtrl)
+
+	// Mount "resource_roles" controller
+	resourceRolesCtrl := controller.NewResourceRolesController(service, appDB)
+	app.MountResourceRolesController(service, resourceRolesCtrl)
+
+	// Mount "webhooks" controller
+	webhooksCtrl := controller.NewWebhooksController(service, appDB)
+	app.MountWebhooksController(service, webhooksCtrl)
+
+	// Mount "audit" controller
+	auditCtrl := controller.NewAuditController(service, appDB)
+	app.MountAuditController(service, auditCtrl)
+
+	// Start delivering the events recorded in the outbox to WIT, to the webhooks, to the Keycloak space policies
+	// and to the approval of the Keycloak users until the service is shut down.
+	// Each sink has its own dispatcher, so a WIT outage doesn't hold back the webhooks.
+	dispatcherCtx, stopDispatchers := context.WithCancel(tokencontext.ContextWithTokenManager(context.Background(), tokenManager))
+	outboxDispatchers := []*outbox.Dispatcher{
+		outbox.NewDispatcher(db, config, wit.NewOutboxSink(config)),
+		outbox.NewDispatcher(db, config, webhook.NewSink(db, tokenCipher)),
+		outbox.NewDispatcher(db, config, collaborator.NewPolicySink(appDB, policyManager)),
+		outbox.NewDispatcher(db, config, admin.NewApprovalSink(login.NewKeycloakUserAdminClient(config))),
+	}
+	for _, dispatcher := range outboxDispatchers {
+		dispatcher.Start(dispatcherCtx)
+	}
+	webhookDeliverer := webhook.NewDeliverer(db, config, tokenCipher)
+	webhookDeliverer.Start(dispatcherCtx)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		log.Info(nil, map[string]interface{}{
+			"signal": sig.String(),
+		}, "shutting down once the deliveries in progress are complete")
+		stopDispatchers()
+		for _, dispatcher := range outboxDispatchers {
+			dispatcher.Wait()
+		}
+		webhookDeliverer.Wait()
+		os.Exit(0)
+	}()
+	// Reload the service account key ring, so the keys added to or removed from the key ring directory
+	// are taken into account without restarting the service
+	go func() {
+		for range time.Tick(config.GetServiceAccountKeyRingReloadInterval()) {
+			keys, err := config.LoadServiceAccountKeyRing()
+			if err == nil {
+				err = tokenManager.UpdateKeyRing(keys)
+			}
+			if err != nil {
+				log.Error(nil, map[string]interface{}{
+					"err": err,
+				}, "failed to reload the service account key ring")
+			}
+		}
+	}()
+	// Re-encrypt the external tokens stored in plaintext or encrypted with the deprecated key
+	go func() {
+		reencrypted, err := appDB.ExternalTokens().Reencrypt(context.Background(), 100)
+		if err != nil {
+			log.Error(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to re-encrypt the external tokens")
+			return
+		}
+		log.Info(nil, map[string]interface{}{
+			"key_id":      tokenCipher.KeyID(),
+			"reencrypted": reencrypted,
+		}, "external tokens re-encrypted")
+	}()
+	// Re-encrypt the webhook secrets stored in plaintext or encrypted with the deprecated key
+	go func() {
+		reencrypted, err := appDB.WebhookSubscriptions().Reencrypt(context.Background(), 100)
+		if err != nil {
+			log.Error(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to re-encrypt the webhook secrets")
+			return
+		}
+		log.Info(nil, map[string]interface{}{
+			"key_id":      tokenCipher.KeyID(),
+			"reencrypted": reencrypted,
+		}, "webhook secrets re-encrypted")
+	}()
+
 	log.Logger().Infoln("Git Commit SHA: ", controller.Commit)
 	log.Logger().Infoln("UTC Build Time: ", controller.BuildTime)
 	log.Logger().Infoln("UTC Start Time: ", controller.StartTime)
@@ -218,6 +396,7 @@ func main() {
 	log.Logger().Infoln("NumCPU:         ", runtime.NumCPU())
 
 	http.Handle("/api/", service.Mux)
+	http.Handle("/.well-known/", service.Mux)
 	http.Handle("/", http.FileServer(assetFS()))
 	http.Handle("/favicon.ico", http.NotFoundHandler())
 
@@ -0,0 +1,99 @@
+// Package metric defines the business metrics of the service, exposed with the default Go collectors on /metrics
+package metric
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "auth"
+
+	// LoginSucceeded is the outcome of a login which issued tokens to the user
+	LoginSucceeded = "success"
+	// LoginNotApproved is the outcome of a login of a user who is not approved yet
+	LoginNotApproved = "not_approved"
+	// LoginDeactivated is the outcome of a login of a deactivated user
+	LoginDeactivated = "deactivated"
+	// LoginFailed is the outcome of a login which failed for any other reason
+	LoginFailed = "error"
+
+	// ExternalTokenRetrieve is the retrieval of the token of an external provider
+	ExternalTokenRetrieve = "retrieve"
+	// ExternalTokenLink is the linking of an account of an external provider
+	ExternalTokenLink = "link"
+	// ExternalTokenDelete is the deletion of the token of an external provider
+	ExternalTokenDelete = "delete"
+
+	// UnknownClientID is the client ID recorded for the exchanges requested with an ID which is not a service account ID,
+	// so random IDs can't create new time series
+	UnknownClientID = "unknown"
+
+	succeeded = "success"
+	failed    = "error"
+)
+
+var (
+	loginTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_total",
+		Help:      "Number of logins completed after the redirect from Keycloak, by outcome.",
+	}, []string{"outcome"})
+
+	externalTokenOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_token_operations_total",
+		Help:      "Number of retrievals, links and deletions of the tokens of the external providers, by provider type and outcome.",
+	}, []string{"operation", "provider", "outcome"})
+
+	serviceAccountExchangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "service_account_exchanges_total",
+		Help:      "Number of token exchanges requested by the service accounts, by client ID, grant type and outcome.",
+	}, []string{"client_id", "grant_type", "outcome"})
+
+	keycloakRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "keycloak_request_duration_seconds",
+		Help:      "Latency of the requests sent to Keycloak, by operation and response status. The status is 'error' if no response was received.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"operation", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(loginTotal, externalTokenOperationsTotal, serviceAccountExchangesTotal, keycloakRequestDuration)
+}
+
+// RecordLogin counts a login with the given outcome
+func RecordLogin(outcome string) {
+	loginTotal.WithLabelValues(outcome).Inc()
+}
+
+// RecordExternalTokenOperation counts an operation on the token of an external provider of the given type
+func RecordExternalTokenOperation(operation string, providerType string, success bool) {
+	externalTokenOperationsTotal.WithLabelValues(operation, providerType, outcome(success)).Inc()
+}
+
+// RecordServiceAccountExchange counts a token exchange requested by a service account
+func RecordServiceAccountExchange(clientID string, grantType string, success bool) {
+	serviceAccountExchangesTotal.WithLabelValues(clientID, grantType, outcome(success)).Inc()
+}
+
+// ObserveKeycloakRequest records the latency and the response status of a request to Keycloak started at the given time
+func ObserveKeycloakRequest(operation string, start time.Time, res *http.Response, err error) {
+	status := failed
+	if err == nil && res != nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	keycloakRequestDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+func outcome(success bool) string {
+	if success {
+		return succeeded
+	}
+	return failed
+}
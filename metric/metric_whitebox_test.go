@@ -0,0 +1,54 @@
+package metric
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordExternalTokenOperation(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	before := counterValue(t, externalTokenOperationsTotal.WithLabelValues(ExternalTokenLink, "github", failed))
+	// when
+	RecordExternalTokenOperation(ExternalTokenLink, "github", false)
+	// then
+	assert.Equal(t, before+1, counterValue(t, externalTokenOperationsTotal.WithLabelValues(ExternalTokenLink, "github", failed)))
+}
+
+func TestObserveKeycloakRequest(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	created := sampleCount(t, "test_create", "201")
+	unreachable := sampleCount(t, "test_create", failed)
+	// when
+	ObserveKeycloakRequest("test_create", time.Now(), &http.Response{StatusCode: http.StatusCreated}, nil)
+	ObserveKeycloakRequest("test_create", time.Now(), nil, errors.New("connection refused"))
+	// then
+	assert.Equal(t, created+1, sampleCount(t, "test_create", "201"))
+	assert.Equal(t, unreachable+1, sampleCount(t, "test_create", failed))
+}
+
+func counterValue(t *testing.T, counter interface {
+	Write(*dto.Metric) error
+}) float64 {
+	var m dto.Metric
+	require.Nil(t, counter.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func sampleCount(t *testing.T, operation string, status string) uint64 {
+	var m dto.Metric
+	histogram := keycloakRequestDuration.WithLabelValues(operation, status).(interface {
+		Write(*dto.Metric) error
+	})
+	require.Nil(t, histogram.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
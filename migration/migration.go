@@ -143,6 +143,54 @@ func GetMigrations(configuration MigrationConfiguration) Migrations {
 	// version 11
 	m = append(m, steps{ExecuteSQLFile("011-add-username-to-external-token.sql")})
 
+	// version 12
+	m = append(m, steps{ExecuteSQLFile("012-identity-role-uuid.sql")})
+
+	// version 13
+	m = append(m, steps{ExecuteSQLFile("013-space-contributor-role.sql")})
+
+	// version 14
+	m = append(m, steps{ExecuteSQLFile("014-refresh-token.sql")})
+
+	// version 15
+	m = append(m, steps{ExecuteSQLFile("015-outbox.sql")})
+
+	// version 16
+	m = append(m, steps{ExecuteSQLFile("016-webhooks.sql")})
+
+	// version 17
+	m = append(m, steps{ExecuteSQLFile("017-user-deactivation.sql")})
+
+	// version 18
+	m = append(m, steps{ExecuteSQLFile("018-user-approval-state.sql")})
+
+	// version 19
+	m = append(m, steps{ExecuteSQLFile("019-audit-event.sql")})
+
+	// version 20
+	m = append(m, steps{ExecuteSQLFile("020-rate-limit-bucket.sql")})
+
+	// version 21
+	m = append(m, steps{ExecuteSQLFile("021-external-token-encryption.sql")})
+
+	// version 22
+	m = append(m, steps{ExecuteSQLFile("022-external-token-refresh-token.sql")})
+
+	// version 23
+	m = append(m, steps{ExecuteSQLFile("023-oauth-state-code-challenge.sql")})
+
+	// version 24
+	m = append(m, steps{ExecuteSQLFile("024-outbox-delivery.sql")})
+
+	// version 25
+	m = append(m, steps{ExecuteSQLFile("025-webhook-subscription-secret-encryption.sql")})
+
+	// version 26
+	m = append(m, steps{ExecuteSQLFile("026-audit-event-append-only.sql")})
+
+	// version 27
+	m = append(m, steps{ExecuteSQLFile("027-user-approval-state-unknown.sql")})
+
 	// Version N
 	//
 	// In order to add an upgrade, simply append an array of MigrationFunc to the
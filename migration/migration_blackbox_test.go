@@ -103,6 +103,22 @@ func TestMigrations(t *testing.T) {
 	t.Run("TestMigration09", testMigration09)
 	t.Run("TestMigration10", testMigration10)
 	t.Run("TestMigration11", testMigration11)
+	t.Run("TestMigration12", testMigration12)
+	t.Run("TestMigration13", testMigration13)
+	t.Run("TestMigration14", testMigration14)
+	t.Run("TestMigration15", testMigration15)
+	t.Run("TestMigration16", testMigration16)
+	t.Run("TestMigration17", testMigration17)
+	t.Run("TestMigration18", testMigration18)
+	t.Run("TestMigration19", testMigration19)
+	t.Run("TestMigration20", testMigration20)
+	t.Run("TestMigration21", testMigration21)
+	t.Run("TestMigration22", testMigration22)
+	t.Run("TestMigration23", testMigration23)
+	t.Run("TestMigration24", testMigration24)
+	t.Run("TestMigration25", testMigration25)
+	t.Run("TestMigration26", testMigration26)
+	t.Run("TestMigration27", testMigration27)
 
 	// Perform the migration
 	if err := migration.Migrate(sqlDB, databaseName, conf); err != nil {
@@ -176,6 +192,181 @@ func testMigration11(t *testing.T) {
 	assert.True(t, dialect.HasColumn("external_tokens", "username"))
 }
 
+func testMigration12(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(13)], (13))
+
+	assert.True(t, dialect.HasIndex("identity_role", "idx_identity_role_identity_resource"))
+	assert.True(t, dialect.HasIndex("resource", "idx_resource_parent_resource_id"))
+	var dataType string
+	err := sqlDB.QueryRow("SELECT data_type FROM information_schema.columns WHERE table_name = 'identity_role' AND column_name = 'identity_role_id'").Scan(&dataType)
+	require.Nil(t, err)
+	assert.Equal(t, "uuid", dataType)
+}
+
+func testMigration13(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(14)], (14))
+
+	assert.True(t, dialect.HasIndex("identity_role", "uix_identity_role_identity_resource_role"))
+	var count int
+	err := sqlDB.QueryRow("SELECT count(*) FROM role r, resource_type t WHERE r.resource_type_id = t.resource_type_id AND t.name = 'openshift.io/resource/space' AND r.name = 'contributor'").Scan(&count)
+	require.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testMigration14(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(15)], (15))
+
+	assert.True(t, dialect.HasTable("refresh_token"))
+	assert.True(t, dialect.HasColumn("refresh_token", "token_hash"))
+	assert.True(t, dialect.HasColumn("refresh_token", "session_id"))
+	assert.True(t, dialect.HasColumn("refresh_token", "parent_id"))
+	assert.True(t, dialect.HasIndex("refresh_token", "uix_refresh_token_token_hash"))
+	assert.True(t, dialect.HasIndex("refresh_token", "idx_refresh_token_session_id"))
+}
+
+func testMigration15(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(16)], (16))
+
+	assert.True(t, dialect.HasTable("outbox_event"))
+	assert.True(t, dialect.HasColumn("outbox_event", "event_type"))
+	assert.True(t, dialect.HasColumn("outbox_event", "payload"))
+	assert.True(t, dialect.HasColumn("outbox_event", "next_attempt_at"))
+	assert.True(t, dialect.HasIndex("outbox_event", "idx_outbox_event_pending"))
+}
+
+func testMigration16(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(17)], (17))
+
+	assert.True(t, dialect.HasTable("webhook_subscription"))
+	assert.True(t, dialect.HasColumn("webhook_subscription", "event_types"))
+	assert.True(t, dialect.HasIndex("webhook_subscription", "idx_webhook_subscription_owner_id"))
+	assert.True(t, dialect.HasTable("webhook_delivery"))
+	assert.True(t, dialect.HasColumn("webhook_delivery", "response_status"))
+	assert.True(t, dialect.HasIndex("webhook_delivery", "uix_webhook_delivery_subscription_event"))
+	assert.True(t, dialect.HasIndex("webhook_delivery", "idx_webhook_delivery_pending"))
+}
+
+func testMigration17(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(18)], (18))
+
+	assert.True(t, dialect.HasColumn("users", "deactivated"))
+}
+
+func testMigration18(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(19)], (19))
+
+	assert.True(t, dialect.HasColumn("users", "approval_state"))
+	assert.True(t, dialect.HasIndex("users", "idx_users_approval_state"))
+}
+
+func testMigration19(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(20)], (20))
+
+	assert.True(t, dialect.HasTable("audit_event"))
+	assert.True(t, dialect.HasIndex("audit_event", "idx_audit_event_actor_id"))
+
+	// the events can't be updated
+	_, err := sqlDB.Exec("INSERT INTO audit_event (audit_event_id, action, outcome) VALUES ('00000000-0000-0000-0000-000000000019', 'login', 'success')")
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("UPDATE audit_event SET outcome = 'failure' WHERE audit_event_id = '00000000-0000-0000-0000-000000000019'")
+	assert.NotNil(t, err)
+}
+
+func testMigration20(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(21)], (21))
+
+	assert.True(t, dialect.HasTable("rate_limit_bucket"))
+	assert.True(t, dialect.HasIndex("rate_limit_bucket", "idx_rate_limit_bucket_updated_at"))
+}
+
+func testMigration21(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(22)], (22))
+
+	assert.True(t, dialect.HasColumn("external_tokens", "token_key_id"))
+	assert.True(t, dialect.HasColumn("external_tokens", "token_encrypted_key"))
+	assert.True(t, dialect.HasIndex("external_tokens", "idx_external_tokens_token_key_id"))
+}
+
+func testMigration22(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(23)], (23))
+
+	assert.True(t, dialect.HasColumn("external_tokens", "refresh_token"))
+	assert.True(t, dialect.HasColumn("external_tokens", "refresh_token_encrypted_key"))
+	assert.True(t, dialect.HasColumn("external_tokens", "token_type"))
+	assert.True(t, dialect.HasColumn("external_tokens", "expires_at"))
+}
+
+func testMigration23(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(24)], (24))
+
+	assert.True(t, dialect.HasColumn("oauth_state_references", "code_challenge"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "code_challenge_method"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "identity_id"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "session_state"))
+}
+
+func testMigration24(t *testing.T) {
+	_, err := sqlDB.Exec("INSERT INTO outbox_event (event_id, event_type, identity_id, attempts, next_attempt_at, delivered_at) VALUES ('00000000-0000-0000-0000-000000000024', 'user.created', uuid_generate_v4(), 1, now(), now())")
+	require.Nil(t, err)
+	migrateToVersion(sqlDB, migrations[:(25)], (25))
+
+	assert.True(t, dialect.HasTable("outbox_delivery"))
+	assert.True(t, dialect.HasColumn("outbox_delivery", "sink"))
+	assert.True(t, dialect.HasColumn("outbox_delivery", "next_attempt_at"))
+	assert.False(t, dialect.HasColumn("outbox_event", "next_attempt_at"))
+	assert.True(t, dialect.HasIndex("outbox_event", "idx_outbox_event_identity_id"))
+
+	// the delivered events are not delivered again
+	var count int
+	err = sqlDB.QueryRow("SELECT count(*) FROM outbox_delivery WHERE event_id = '00000000-0000-0000-0000-000000000024' AND delivered_at IS NOT NULL").Scan(&count)
+	require.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func testMigration25(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(26)], (26))
+
+	assert.True(t, dialect.HasColumn("webhook_subscription", "secret_key_id"))
+	assert.True(t, dialect.HasColumn("webhook_subscription", "secret_encrypted_key"))
+}
+
+func testMigration26(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(27)], (27))
+
+	// the events can't be deleted nor truncated
+	_, err := sqlDB.Exec("INSERT INTO audit_event (audit_event_id, action, outcome) VALUES ('00000000-0000-0000-0000-000000000026', 'login', 'success')")
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("DELETE FROM audit_event WHERE audit_event_id = '00000000-0000-0000-0000-000000000026'")
+	assert.NotNil(t, err)
+	_, err = sqlDB.Exec("TRUNCATE audit_event")
+	assert.NotNil(t, err)
+	_, err = sqlDB.Exec("UPDATE audit_event SET outcome = 'failure' WHERE audit_event_id = '00000000-0000-0000-0000-000000000026'")
+	assert.NotNil(t, err)
+}
+
+func testMigration27(t *testing.T) {
+	// a user registered and approved after the approval state was stored locally
+	_, err := sqlDB.Exec("INSERT INTO users (created_at, updated_at, id, email, approval_state) VALUES (now(), now(), '00000000-0000-0000-0000-000000000027', 'test27@example.com', 'approved')")
+	require.Nil(t, err)
+	migrateToVersion(sqlDB, migrations[:(28)], (28))
+
+	// the users created before version 18 have no approval state anymore
+	var approvalState sql.NullString
+	err = sqlDB.QueryRow("SELECT approval_state FROM users WHERE id = 'f03f023b-0427-4cdb-924b-fb2369018ab7'").Scan(&approvalState)
+	require.Nil(t, err)
+	assert.False(t, approvalState.Valid)
+	err = sqlDB.QueryRow("SELECT approval_state FROM users WHERE id = '00000000-0000-0000-0000-000000000027'").Scan(&approvalState)
+	require.Nil(t, err)
+	assert.Equal(t, sql.NullString{String: "approved", Valid: true}, approvalState)
+
+	// the new users have no default approval state
+	_, err = sqlDB.Exec("INSERT INTO users (created_at, updated_at, id, email) VALUES (now(), now(), '00000000-0000-0000-0000-000000000028', 'test28@example.com')")
+	require.Nil(t, err)
+	err = sqlDB.QueryRow("SELECT approval_state FROM users WHERE id = '00000000-0000-0000-0000-000000000028'").Scan(&approvalState)
+	require.Nil(t, err)
+	assert.False(t, approvalState.Valid)
+}
+
 // runSQLscript loads the given filename from the packaged SQL test files and
 // executes it on the given database. Golang text/template module is used
 // to handle all the optional arguments passed to the sql test files
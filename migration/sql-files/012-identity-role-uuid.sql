@@ -0,0 +1,9 @@
+-- identity_role_id should be a UUID like the primary keys of the other authorization tables
+ALTER TABLE identity_role ALTER COLUMN identity_role_id DROP DEFAULT;
+ALTER TABLE identity_role ALTER COLUMN identity_role_id SET DATA TYPE uuid USING uuid_generate_v4();
+ALTER TABLE identity_role ALTER COLUMN identity_role_id SET DEFAULT uuid_generate_v4();
+DROP SEQUENCE IF EXISTS identity_role_identity_role_id_seq;
+
+-- indexes used when evaluating the permissions of an identity on a resource and its parents
+CREATE INDEX idx_identity_role_identity_resource ON identity_role (identity_id, resource_id);
+CREATE INDEX idx_resource_parent_resource_id ON resource (parent_resource_id);
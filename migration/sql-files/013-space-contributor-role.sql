@@ -0,0 +1,15 @@
+-- resource type and role used to store the collaborators of a space
+INSERT INTO resource_type (resource_type_id, name, description, created_at, updated_at)
+    SELECT uuid_generate_v4(), 'openshift.io/resource/space', 'An openshift.io space', now(), now()
+    WHERE NOT EXISTS (SELECT 1 FROM resource_type WHERE name = 'openshift.io/resource/space' AND deleted_at IS NULL);
+
+INSERT INTO role (role_id, resource_type_id, name, created_at, updated_at)
+    SELECT uuid_generate_v4(), resource_type_id, 'contributor', now(), now()
+    FROM resource_type
+    WHERE name = 'openshift.io/resource/space' AND deleted_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM role r
+        WHERE r.resource_type_id = resource_type.resource_type_id AND r.name = 'contributor' AND r.deleted_at IS NULL);
+
+-- a role can be assigned only once to an identity for a given resource
+CREATE UNIQUE INDEX uix_identity_role_identity_resource_role ON identity_role (identity_id, resource_id, role_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,21 @@
+-- refresh tokens issued by the Auth service. Only the SHA-256 hash of the tokens is stored.
+-- The refresh tokens obtained by rotating the refresh token of a login session share the session ID,
+-- so the whole token family can be revoked at once.
+CREATE TABLE refresh_token (
+    refresh_token_id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    token_hash text NOT NULL,
+    identity_id uuid NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    client_id text,
+    session_id uuid NOT NULL,
+    parent_id uuid REFERENCES refresh_token(refresh_token_id) ON DELETE CASCADE,
+    issued_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    rotated_at timestamp with time zone,
+    revoked_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX uix_refresh_token_token_hash ON refresh_token (token_hash);
+CREATE INDEX idx_refresh_token_session_id ON refresh_token (session_id);
+CREATE INDEX idx_refresh_token_identity_id ON refresh_token (identity_id);
@@ -0,0 +1,20 @@
+-- events about users and identities recorded in the same transaction as the change they describe.
+-- The events are delivered asynchronously to the services which need to know about the change (WIT, etc.)
+-- and retried until they are delivered or the maximum number of attempts is reached.
+CREATE TABLE outbox_event (
+    event_id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    event_type text NOT NULL,
+    identity_id uuid NOT NULL,
+    origin text,
+    payload jsonb,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    delivered_at timestamp with time zone,
+    failed_at timestamp with time zone,
+    last_error text
+);
+
+-- the pending events of an identity are delivered in the order they were recorded
+CREATE INDEX idx_outbox_event_pending ON outbox_event (identity_id, created_at) WHERE delivered_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,34 @@
+-- webhook subscriptions registered by the service accounts to receive the events recorded in the outbox
+CREATE TABLE webhook_subscription (
+    subscription_id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    owner_id uuid NOT NULL,
+    url text NOT NULL,
+    event_types text[] NOT NULL,
+    secret text NOT NULL
+);
+
+CREATE INDEX idx_webhook_subscription_owner_id ON webhook_subscription (owner_id);
+
+-- deliveries of the events to the webhook subscriptions. The deliveries are kept as a log
+-- which can be queried by the owner of the subscription.
+CREATE TABLE webhook_delivery (
+    delivery_id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    subscription_id uuid NOT NULL REFERENCES webhook_subscription (subscription_id) ON DELETE CASCADE,
+    event_id uuid NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    delivered_at timestamp with time zone,
+    failed_at timestamp with time zone,
+    response_status integer,
+    last_error text
+);
+
+-- an event is delivered once to each subscription
+CREATE UNIQUE INDEX uix_webhook_delivery_subscription_event ON webhook_delivery (subscription_id, event_id);
+CREATE INDEX idx_webhook_delivery_pending ON webhook_delivery (next_attempt_at) WHERE delivered_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,2 @@
+-- a deactivated user can't log in nor refresh its tokens until it is reactivated
+ALTER TABLE users ADD COLUMN deactivated boolean NOT NULL DEFAULT false;
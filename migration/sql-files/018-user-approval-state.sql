@@ -0,0 +1,4 @@
+-- the approval state of the users is stored locally instead of in Keycloak only.
+-- The existing users have all been approved, since only the approved users could log in.
+ALTER TABLE users ADD COLUMN approval_state text NOT NULL DEFAULT 'approved';
+CREATE INDEX idx_users_approval_state ON users (approval_state, created_at) WHERE approval_state <> 'approved';
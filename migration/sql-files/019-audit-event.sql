@@ -0,0 +1,28 @@
+-- append-only log of the security-relevant events (logins, token exchanges, links of external accounts, etc.)
+-- which can be queried by the service accounts.
+CREATE TABLE audit_event (
+    audit_event_id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone,
+    actor_id uuid,
+    subject text,
+    action text NOT NULL,
+    outcome text NOT NULL,
+    client_ip text,
+    request_id text,
+    details jsonb
+);
+
+CREATE INDEX idx_audit_event_created_at ON audit_event (created_at);
+CREATE INDEX idx_audit_event_actor_id ON audit_event (actor_id, created_at);
+CREATE INDEX idx_audit_event_action ON audit_event (action, created_at);
+
+-- the events can't be modified once recorded
+CREATE FUNCTION reject_audit_event_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events can not be updated';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_event_append_only BEFORE UPDATE ON audit_event
+    FOR EACH ROW EXECUTE PROCEDURE reject_audit_event_update();
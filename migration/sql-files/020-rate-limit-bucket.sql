@@ -0,0 +1,9 @@
+-- token buckets of the rate limits, shared by all the replicas of the service when the "postgres" store is configured
+CREATE TABLE rate_limit_bucket (
+    bucket_key text primary key NOT NULL,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_bucket_updated_at ON rate_limit_bucket (updated_at);
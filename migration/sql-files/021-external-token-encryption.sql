@@ -0,0 +1,6 @@
+-- the external tokens are encrypted with a data key, which is encrypted with the key-encryption key identified by token_key_id.
+-- the existing tokens are stored in plaintext (with an empty key ID) until they are re-encrypted.
+ALTER TABLE external_tokens ADD COLUMN token_key_id text NOT NULL DEFAULT '';
+ALTER TABLE external_tokens ADD COLUMN token_encrypted_key text NOT NULL DEFAULT '';
+
+CREATE INDEX idx_external_tokens_token_key_id ON external_tokens (token_key_id);
@@ -0,0 +1,6 @@
+-- the refresh token (encrypted like the token), the type and the expiry of the tokens issued by the external providers.
+-- the expiry of the existing tokens is unknown.
+ALTER TABLE external_tokens ADD COLUMN refresh_token text NOT NULL DEFAULT '';
+ALTER TABLE external_tokens ADD COLUMN refresh_token_encrypted_key text NOT NULL DEFAULT '';
+ALTER TABLE external_tokens ADD COLUMN token_type text NOT NULL DEFAULT '';
+ALTER TABLE external_tokens ADD COLUMN expires_at timestamp with time zone;
@@ -0,0 +1,6 @@
+-- the RFC 7636 code challenge of the public clients. The state references of the authorization codes
+-- issued to the public clients at login also store the identity and the Keycloak session state.
+ALTER TABLE oauth_state_references ADD COLUMN code_challenge text NOT NULL DEFAULT '';
+ALTER TABLE oauth_state_references ADD COLUMN code_challenge_method text NOT NULL DEFAULT '';
+ALTER TABLE oauth_state_references ADD COLUMN identity_id uuid;
+ALTER TABLE oauth_state_references ADD COLUMN session_state text NOT NULL DEFAULT '';
@@ -0,0 +1,31 @@
+-- the state of the delivery of the events recorded in the outbox is kept for each sink (WIT, the webhooks, etc.),
+-- so a failing sink doesn't hold back or duplicate the deliveries to the other sinks.
+-- An event which has no delivery for a sink has not been delivered to the sink yet.
+CREATE TABLE outbox_delivery (
+    event_id uuid NOT NULL REFERENCES outbox_event (event_id) ON DELETE CASCADE,
+    sink text NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    delivered_at timestamp with time zone,
+    failed_at timestamp with time zone,
+    last_error text,
+    PRIMARY KEY (event_id, sink)
+);
+
+-- the events recorded so far were delivered to the WIT and the webhooks sinks together
+INSERT INTO outbox_delivery (event_id, sink, created_at, updated_at, attempts, next_attempt_at, delivered_at, failed_at, last_error)
+    SELECT event_id, sink, created_at, updated_at, attempts, next_attempt_at, delivered_at, failed_at, last_error
+    FROM outbox_event CROSS JOIN (VALUES ('wit'), ('webhooks')) AS sinks (sink)
+    WHERE attempts > 0 OR delivered_at IS NOT NULL OR failed_at IS NOT NULL;
+
+DROP INDEX idx_outbox_event_pending;
+ALTER TABLE outbox_event DROP COLUMN attempts;
+ALTER TABLE outbox_event DROP COLUMN next_attempt_at;
+ALTER TABLE outbox_event DROP COLUMN delivered_at;
+ALTER TABLE outbox_event DROP COLUMN failed_at;
+ALTER TABLE outbox_event DROP COLUMN last_error;
+
+-- the pending events of an identity are delivered to each sink in the order they were recorded
+CREATE INDEX idx_outbox_event_identity_id ON outbox_event (identity_id, created_at);
@@ -0,0 +1,5 @@
+-- the secrets of the webhook subscriptions are encrypted like the external tokens, with a data key which is encrypted
+-- with the key-encryption key identified by secret_key_id. The existing secrets are stored in plaintext
+-- (with an empty key ID) until they are re-encrypted.
+ALTER TABLE webhook_subscription ADD COLUMN secret_key_id text NOT NULL DEFAULT '';
+ALTER TABLE webhook_subscription ADD COLUMN secret_encrypted_key text NOT NULL DEFAULT '';
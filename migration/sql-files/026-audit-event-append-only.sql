@@ -0,0 +1,14 @@
+-- the events can't be deleted either, one by one or by truncating the table
+CREATE OR REPLACE FUNCTION reject_audit_event_update() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events can not be modified (%)', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER audit_event_append_only ON audit_event;
+
+CREATE TRIGGER audit_event_append_only BEFORE UPDATE OR DELETE ON audit_event
+    FOR EACH ROW EXECUTE PROCEDURE reject_audit_event_update();
+
+CREATE TRIGGER audit_event_no_truncate BEFORE TRUNCATE ON audit_event
+    FOR EACH STATEMENT EXECUTE PROCEDURE reject_audit_event_update();
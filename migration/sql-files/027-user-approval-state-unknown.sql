@@ -0,0 +1,8 @@
+-- the users created before the approval state was stored locally were all set as approved by default,
+-- including the ones waiting to be approved in Keycloak. Their approval state is unset, so it is initialised
+-- from the "approved" attribute of their Keycloak account the next time they log in.
+ALTER TABLE users ALTER COLUMN approval_state DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN approval_state DROP NOT NULL;
+UPDATE users SET approval_state = NULL
+    WHERE approval_state = 'approved'
+    AND created_at < (SELECT updated_at FROM version WHERE version = 18);
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Delivery is the state of the delivery of an event to a sink. An event which has no delivery for a sink
+// has not been delivered to the sink yet and is due for delivery.
+type Delivery struct {
+	gormsupport.LifecycleHardDelete
+	EventID       uuid.UUID `sql:"type:uuid" gorm:"primary_key"`
+	Sink          string    `gorm:"primary_key"`
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time
+	LastError     *string
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m Delivery) TableName() string {
+	return "outbox_delivery"
+}
+
+// PendingEvent is an event which is due for delivery to a sink, along with the state of its delivery to the sink
+type PendingEvent struct {
+	Event
+	Attempts      int
+	NextAttemptAt time.Time
+}
+
+// GormDeliveryRepository is the implementation of the storage interface for Delivery.
+type GormDeliveryRepository struct {
+	db *gorm.DB
+}
+
+// NewDeliveryRepository creates a new storage type.
+func NewDeliveryRepository(db *gorm.DB) *GormDeliveryRepository {
+	return &GormDeliveryRepository{db: db}
+}
+
+// DeliveryRepository represents the storage interface.
+type DeliveryRepository interface {
+	Load(ctx context.Context, eventID uuid.UUID, sink string) (*Delivery, error)
+	ListPending(ctx context.Context, sink string, limit int) ([]PendingEvent, error)
+	Claim(ctx context.Context, sink string, event *PendingEvent, lease time.Duration) (bool, error)
+	MarkDelivered(ctx context.Context, eventID uuid.UUID, sink string) error
+	MarkRetry(ctx context.Context, eventID uuid.UUID, sink string, lastError string, nextAttemptAt time.Time) error
+	MarkFailed(ctx context.Context, eventID uuid.UUID, sink string, lastError string) error
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormDeliveryRepository) TableName() string {
+	return "outbox_delivery"
+}
+
+// Load returns the delivery of the event to the sink
+// returns NotFoundError if the delivery doesn't exist
+func (m *GormDeliveryRepository) Load(ctx context.Context, eventID uuid.UUID, sink string) (*Delivery, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "load"}, time.Now())
+	var native Delivery
+	err := m.db.Table(m.TableName()).Where("event_id = ? AND sink = ?", eventID, sink).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("outbox_delivery", eventID.String()+"/"+sink)
+	}
+	return &native, errs.WithStack(err)
+}
+
+// ListPending returns the events which are due for delivery to the sink, oldest first.
+// Only the oldest pending event of each identity is returned, so the events of an identity are delivered
+// to the sink in the order they were recorded, even when an event has to be retried.
+// The events are pending for each sink independently, so a failing sink doesn't hold back the other sinks.
+func (m *GormDeliveryRepository) ListPending(ctx context.Context, sink string, limit int) ([]PendingEvent, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "listPending"}, time.Now())
+	var rows []PendingEvent
+	err := m.db.Raw(`SELECT * FROM (
+			SELECT DISTINCT ON (e.identity_id) e.*,
+				COALESCE(d.attempts, 0) AS attempts,
+				COALESCE(d.next_attempt_at, e.created_at) AS next_attempt_at
+			FROM outbox_event e LEFT JOIN outbox_delivery d ON d.event_id = e.event_id AND d.sink = ?
+			WHERE d.delivered_at IS NULL AND d.failed_at IS NULL
+			ORDER BY e.identity_id, e.created_at
+		) AS pending
+		WHERE next_attempt_at <= ?
+		ORDER BY created_at
+		LIMIT ?`, sink, gorm.NowFunc(), limit).Scan(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// Claim postpones the next attempt of the delivery of the pending event to the sink by the given lease,
+// so no other dispatcher delivers it meanwhile. The delivery is created on the first attempt.
+// Returns false if the event has been claimed by another dispatcher since it was loaded.
+func (m *GormDeliveryRepository) Claim(ctx context.Context, sink string, event *PendingEvent, lease time.Duration) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "claim"}, time.Now())
+	now := gorm.NowFunc()
+	nextAttemptAt := now.Add(lease)
+	db := m.db.Exec(`INSERT INTO outbox_delivery (event_id, sink, created_at, updated_at, attempts, next_attempt_at)
+		VALUES (?, ?, ?, ?, 0, ?)
+		ON CONFLICT (event_id, sink) DO UPDATE SET next_attempt_at = EXCLUDED.next_attempt_at, updated_at = EXCLUDED.updated_at
+		WHERE outbox_delivery.next_attempt_at = ? AND outbox_delivery.delivered_at IS NULL AND outbox_delivery.failed_at IS NULL`,
+		event.ID, sink, now, now, nextAttemptAt, event.NextAttemptAt)
+	if db.Error != nil {
+		return false, errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return false, nil
+	}
+	event.NextAttemptAt = nextAttemptAt
+	return true, nil
+}
+
+// MarkDelivered records that the event has been delivered to the sink
+func (m *GormDeliveryRepository) MarkDelivered(ctx context.Context, eventID uuid.UUID, sink string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "markDelivered"}, time.Now())
+	return m.update(ctx, eventID, sink, map[string]interface{}{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"delivered_at": gorm.NowFunc(),
+		"last_error":   nil,
+	})
+}
+
+// MarkRetry records a failed delivery of the event to the sink which will be attempted again at the given time
+func (m *GormDeliveryRepository) MarkRetry(ctx context.Context, eventID uuid.UUID, sink string, lastError string, nextAttemptAt time.Time) error {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "markRetry"}, time.Now())
+	return m.update(ctx, eventID, sink, map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	})
+}
+
+// MarkFailed records a failed delivery of the event to the sink which won't be attempted again
+func (m *GormDeliveryRepository) MarkFailed(ctx context.Context, eventID uuid.UUID, sink string, lastError string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_delivery", "markFailed"}, time.Now())
+	return m.update(ctx, eventID, sink, map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"failed_at":  gorm.NowFunc(),
+		"last_error": lastError,
+	})
+}
+
+func (m *GormDeliveryRepository) update(ctx context.Context, eventID uuid.UUID, sink string, values map[string]interface{}) error {
+	db := m.db.Model(&Delivery{}).Where("event_id = ? AND sink = ?", eventID, sink).Updates(values)
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"event_id": eventID,
+			"sink":     sink,
+			"err":      db.Error,
+		}, "unable to update the delivery of the event")
+		return errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return errors.NewNotFoundError("outbox_delivery", eventID.String()+"/"+sink)
+	}
+	return nil
+}
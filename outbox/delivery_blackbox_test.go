@@ -0,0 +1,167 @@
+package outbox_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type deliveryBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	events *outbox.GormEventRepository
+	repo   *outbox.GormDeliveryRepository
+	sink   string
+}
+
+func TestRunDeliveryBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &deliveryBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *deliveryBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.events = outbox.NewEventRepository(s.DB)
+	s.repo = outbox.NewDeliveryRepository(s.DB)
+	s.sink = "sink-" + uuid.NewV4().String()
+}
+
+func (s *deliveryBlackboxTest) TestListPendingOldestEventOfEachIdentity() {
+	// given
+	identityID := uuid.NewV4()
+	first := s.createEvent(identityID)
+	s.createEvent(identityID)
+	otherIdentityID := uuid.NewV4()
+	postponed := s.createEvent(otherIdentityID)
+	s.createEvent(otherIdentityID)
+	s.claim(postponed.ID)
+	// when
+	events := s.listPending(identityID, otherIdentityID)
+	// then the later events wait for the earlier ones
+	require.Len(s.T(), events, 1)
+	assert.Equal(s.T(), first.ID, events[0].ID)
+
+	// when the first event is delivered
+	s.claim(first.ID)
+	require.Nil(s.T(), s.repo.MarkDelivered(s.Ctx, first.ID, s.sink))
+	events = s.listPending(identityID, otherIdentityID)
+	// then the next one is pending
+	require.Len(s.T(), events, 1)
+	assert.NotEqual(s.T(), first.ID, events[0].ID)
+	assert.Equal(s.T(), identityID, events[0].IdentityID)
+
+	// when the postponed event fails
+	require.Nil(s.T(), s.repo.MarkFailed(s.Ctx, postponed.ID, s.sink, "failure"))
+	events = s.listPending(identityID, otherIdentityID)
+	// then the next event of the identity is pending
+	require.Len(s.T(), events, 2)
+	failed, err := s.repo.Load(s.Ctx, postponed.ID, s.sink)
+	require.Nil(s.T(), err)
+	assert.NotNil(s.T(), failed.FailedAt)
+	require.NotNil(s.T(), failed.LastError)
+	assert.Equal(s.T(), "failure", *failed.LastError)
+	assert.Equal(s.T(), 1, failed.Attempts)
+
+	// the events are still pending for the other sinks
+	events, err = s.repo.ListPending(s.Ctx, "other-"+s.sink, 1000)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), filterEvents(events, identityID, otherIdentityID), 2)
+}
+
+func (s *deliveryBlackboxTest) TestClaimOnlyOnce() {
+	// given
+	event := s.createEvent(uuid.NewV4())
+	pending := s.listPending(event.IdentityID)
+	require.Len(s.T(), pending, 1)
+	other := pending[0]
+	// when
+	claimed, err := s.repo.Claim(s.Ctx, s.sink, &pending[0], time.Minute)
+	require.Nil(s.T(), err)
+	claimedTwice, err := s.repo.Claim(s.Ctx, s.sink, &other, time.Minute)
+	require.Nil(s.T(), err)
+	// then
+	assert.True(s.T(), claimed)
+	assert.False(s.T(), claimedTwice)
+	assert.Empty(s.T(), s.listPending(event.IdentityID))
+	// the event can be claimed again for another sink
+	claimed, err = s.repo.Claim(s.Ctx, "other-"+s.sink, &other, time.Minute)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), claimed)
+}
+
+func (s *deliveryBlackboxTest) TestMarkRetry() {
+	// given
+	event := s.createEvent(uuid.NewV4())
+	s.claim(event.ID)
+	// when
+	err := s.repo.MarkRetry(s.Ctx, event.ID, s.sink, "failure", time.Now().Add(time.Hour))
+	// then
+	require.Nil(s.T(), err)
+	loaded, err := s.repo.Load(s.Ctx, event.ID, s.sink)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, loaded.Attempts)
+	assert.Nil(s.T(), loaded.DeliveredAt)
+	assert.Nil(s.T(), loaded.FailedAt)
+	assert.Empty(s.T(), s.listPending(event.IdentityID))
+}
+
+func (s *deliveryBlackboxTest) TestMarkUnclaimedEventFails() {
+	// when
+	err := s.repo.MarkDelivered(s.Ctx, uuid.NewV4(), s.sink)
+	// then
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *deliveryBlackboxTest) createEvent(identityID uuid.UUID) *outbox.Event {
+	event := &outbox.Event{
+		Type:       outbox.UserUpdated,
+		IdentityID: identityID,
+		Payload:    outbox.Payload(`{}`),
+	}
+	err := s.events.Create(s.Ctx, event)
+	require.Nil(s.T(), err)
+	return event
+}
+
+// claim claims the pending event for the sink of the test
+func (s *deliveryBlackboxTest) claim(eventID uuid.UUID) {
+	events, err := s.repo.ListPending(s.Ctx, s.sink, 1000)
+	require.Nil(s.T(), err)
+	for i := range events {
+		if uuid.Equal(events[i].ID, eventID) {
+			claimed, err := s.repo.Claim(s.Ctx, s.sink, &events[i], time.Minute)
+			require.Nil(s.T(), err)
+			require.True(s.T(), claimed)
+			return
+		}
+	}
+	require.Fail(s.T(), "the event is not pending", eventID.String())
+}
+
+// listPending returns the pending events of the given identities for the sink of the test
+func (s *deliveryBlackboxTest) listPending(identityIDs ...uuid.UUID) []outbox.PendingEvent {
+	events, err := s.repo.ListPending(s.Ctx, s.sink, 1000)
+	require.Nil(s.T(), err)
+	return filterEvents(events, identityIDs...)
+}
+
+// filterEvents returns the events of the given identities
+func filterEvents(events []outbox.PendingEvent, identityIDs ...uuid.UUID) []outbox.PendingEvent {
+	var result []outbox.PendingEvent
+	for _, event := range events {
+		for _, identityID := range identityIDs {
+			if uuid.Equal(event.IdentityID, identityID) {
+				result = append(result, event)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxRetryBackoff is the maximum delay between two delivery attempts of an event
+	maxRetryBackoff = time.Hour
+	// deliveryLease is the time an event is reserved for the dispatcher delivering it.
+	// The event is delivered again after the lease if the dispatcher has been stopped in the middle of the delivery.
+	deliveryLease = 5 * time.Minute
+)
+
+// Sink delivers the events to a consumer.
+// The events are delivered at least once, so a sink must be able to handle the same event several times.
+type Sink interface {
+	// Name returns the name of the sink, which identifies the deliveries of the events to the sink, so it must not change
+	Name() string
+	// Deliver delivers the event to the consumer. The sinks are free to ignore the events they are not interested in.
+	Deliver(ctx context.Context, event Event) error
+}
+
+type dispatcherConfiguration interface {
+	GetOutboxPollInterval() time.Duration
+	GetOutboxBatchSize() int
+	GetOutboxMaxAttempts() int
+	GetOutboxRetryBackoff() time.Duration
+}
+
+// Dispatcher delivers the pending events to a sink. The state of the deliveries is kept for each sink,
+// so every sink has its own dispatcher and a failing sink doesn't hold back or duplicate the deliveries to the other sinks.
+// A failed delivery is retried with an exponential backoff until the maximum number of attempts is reached.
+type Dispatcher struct {
+	deliveries DeliveryRepository
+	config     dispatcherConfiguration
+	sink       Sink
+	stopped    chan struct{}
+}
+
+// NewDispatcher creates a dispatcher delivering the events to the given sink
+func NewDispatcher(db *gorm.DB, config dispatcherConfiguration, sink Sink) *Dispatcher {
+	return &Dispatcher{
+		deliveries: NewDeliveryRepository(db),
+		config:     config,
+		sink:       sink,
+	}
+}
+
+// Start delivers the pending events in the background until the context is done.
+// The values of the context are passed to the sinks, but the delivery in progress when the context is done
+// is not cancelled: use Wait to wait for it to complete.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.stopped = make(chan struct{})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(d.config.GetOutboxPollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.DispatchPending(ctx)
+			}
+		}
+	}()
+}
+
+// Wait waits until the dispatcher started with Start is stopped and the delivery in progress is complete
+func (d *Dispatcher) Wait() {
+	if d.stopped != nil {
+		<-d.stopped
+	}
+}
+
+// DispatchPending delivers the events which are due and returns the number of delivered events.
+// The remaining events are left pending when the context is done.
+func (d *Dispatcher) DispatchPending(ctx context.Context) int {
+	events, err := d.deliveries.ListPending(ctx, d.sink.Name(), d.config.GetOutboxBatchSize())
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"sink": d.sink.Name(),
+			"err":  err,
+		}, "unable to list the pending events")
+		return 0
+	}
+	delivered := 0
+	for i := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if d.dispatch(WithoutCancel(ctx), &events[i]) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// dispatch delivers the event to the sink and records the result of the attempt.
+// Returns true if the event has been delivered.
+func (d *Dispatcher) dispatch(ctx context.Context, event *PendingEvent) bool {
+	sink := d.sink.Name()
+	claimed, err := d.deliveries.Claim(ctx, sink, event, deliveryLease)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"event_id": event.ID,
+			"sink":     sink,
+			"err":      err,
+		}, "unable to claim the event")
+		return false
+	}
+	if !claimed {
+		// the event is being delivered by another dispatcher
+		return false
+	}
+	deliveryErr := d.sink.Deliver(ctx, event.Event)
+	if deliveryErr == nil {
+		err = d.deliveries.MarkDelivered(ctx, event.ID, sink)
+	} else if event.Attempts+1 >= d.config.GetOutboxMaxAttempts() {
+		log.Error(ctx, map[string]interface{}{
+			"event_id":    event.ID,
+			"event_type":  event.Type,
+			"identity_id": event.IdentityID,
+			"sink":        sink,
+			"attempts":    event.Attempts + 1,
+			"err":         deliveryErr,
+		}, "giving up delivering the event")
+		err = d.deliveries.MarkFailed(ctx, event.ID, sink, deliveryErr.Error())
+	} else {
+		log.Warn(ctx, map[string]interface{}{
+			"event_id":    event.ID,
+			"event_type":  event.Type,
+			"identity_id": event.IdentityID,
+			"sink":        sink,
+			"attempts":    event.Attempts + 1,
+			"err":         deliveryErr,
+		}, "unable to deliver the event")
+		err = d.deliveries.MarkRetry(ctx, event.ID, sink, deliveryErr.Error(), time.Now().Add(Backoff(d.config.GetOutboxRetryBackoff(), event.Attempts+1)))
+	}
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"event_id": event.ID,
+			"sink":     sink,
+			"err":      err,
+		}, "unable to record the delivery attempt of the event")
+	}
+	return deliveryErr == nil
+}
+
+// WithoutCancel returns a context which keeps the values of the given context but is never cancelled,
+// so a delivery in progress is not interrupted when the dispatcher or the deliverer sending it is stopped
+func WithoutCancel(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+// detachedContext is the context returned by WithoutCancel
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts:
+// the initial delay is doubled after every failed attempt, up to one hour
+func Backoff(initial time.Duration, attempts int) time.Duration {
+	backoff := initial
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,193 @@
+package outbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type dispatcherBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo       *outbox.GormEventRepository
+	deliveries *outbox.GormDeliveryRepository
+}
+
+func TestRunDispatcherBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &dispatcherBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *dispatcherBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = outbox.NewEventRepository(s.DB)
+	s.deliveries = outbox.NewDeliveryRepository(s.DB)
+}
+
+func (s *dispatcherBlackboxTest) TestDeliverToSink() {
+	// given
+	event := s.createEvent()
+	sink := &dummySink{name: "sink-" + uuid.NewV4().String()}
+	dispatcher := outbox.NewDispatcher(s.DB, &dummyDispatcherConfig{maxAttempts: 3}, sink)
+	// when
+	dispatcher.DispatchPending(s.Ctx)
+	// then
+	assert.Equal(s.T(), []uuid.UUID{event.ID}, sink.delivered)
+	delivery, err := s.deliveries.Load(s.Ctx, event.ID, sink.name)
+	require.Nil(s.T(), err)
+	assert.NotNil(s.T(), delivery.DeliveredAt)
+	assert.Equal(s.T(), 1, delivery.Attempts)
+
+	// a delivered event is not delivered again
+	dispatcher.DispatchPending(s.Ctx)
+	assert.Len(s.T(), sink.delivered, 1)
+}
+
+func (s *dispatcherBlackboxTest) TestFailingSinkDoesNotHoldBackOtherSinks() {
+	// given two events of the same identity
+	event := s.createEvent()
+	next := s.createEventOf(event.IdentityID)
+	failing := &dummySink{name: "failing-" + uuid.NewV4().String(), err: errs.New("unavailable")}
+	working := &dummySink{name: "working-" + uuid.NewV4().String()}
+	failingDispatcher := outbox.NewDispatcher(s.DB, &dummyDispatcherConfig{maxAttempts: 3}, failing)
+	workingDispatcher := outbox.NewDispatcher(s.DB, &dummyDispatcherConfig{maxAttempts: 3}, working)
+	// when
+	failingDispatcher.DispatchPending(s.Ctx)
+	workingDispatcher.DispatchPending(s.Ctx)
+	workingDispatcher.DispatchPending(s.Ctx)
+	// then the events are delivered once to the working sink, in order
+	assert.Equal(s.T(), []uuid.UUID{event.ID, next.ID}, working.delivered)
+	// and the failing sink retries the first event only
+	assert.Equal(s.T(), []uuid.UUID{event.ID}, failing.delivered)
+	delivery, err := s.deliveries.Load(s.Ctx, event.ID, failing.name)
+	require.Nil(s.T(), err)
+	assert.Nil(s.T(), delivery.DeliveredAt)
+	_, err = s.deliveries.Load(s.Ctx, next.ID, failing.name)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *dispatcherBlackboxTest) TestRetryUntilMaxAttempts() {
+	// given
+	event := s.createEvent()
+	sink := &dummySink{name: "sink-" + uuid.NewV4().String(), err: errs.New("unavailable")}
+	dispatcher := outbox.NewDispatcher(s.DB, &dummyDispatcherConfig{maxAttempts: 2}, sink)
+	// when
+	dispatcher.DispatchPending(s.Ctx)
+	// then the delivery is retried later
+	delivery, err := s.deliveries.Load(s.Ctx, event.ID, sink.name)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, delivery.Attempts)
+	assert.Nil(s.T(), delivery.FailedAt)
+	require.NotNil(s.T(), delivery.LastError)
+	assert.Equal(s.T(), "unavailable", *delivery.LastError)
+	assert.True(s.T(), delivery.NextAttemptAt.After(time.Now()))
+
+	// when the next attempt is due and fails
+	s.DB.Model(&outbox.Delivery{}).Where("event_id = ? AND sink = ?", event.ID, sink.name).Update("next_attempt_at", time.Now().Add(-time.Second))
+	dispatcher.DispatchPending(s.Ctx)
+	// then the event is not delivered anymore
+	delivery, err = s.deliveries.Load(s.Ctx, event.ID, sink.name)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, delivery.Attempts)
+	assert.NotNil(s.T(), delivery.FailedAt)
+	assert.Nil(s.T(), delivery.DeliveredAt)
+	assert.Len(s.T(), sink.delivered, 2)
+}
+
+func (s *dispatcherBlackboxTest) TestStartAndStop() {
+	// given
+	event := s.createEvent()
+	sink := &dummySink{name: "sink-" + uuid.NewV4().String(), deliveries: make(chan uuid.UUID, 10)}
+	dispatcher := outbox.NewDispatcher(s.DB, &dummyDispatcherConfig{maxAttempts: 3}, sink)
+	ctx, cancel := context.WithCancel(s.Ctx)
+	defer cancel()
+	// when
+	dispatcher.Start(ctx)
+	// then
+	select {
+	case id := <-sink.deliveries:
+		assert.Equal(s.T(), event.ID, id)
+	case <-time.After(10 * time.Second):
+		assert.Fail(s.T(), "the event has not been delivered")
+	}
+	// when
+	cancel()
+	// then
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		assert.Fail(s.T(), "the dispatcher has not been stopped")
+	}
+}
+
+func (s *dispatcherBlackboxTest) createEvent() *outbox.Event {
+	return s.createEventOf(uuid.NewV4())
+}
+
+func (s *dispatcherBlackboxTest) createEventOf(identityID uuid.UUID) *outbox.Event {
+	event := &outbox.Event{
+		Type:       outbox.UserCreated,
+		IdentityID: identityID,
+		Payload:    outbox.Payload(`{}`),
+	}
+	err := s.repo.Create(s.Ctx, event)
+	require.Nil(s.T(), err)
+	return event
+}
+
+type dummyDispatcherConfig struct {
+	maxAttempts int
+}
+
+func (c *dummyDispatcherConfig) GetOutboxPollInterval() time.Duration {
+	return 100 * time.Millisecond
+}
+
+func (c *dummyDispatcherConfig) GetOutboxBatchSize() int {
+	return 1000
+}
+
+func (c *dummyDispatcherConfig) GetOutboxMaxAttempts() int {
+	return c.maxAttempts
+}
+
+func (c *dummyDispatcherConfig) GetOutboxRetryBackoff() time.Duration {
+	return time.Minute
+}
+
+// dummySink records the IDs of the events delivered by the tests, ignoring the events created by other tests
+type dummySink struct {
+	name       string
+	err        error
+	delivered  []uuid.UUID
+	deliveries chan uuid.UUID
+}
+
+func (s *dummySink) Name() string {
+	return s.name
+}
+
+func (s *dummySink) Deliver(ctx context.Context, event outbox.Event) error {
+	if string(event.Payload) == "{}" {
+		s.delivered = append(s.delivered, event.ID)
+		if s.deliveries != nil {
+			s.deliveries <- event.ID
+		}
+	}
+	return s.err
+}
@@ -0,0 +1,307 @@
+// Package outbox implements a transactional outbox for the changes of the users, identities and spaces.
+// The events are recorded in the same transaction as the change they describe, so they can't get lost
+// if the transaction is committed, and are delivered asynchronously to the sinks (WIT, etc.) with retries
+// by a Dispatcher for each sink.
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// UserCreated is the type of the event recorded when a new user and its identity are created
+	UserCreated = "user.created"
+	// UserUpdated is the type of the event recorded when a user or its identity is updated
+	UserUpdated = "user.updated"
+	// IdentityLinked is the type of the event recorded when an identity is linked to an account of an external provider
+	IdentityLinked = "identity.linked"
+	// TokenDeleted is the type of the event recorded when the tokens of an external provider are deleted,
+	// which unlinks the identity from the external account
+	TokenDeleted = "token.deleted"
+	// SpaceCollaboratorAdded is the type of the event recorded when an identity is added to the collaborators of a space
+	SpaceCollaboratorAdded = "space.collaborator.added"
+	// SpaceCollaboratorRemoved is the type of the event recorded when an identity is removed from the collaborators of a space
+	SpaceCollaboratorRemoved = "space.collaborator.removed"
+)
+
+// EventTypes lists the types of the events recorded in the outbox
+var EventTypes = []string{UserCreated, UserUpdated, IdentityLinked, TokenDeleted, SpaceCollaboratorAdded, SpaceCollaboratorRemoved}
+
+// Event describes a change of a user or an identity which must be delivered to the sinks
+type Event struct {
+	gormsupport.LifecycleHardDelete
+	ID         uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:event_id"`
+	Type       string    `gorm:"column:event_type"`
+	IdentityID uuid.UUID `sql:"type:uuid"`
+	// Origin is the URL of the Auth service which recorded the event
+	Origin  string
+	Payload Payload `sql:"type:jsonb"`
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m Event) TableName() string {
+	return "outbox_event"
+}
+
+// Unmarshal decodes the payload of the event
+func (m Event) Unmarshal(v interface{}) error {
+	return errs.WithStack(json.Unmarshal(m.Payload, v))
+}
+
+// RequestData returns a request to the URL of the Auth service which recorded the event,
+// so the sinks can compute the URLs of the services and issue the tokens as when handling the original request
+func (m Event) RequestData() *goa.RequestData {
+	req := &http.Request{Header: http.Header{}}
+	if u, err := url.Parse(m.Origin); err == nil && m.Origin != "" {
+		req.Host = u.Host
+		req.URL = u
+	}
+	return &goa.RequestData{Request: req}
+}
+
+// Payload is the JSON payload of an event
+type Payload []byte
+
+// Value implements the driver.Valuer interface
+func (p Payload) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return string(p), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (p *Payload) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+	case []byte:
+		*p = append(Payload{}, v...)
+	case string:
+		*p = Payload(v)
+	default:
+		return errs.Errorf("unexpected type %T of the payload", src)
+	}
+	return nil
+}
+
+// User is the payload of the user events: the state of the user and its identity after the change
+type User struct {
+	IdentityID            uuid.UUID              `json:"identity_id"`
+	UserID                uuid.UUID              `json:"user_id"`
+	Username              string                 `json:"username"`
+	ProviderType          string                 `json:"provider_type"`
+	RegistrationCompleted bool                   `json:"registration_completed"`
+	Email                 string                 `json:"email"`
+	FullName              string                 `json:"full_name"`
+	Bio                   string                 `json:"bio"`
+	ImageURL              string                 `json:"image_url"`
+	URL                   string                 `json:"url"`
+	Company               string                 `json:"company"`
+	Cluster               string                 `json:"cluster"`
+	ContextInformation    map[string]interface{} `json:"context_information,omitempty"`
+	Deactivated           bool                   `json:"deactivated"`
+	ApprovalState         *string                `json:"approval_state"`
+}
+
+// Identity returns the identity, with its user, described by the payload
+func (u User) Identity() account.Identity {
+	return account.Identity{
+		ID:                    u.IdentityID,
+		Username:              u.Username,
+		ProviderType:          u.ProviderType,
+		RegistrationCompleted: u.RegistrationCompleted,
+		UserID:                account.NullUUID{UUID: u.UserID, Valid: true},
+		User: account.User{
+			ID:                 u.UserID,
+			Email:              u.Email,
+			FullName:           u.FullName,
+			Bio:                u.Bio,
+			ImageURL:           u.ImageURL,
+			URL:                u.URL,
+			Company:            u.Company,
+			Cluster:            u.Cluster,
+			ContextInformation: u.ContextInformation,
+			Deactivated:        u.Deactivated,
+			ApprovalState:      u.ApprovalState,
+		},
+	}
+}
+
+// ExternalAccount is the payload of the events about the accounts of the external providers linked to an identity
+type ExternalAccount struct {
+	IdentityID   uuid.UUID `json:"identity_id"`
+	ProviderID   uuid.UUID `json:"provider_id"`
+	ProviderName string    `json:"provider_name"`
+	Username     string    `json:"username,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+}
+
+// SpaceCollaborator is the payload of the events about the collaborators of a space
+type SpaceCollaborator struct {
+	SpaceID    string    `json:"space_id"`
+	IdentityID uuid.UUID `json:"identity_id"`
+}
+
+// NewEvent returns an event of the given type about the identity, with the given data as payload.
+// The URL of the Auth service is taken from the request found in the context, if any.
+func NewEvent(ctx context.Context, eventType string, identityID uuid.UUID, data interface{}) (*Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	var origin string
+	if req := goa.ContextRequest(ctx); req != nil && req.Request != nil {
+		origin = rest.AbsoluteURL(req, "")
+	}
+	return &Event{
+		Type:       eventType,
+		IdentityID: identityID,
+		Origin:     origin,
+		Payload:    payload,
+	}, nil
+}
+
+// RecordEvent records an event of the given type about the identity, with the given data as payload.
+// It must be called in the transaction which makes the change described by the event.
+func RecordEvent(ctx context.Context, repo EventRepository, eventType string, identityID uuid.UUID, data interface{}) error {
+	event, err := NewEvent(ctx, eventType, identityID, data)
+	if err != nil {
+		return err
+	}
+	return repo.Create(ctx, event)
+}
+
+// NewUserEvent returns an event of the given type with the current state of the identity and its user
+func NewUserEvent(ctx context.Context, eventType string, identity account.Identity) (*Event, error) {
+	return NewEvent(ctx, eventType, identity.ID, User{
+		IdentityID:            identity.ID,
+		UserID:                identity.User.ID,
+		Username:              identity.Username,
+		ProviderType:          identity.ProviderType,
+		RegistrationCompleted: identity.RegistrationCompleted,
+		Email:                 identity.User.Email,
+		FullName:              identity.User.FullName,
+		Bio:                   identity.User.Bio,
+		ImageURL:              identity.User.ImageURL,
+		URL:                   identity.User.URL,
+		Company:               identity.User.Company,
+		Cluster:               identity.User.Cluster,
+		ContextInformation:    identity.User.ContextInformation,
+		Deactivated:           identity.User.Deactivated,
+		ApprovalState:         identity.User.ApprovalState,
+	})
+}
+
+// RecordUserEvent records an event of the given type with the current state of the identity and its user.
+// It must be called in the transaction which changes the user or the identity.
+func RecordUserEvent(ctx context.Context, repo EventRepository, eventType string, identity account.Identity) error {
+	event, err := NewUserEvent(ctx, eventType, identity)
+	if err != nil {
+		return err
+	}
+	return repo.Create(ctx, event)
+}
+
+// GormEventRepository is the implementation of the storage interface for Event.
+type GormEventRepository struct {
+	db *gorm.DB
+}
+
+// NewEventRepository creates a new storage type.
+func NewEventRepository(db *gorm.DB) *GormEventRepository {
+	return &GormEventRepository{db: db}
+}
+
+// EventRepository represents the storage interface.
+type EventRepository interface {
+	Load(ctx context.Context, id uuid.UUID) (*Event, error)
+	Create(ctx context.Context, event *Event) error
+	ListByIdentity(ctx context.Context, identityID uuid.UUID) ([]Event, error)
+	DeleteByIdentity(ctx context.Context, identityID uuid.UUID) (int64, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormEventRepository) TableName() string {
+	return "outbox_event"
+}
+
+// Load returns the event for the given ID
+// returns NotFoundError if the event doesn't exist
+func (m *GormEventRepository) Load(ctx context.Context, id uuid.UUID) (*Event, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_event", "load"}, time.Now())
+	var native Event
+	err := m.db.Table(m.TableName()).Where("event_id = ?", id).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("outbox_event", id.String())
+	}
+	return &native, errs.WithStack(err)
+}
+
+// Create creates a new record.
+func (m *GormEventRepository) Create(ctx context.Context, model *Event) error {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_event", "create"}, time.Now())
+	if model.ID == uuid.Nil {
+		model.ID = uuid.NewV4()
+	}
+	err := m.db.Create(model).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"event_id":    model.ID,
+			"event_type":  model.Type,
+			"identity_id": model.IdentityID,
+			"err":         err,
+		}, "unable to record the event")
+		return errs.WithStack(err)
+	}
+	log.Debug(ctx, map[string]interface{}{
+		"event_id":    model.ID,
+		"event_type":  model.Type,
+		"identity_id": model.IdentityID,
+	}, "event recorded")
+	return nil
+}
+
+// ListByIdentity returns the events of the identity in the order they were recorded
+func (m *GormEventRepository) ListByIdentity(ctx context.Context, identityID uuid.UUID) ([]Event, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_event", "listByIdentity"}, time.Now())
+	var rows []Event
+	err := m.db.Table(m.TableName()).Where("identity_id = ?", identityID).Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// DeleteByIdentity deletes all the events of the identity, whether they were delivered or not,
+// and returns the number of deleted events
+func (m *GormEventRepository) DeleteByIdentity(ctx context.Context, identityID uuid.UUID) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "outbox_event", "deleteByIdentity"}, time.Now())
+	db := m.db.Where("identity_id = ?", identityID).Delete(&Event{})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": identityID,
+			"err":         db.Error,
+		}, "unable to delete the events of the identity")
+		return 0, errs.WithStack(db.Error)
+	}
+	return db.RowsAffected, nil
+}
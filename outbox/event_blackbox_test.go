@@ -0,0 +1,69 @@
+package outbox_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type eventBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo *outbox.GormEventRepository
+}
+
+func TestRunEventBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &eventBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *eventBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = outbox.NewEventRepository(s.DB)
+}
+
+func (s *eventBlackboxTest) TestRecordUserEvent() {
+	// given
+	identity, err := testsupport.CreateTestIdentity(s.DB, "outbox_event_blackbox_test-"+uuid.NewV4().String(), account.KeycloakIDP)
+	require.Nil(s.T(), err)
+	identity.User = account.User{ID: uuid.NewV4(), FullName: "John Doe", Email: "jdoe@example.com", ContextInformation: account.ContextInformation{"space": "foo"}}
+	req := &goa.RequestData{Request: &http.Request{Host: "auth.example.com"}}
+	ctx := goa.NewContext(context.Background(), nil, req.Request, nil)
+	// when
+	err = outbox.RecordUserEvent(ctx, s.repo, outbox.UserCreated, identity)
+	// then
+	require.Nil(s.T(), err)
+	events, err := s.repo.ListByIdentity(s.Ctx, identity.ID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), events, 1)
+	event := events[0]
+	assert.Equal(s.T(), outbox.UserCreated, event.Type)
+	assert.Equal(s.T(), "http://auth.example.com", event.Origin)
+	assert.Equal(s.T(), "auth.example.com", event.RequestData().Host)
+	var payload outbox.User
+	require.Nil(s.T(), event.Unmarshal(&payload))
+	assert.Equal(s.T(), identity.ID, payload.IdentityID)
+	assert.Equal(s.T(), identity.Username, payload.Username)
+	assert.Equal(s.T(), "John Doe", payload.FullName)
+	assert.Equal(s.T(), "foo", payload.ContextInformation["space"])
+	assert.Equal(s.T(), identity.User.ID, payload.Identity().User.ID)
+}
+
+func (s *eventBlackboxTest) TestLoadUnknownEventFails() {
+	// when
+	_, err := s.repo.Load(s.Ctx, uuid.NewV4())
+	// then
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
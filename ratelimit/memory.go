@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is the minimal delay between two removals of the full buckets
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+// MemoryStore keeps the buckets in memory. The limits apply to each replica of the service separately.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from the bucket of the given key if it contains one
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	b, found := s.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = limit.refill(b.tokens, now.Sub(b.updatedAt))
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return false, limit.retryAfter(b.tokens), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// prune removes the buckets which have been refilled since they were last used, as they are the same as new buckets.
+// It must be called with the lock held.
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < pruneInterval {
+		return
+	}
+	s.lastPrune = now
+	for key, b := range s.buckets {
+		if b.limit.refill(b.tokens, now.Sub(b.updatedAt)) >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
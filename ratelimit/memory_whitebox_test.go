@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			allowed, _, err := store.Take(context.Background(), "ip:10.0.0.1", limit)
+			require.Nil(t, err)
+			assert.True(t, allowed)
+		}
+		allowed, retryAfter, err := store.Take(context.Background(), "ip:10.0.0.1", limit)
+		require.Nil(t, err)
+		assert.False(t, allowed)
+		assert.Equal(t, 500*time.Millisecond, retryAfter)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		allowed, _, err := store.Take(context.Background(), "ip:10.0.0.2", limit)
+		require.Nil(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		now = now.Add(600 * time.Millisecond)
+		allowed, _, err := store.Take(context.Background(), "ip:10.0.0.1", limit)
+		require.Nil(t, err)
+		assert.True(t, allowed)
+		allowed, retryAfter, err := store.Take(context.Background(), "ip:10.0.0.1", limit)
+		require.Nil(t, err)
+		assert.False(t, allowed)
+		assert.InDelta(t, float64(400*time.Millisecond), float64(retryAfter), float64(time.Millisecond))
+	})
+
+	t.Run("prune the full buckets", func(t *testing.T) {
+		now = now.Add(2 * pruneInterval)
+		_, _, err := store.Take(context.Background(), "ip:10.0.0.3", limit)
+		require.Nil(t, err)
+		assert.Len(t, store.buckets, 1)
+	})
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+)
+
+// bucketTTL is how long the buckets which are not used are kept in the database.
+// The limits whose buckets take longer to refill are reset after this delay.
+const bucketTTL = time.Hour
+
+// takeQuery refills the bucket of the key, then takes a token from it if it contains one, in a single statement
+// so concurrent requests sent to several replicas can't take the same token.
+// The arguments are the key and the burst, then the burst and the rate three times.
+const takeQuery = `INSERT INTO rate_limit_bucket AS b (bucket_key, tokens, allowed, updated_at)
+	VALUES (?, ?::float8 - 1, true, now())
+	ON CONFLICT (bucket_key) DO UPDATE SET
+		tokens = LEAST(?::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * ?::float8)
+			- CASE WHEN LEAST(?::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * ?::float8) >= 1 THEN 1 ELSE 0 END,
+		allowed = LEAST(?::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * ?::float8) >= 1,
+		updated_at = now()
+	RETURNING tokens, allowed`
+
+// PostgresStore keeps the buckets in the database, so the limits are shared by all the replicas of the service
+type PostgresStore struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewPostgresStore returns a new store keeping the buckets in the given database
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take takes a token from the bucket of the given key if it contains one
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "rate_limit_bucket", "take"}, time.Now())
+	s.prune(ctx)
+	burst := float64(limit.Burst)
+	var tokens float64
+	var allowed bool
+	err := s.db.Raw(takeQuery, key, burst, burst, limit.Rate, burst, limit.Rate, burst, limit.Rate).Row().Scan(&tokens, &allowed)
+	if err != nil {
+		return false, 0, errs.Wrapf(err, "unable to take a token from the bucket '%s'", key)
+	}
+	if !allowed {
+		return false, limit.retryAfter(tokens), nil
+	}
+	return true, 0, nil
+}
+
+// prune deletes the buckets which have not been used for a while, at most once per pruneInterval
+func (s *PostgresStore) prune(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < pruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+	err := s.db.Exec("DELETE FROM rate_limit_bucket WHERE updated_at < ?", time.Now().Add(-bucketTTL)).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "unable to delete the unused rate limit buckets")
+	}
+}
@@ -0,0 +1,183 @@
+// Package ratelimit throttles the endpoints which are expensive or can be abused (token exchanges with bcrypt
+// comparisons, user searches, logins) with token buckets keyed by client IP, by client ID or by identity.
+// A client can send up to Burst requests at once, then Rate requests per second. The requests over the limit
+// are rejected with a 429 error and a Retry-After header.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/login"
+	"github.com/fabric8-services/fabric8-auth/rest"
+
+	"github.com/goadesign/goa"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	// StoreMemory keeps the buckets in the memory of the replica
+	StoreMemory = "memory"
+	// StorePostgres keeps the buckets in the database, so the limits are shared by all the replicas
+	StorePostgres = "postgres"
+)
+
+// Limit is the configuration of a token bucket: up to Burst requests can be sent at once, then Rate requests per second.
+// A limit with a rate or a burst of 0 is disabled.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Disabled returns true if the limit doesn't throttle the requests
+func (l Limit) Disabled() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// refill returns the tokens of a bucket which had the given tokens the given duration ago
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+}
+
+// retryAfter returns how long it takes for a bucket with the given tokens to contain a whole token
+func (l Limit) retryAfter(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take takes a token from the bucket of the given key if it contains one. If it doesn't, Take returns false
+	// and how long the client must wait before the bucket contains a token.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// KeyFunc returns the key of the bucket of a request, or an empty string if the request is not throttled by the rule
+type KeyFunc func(ctx context.Context, req *http.Request) string
+
+// Rule throttles the requests sent to an endpoint with a bucket per key
+type Rule struct {
+	// Name identifies the endpoint in the keys of the buckets
+	Name   string
+	Method string
+	Path   string
+	Key    KeyFunc
+	Limit  Limit
+}
+
+func (r Rule) matches(req *http.Request) bool {
+	return req.Method == r.Method && strings.TrimSuffix(req.URL.Path, "/") == r.Path
+}
+
+// Configuration is the configuration of the rate limits
+type Configuration interface {
+	GetRateLimitStore() string
+	GetRateLimitClientIPRate() float64
+	GetRateLimitClientIPBurst() int
+	GetRateLimitClientIDRate() float64
+	GetRateLimitClientIDBurst() int
+	GetRateLimitIdentityRate() float64
+	GetRateLimitIdentityBurst() int
+}
+
+// NewStore returns the configured store
+func NewStore(config Configuration, db *gorm.DB) (Store, error) {
+	switch config.GetRateLimitStore() {
+	case StoreMemory, "":
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return NewPostgresStore(db), nil
+	default:
+		return nil, errs.Errorf("unknown rate limit store '%s'", config.GetRateLimitStore())
+	}
+}
+
+// Rules returns the rules throttling the token exchanges, the user searches and the logins with the configured limits
+func Rules(config Configuration) []Rule {
+	byClientIP := Limit{Rate: config.GetRateLimitClientIPRate(), Burst: config.GetRateLimitClientIPBurst()}
+	byClientID := Limit{Rate: config.GetRateLimitClientIDRate(), Burst: config.GetRateLimitClientIDBurst()}
+	byIdentity := Limit{Rate: config.GetRateLimitIdentityRate(), Burst: config.GetRateLimitIdentityBurst()}
+	return []Rule{
+		{Name: "token_exchange", Method: http.MethodPost, Path: "/api/token", Key: ByClientIP, Limit: byClientIP},
+		{Name: "token_exchange", Method: http.MethodPost, Path: "/api/token", Key: ByClientID, Limit: byClientID},
+		{Name: "search_users", Method: http.MethodGet, Path: "/api/search/users", Key: ByClientIP, Limit: byClientIP},
+		{Name: "search_users", Method: http.MethodGet, Path: "/api/search/users", Key: ByIdentity, Limit: byIdentity},
+		{Name: "login", Method: http.MethodGet, Path: "/api/login", Key: ByClientIP, Limit: byClientIP},
+	}
+}
+
+// Middleware rejects the requests over the limit of any of the rules matching them with a TooManyRequestsError.
+// It must be placed after the middleware storing the token in the context, so the requests can be throttled by identity.
+// If the store fails, the requests are not throttled.
+func Middleware(store Store, rules ...Rule) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			for _, rule := range rules {
+				if rule.Limit.Disabled() || !rule.matches(req) {
+					continue
+				}
+				key := rule.Key(ctx, req)
+				if key == "" {
+					continue
+				}
+				allowed, retryAfter, err := store.Take(ctx, rule.Name+":"+key, rule.Limit)
+				if err != nil {
+					log.Error(ctx, map[string]interface{}{
+						"rule": rule.Name,
+						"key":  key,
+						"err":  err,
+					}, "unable to check the rate limit; the request is not throttled")
+					continue
+				}
+				if !allowed {
+					log.Warn(ctx, map[string]interface{}{
+						"rule":        rule.Name,
+						"key":         key,
+						"retry_after": retryAfter.String(),
+					}, "request rejected by the rate limit")
+					return errors.NewTooManyRequestsError("too many requests, retry later", retryAfter)
+				}
+			}
+			return h(ctx, rw, req)
+		}
+	}
+}
+
+// ByClientIP keys the buckets by the IP of the client
+func ByClientIP(ctx context.Context, req *http.Request) string {
+	return "ip:" + rest.ClientIP(req)
+}
+
+// ByClientID keys the buckets by the client ID of the token exchanges, whether it is a known service account ID or not
+func ByClientID(ctx context.Context, req *http.Request) string {
+	reqData := goa.ContextRequest(ctx)
+	if reqData == nil {
+		return ""
+	}
+	if payload, ok := reqData.Payload.(*app.TokenExchange); ok && payload.ClientID != nil {
+		return "client_id:" + *payload.ClientID
+	}
+	return ""
+}
+
+// ByIdentity keys the buckets by the identity of the token of the request. The requests without a token are not throttled.
+func ByIdentity(ctx context.Context, req *http.Request) string {
+	if goajwt.ContextJWT(ctx) == nil {
+		return ""
+	}
+	identityID, err := login.ContextIdentity(ctx)
+	if err != nil {
+		return ""
+	}
+	return "identity:" + identityID.String()
+}
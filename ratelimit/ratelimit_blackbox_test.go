@@ -0,0 +1,128 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/ratelimit"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/goadesign/goa"
+	errs "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	rule := ratelimit.Rule{Name: "search_users", Method: "GET", Path: "/api/search/users", Key: ratelimit.ByClientIP, Limit: ratelimit.Limit{Rate: 1, Burst: 2}}
+	handled := 0
+	handler := ratelimit.Middleware(ratelimit.NewMemoryStore(), rule)(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		handled++
+		return nil
+	})
+	send := func(method string, target string, remoteAddr string) error {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		rw := httptest.NewRecorder()
+		return handler(goa.NewContext(context.Background(), rw, req, nil), rw, req)
+	}
+
+	t.Run("requests within the limit", func(t *testing.T) {
+		require.Nil(t, send("GET", "/api/search/users?q=john", "10.0.0.1:41234"))
+		require.Nil(t, send("GET", "/api/search/users/?q=jane", "10.0.0.1:41235"))
+		assert.Equal(t, 2, handled)
+	})
+
+	t.Run("request over the limit", func(t *testing.T) {
+		err := send("GET", "/api/search/users?q=john", "10.0.0.1:41236")
+		require.NotNil(t, err)
+		tooMany, cause := errors.IsTooManyRequestsError(err)
+		require.True(t, tooMany)
+		assert.True(t, cause.(errors.TooManyRequestsError).RetryAfter > 0)
+		assert.True(t, cause.(errors.TooManyRequestsError).RetryAfter <= time.Second)
+		assert.Equal(t, 2, handled)
+	})
+
+	t.Run("other client", func(t *testing.T) {
+		require.Nil(t, send("GET", "/api/search/users?q=john", "10.0.0.2:41234"))
+		assert.Equal(t, 3, handled)
+	})
+
+	t.Run("other endpoint", func(t *testing.T) {
+		require.Nil(t, send("GET", "/api/users", "10.0.0.1:41237"))
+		require.Nil(t, send("POST", "/api/search/users", "10.0.0.1:41238"))
+		assert.Equal(t, 5, handled)
+	})
+}
+
+func TestMiddlewareDisabledLimit(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	rule := ratelimit.Rule{Name: "login", Method: "GET", Path: "/api/login", Key: ratelimit.ByClientIP, Limit: ratelimit.Limit{Rate: 0, Burst: 10}}
+	handler := ratelimit.Middleware(failingStore{}, rule)(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		return nil
+	})
+	req := httptest.NewRequest("GET", "/api/login", nil)
+	rw := httptest.NewRecorder()
+	// when/then the store is not used
+	assert.Nil(t, handler(goa.NewContext(context.Background(), rw, req, nil), rw, req))
+}
+
+func TestMiddlewareStoreFailure(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	rule := ratelimit.Rule{Name: "login", Method: "GET", Path: "/api/login", Key: ratelimit.ByClientIP, Limit: ratelimit.Limit{Rate: 1, Burst: 10}}
+	handled := false
+	handler := ratelimit.Middleware(failingStore{}, rule)(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		handled = true
+		return nil
+	})
+	req := httptest.NewRequest("GET", "/api/login", nil)
+	rw := httptest.NewRecorder()
+	// when
+	err := handler(goa.NewContext(context.Background(), rw, req, nil), rw, req)
+	// then the request is not throttled
+	assert.Nil(t, err)
+	assert.True(t, handled)
+}
+
+func TestByClientIP(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	req := httptest.NewRequest("GET", "/api/login", nil)
+	req.RemoteAddr = "10.0.0.1:41234"
+	assert.Equal(t, "ip:10.0.0.1", ratelimit.ByClientIP(context.Background(), req))
+	// the address added by the proxy is used, not the ones sent by the client
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 192.168.1.10")
+	assert.Equal(t, "ip:192.168.1.10", ratelimit.ByClientIP(context.Background(), req))
+}
+
+func TestByClientID(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	req := httptest.NewRequest("POST", "/api/token", nil)
+	ctx := goa.NewContext(context.Background(), httptest.NewRecorder(), req, nil)
+	// when/then
+	assert.Equal(t, "", ratelimit.ByClientID(ctx, req))
+	clientID := "c211f1bd-17a7-4f8c-9f80-0917d167889d"
+	goa.ContextRequest(ctx).Payload = &app.TokenExchange{GrantType: "client_credentials", ClientID: &clientID}
+	assert.Equal(t, "client_id:"+clientID, ratelimit.ByClientID(ctx, req))
+}
+
+func TestByIdentityWithoutToken(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	req := httptest.NewRequest("GET", "/api/search/users", nil)
+	assert.Equal(t, "", ratelimit.ByIdentity(context.Background(), req))
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errs.New("store unavailable")
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/goadesign/goa"
 	"io/ioutil"
+	"net"
 	"net/http"
 )
 
@@ -26,6 +27,20 @@ func AbsoluteURL(req *goa.RequestData, relative string) string {
 	return fmt.Sprintf("%s://%s%s", scheme, req.Host, relative)
 }
 
+// ClientIP returns the IP of the client of the request. The last address of the X-Forwarded-For header is used
+// if the request went through a proxy, since the previous ones are sent by the client and can't be trusted.
+func ClientIP(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return ip
+}
+
 // ReplaceDomainPrefix replaces the last name in the host by a new name. Example: api.service.domain.org -> sso.service.domain.org
 func ReplaceDomainPrefix(host string, replaceBy string) (string, error) {
 	split := strings.SplitN(host, ".", 2)
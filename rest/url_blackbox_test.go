@@ -67,3 +67,17 @@ func TestReplaceDomainPrefixInTooShortHostFails(t *testing.T) {
 	_, err := ReplaceDomainPrefix("org", "sso")
 	assert.NotNil(t, err)
 }
+
+func TestClientIP(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	t.Parallel()
+
+	req := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:41234"}
+	assert.Equal(t, "10.0.0.1", ClientIP(req))
+
+	// the last hop is used, since the previous addresses are sent by the client
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 192.168.1.10")
+	assert.Equal(t, "192.168.1.10", ClientIP(req))
+	req.Header.Set("X-Forwarded-For", "192.168.1.11")
+	assert.Equal(t, "192.168.1.11", ClientIP(req))
+}
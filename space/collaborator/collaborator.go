@@ -0,0 +1,322 @@
+// Package collaborator manages the collaborators of spaces. The collaborators of a space
+// are the identities which have the contributor role assigned for the resource of the space.
+package collaborator
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/authorization/resource"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// SpaceResourceType is the name of the resource type of spaces
+	SpaceResourceType = "openshift.io/resource/space"
+	// ContributorRole is the name of the role assigned to the collaborators of a space
+	ContributorRole = "contributor"
+
+	uniqueIdentityRoleIndex = "uix_identity_role_identity_resource_role"
+)
+
+// CreateSpaceResource creates the resource of the given space and assigns the contributor role to the space owner
+func CreateSpaceResource(ctx context.Context, appl application.Application, spaceID uuid.UUID, ownerID uuid.UUID) (*resource.Resource, error) {
+	resourceType, err := appl.ResourceTypeRepository().Lookup(ctx, SpaceResourceType)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	res := &resource.Resource{
+		ResourceID:     spaceID.String(),
+		OwnerID:        ownerID,
+		ResourceTypeID: resourceType.ResourceTypeID,
+	}
+	err = appl.ResourceRepository().Create(ctx, res)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	res.ResourceType = *resourceType
+	_, err = Add(ctx, appl, res, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LoadSpaceResource loads the resource of the given space
+// returns NotFoundError if the collaborators of the space have not been imported yet
+func LoadSpaceResource(ctx context.Context, appl application.Application, spaceID uuid.UUID) (*resource.Resource, error) {
+	res, err := appl.ResourceRepository().Load(ctx, spaceID.String())
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			log.Error(ctx, map[string]interface{}{
+				"space_id": spaceID,
+			}, "no resource found for the space. Its collaborators may not have been imported from Keycloak yet")
+			return nil, err
+		}
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return res, nil
+}
+
+// List returns the IDs of the collaborators of the space resource in the order they were added
+func List(ctx context.Context, appl application.Application, res *resource.Resource) ([]uuid.UUID, error) {
+	contributor, err := lookupContributorRole(ctx, appl, res)
+	if err != nil {
+		return nil, err
+	}
+	identityRoles, err := appl.IdentityRoleRepository().FindIdentityRolesByResource(ctx, res.ResourceID)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	var identityIDs []uuid.UUID
+	for _, identityRole := range identityRoles {
+		if identityRole.RoleID == contributor.RoleID {
+			identityIDs = append(identityIDs, identityRole.IdentityID)
+		}
+	}
+	return identityIDs, nil
+}
+
+// IsCollaborator returns true if the identity has the contributor role assigned for the space resource
+func IsCollaborator(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error) {
+	contributor, err := lookupContributorRole(ctx, appl, res)
+	if err != nil {
+		return false, err
+	}
+	_, found, err := findContributorAssignment(ctx, appl, res, contributor, identityID)
+	return found, err
+}
+
+// Add assigns the contributor role to the identity for the space resource.
+// Returns false if the identity was already a collaborator.
+// Returns VersionConflictError if the role has been assigned concurrently.
+func Add(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error) {
+	contributor, err := lookupContributorRole(ctx, appl, res)
+	if err != nil {
+		return false, err
+	}
+	_, found, err := findContributorAssignment(ctx, appl, res, contributor, identityID)
+	if err != nil || found {
+		return false, err
+	}
+	err = appl.IdentityRoleRepository().Create(ctx, &role.IdentityRole{
+		IdentityID: identityID,
+		ResourceID: res.ResourceID,
+		RoleID:     contributor.RoleID,
+	})
+	if err != nil {
+		if gormsupport.IsUniqueViolation(errs.Cause(err), uniqueIdentityRoleIndex) {
+			return false, errors.NewVersionConflictError("the identity has been added to the collaborators concurrently")
+		}
+		return false, errors.NewInternalError(ctx, err)
+	}
+	return true, nil
+}
+
+// Remove revokes the contributor role of the identity for the space resource.
+// Returns false if the identity was not a collaborator.
+func Remove(ctx context.Context, appl application.Application, res *resource.Resource, identityID uuid.UUID) (bool, error) {
+	contributor, err := lookupContributorRole(ctx, appl, res)
+	if err != nil {
+		return false, err
+	}
+	assignment, found, err := findContributorAssignment(ctx, appl, res, contributor, identityID)
+	if err != nil || !found {
+		return false, err
+	}
+	err = appl.IdentityRoleRepository().Delete(ctx, assignment.IdentityRoleID)
+	if err != nil {
+		return false, errors.NewInternalError(ctx, err)
+	}
+	return true, nil
+}
+
+// ImportPolicies imports the collaborators stored in the Keycloak policies of the existing spaces.
+// The resource of a space is created if it does not exist yet. Collaborators which are already
+// imported are skipped, so the import can be run several times.
+func ImportPolicies(ctx context.Context, db application.DB, policyManager auth.AuthzPolicyManager) error {
+	var spaceResources []spaceResource
+	err := application.Transactional(db, func(appl application.Application) error {
+		resources, err := appl.SpaceResources().List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range resources {
+			spaceResources = append(spaceResources, spaceResource{spaceID: r.SpaceID, ownerID: r.OwnerID, policyID: r.PolicyID})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range spaceResources {
+		err := importPolicy(ctx, db, policyManager, nil, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportPolicy imports the collaborators stored in the Keycloak policy of the space unless they have already
+// been imported, so the collaborators of the spaces which have not been imported by ImportPolicies are found on first access.
+// returns NotFoundError if the space doesn't exist
+func ImportPolicy(ctx context.Context, db application.DB, policyManager auth.AuthzPolicyManager, req *goa.RequestData, spaceID uuid.UUID) error {
+	r, err := findNotImportedSpaceResource(ctx, db, spaceID)
+	if err != nil || r == nil {
+		return err
+	}
+	err = importPolicy(ctx, db, policyManager, req, *r)
+	if err != nil {
+		// the collaborators may have been imported concurrently by another request
+		if r, findErr := findNotImportedSpaceResource(ctx, db, spaceID); findErr == nil && r == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// findNotImportedSpaceResource returns the space resource of the space if its collaborators have not been imported yet, nil otherwise
+// returns NotFoundError if the space doesn't exist
+func findNotImportedSpaceResource(ctx context.Context, db application.DB, spaceID uuid.UUID) (*spaceResource, error) {
+	var result *spaceResource
+	err := application.Transactional(db, func(appl application.Application) error {
+		r, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
+		if err != nil {
+			return err
+		}
+		_, err = appl.ResourceRepository().Load(ctx, spaceID.String())
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			result = &spaceResource{spaceID: r.SpaceID, ownerID: r.OwnerID, policyID: r.PolicyID}
+			return nil
+		}
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// importPolicy imports the collaborators stored in the Keycloak policy of the space.
+// The resource of the space is created if it does not exist yet.
+func importPolicy(ctx context.Context, db application.DB, policyManager auth.AuthzPolicyManager, req *goa.RequestData, r spaceResource) error {
+	policy, _, err := policyManager.GetPolicy(ctx, req, r.policyID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"space_id":  r.spaceID,
+			"policy_id": r.policyID,
+			"err":       err,
+		}, "unable to get the space policy")
+		return err
+	}
+	var userIDs []string
+	if policy.Config.UserIDs != "" {
+		// UsersIDs format : "[\"<ID>\",\"<ID>\"]"
+		err = json.Unmarshal([]byte(policy.Config.UserIDs), &userIDs)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"space_id":  r.spaceID,
+				"policy_id": r.policyID,
+				"users_ids": policy.Config.UserIDs,
+				"err":       err,
+			}, "unable to parse the users of the space policy")
+			return errs.WithStack(err)
+		}
+	}
+	imported := 0
+	err = application.Transactional(db, func(appl application.Application) error {
+		res, err := appl.ResourceRepository().Load(ctx, r.spaceID.String())
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); !notFound {
+				return err
+			}
+			res, err = CreateSpaceResource(ctx, appl, r.spaceID, r.ownerID)
+			if err != nil {
+				return err
+			}
+		}
+		for _, userID := range userIDs {
+			identityID, err := uuid.FromString(userID)
+			if err != nil {
+				log.Warn(ctx, map[string]interface{}{
+					"space_id":    r.spaceID,
+					"identity_id": userID,
+				}, "skipping invalid identity ID listed in the space policy")
+				continue
+			}
+			if !appl.Identities().IsValid(ctx, identityID) {
+				log.Warn(ctx, map[string]interface{}{
+					"space_id":    r.spaceID,
+					"identity_id": userID,
+				}, "skipping unknown identity listed in the space policy")
+				continue
+			}
+			added, err := Add(ctx, appl, res, identityID)
+			if err != nil {
+				return err
+			}
+			if added {
+				imported++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"space_id": r.spaceID,
+			"err":      err,
+		}, "unable to import the space collaborators")
+		return err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"space_id": r.spaceID,
+		"imported": imported,
+	}, "space collaborators imported")
+	return nil
+}
+
+// spaceResource holds what is needed from a space resource to import its collaborators
+type spaceResource struct {
+	spaceID  uuid.UUID
+	ownerID  uuid.UUID
+	policyID string
+}
+
+// lookupContributorRole returns the contributor role defined for the type of the space resource
+func lookupContributorRole(ctx context.Context, appl application.Application, res *resource.Resource) (*role.Role, error) {
+	contributor, err := appl.RoleRepository().Lookup(ctx, ContributorRole, res.ResourceTypeID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id":      res.ResourceID,
+			"resource_type_id": res.ResourceTypeID,
+			"err":              err,
+		}, "the contributor role is not defined for the space resource type")
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return contributor, nil
+}
+
+// findContributorAssignment returns the assignment of the contributor role to the identity for the space resource, if any
+func findContributorAssignment(ctx context.Context, appl application.Application, res *resource.Resource, contributor *role.Role, identityID uuid.UUID) (*role.IdentityRole, bool, error) {
+	identityRoles, err := appl.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(ctx, identityID, res.ResourceID)
+	if err != nil {
+		return nil, false, errors.NewInternalError(ctx, err)
+	}
+	for i := range identityRoles {
+		if identityRoles[i].RoleID == contributor.RoleID {
+			return &identityRoles[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
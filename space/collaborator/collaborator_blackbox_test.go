@@ -0,0 +1,213 @@
+package collaborator_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/space"
+	"github.com/fabric8-services/fabric8-auth/space/collaborator"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type dummyPolicyManager struct {
+	policies map[string]*auth.KeycloakPolicy
+}
+
+func (m *dummyPolicyManager) GetPolicy(ctx context.Context, request *goa.RequestData, policyID string) (*auth.KeycloakPolicy, *string, error) {
+	pat := ""
+	policy, ok := m.policies[policyID]
+	if !ok {
+		// space resource not created by this test
+		return &auth.KeycloakPolicy{}, &pat, nil
+	}
+	result := *policy
+	return &result, &pat, nil
+}
+
+func (m *dummyPolicyManager) UpdatePolicy(ctx context.Context, request *goa.RequestData, policy auth.KeycloakPolicy, pat string) error {
+	m.policies[*policy.ID] = &policy
+	return nil
+}
+
+func (m *dummyPolicyManager) AddUserToPolicy(p *auth.KeycloakPolicy, userID string) bool {
+	return p.AddUserToPolicy(userID)
+}
+
+func (m *dummyPolicyManager) RemoveUserFromPolicy(p *auth.KeycloakPolicy, userID string) bool {
+	return p.RemoveUserFromPolicy(userID)
+}
+
+type collaboratorBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	owner         account.Identity
+	collaborator  account.Identity
+	policyManager *dummyPolicyManager
+}
+
+func TestRunCollaboratorBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &collaboratorBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *collaboratorBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	var err error
+	s.owner, err = testsupport.CreateTestIdentity(s.DB, "collaborator_blackbox_test-"+uuid.NewV4().String(), "collaborator_blackbox_test")
+	require.Nil(s.T(), err)
+	s.collaborator, err = testsupport.CreateTestIdentity(s.DB, "collaborator_blackbox_test-"+uuid.NewV4().String(), "collaborator_blackbox_test")
+	require.Nil(s.T(), err)
+	s.policyManager = &dummyPolicyManager{policies: map[string]*auth.KeycloakPolicy{}}
+}
+
+func (s *collaboratorBlackBoxTest) createSpaceResource(userIDs ...string) uuid.UUID {
+	policyID := uuid.NewV4().String()
+	policy := &auth.KeycloakPolicy{ID: &policyID}
+	for _, userID := range userIDs {
+		policy.AddUserToPolicy(userID)
+	}
+	s.policyManager.policies[policyID] = policy
+	spaceResource := &space.Resource{
+		ResourceID:   uuid.NewV4().String(),
+		PolicyID:     policyID,
+		PermissionID: uuid.NewV4().String(),
+		SpaceID:      uuid.NewV4(),
+		OwnerID:      s.owner.ID,
+	}
+	_, err := s.Application.SpaceResources().Create(s.Ctx, spaceResource)
+	require.Nil(s.T(), err)
+	return spaceResource.SpaceID
+}
+
+func (s *collaboratorBlackBoxTest) listCollaborators(spaceID uuid.UUID) []uuid.UUID {
+	var identityIDs []uuid.UUID
+	err := application.Transactional(s.Application, func(appl application.Application) error {
+		res, err := collaborator.LoadSpaceResource(s.Ctx, appl, spaceID)
+		if err != nil {
+			return err
+		}
+		identityIDs, err = collaborator.List(s.Ctx, appl, res)
+		return err
+	})
+	require.Nil(s.T(), err)
+	return identityIDs
+}
+
+func (s *collaboratorBlackBoxTest) TestImportPolicies() {
+	// given
+	spaceID := s.createSpaceResource(s.owner.ID.String(), s.collaborator.ID.String(), uuid.NewV4().String())
+	// when
+	err := collaborator.ImportPolicies(s.Ctx, s.Application, s.policyManager)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []uuid.UUID{s.owner.ID, s.collaborator.ID}, s.listCollaborators(spaceID))
+}
+
+func (s *collaboratorBlackBoxTest) TestImportPoliciesTwice() {
+	// given
+	spaceID := s.createSpaceResource(s.owner.ID.String(), s.collaborator.ID.String())
+	err := collaborator.ImportPolicies(s.Ctx, s.Application, s.policyManager)
+	require.Nil(s.T(), err)
+	// when
+	err = collaborator.ImportPolicies(s.Ctx, s.Application, s.policyManager)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []uuid.UUID{s.owner.ID, s.collaborator.ID}, s.listCollaborators(spaceID))
+}
+
+func (s *collaboratorBlackBoxTest) TestImportEmptyPolicyKeepsOwner() {
+	// given
+	spaceID := s.createSpaceResource()
+	// when
+	err := collaborator.ImportPolicies(s.Ctx, s.Application, s.policyManager)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []uuid.UUID{s.owner.ID}, s.listCollaborators(spaceID))
+}
+
+func (s *collaboratorBlackBoxTest) TestImportPolicy() {
+	// given
+	spaceID := s.createSpaceResource(s.owner.ID.String(), s.collaborator.ID.String())
+	// when
+	err := collaborator.ImportPolicy(s.Ctx, s.Application, s.policyManager, nil, spaceID)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []uuid.UUID{s.owner.ID, s.collaborator.ID}, s.listCollaborators(spaceID))
+}
+
+func (s *collaboratorBlackBoxTest) TestImportPolicyOnlyOnce() {
+	// given
+	spaceID := s.createSpaceResource(s.owner.ID.String())
+	err := collaborator.ImportPolicy(s.Ctx, s.Application, s.policyManager, nil, spaceID)
+	require.Nil(s.T(), err)
+	// when the policy changes after the import
+	s.policyManager.policies[s.policyID(spaceID)].AddUserToPolicy(s.collaborator.ID.String())
+	err = collaborator.ImportPolicy(s.Ctx, s.Application, s.policyManager, nil, spaceID)
+	// then the collaborators are not imported again
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []uuid.UUID{s.owner.ID}, s.listCollaborators(spaceID))
+}
+
+func (s *collaboratorBlackBoxTest) TestImportPolicyOfUnknownSpaceNotFound() {
+	// when
+	err := collaborator.ImportPolicy(s.Ctx, s.Application, s.policyManager, nil, uuid.NewV4())
+	// then
+	notFound, _ := errors.IsNotFoundError(err)
+	assert.True(s.T(), notFound)
+}
+
+func (s *collaboratorBlackBoxTest) TestPolicySinkReplacesPolicyUsers() {
+	// given a policy which is out of sync with the collaborators
+	spaceID := s.createSpaceResource(s.owner.ID.String(), s.collaborator.ID.String())
+	err := collaborator.ImportPolicy(s.Ctx, s.Application, s.policyManager, nil, spaceID)
+	require.Nil(s.T(), err)
+	s.policyManager.policies[s.policyID(spaceID)].RemoveUserFromPolicy(s.collaborator.ID.String())
+	event, err := outbox.NewEvent(s.Ctx, outbox.SpaceCollaboratorAdded, s.collaborator.ID, outbox.SpaceCollaborator{
+		SpaceID:    spaceID.String(),
+		IdentityID: s.collaborator.ID,
+	})
+	require.Nil(s.T(), err)
+	sink := collaborator.NewPolicySink(s.Application, s.policyManager)
+	// when the event is delivered twice
+	for i := 0; i < 2; i++ {
+		err = sink.Deliver(s.Ctx, *event)
+		// then
+		require.Nil(s.T(), err)
+		var userIDs []string
+		err = json.Unmarshal([]byte(s.policyManager.policies[s.policyID(spaceID)].Config.UserIDs), &userIDs)
+		require.Nil(s.T(), err)
+		assert.Equal(s.T(), []string{s.owner.ID.String(), s.collaborator.ID.String()}, userIDs)
+	}
+}
+
+func (s *collaboratorBlackBoxTest) TestPolicySinkIgnoresDeletedSpaces() {
+	// given
+	event, err := outbox.NewEvent(s.Ctx, outbox.SpaceCollaboratorRemoved, s.collaborator.ID, outbox.SpaceCollaborator{
+		SpaceID:    uuid.NewV4().String(),
+		IdentityID: s.collaborator.ID,
+	})
+	require.Nil(s.T(), err)
+	// when
+	err = collaborator.NewPolicySink(s.Application, s.policyManager).Deliver(s.Ctx, *event)
+	// then
+	assert.Nil(s.T(), err)
+}
+
+func (s *collaboratorBlackBoxTest) policyID(spaceID uuid.UUID) string {
+	spaceResource, err := s.Application.SpaceResources().LoadBySpace(s.Ctx, &spaceID)
+	require.Nil(s.T(), err)
+	return spaceResource.PolicyID
+}
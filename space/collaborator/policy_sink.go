@@ -0,0 +1,100 @@
+package collaborator
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PolicySink keeps the Keycloak policies of the spaces in sync with the collaborators stored in the database
+// as long as WIT authorizes the space operations with the RPTs issued by Keycloak.
+// The policies are updated when the changes of the collaborators are delivered from the outbox,
+// so Keycloak is never called in the transactions changing the collaborators.
+type PolicySink struct {
+	db            application.DB
+	policyManager auth.AuthzPolicyManager
+}
+
+// NewPolicySink creates a sink updating the Keycloak policies of the spaces
+func NewPolicySink(db application.DB, policyManager auth.AuthzPolicyManager) *PolicySink {
+	return &PolicySink{
+		db:            db,
+		policyManager: policyManager,
+	}
+}
+
+// Name returns the name of the sink
+func (s *PolicySink) Name() string {
+	return "keycloak-space-policies"
+}
+
+// Deliver replaces the users of the Keycloak policy of the space with its current collaborators.
+// The policy is not updated with the change described by the event but with all the collaborators,
+// so delivering the events several times or out of order leaves the policy in sync with the database.
+func (s *PolicySink) Deliver(ctx context.Context, event outbox.Event) error {
+	if event.Type != outbox.SpaceCollaboratorAdded && event.Type != outbox.SpaceCollaboratorRemoved {
+		return nil
+	}
+	var collaborator outbox.SpaceCollaborator
+	err := event.Unmarshal(&collaborator)
+	if err != nil {
+		return err
+	}
+	spaceID, err := uuid.FromString(collaborator.SpaceID)
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	var policyID string
+	userIDs := []string{}
+	err = application.Transactional(s.db, func(appl application.Application) error {
+		spaceResource, err := appl.SpaceResources().LoadBySpace(ctx, &spaceID)
+		if err != nil {
+			return err
+		}
+		policyID = spaceResource.PolicyID
+		res, err := LoadSpaceResource(ctx, appl, spaceID)
+		if err != nil {
+			return err
+		}
+		identityIDs, err := List(ctx, appl, res)
+		if err != nil {
+			return err
+		}
+		for _, identityID := range identityIDs {
+			userIDs = append(userIDs, identityID.String())
+		}
+		return nil
+	})
+	if notFound, _ := errors.IsNotFoundError(err); notFound {
+		log.Warn(ctx, map[string]interface{}{
+			"space_id": spaceID,
+			"event_id": event.ID,
+		}, "the space has been deleted since the change of its collaborators. Skipping the update of its policy")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	users, err := json.Marshal(userIDs)
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	req := event.RequestData()
+	policy, pat, err := s.policyManager.GetPolicy(ctx, req, policyID)
+	if err != nil {
+		return err
+	}
+	if policy.Config.UserIDs == string(users) {
+		return nil
+	}
+	policy.Config.UserIDs = string(users)
+	return s.policyManager.UpdatePolicy(ctx, req, *policy, *pat)
+}
@@ -61,6 +61,7 @@ type ResourceRepository interface {
 	Load(ctx context.Context, ID uuid.UUID) (*Resource, error)
 	Delete(ctx context.Context, ID uuid.UUID) error
 	LoadBySpace(ctx context.Context, spaceID *uuid.UUID) (*Resource, error)
+	List(ctx context.Context) ([]Resource, error)
 }
 
 // NewResourceRepository creates a new space resource repo
@@ -195,3 +196,14 @@ func (r *GormResourceRepository) LoadBySpace(ctx context.Context, spaceID *uuid.
 	}
 	return &res, nil
 }
+
+// List returns all the space resources ordered by creation date
+func (r *GormResourceRepository) List(ctx context.Context) ([]Resource, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "spaceresource", "list"}, time.Now())
+	var rows []Resource
+	tx := r.db.Order("created_at").Find(&rows)
+	if tx.Error != nil && !tx.RecordNotFound() {
+		return nil, errors.NewInternalError(ctx, tx.Error)
+	}
+	return rows, nil
+}
@@ -124,6 +124,21 @@ func (test *resourceRepoBBTest) TestLoadByDifferentSpaceFails() {
 	assert.NotNil(test.T(), err)
 }
 
+func (test *resourceRepoBBTest) TestList() {
+	res, _ := expectResource(test.create(testResourceID, testPolicyID, testPermissionID), test.requireOk)
+	res2, _ := expectResource(test.create(testResource2ID, testPolicyID2, testPermissionID2), test.requireOk)
+
+	resources, err := test.repo.List(context.Background())
+	require.Nil(test.T(), err)
+	var found1, found2 bool
+	for _, r := range resources {
+		found1 = found1 || r.ID == res.ID
+		found2 = found2 || r.ID == res2.ID
+	}
+	assert.True(test.T(), found1)
+	assert.True(test.T(), found2)
+}
+
 type resourceExpectation func(p *space.Resource, err error)
 
 func expectResource(f func() (*space.Resource, error), e resourceExpectation) (*space.Resource, error) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/token/link"
@@ -14,18 +15,29 @@ import (
 	netcontext "golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"strings"
+	"time"
 )
 
 type DummyProviderFactory struct {
 	Token           string
 	Config          *configuration.ConfigurationData
 	LoadProfileFail bool
+	// RefreshFail makes the provider reject the refresh tokens
+	RefreshFail bool
+	// RefreshUnavailable makes the provider unreachable when the tokens are refreshed
+	RefreshUnavailable bool
 }
 
 func (factory *DummyProviderFactory) NewOauthProvider(ctx context.Context, req *goa.RequestData, forResource string) (link.ProviderConfig, error) {
 	if strings.HasPrefix(forResource, "https://github.com") {
 		return &DummyProvider{factory: factory, id: link.GitHubProviderID, url: forResource, name: "github"}, nil
 	}
+	if strings.HasPrefix(forResource, "https://gitlab.com") {
+		return &DummyProvider{factory: factory, id: link.GitLabProviderID, url: forResource, name: "gitlab"}, nil
+	}
+	if strings.HasPrefix(forResource, "https://bitbucket.org") {
+		return &DummyProvider{factory: factory, id: link.BitbucketProviderID, url: forResource, name: "bitbucket"}, nil
+	}
 	if strings.HasPrefix(forResource, "https://api.starter-us-east-2.openshift.com") {
 		cluster := factory.Config.GetOSOClusters()["https://api.starter-us-east-2.openshift.com"]
 		return &DummyProvider{factory: factory, id: cluster.TokenProviderID, url: forResource, name: "openshift-v3"}, nil
@@ -69,3 +81,31 @@ func (provider *DummyProvider) Profile(ctx context.Context, token oauth2.Token)
 		Username: token.AccessToken + "testuser",
 	}, nil
 }
+
+// TokenSource returns a token source issuing the token of the factory, valid for an hour, if the given token has a refresh token
+func (provider *DummyProvider) TokenSource(ctx netcontext.Context, token *oauth2.Token) oauth2.TokenSource {
+	return &dummyTokenSource{provider: provider, refreshToken: token.RefreshToken}
+}
+
+type dummyTokenSource struct {
+	provider     *DummyProvider
+	refreshToken string
+}
+
+func (source *dummyTokenSource) Token() (*oauth2.Token, error) {
+	if source.refreshToken == "" || source.provider.factory.RefreshFail {
+		return nil, &oauth2.RetrieveError{
+			Response: &http.Response{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"},
+			Body:     []byte(`{"error":"invalid_grant"}`),
+		}
+	}
+	if source.provider.factory.RefreshUnavailable {
+		return nil, errors.New("unable to reach the provider")
+	}
+	return &oauth2.Token{
+		AccessToken:  source.provider.factory.Token,
+		RefreshToken: source.refreshToken,
+		TokenType:    "bearer",
+		Expiry:       time.Now().Add(time.Hour),
+	}, nil
+}
@@ -110,8 +110,12 @@ func NewManager() token.Manager {
 		panic(fmt.Errorf("failed to setup parse priviate key: %s", err.Error()))
 	}
 	serviceAccountKey := &token.PrivateKey{KeyID: "9MLnViaRkhVj1GT9kpWUkwHIwUD-wZfUxR-3CpkE-Xs", Key: rsaServiceAccountKey}
+	config, err := configuration.GetConfigurationData()
+	if err != nil {
+		panic(fmt.Errorf("failed to setup the configuration: %s", err.Error()))
+	}
 
-	return token.NewManagerWithPublicKey(publicKey, serviceAccountKey)
+	return token.NewManagerWithPublicKey(publicKey, serviceAccountKey, config)
 }
 
 func PrivateKey() *rsa.PrivateKey {
@@ -0,0 +1,174 @@
+// Package encryption protects the secrets stored in the database with envelope encryption:
+// every secret is encrypted with its own random data key, and the data key is encrypted with
+// a key-encryption key identified by its ID. Only the encrypted data key and the ID of the
+// key-encryption key are stored next to the secret, so the key-encryption key can be rotated
+// by re-encrypting the data keys.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	errs "github.com/pkg/errors"
+)
+
+// dataKeySize is the size of the data keys, for AES-256
+const dataKeySize = 32
+
+// Configuration provides the key-encryption keys
+type Configuration interface {
+	GetExternalTokenEncryptionKey() ([]byte, string)
+	GetDeprecatedExternalTokenEncryptionKey() ([]byte, string)
+}
+
+// Envelope is an encrypted secret with the data key it is encrypted with
+type Envelope struct {
+	// KeyID is the ID of the key-encryption key the data key is encrypted with
+	KeyID string
+	// EncryptedKey is the encrypted data key, base64-encoded
+	EncryptedKey string
+	// Ciphertext is the encrypted secret, base64-encoded
+	Ciphertext string
+}
+
+// Cipher encrypts the secrets with the current key-encryption key, and decrypts them
+// with the current or the deprecated key-encryption key
+type Cipher struct {
+	keyID string
+	keys  map[string]cipher.AEAD
+}
+
+// NewCipher returns a cipher using the configured key-encryption keys
+func NewCipher(config Configuration) (*Cipher, error) {
+	key, keyID := config.GetExternalTokenEncryptionKey()
+	if len(key) == 0 || keyID == "" {
+		return nil, errs.New("the external token encryption key or its ID is not set")
+	}
+	c := &Cipher{keyID: keyID, keys: map[string]cipher.AEAD{}}
+	err := c.addKey(keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	deprecatedKey, deprecatedKeyID := config.GetDeprecatedExternalTokenEncryptionKey()
+	if len(deprecatedKey) > 0 && deprecatedKeyID != "" {
+		if deprecatedKeyID == keyID {
+			return nil, errs.Errorf("the deprecated external token encryption key has the same ID as the current one: %s", keyID)
+		}
+		err = c.addKey(deprecatedKeyID, deprecatedKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Cipher) addKey(keyID string, encodedKey []byte) error {
+	key, err := base64.StdEncoding.DecodeString(string(encodedKey))
+	if err != nil {
+		return errs.Wrapf(err, "the external token encryption key %s is not base64-encoded", keyID)
+	}
+	if len(key) != dataKeySize {
+		return errs.Errorf("the external token encryption key %s must be a %d-byte AES key", keyID, dataKeySize)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	c.keys[keyID] = aead
+	return nil
+}
+
+// KeyID returns the ID of the key-encryption key the secrets are encrypted with
+func (c *Cipher) KeyID() string {
+	return c.keyID
+}
+
+// Encrypt encrypts the secret with a new data key. The associated data (e.g. the ID of the row
+// storing the secret) is authenticated, so the envelope can't be decrypted with other associated data.
+func (c *Cipher) Encrypt(secret string, associatedData []byte) (Envelope, error) {
+	dataKey := make([]byte, dataKeySize)
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return Envelope{}, errs.Wrap(err, "unable to generate a data key")
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+	ciphertext, err := seal(dataAEAD, []byte(secret), associatedData)
+	if err != nil {
+		return Envelope{}, err
+	}
+	encryptedKey, err := seal(c.keys[c.keyID], dataKey, []byte(c.keyID))
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		KeyID:        c.keyID,
+		EncryptedKey: base64.StdEncoding.EncodeToString(encryptedKey),
+		Ciphertext:   base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Decrypt decrypts the secret of the envelope with the associated data it was encrypted with
+func (c *Cipher) Decrypt(envelope Envelope, associatedData []byte) (string, error) {
+	keyAEAD, found := c.keys[envelope.KeyID]
+	if !found {
+		return "", errs.Errorf("unknown encryption key %s", envelope.KeyID)
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(envelope.EncryptedKey)
+	if err != nil {
+		return "", errs.Wrap(err, "invalid encrypted data key")
+	}
+	dataKey, err := open(keyAEAD, encryptedKey, []byte(envelope.KeyID))
+	if err != nil {
+		return "", errs.Wrapf(err, "unable to decrypt the data key with the encryption key %s", envelope.KeyID)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return "", errs.Wrap(err, "invalid ciphertext")
+	}
+	secret, err := open(dataAEAD, ciphertext, associatedData)
+	if err != nil {
+		return "", errs.Wrap(err, "unable to decrypt the secret")
+	}
+	return string(secret), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	return aead, nil
+}
+
+// seal encrypts the plaintext with a random nonce, which is prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext []byte, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, errs.Wrap(err, "unable to generate a nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// open decrypts a ciphertext returned by seal
+func open(aead cipher.AEAD, ciphertext []byte, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errs.New("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], associatedData)
+}
@@ -0,0 +1,152 @@
+package encryption_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	key1 = "E97pLHXHSzLyfNXqylXumECr3tVvaOOB224huwvLOoY="
+	key2 = "qPHTT2J7vXOHKeqHVKCWjwC06nsNnSuw5bUGtRyIYcc="
+)
+
+type keyConfig struct {
+	key             string
+	keyID           string
+	deprecatedKey   string
+	deprecatedKeyID string
+}
+
+func (c keyConfig) GetExternalTokenEncryptionKey() ([]byte, string) {
+	return []byte(c.key), c.keyID
+}
+
+func (c keyConfig) GetDeprecatedExternalTokenEncryptionKey() ([]byte, string) {
+	return []byte(c.deprecatedKey), c.deprecatedKeyID
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	cipher, err := encryption.NewCipher(keyConfig{key: key1, keyID: "key1"})
+	require.Nil(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		// when
+		envelope, err := cipher.Encrypt("some-github-token", []byte("row1"))
+		// then
+		require.Nil(t, err)
+		assert.Equal(t, "key1", envelope.KeyID)
+		assert.NotContains(t, envelope.Ciphertext, "some-github-token")
+		secret, err := cipher.Decrypt(envelope, []byte("row1"))
+		require.Nil(t, err)
+		assert.Equal(t, "some-github-token", secret)
+	})
+
+	t.Run("new data key for every secret", func(t *testing.T) {
+		// when
+		envelope1, err := cipher.Encrypt("some-github-token", []byte("row1"))
+		require.Nil(t, err)
+		envelope2, err := cipher.Encrypt("some-github-token", []byte("row1"))
+		require.Nil(t, err)
+		// then
+		assert.NotEqual(t, envelope1.EncryptedKey, envelope2.EncryptedKey)
+		assert.NotEqual(t, envelope1.Ciphertext, envelope2.Ciphertext)
+	})
+
+	t.Run("other associated data", func(t *testing.T) {
+		// given
+		envelope, err := cipher.Encrypt("some-github-token", []byte("row1"))
+		require.Nil(t, err)
+		// when
+		_, err = cipher.Decrypt(envelope, []byte("row2"))
+		// then
+		require.NotNil(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		// given
+		envelope, err := cipher.Encrypt("some-github-token", []byte("row1"))
+		require.Nil(t, err)
+		envelope.KeyID = "key2"
+		// when
+		_, err = cipher.Decrypt(envelope, []byte("row1"))
+		// then
+		require.NotNil(t, err)
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	// given
+	oldCipher, err := encryption.NewCipher(keyConfig{key: key1, keyID: "key1"})
+	require.Nil(t, err)
+	envelope, err := oldCipher.Encrypt("some-github-token", []byte("row1"))
+	require.Nil(t, err)
+
+	t.Run("decrypt with the deprecated key", func(t *testing.T) {
+		// given
+		cipher, err := encryption.NewCipher(keyConfig{key: key2, keyID: "key2", deprecatedKey: key1, deprecatedKeyID: "key1"})
+		require.Nil(t, err)
+		// when
+		secret, err := cipher.Decrypt(envelope, []byte("row1"))
+		// then
+		require.Nil(t, err)
+		assert.Equal(t, "some-github-token", secret)
+		assert.Equal(t, "key2", cipher.KeyID())
+	})
+
+	t.Run("deprecated key removed", func(t *testing.T) {
+		// given
+		cipher, err := encryption.NewCipher(keyConfig{key: key2, keyID: "key2"})
+		require.Nil(t, err)
+		// when
+		_, err = cipher.Decrypt(envelope, []byte("row1"))
+		// then
+		require.NotNil(t, err)
+	})
+
+	t.Run("key replaced without changing its ID", func(t *testing.T) {
+		// given
+		cipher, err := encryption.NewCipher(keyConfig{key: key2, keyID: "key1"})
+		require.Nil(t, err)
+		// when
+		_, err = cipher.Decrypt(envelope, []byte("row1"))
+		// then
+		require.NotNil(t, err)
+	})
+}
+
+func TestNewCipherInvalidConfiguration(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	t.Run("no key", func(t *testing.T) {
+		_, err := encryption.NewCipher(keyConfig{keyID: "key1"})
+		require.NotNil(t, err)
+	})
+
+	t.Run("no key ID", func(t *testing.T) {
+		_, err := encryption.NewCipher(keyConfig{key: key1})
+		require.NotNil(t, err)
+	})
+
+	t.Run("not base64-encoded", func(t *testing.T) {
+		_, err := encryption.NewCipher(keyConfig{key: "not a key!", keyID: "key1"})
+		require.NotNil(t, err)
+	})
+
+	t.Run("wrong key size", func(t *testing.T) {
+		_, err := encryption.NewCipher(keyConfig{key: "c2hvcnQga2V5", keyID: "key1"})
+		require.NotNil(t, err)
+	})
+
+	t.Run("deprecated key with the same ID", func(t *testing.T) {
+		_, err := encryption.NewCipher(keyConfig{key: key2, keyID: "key1", deprecatedKey: key1, deprecatedKeyID: "key1"})
+		require.NotNil(t, err)
+	})
+}
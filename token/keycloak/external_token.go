@@ -11,6 +11,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	errs "github.com/pkg/errors"
 )
 
@@ -37,7 +38,7 @@ type KeycloakExternalTokenServiceClient struct {
 // NewKeycloakTokenServiceClient creates a new KeycloakTokenServiceClient
 func NewKeycloakTokenServiceClient(config auth.KeycloakConfiguration) KeycloakExternalTokenServiceClient {
 	return KeycloakExternalTokenServiceClient{
-		client: http.DefaultClient,
+		client: tracing.NewHTTPClient("keycloak"),
 		config: config,
 	}
 }
@@ -58,7 +59,7 @@ func (c *KeycloakExternalTokenServiceClient) Get(ctx context.Context, accessToke
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("Accept", "application/json, text/plain, */*")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -115,7 +116,7 @@ func (c *KeycloakExternalTokenServiceClient) Delete(ctx context.Context, keycloa
 		return err
 	}
 	req.Header.Add("Authorization", "Bearer "+pat)
-	resp, err := c.client.Do(req)
+	resp, err := c.client.Do(req.WithContext(ctx))
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -0,0 +1,98 @@
+package token
+
+import (
+	"crypto/rsa"
+	"sync"
+	"time"
+)
+
+// SigningKey represents a key of the key ring used to sign and verify the tokens issued by the Auth service.
+// The key signs the tokens from NotBefore (if not zero) as long as no newer key is active,
+// and verifies the tokens until RetireAfter (if not zero).
+type SigningKey struct {
+	PrivateKey
+	NotBefore   time.Time
+	RetireAfter time.Time
+}
+
+// keyRing holds the keys of the service account. The keys are staged, used and retired according to their times,
+// so the signing key can be rotated without restarting or redeploying the service.
+type keyRing struct {
+	keys []*SigningKey
+	lock sync.RWMutex
+}
+
+// newKeyRing returns a key ring holding the given keys.
+// When several active keys have the same NotBefore time, the first one is used to sign the tokens.
+func newKeyRing(keys ...*SigningKey) *keyRing {
+	return &keyRing{keys: keys}
+}
+
+// setKeys replaces all the keys of the key ring
+func (r *keyRing) setKeys(keys ...*SigningKey) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.keys = keys
+}
+
+// active returns true if the key can be used to sign tokens at the given time
+func (k *SigningKey) active(now time.Time) bool {
+	return !now.Before(k.NotBefore) && k.published(now)
+}
+
+// published returns true if the key can be used to verify tokens at the given time
+func (k *SigningKey) published(now time.Time) bool {
+	return k.RetireAfter.IsZero() || now.Before(k.RetireAfter)
+}
+
+// signingKey returns the newest active key, i.e. the active key with the latest NotBefore time, or nil if no key is active
+func (r *keyRing) signingKey() *PrivateKey {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	now := time.Now()
+	var newest *SigningKey
+	for _, key := range r.keys {
+		if key.active(now) && (newest == nil || key.NotBefore.After(newest.NotBefore)) {
+			newest = key
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	return &newest.PrivateKey
+}
+
+// privateKey returns the private key with the given ID if it's still published
+func (r *keyRing) privateKey(keyID string) *PrivateKey {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.KeyID == keyID && key.published(now) {
+			return &key.PrivateKey
+		}
+	}
+	return nil
+}
+
+// publicKey returns the public key with the given ID if it's still published
+func (r *keyRing) publicKey(keyID string) *rsa.PublicKey {
+	if key := r.privateKey(keyID); key != nil {
+		return &key.Key.PublicKey
+	}
+	return nil
+}
+
+// publicKeys returns the public keys which are published, including the keys which are not active yet
+func (r *keyRing) publicKeys() []*PublicKey {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	now := time.Now()
+	var keys []*PublicKey
+	for _, key := range r.keys {
+		if key.published(now) {
+			keys = append(keys, &PublicKey{KeyID: key.KeyID, Key: &key.Key.PublicKey})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,219 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	config "github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/goadesign/goa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestKeyRing(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	suite.Run(t, &TestKeyRingSuite{})
+}
+
+type TestKeyRingSuite struct {
+	suite.Suite
+	current *SigningKey
+	staged  *SigningKey
+	retired *SigningKey
+}
+
+func (s *TestKeyRingSuite) SetupSuite() {
+	now := time.Now()
+	s.current = s.newSigningKey("current", now.Add(-24*time.Hour), time.Time{})
+	s.staged = s.newSigningKey("staged", now.Add(24*time.Hour), time.Time{})
+	s.retired = s.newSigningKey("retired", now.Add(-72*time.Hour), now.Add(-time.Hour))
+}
+
+func (s *TestKeyRingSuite) newSigningKey(kid string, notBefore time.Time, retireAfter time.Time) *SigningKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(s.T(), err)
+	return &SigningKey{PrivateKey: PrivateKey{KeyID: kid, Key: key}, NotBefore: notBefore, RetireAfter: retireAfter}
+}
+
+func (s *TestKeyRingSuite) TestNewestActiveKeySigns() {
+	ring := newKeyRing(s.retired, s.current, s.staged)
+	assert.Equal(s.T(), "current", ring.signingKey().KeyID)
+
+	// when the staged key becomes active
+	active := *s.staged
+	active.NotBefore = time.Now().Add(-time.Minute)
+	ring = newKeyRing(s.retired, s.current, &active)
+	assert.Equal(s.T(), "staged", ring.signingKey().KeyID)
+	// the previous key still verifies the tokens it signed
+	assert.NotNil(s.T(), ring.publicKey("current"))
+}
+
+func (s *TestKeyRingSuite) TestFirstKeySignsWhenSameNotBefore() {
+	legacy := &SigningKey{PrivateKey: s.current.PrivateKey}
+	other := &SigningKey{PrivateKey: s.staged.PrivateKey}
+	assert.Equal(s.T(), "current", newKeyRing(legacy, other).signingKey().KeyID)
+}
+
+func (s *TestKeyRingSuite) TestNoActiveKey() {
+	assert.Nil(s.T(), newKeyRing(s.retired, s.staged).signingKey())
+	tm := &tokenManager{keyRing: newKeyRing(s.retired, s.staged)}
+	assert.NotNil(s.T(), tm.CheckSigningKeys())
+	tm = &tokenManager{keyRing: newKeyRing(s.retired, s.current)}
+	assert.Nil(s.T(), tm.CheckSigningKeys())
+}
+
+func (s *TestKeyRingSuite) TestPublishedKeys() {
+	ring := newKeyRing(s.retired, s.current, s.staged)
+	var kids []string
+	for _, key := range ring.publicKeys() {
+		kids = append(kids, key.KeyID)
+	}
+	assert.Equal(s.T(), []string{"current", "staged"}, kids)
+	assert.NotNil(s.T(), ring.publicKey("staged"))
+	assert.Nil(s.T(), ring.publicKey("retired"))
+	assert.Nil(s.T(), ring.privateKey("retired"))
+	assert.Nil(s.T(), ring.publicKey("unknown"))
+}
+
+func (s *TestKeyRingSuite) TestTokenManagerRotatesKeys() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	tm := &tokenManager{
+		publicKeysMap: map[string]*rsa.PublicKey{},
+		keyRing:       newKeyRing(s.retired, s.current, s.staged),
+	}
+
+	// the tokens are signed with the current key
+	tokenString, err := tm.GenerateServiceAccountToken(r, AuthServiceAccountID, "fabric8-auth")
+	require.Nil(s.T(), err)
+	token, err := jwt.Parse(tokenString, tm.keyFunction(context.Background()))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "current", token.Header["kid"])
+
+	// the staged key is published but the retired one isn't
+	assert.Len(s.T(), tm.PublicKeys(), 2)
+	assert.Len(s.T(), tm.JsonWebKeys().Keys, 2)
+	assert.Len(s.T(), tm.PemKeys().Keys, 2)
+	assert.NotNil(s.T(), tm.PublicKey("staged"))
+	assert.Nil(s.T(), tm.PublicKey("retired"))
+
+	// the tokens signed with a retired key are rejected
+	retiredToken := tm.GenerateUnsignedServiceAccountToken(r, AuthServiceAccountID, "fabric8-auth")
+	retiredToken.Header["kid"] = "retired"
+	tokenString, err = retiredToken.SignedString(s.retired.Key)
+	require.Nil(s.T(), err)
+	_, err = tm.ParseTokenWithMapClaims(context.Background(), tokenString)
+	assert.NotNil(s.T(), err)
+}
+
+func (s *TestKeyRingSuite) TestAuthServiceAccountTokenResignedOnRotation() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	now := time.Now()
+	next := s.newSigningKey("next", now.Add(time.Hour), time.Time{})
+	tm := &tokenManager{
+		publicKeysMap: map[string]*rsa.PublicKey{},
+		keyRing:       newKeyRing(s.current, next),
+	}
+
+	// the token is cached as long as the signing key doesn't change
+	tokenString, err := tm.AuthServiceAccountToken(r)
+	require.Nil(s.T(), err)
+	token, err := jwt.Parse(tokenString, tm.keyFunction(context.Background()))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "current", token.Header["kid"])
+	cached, err := tm.AuthServiceAccountToken(r)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), tokenString, cached)
+
+	// the token is re-signed when it's about to expire
+	tm.serviceAccountToken.expiresAt = now.Add(authServiceAccountTokenRenewBefore / 2)
+	renewed, err := tm.AuthServiceAccountToken(r)
+	require.Nil(s.T(), err)
+	assert.NotEqual(s.T(), tokenString, renewed)
+
+	// the token is re-signed with the new key once it becomes the signing key
+	next.NotBefore = now.Add(-time.Minute)
+	rotated, err := tm.AuthServiceAccountToken(r)
+	require.Nil(s.T(), err)
+	token, err = jwt.Parse(rotated, tm.keyFunction(context.Background()))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "next", token.Header["kid"])
+}
+
+func (s *TestKeyRingSuite) TestSelectKeysByKeyID() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	tm := &tokenManager{
+		publicKeysMap: map[string]*rsa.PublicKey{},
+		keyRing:       newKeyRing(s.retired, s.current),
+	}
+	request := func(kid string, key *rsa.PrivateKey) *http.Request {
+		token := tm.GenerateUnsignedServiceAccountToken(r, AuthServiceAccountID, "fabric8-auth")
+		token.Header["kid"] = kid
+		tokenString, err := token.SignedString(key)
+		require.Nil(s.T(), err)
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return req
+	}
+
+	// the key identified by the token is selected
+	keys := tm.SelectKeys(request("current", s.current.Key))
+	require.Len(s.T(), keys, 1)
+	assert.Equal(s.T(), &s.current.Key.PublicKey, keys[0])
+	// no key is selected for the retired and the unknown keys
+	assert.Empty(s.T(), tm.SelectKeys(request("retired", s.retired.Key)))
+	assert.Empty(s.T(), tm.SelectKeys(request("unknown", s.current.Key)))
+	assert.Empty(s.T(), tm.SelectKeys(&http.Request{Header: http.Header{}}))
+
+	// the key is selected as long as it's not retired
+	tm.keyRing.setKeys(&SigningKey{PrivateKey: s.current.PrivateKey, RetireAfter: time.Now().Add(-time.Minute)}, s.staged)
+	assert.Empty(s.T(), tm.SelectKeys(request("current", s.current.Key)))
+}
+
+func (s *TestKeyRingSuite) TestUpdateKeyRing() {
+	legacy := &SigningKey{PrivateKey: s.current.PrivateKey}
+	tm := &tokenManager{
+		publicKeysMap:  map[string]*rsa.PublicKey{},
+		keyRing:        newKeyRing(legacy),
+		configuredKeys: []*SigningKey{legacy},
+	}
+	added := config.ServiceAccountKey{
+		KeyID:      "added",
+		PrivateKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(s.staged.Key)}),
+		NotBefore:  time.Now().Add(-time.Minute),
+	}
+
+	// when a key is added to the key ring
+	err := tm.UpdateKeyRing([]config.ServiceAccountKey{added})
+	// then it signs the tokens and the legacy key is kept
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "added", tm.keyRing.signingKey().KeyID)
+	assert.NotNil(s.T(), tm.PublicKey("current"))
+
+	// when the key is removed from the key ring
+	err = tm.UpdateKeyRing(nil)
+	// then it's no longer published
+	require.Nil(s.T(), err)
+	assert.Nil(s.T(), tm.PublicKey("added"))
+	assert.Equal(s.T(), "current", tm.keyRing.signingKey().KeyID)
+
+	// an invalid key leaves the key ring unchanged
+	err = tm.UpdateKeyRing([]config.ServiceAccountKey{{KeyID: "invalid", PrivateKey: []byte("invalid")}})
+	assert.NotNil(s.T(), err)
+	assert.Equal(s.T(), "current", tm.keyRing.signingKey().KeyID)
+}
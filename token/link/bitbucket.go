@@ -0,0 +1,78 @@
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
+
+	"github.com/satori/go.uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	BitbucketProviderID = "051d7a5e-521b-4423-840a-6e5fbaa6f85d" // Do not change! This ID is used as provider ID in the external token table
+)
+
+// BitbucketEndpoint is the OAuth 2.0 endpoint of Bitbucket Cloud
+var BitbucketEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://bitbucket.org/site/oauth2/authorize",
+	TokenURL: "https://bitbucket.org/site/oauth2/access_token",
+}
+
+type BitbucketIdentityProvider struct {
+	oauth.OauthIdentityProvider
+}
+
+type bitbucketUser struct {
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+}
+
+func NewBitbucketIdentityProvider(clientID string, clientSecret string, scopes string, authURL string) *BitbucketIdentityProvider {
+	provider := &BitbucketIdentityProvider{}
+	provider.ClientID = clientID
+	provider.ClientSecret = clientSecret
+	provider.Endpoint = BitbucketEndpoint
+	provider.RedirectURL = authURL + client.CallbackTokenPath()
+	provider.ScopeStr = scopes
+	provider.Config.Scopes = strings.Split(scopes, " ")
+	provider.ProviderID, _ = uuid.FromString(BitbucketProviderID)
+	provider.ProfileURL = "https://api.bitbucket.org/2.0/user"
+	return provider
+}
+
+func (provider *BitbucketIdentityProvider) ID() uuid.UUID {
+	return provider.ProviderID
+}
+
+func (provider *BitbucketIdentityProvider) Scopes() string {
+	return provider.ScopeStr
+}
+
+func (provider *BitbucketIdentityProvider) TypeName() string {
+	return "bitbucket"
+}
+
+// Profile fetches a user profile from the Identity Provider.
+// The accounts which have no username any more are identified by their nickname.
+func (provider *BitbucketIdentityProvider) Profile(ctx context.Context, token oauth2.Token) (*oauth.UserProfile, error) {
+	body, err := provider.UserProfilePayload(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var u bitbucketUser
+	err = json.Unmarshal(body, &u)
+	if err != nil {
+		return nil, err
+	}
+	userProfile := &oauth.UserProfile{
+		Username: u.Username,
+	}
+	if userProfile.Username == "" {
+		userProfile.Username = u.Nickname
+	}
+	return userProfile, nil
+}
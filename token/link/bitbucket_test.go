@@ -0,0 +1,55 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestBitbucketProviderID(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	_, err := uuid.FromString(BitbucketProviderID)
+	assert.Nil(t, err)
+	assert.Equal(t, "051d7a5e-521b-4423-840a-6e5fbaa6f85d", BitbucketProviderID)
+}
+
+func TestBitbucketProfile(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2.0/user", func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, `{"username":"jdoe","nickname":"johnny"}`)
+	})
+	mux.HandleFunc("/2.0/user/without-username", func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, `{"nickname":"johnny"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	provider := NewBitbucketIdentityProvider("bitbucket-client", "bitbucket-secret", "account repository", "https://auth.openshift.io")
+	assert.Equal(t, "https://api.bitbucket.org/2.0/user", provider.ProfileURL)
+	assert.Equal(t, "bitbucket", provider.TypeName())
+
+	t.Run("username", func(t *testing.T) {
+		provider.ProfileURL = server.URL + "/2.0/user"
+		userProfile, err := provider.Profile(context.Background(), oauth2.Token{AccessToken: "some-token"})
+		require.Nil(t, err)
+		assert.Equal(t, "jdoe", userProfile.Username)
+	})
+
+	t.Run("no username", func(t *testing.T) {
+		provider.ProfileURL = server.URL + "/2.0/user/without-username"
+		userProfile, err := provider.Profile(context.Background(), oauth2.Token{AccessToken: "some-token"})
+		require.Nil(t, err)
+		assert.Equal(t, "johnny", userProfile.Username)
+	})
+}
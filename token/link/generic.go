@@ -0,0 +1,261 @@
+package link
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"golang.org/x/oauth2"
+)
+
+// GenericIdentityProvider is an OAuth2 or OpenID Connect provider defined in the configuration
+type GenericIdentityProvider struct {
+	oauth.OauthIdentityProvider
+	name         string
+	usernamePath []jsonPathStep
+}
+
+// NewGenericIdentityProvider creates a provider from its configuration and its endpoints.
+// The endpoints are the ones of the configuration for the OAuth2 providers, and the discovered ones for the OpenID Connect providers.
+func NewGenericIdentityProvider(config configuration.ExternalProvider, endpoints ProviderEndpoints, authURL string) (*GenericIdentityProvider, error) {
+	usernamePath, err := parseJSONPath(config.UsernamePath)
+	if err != nil {
+		return nil, errs.Wrapf(err, "invalid username path of the external provider %s", config.Name)
+	}
+	providerID, err := uuid.FromString(config.ID)
+	if err != nil {
+		return nil, errs.Wrapf(err, "invalid ID of the external provider %s", config.Name)
+	}
+	provider := &GenericIdentityProvider{name: config.Name, usernamePath: usernamePath}
+	provider.ClientID = config.ClientID
+	provider.ClientSecret = config.ClientSecret
+	provider.Endpoint = oauth2.Endpoint{
+		AuthURL:  endpoints.AuthURL,
+		TokenURL: endpoints.TokenURL,
+	}
+	provider.RedirectURL = authURL + client.CallbackTokenPath()
+	provider.ScopeStr = config.Scopes
+	provider.Config.Scopes = strings.Fields(config.Scopes)
+	provider.ProviderID = providerID
+	provider.ProfileURL = endpoints.ProfileURL
+	return provider, nil
+}
+
+func (provider *GenericIdentityProvider) ID() uuid.UUID {
+	return provider.ProviderID
+}
+
+func (provider *GenericIdentityProvider) Scopes() string {
+	return provider.ScopeStr
+}
+
+func (provider *GenericIdentityProvider) TypeName() string {
+	return provider.name
+}
+
+// Profile fetches a user profile from the Identity Provider and extracts the username with the username path
+func (provider *GenericIdentityProvider) Profile(ctx context.Context, token oauth2.Token) (*oauth.UserProfile, error) {
+	body, err := provider.UserProfilePayload(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	username, err := extractJSONPath(body, provider.usernamePath)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"provider_name": provider.name,
+			"profile_url":   provider.ProfileURL,
+			"err":           err,
+		}, "unable to extract the username from the user profile")
+		return nil, err
+	}
+	return &oauth.UserProfile{
+		Username: username,
+	}, nil
+}
+
+// ProviderEndpoints are the endpoints of an external provider
+type ProviderEndpoints struct {
+	AuthURL    string
+	TokenURL   string
+	ProfileURL string
+}
+
+// oidcDiscovery discovers the endpoints of the OpenID Connect providers from their issuer, and caches them
+type oidcDiscovery struct {
+	client    *http.Client
+	mu        sync.Mutex
+	endpoints map[string]ProviderEndpoints
+}
+
+func newOIDCDiscovery() *oidcDiscovery {
+	return &oidcDiscovery{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		endpoints: map[string]ProviderEndpoints{},
+	}
+}
+
+// providerEndpoints returns the endpoints of the provider. The endpoints which are not configured are discovered from the issuer
+// of the OpenID Connect providers.
+func (d *oidcDiscovery) providerEndpoints(ctx context.Context, config configuration.ExternalProvider) (ProviderEndpoints, error) {
+	endpoints := ProviderEndpoints{
+		AuthURL:    config.AuthURL,
+		TokenURL:   config.TokenURL,
+		ProfileURL: config.ProfileURL,
+	}
+	if config.Type != configuration.ExternalProviderTypeOIDC || (endpoints.AuthURL != "" && endpoints.TokenURL != "" && endpoints.ProfileURL != "") {
+		return endpoints, nil
+	}
+	discovered, err := d.discover(ctx, config.Issuer)
+	if err != nil {
+		return endpoints, err
+	}
+	if endpoints.AuthURL == "" {
+		endpoints.AuthURL = discovered.AuthURL
+	}
+	if endpoints.TokenURL == "" {
+		endpoints.TokenURL = discovered.TokenURL
+	}
+	if endpoints.ProfileURL == "" {
+		endpoints.ProfileURL = discovered.ProfileURL
+	}
+	return endpoints, nil
+}
+
+// discover loads the discovery document of the issuer, unless it has already been loaded
+func (d *oidcDiscovery) discover(ctx context.Context, issuer string) (ProviderEndpoints, error) {
+	d.mu.Lock()
+	endpoints, found := d.endpoints[issuer]
+	d.mu.Unlock()
+	if found {
+		return endpoints, nil
+	}
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequest("GET", discoveryURL, nil)
+	if err != nil {
+		return endpoints, errs.WithStack(err)
+	}
+	res, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"discovery_url": discoveryURL,
+			"err":           err,
+		}, "unable to load the OpenID Connect discovery document")
+		return endpoints, errs.Wrapf(err, "unable to load the OpenID Connect discovery document of %s", issuer)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return endpoints, errs.Errorf("unable to load the OpenID Connect discovery document of %s: %s", issuer, res.Status)
+	}
+	var document struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&document)
+	if err != nil {
+		return endpoints, errs.Wrapf(err, "invalid OpenID Connect discovery document of %s", issuer)
+	}
+	if strings.TrimSuffix(document.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return endpoints, errs.Errorf("the OpenID Connect discovery document of %s is issued by %s", issuer, document.Issuer)
+	}
+	endpoints = ProviderEndpoints{
+		AuthURL:    document.AuthorizationEndpoint,
+		TokenURL:   document.TokenEndpoint,
+		ProfileURL: document.UserinfoEndpoint,
+	}
+	d.mu.Lock()
+	d.endpoints[issuer] = endpoints
+	d.mu.Unlock()
+	return endpoints, nil
+}
+
+// jsonPathStep is a step of a JSONPath: the name of a member of an object, or the index of an element of an array
+type jsonPathStep struct {
+	name  string
+	index int
+}
+
+// parseJSONPath parses the subset of JSONPath made of member names and array indexes, e.g. "$.data.users[0].login".
+// The leading "$" is optional.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, errs.New("empty JSONPath")
+	}
+	var steps []jsonPathStep
+	for _, member := range strings.Split(path, ".") {
+		name := member
+		var indexes []int
+		if bracket := strings.Index(member, "["); bracket >= 0 {
+			name = member[:bracket]
+			for _, index := range strings.Split(strings.TrimSuffix(member[bracket+1:], "]"), "][") {
+				i, err := strconv.Atoi(index)
+				if err != nil || i < 0 {
+					return nil, errs.Errorf("invalid array index in JSONPath '%s'", path)
+				}
+				indexes = append(indexes, i)
+			}
+		}
+		if name == "" && len(indexes) == 0 {
+			return nil, errs.Errorf("empty member name in JSONPath '%s'", path)
+		}
+		if name != "" {
+			steps = append(steps, jsonPathStep{name: name, index: -1})
+		}
+		for _, i := range indexes {
+			steps = append(steps, jsonPathStep{index: i})
+		}
+	}
+	return steps, nil
+}
+
+// extractJSONPath returns the string or number found at the given path of the JSON document
+func extractJSONPath(document []byte, path []jsonPathStep) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return "", errs.Wrap(err, "invalid JSON document")
+	}
+	for _, step := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if step.name == "" {
+				return "", errs.Errorf("expected an array at index %d", step.index)
+			}
+			value = v[step.name]
+		case []interface{}:
+			if step.name != "" || step.index >= len(v) {
+				return "", errs.Errorf("no element %s%d in the array", step.name, step.index)
+			}
+			value = v[step.index]
+		default:
+			return "", errs.Errorf("no member %s in the document", step.name)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return "", errs.New("the value found in the document is empty")
+		}
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", errs.Errorf("expected a string or a number in the document, found %T", value)
+	}
+}
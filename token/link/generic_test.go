@@ -0,0 +1,199 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestExtractJSONPath(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	document := []byte(`{"login":"jdoe","id":42,"data":{"users":[{"name":"first"},{"name":"second"}]},"empty":""}`)
+
+	for path, expected := range map[string]string{
+		"$.login":               "jdoe",
+		"login":                 "jdoe",
+		"$.id":                  "42",
+		"$.data.users[1].name":  "second",
+		"$.data.users[0].name":  "first",
+		"data.users[0].name":    "first",
+		"$.data.users[0]['x']":  "",
+		"$.data.users[2].name":  "",
+		"$.missing":             "",
+		"$.empty":               "",
+		"$.data":                "",
+		"$.login.name":          "",
+		"$.data.users.name":     "",
+		"$.data[0]":             "",
+		"$.data.users[-1].name": "",
+	} {
+		t.Run(path, func(t *testing.T) {
+			steps, err := parseJSONPath(path)
+			if err != nil {
+				assert.Empty(t, expected)
+				return
+			}
+			value, err := extractJSONPath(document, steps)
+			if expected == "" {
+				assert.NotNil(t, err)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, expected, value)
+			}
+		})
+	}
+
+	t.Run("empty path", func(t *testing.T) {
+		_, err := parseJSONPath("$")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("invalid document", func(t *testing.T) {
+		steps, err := parseJSONPath("$.login")
+		require.Nil(t, err)
+		_, err = extractJSONPath([]byte("not json"), steps)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGenericProvider(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	profileServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer some-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"user":{"login":"jdoe"}}`)
+	}))
+	defer profileServer.Close()
+	config := configuration.ExternalProvider{
+		ID:           "2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11",
+		Name:         "gitea",
+		Type:         configuration.ExternalProviderTypeOAuth2,
+		ClientID:     "gitea-client",
+		ClientSecret: "gitea-secret",
+		Scopes:       "read:user write:repo",
+		UsernamePath: "$.user.login",
+	}
+	endpoints := ProviderEndpoints{
+		AuthURL:    "https://gitea.example.com/login/oauth/authorize",
+		TokenURL:   "https://gitea.example.com/login/oauth/access_token",
+		ProfileURL: profileServer.URL,
+	}
+
+	provider, err := NewGenericIdentityProvider(config, endpoints, "https://auth.openshift.io")
+	require.Nil(t, err)
+	assert.Equal(t, "2f1d4c4b-8f0d-4c0e-9a39-7b3d2b0a5c11", provider.ID().String())
+	assert.Equal(t, "gitea", provider.TypeName())
+	assert.Equal(t, "read:user write:repo", provider.Scopes())
+	assert.Equal(t, []string{"read:user", "write:repo"}, provider.Config.Scopes)
+	assert.Equal(t, "https://gitea.example.com/login/oauth/access_token", provider.Endpoint.TokenURL)
+	assert.Equal(t, "https://auth.openshift.io/api/token/link/callback", provider.RedirectURL)
+
+	profile, err := provider.Profile(context.Background(), oauth2.Token{AccessToken: "some-token"})
+	require.Nil(t, err)
+	assert.Equal(t, "jdoe", profile.Username)
+
+	t.Run("invalid username path", func(t *testing.T) {
+		invalidConfig := config
+		invalidConfig.UsernamePath = "$.user[x]"
+		_, err := NewGenericIdentityProvider(invalidConfig, endpoints, "https://auth.openshift.io")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("username not found", func(t *testing.T) {
+		otherConfig := config
+		otherConfig.UsernamePath = "$.user.name"
+		otherProvider, err := NewGenericIdentityProvider(otherConfig, endpoints, "https://auth.openshift.io")
+		require.Nil(t, err)
+		_, err = otherProvider.Profile(context.Background(), oauth2.Token{AccessToken: "some-token"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	requests := 0
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer := server.URL
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprintf(rw, `{"issuer":"%[1]s","authorization_endpoint":"%[1]s/authorize","token_endpoint":"%[1]s/token","userinfo_endpoint":"%[1]s/userinfo"}`, issuer)
+	})
+	// the discovery document of another issuer
+	mux.HandleFunc("/realms/other/.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, `{"issuer":"https://sso.example.com","authorization_endpoint":"https://sso.example.com/authorize"}`)
+	})
+	config := configuration.ExternalProvider{
+		Type:   configuration.ExternalProviderTypeOIDC,
+		Issuer: issuer,
+	}
+
+	t.Run("endpoints discovered", func(t *testing.T) {
+		discovery := newOIDCDiscovery()
+		endpoints, err := discovery.providerEndpoints(context.Background(), config)
+		require.Nil(t, err)
+		assert.Equal(t, ProviderEndpoints{AuthURL: issuer + "/authorize", TokenURL: issuer + "/token", ProfileURL: issuer + "/userinfo"}, endpoints)
+		// the discovery document is cached
+		_, err = discovery.providerEndpoints(context.Background(), config)
+		require.Nil(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("configured endpoints override discovered ones", func(t *testing.T) {
+		configured := config
+		configured.ProfileURL = "https://sso.example.com/profile"
+		endpoints, err := newOIDCDiscovery().providerEndpoints(context.Background(), configured)
+		require.Nil(t, err)
+		assert.Equal(t, issuer+"/token", endpoints.TokenURL)
+		assert.Equal(t, "https://sso.example.com/profile", endpoints.ProfileURL)
+	})
+
+	t.Run("not discovered when all endpoints are configured", func(t *testing.T) {
+		configured := configuration.ExternalProvider{
+			Type:       configuration.ExternalProviderTypeOIDC,
+			Issuer:     "http://localhost:0",
+			AuthURL:    "https://sso.example.com/authorize",
+			TokenURL:   "https://sso.example.com/token",
+			ProfileURL: "https://sso.example.com/userinfo",
+		}
+		endpoints, err := newOIDCDiscovery().providerEndpoints(context.Background(), configured)
+		require.Nil(t, err)
+		assert.Equal(t, "https://sso.example.com/token", endpoints.TokenURL)
+	})
+
+	t.Run("issuer with a trailing slash", func(t *testing.T) {
+		trailingSlash := config
+		trailingSlash.Issuer = issuer + "/"
+		_, err := newOIDCDiscovery().providerEndpoints(context.Background(), trailingSlash)
+		assert.Nil(t, err)
+	})
+
+	t.Run("other issuer", func(t *testing.T) {
+		otherIssuer := config
+		otherIssuer.Issuer = issuer + "/realms/other"
+		_, err := newOIDCDiscovery().providerEndpoints(context.Background(), otherIssuer)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("no discovery document", func(t *testing.T) {
+		missing := config
+		missing.Issuer = server.URL + "/realms/missing"
+		_, err := newOIDCDiscovery().providerEndpoints(context.Background(), missing)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,72 @@
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
+
+	"github.com/satori/go.uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	GitLabProviderID = "7134f7fd-ab9f-4f16-a89e-2c072b241b35" // Do not change! This ID is used as provider ID in the external token table
+)
+
+type GitLabIdentityProvider struct {
+	oauth.OauthIdentityProvider
+}
+
+type gitLabUser struct {
+	Username string `json:"username"`
+}
+
+// NewGitLabIdentityProvider creates a provider for the GitLab instance at the given URL (https://gitlab.com or a self-hosted instance)
+func NewGitLabIdentityProvider(gitLabURL string, clientID string, clientSecret string, scopes string, authURL string) *GitLabIdentityProvider {
+	provider := &GitLabIdentityProvider{}
+	provider.ClientID = clientID
+	provider.ClientSecret = clientSecret
+	provider.Endpoint = oauth2.Endpoint{
+		AuthURL:  fmt.Sprintf("%s/oauth/authorize", gitLabURL),
+		TokenURL: fmt.Sprintf("%s/oauth/token", gitLabURL),
+	}
+	provider.RedirectURL = authURL + client.CallbackTokenPath()
+	provider.ScopeStr = scopes
+	provider.Config.Scopes = strings.Split(scopes, " ")
+	provider.ProviderID, _ = uuid.FromString(GitLabProviderID)
+	provider.ProfileURL = fmt.Sprintf("%s/api/v4/user", gitLabURL)
+	return provider
+}
+
+func (provider *GitLabIdentityProvider) ID() uuid.UUID {
+	return provider.ProviderID
+}
+
+func (provider *GitLabIdentityProvider) Scopes() string {
+	return provider.ScopeStr
+}
+
+func (provider *GitLabIdentityProvider) TypeName() string {
+	return "gitlab"
+}
+
+// Profile fetches a user profile from the Identity Provider
+func (provider *GitLabIdentityProvider) Profile(ctx context.Context, token oauth2.Token) (*oauth.UserProfile, error) {
+	body, err := provider.UserProfilePayload(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var u gitLabUser
+	err = json.Unmarshal(body, &u)
+	if err != nil {
+		return nil, err
+	}
+	userProfile := &oauth.UserProfile{
+		Username: u.Username,
+	}
+	return userProfile, nil
+}
@@ -0,0 +1,47 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestGitLabProviderID(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	_, err := uuid.FromString(GitLabProviderID)
+	assert.Nil(t, err)
+	assert.Equal(t, "7134f7fd-ab9f-4f16-a89e-2c072b241b35", GitLabProviderID)
+}
+
+func TestGitLabProviderSelfHosted(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v4/user" || req.Header.Get("Authorization") != "Bearer some-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"id":42,"username":"jdoe","name":"John Doe"}`)
+	}))
+	defer server.Close()
+
+	provider := NewGitLabIdentityProvider(server.URL, "gitlab-client", "gitlab-secret", "api read_user", "https://auth.openshift.io")
+	assert.Equal(t, server.URL+"/oauth/authorize", provider.Endpoint.AuthURL)
+	assert.Equal(t, server.URL+"/oauth/token", provider.Endpoint.TokenURL)
+	assert.Equal(t, []string{"api", "read_user"}, provider.Config.Scopes)
+	assert.Equal(t, "gitlab", provider.TypeName())
+
+	profile, err := provider.Profile(context.Background(), oauth2.Token{AccessToken: "some-token"})
+	require.Nil(t, err)
+	assert.Equal(t, "jdoe", profile.Username)
+}
@@ -9,15 +9,20 @@ import (
 	"strings"
 
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/audit"
+	"github.com/fabric8-services/fabric8-auth/auth"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	errs "github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/metric"
+	"github.com/fabric8-services/fabric8-auth/outbox"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/token/oauth"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
 
 	"github.com/goadesign/goa"
 	"github.com/satori/go.uuid"
+	netcontext "golang.org/x/net/context"
 	"golang.org/x/oauth2"
 )
 
@@ -25,6 +30,8 @@ const (
 	identityIDParam = "identity_id"
 	forParam        = "for"
 	nextParam       = "link_next"
+	codeParam       = "code"
+	stateParam      = "state"
 )
 
 // ProviderConfig represents OAuth2 config for linking accounts
@@ -33,12 +40,15 @@ type ProviderConfig interface {
 	ID() uuid.UUID
 	Scopes() string
 	TypeName() string
+	// TokenSource returns a token source refreshing the given token with its refresh token when it's expired
+	TokenSource(ctx netcontext.Context, token *oauth2.Token) oauth2.TokenSource
 }
 
 // LinkOAuthService represents OAuth service interface for linking accounts
 type LinkOAuthService interface {
-	ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string) (string, error)
+	ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string, codeChallenge *oauth.CodeChallenge) (string, error)
 	Callback(ctx context.Context, req *goa.RequestData, state string, code string) (string, error)
+	CompleteLink(ctx context.Context, req *goa.RequestData, state string, code string, codeVerifier string) (string, error)
 }
 
 type LinkConfig interface {
@@ -46,8 +56,16 @@ type LinkConfig interface {
 	GetGitHubClientID() string
 	GetGitHubClientDefaultScopes() string
 	GetGitHubClientSecret() string
+	GetGitLabURL() string
+	GetGitLabClientID() string
+	GetGitLabClientDefaultScopes() string
+	GetGitLabClientSecret() string
+	GetBitbucketClientID() string
+	GetBitbucketClientDefaultScopes() string
+	GetBitbucketClientSecret() string
 	IsTLSInsecureSkipVerify() bool
 	GetOSOClusters() map[string]configuration.OSOCluster
+	GetExternalProviders() []configuration.ExternalProvider
 }
 
 // OauthProviderFactory represents oauth provider factory
@@ -58,13 +76,15 @@ type OauthProviderFactory interface {
 // NewOauthProviderFactory returns the default Oauth provider factory.
 func NewOauthProviderFactory(config LinkConfig) *OauthProviderFactoryService {
 	service := &OauthProviderFactoryService{
-		config: config,
+		config:    config,
+		discovery: newOIDCDiscovery(),
 	}
 	return service
 }
 
 type OauthProviderFactoryService struct {
-	config LinkConfig
+	config    LinkConfig
+	discovery *oidcDiscovery
 }
 
 // LinkService represents service for linking accounts
@@ -84,8 +104,9 @@ func NewLinkServiceWithFactory(config LinkConfig, db application.DB, factory Oau
 	return service
 }
 
-// ProviderLocation returns a URL to OAuth 2.0 provider's consent page to be used to initiate account linking
-func (service *LinkService) ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string) (string, error) {
+// ProviderLocation returns a URL to OAuth 2.0 provider's consent page to be used to initiate account linking.
+// The code challenge of a public client is saved with the state, the client will have to send the code verifier to complete the linking.
+func (service *LinkService) ProviderLocation(ctx context.Context, req *goa.RequestData, identityID string, forResource string, redirectURL string, codeChallenge *oauth.CodeChallenge) (string, error) {
 	// We need to save the "identityID" and "for" as params in the redirect location URL so we don't lose them when redirect to the provider for auth and back to auth.
 	linkURL, err := url.Parse(redirectURL)
 	if err != nil {
@@ -114,7 +135,7 @@ func (service *LinkService) ProviderLocation(ctx context.Context, req *goa.Reque
 		return "", err
 	}
 	stateID := uuid.NewV4()
-	err = oauth.SaveReferrer(ctx, service.db, stateID, redirectURL, service.config.GetValidRedirectURLs())
+	err = oauth.SaveReferrerWithCodeChallenge(ctx, service.db, stateID, redirectURL, service.config.GetValidRedirectURLs(), codeChallenge)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"redirect_url": redirectURL,
@@ -127,18 +148,59 @@ func (service *LinkService) ProviderLocation(ctx context.Context, req *goa.Reque
 	return oauthProvider.AuthCodeURL(stateID.String(), oauth2.AccessTypeOnline), nil
 }
 
-// Callback returns a redirect URL after callback from an external oauth2 resource provider such as GitHub during user's account linking
+// Callback returns a redirect URL after callback from an external oauth2 resource provider such as GitHub during user's account linking.
+// If the public client sent a code challenge then the client is redirected with the code and a new state, and the linking
+// is completed when the client sends them to CompleteLink with the code verifier.
 func (service *LinkService) Callback(ctx context.Context, req *goa.RequestData, state string, code string) (string, error) {
-	// validate known state
-	knownReferrer, err := oauth.LoadReferrer(ctx, service.db, state)
+	stateReference, err := service.loadStateReference(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	codeChallenge := oauth.StateCodeChallenge(*stateReference)
+	if codeChallenge != nil {
+		return service.redirectToPublicClient(ctx, stateReference.Referrer, code, *codeChallenge)
+	}
+	return service.link(ctx, req, state, code, stateReference.Referrer, false)
+}
+
+// CompleteLink completes the account linking of a public client with the code and the state it was redirected with
+// by the callback, and the code verifier of the code challenge it sent to the link request.
+// The public client is redirected to the referrer even if other resources are left to link, since each
+// authorization request needs a new code challenge: the client sends a new link request for them.
+func (service *LinkService) CompleteLink(ctx context.Context, req *goa.RequestData, state string, code string, codeVerifier string) (string, error) {
+	stateReference, err := service.loadStateReference(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	codeChallenge := oauth.StateCodeChallenge(*stateReference)
+	if codeChallenge == nil {
+		return "", errs.NewBadParameterError("state", state).Expected("state of a link request with a code challenge")
+	}
+	if !codeChallenge.Verify(codeVerifier) {
+		log.Warn(ctx, map[string]interface{}{
+			"state": state,
+		}, "the code verifier doesn't match the code challenge")
+		return "", errs.NewUnauthorizedError("invalid code verifier")
+	}
+	return service.link(ctx, req, state, code, stateReference.Referrer, true)
+}
+
+// loadStateReference loads the state reference, which can't be used again
+func (service *LinkService) loadStateReference(ctx context.Context, state string) (*auth.OauthStateReference, error) {
+	stateReference, err := oauth.LoadStateReference(ctx, service.db, state)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"state": state,
 			"err":   err,
 		}, "can't load referrer by state")
-		return "", err
+		return nil, err
 	}
+	return stateReference, nil
+}
 
+// link exchanges the code for a token of the provider and saves it, then returns the location of the provider
+// for the next resource to link if any, or the referrer
+func (service *LinkService) link(ctx context.Context, req *goa.RequestData, state string, code string, knownReferrer string, publicClient bool) (string, error) {
 	referrerURL, err := url.Parse(knownReferrer)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -162,6 +224,14 @@ func (service *LinkService) Callback(ctx context.Context, req *goa.RequestData,
 	if err != nil {
 		return "", err
 	}
+	linked := false
+	defer func() {
+		metric.RecordExternalTokenOperation(metric.ExternalTokenLink, oauthProvider.TypeName(), linked)
+		// a failure to record the event must not change the response, so the error is only logged by the repository
+		audit.Record(ctx, service.db.AuditEvents(), audit.ExternalTokenLink, identityUUID, oauthProvider.TypeName(), audit.OutcomeOf(linked), audit.Details{
+			"provider_id": oauthProvider.ID(),
+		})
+	}()
 
 	if service.config.IsTLSInsecureSkipVerify() {
 		// For testing only.
@@ -205,10 +275,22 @@ func (service *LinkService) Callback(ctx context.Context, req *goa.RequestData,
 		if err != nil {
 			return err
 		}
+		err = outbox.RecordEvent(ctx, appl.OutboxEvents(), outbox.IdentityLinked, identityUUID, outbox.ExternalAccount{
+			IdentityID:   identityUUID,
+			ProviderID:   oauthProvider.ID(),
+			ProviderName: oauthProvider.TypeName(),
+			Username:     userProfile.Username,
+			Scope:        oauthProvider.Scopes(),
+		})
+		if err != nil {
+			return err
+		}
 		if len(tokens) > 0 {
 			// It was re-linking. Overwrite the existing link.
 			externalToken := tokens[0]
-			externalToken.Token = providerToken.AccessToken
+			// the refresh token of the previous link must not be kept if the provider doesn't issue a new one
+			externalToken.RefreshToken = ""
+			externalToken.UpdateFromOAuth2Token(providerToken)
 			externalToken.Username = userProfile.Username
 			err = appl.ExternalTokens().Save(ctx, &externalToken)
 			if err == nil {
@@ -221,12 +303,12 @@ func (service *LinkService) Callback(ctx context.Context, req *goa.RequestData,
 			return err
 		}
 		externalToken := provider.ExternalToken{
-			Token:      providerToken.AccessToken,
 			IdentityID: identityUUID,
 			Scope:      oauthProvider.Scopes(),
 			ProviderID: oauthProvider.ID(),
 			Username:   userProfile.Username,
 		}
+		externalToken.UpdateFromOAuth2Token(providerToken)
 		err = appl.ExternalTokens().Create(ctx, &externalToken)
 		if err == nil {
 			log.Info(ctx, map[string]interface{}{
@@ -246,15 +328,35 @@ func (service *LinkService) Callback(ctx context.Context, req *goa.RequestData,
 		}, "failed to save token")
 		return "", err
 	}
+	linked = true
 
 	nextResource := referrerURL.Query().Get(nextParam)
-	if nextResource != "" {
-		return service.ProviderLocation(ctx, req, identityID, nextResource, knownReferrer)
+	if nextResource != "" && !publicClient {
+		return service.ProviderLocation(ctx, req, identityID, nextResource, knownReferrer, nil)
 	}
 
 	return knownReferrer, nil
 }
 
+// redirectToPublicClient saves a new state with the code challenge and returns the referrer with the code
+// and the new state, which the public client posts to the callback with its code verifier
+func (service *LinkService) redirectToPublicClient(ctx context.Context, knownReferrer string, code string, codeChallenge oauth.CodeChallenge) (string, error) {
+	referrerURL, err := url.Parse(knownReferrer)
+	if err != nil {
+		return "", err
+	}
+	stateID := uuid.NewV4()
+	err = oauth.SaveReferrerWithCodeChallenge(ctx, service.db, stateID, knownReferrer, service.config.GetValidRedirectURLs(), &codeChallenge)
+	if err != nil {
+		return "", err
+	}
+	parameters := referrerURL.Query()
+	parameters.Set(codeParam, code)
+	parameters.Set(stateParam, stateID.String())
+	referrerURL.RawQuery = parameters.Encode()
+	return referrerURL.String(), nil
+}
+
 // NewOauthProvider creates a new oauth provider for the given resource URL
 func (service *OauthProviderFactoryService) NewOauthProvider(ctx context.Context, req *goa.RequestData, forResource string) (ProviderConfig, error) {
 	authURL := rest.AbsoluteURL(req, "")
@@ -265,14 +367,36 @@ func (service *OauthProviderFactoryService) NewOauthProvider(ctx context.Context
 	if resourceURL.Host == "github.com" {
 		return NewGitHubIdentityProvider(service.config.GetGitHubClientID(), service.config.GetGitHubClientSecret(), service.config.GetGitHubClientDefaultScopes(), authURL), nil
 	}
+	// GitLab and Bitbucket are used only if they are configured
+	if service.config.GetGitLabClientID() != "" {
+		gitLabURL, err := url.Parse(service.config.GetGitLabURL())
+		if err != nil {
+			return nil, errs.NewInternalError(ctx, err)
+		}
+		if resourceURL.Host == gitLabURL.Host {
+			return NewGitLabIdentityProvider(service.config.GetGitLabURL(), service.config.GetGitLabClientID(), service.config.GetGitLabClientSecret(), service.config.GetGitLabClientDefaultScopes(), authURL), nil
+		}
+	}
+	if service.config.GetBitbucketClientID() != "" && resourceURL.Host == "bitbucket.org" {
+		return NewBitbucketIdentityProvider(service.config.GetBitbucketClientID(), service.config.GetBitbucketClientSecret(), service.config.GetBitbucketClientDefaultScopes(), authURL), nil
+	}
 	clusters := service.config.GetOSOClusters()
 	for apiURL, cluster := range clusters {
 		if strings.HasPrefix(forResource, apiURL) {
 			return NewOpenShiftIdentityProvider(cluster, authURL)
 		}
 	}
+	for _, externalProvider := range service.config.GetExternalProviders() {
+		if externalProvider.MatchesResource(forResource) {
+			endpoints, err := service.discovery.providerEndpoints(ctx, externalProvider)
+			if err != nil {
+				return nil, errs.NewInternalError(ctx, err)
+			}
+			return NewGenericIdentityProvider(externalProvider, endpoints, authURL)
+		}
+	}
 	log.Error(ctx, map[string]interface{}{
 		"for": forResource,
 	}, "unable to find oauth config for resource")
-	return nil, errs.NewBadParameterError("for", forResource).Expected("URL to a github.com or openshift.com resource")
+	return nil, errs.NewBadParameterError("for", forResource).Expected("URL to a github.com, gitlab.com, bitbucket.org, openshift.com or configured external provider resource")
 }
@@ -17,6 +17,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/resource"
 	"github.com/fabric8-services/fabric8-auth/test"
 	. "github.com/fabric8-services/fabric8-auth/token/link"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
 
 	"github.com/goadesign/goa"
@@ -63,12 +64,12 @@ func (s *LinkTestSuite) TestInvalidRedirectFails() {
 	}()
 	os.Setenv("AUTH_REDIRECT_VALID", configuration.DefaultValidRedirectURLs)
 
-	_, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://some.host.com")
+	_, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://some.host.com", nil)
 	require.NotNil(s.T(), err)
 }
 
 func (s *LinkTestSuite) TestUnknownProviderFails() {
-	_, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://unknown.provider.com/org/repo", "https://openshift.io/home")
+	_, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://unknown.provider.com/org/repo", "https://openshift.io/home", nil)
 	require.NotNil(s.T(), err)
 }
 
@@ -78,26 +79,72 @@ func (s *LinkTestSuite) TestCallbackWithUnknownStateFails() {
 }
 
 func (s *LinkTestSuite) TestGitHubProviderRedirectsToAuthorize() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", nil)
 	require.Nil(s.T(), err)
 	require.True(s.T(), strings.HasPrefix(location, "https://github.com/login/oauth/authorize"))
 	require.NotEmpty(s.T(), s.stateParam(location))
 }
 
 func (s *LinkTestSuite) TestOSOProviderRedirectsToAuthorize() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), s.Configuration.GetOpenShiftClientApiUrl(), "https://openshift.io/home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), s.Configuration.GetOpenShiftClientApiUrl(), "https://openshift.io/home", nil)
 	require.Nil(s.T(), err)
 	require.Contains(s.T(), location, fmt.Sprintf("%s/oauth/authorize", s.Configuration.GetOpenShiftClientApiUrl()))
 	require.NotEmpty(s.T(), s.stateParam(location))
 }
 
 func (s *LinkTestSuite) TestMultipleProvidersRedirectsToAuthorize() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo,https://openshift.io/home", "https://openshift.io/_home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo,https://openshift.io/home", "https://openshift.io/_home", nil)
 	require.Nil(s.T(), err)
 	require.True(s.T(), strings.HasPrefix(location, "https://github.com/login/oauth/authorize"))
 	require.NotEmpty(s.T(), s.stateParam(location))
 }
 
+func (s *LinkTestSuite) TestGitLabProviderRedirectsToAuthorize() {
+	// given
+	config := nativeProvidersConfig{ConfigurationData: s.Configuration, gitLabURL: "https://gitlab.com"}
+	linkService := NewLinkServiceWithFactory(config, s.Application, NewOauthProviderFactory(config))
+	// when
+	location, err := linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://gitlab.com/org/repo", "https://openshift.io/home", nil)
+	// then
+	require.Nil(s.T(), err)
+	require.True(s.T(), strings.HasPrefix(location, "https://gitlab.com/oauth/authorize"))
+	require.Contains(s.T(), location, "client_id=gitlab-client")
+	require.NotEmpty(s.T(), s.stateParam(location))
+}
+
+func (s *LinkTestSuite) TestSelfHostedGitLabProviderRedirectsToAuthorize() {
+	// given
+	config := nativeProvidersConfig{ConfigurationData: s.Configuration, gitLabURL: "https://gitlab.example.com"}
+	linkService := NewLinkServiceWithFactory(config, s.Application, NewOauthProviderFactory(config))
+	// when
+	location, err := linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://gitlab.example.com/org/repo", "https://openshift.io/home", nil)
+	// then
+	require.Nil(s.T(), err)
+	require.True(s.T(), strings.HasPrefix(location, "https://gitlab.example.com/oauth/authorize"))
+	_, err = linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://gitlab.com/org/repo", "https://openshift.io/home", nil)
+	require.NotNil(s.T(), err)
+}
+
+func (s *LinkTestSuite) TestBitbucketProviderRedirectsToAuthorize() {
+	// given
+	config := nativeProvidersConfig{ConfigurationData: s.Configuration, gitLabURL: "https://gitlab.com"}
+	linkService := NewLinkServiceWithFactory(config, s.Application, NewOauthProviderFactory(config))
+	// when
+	location, err := linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://bitbucket.org/org/repo", "https://openshift.io/home", nil)
+	// then
+	require.Nil(s.T(), err)
+	require.True(s.T(), strings.HasPrefix(location, "https://bitbucket.org/site/oauth2/authorize"))
+	require.Contains(s.T(), location, "client_id=bitbucket-client")
+	require.NotEmpty(s.T(), s.stateParam(location))
+}
+
+func (s *LinkTestSuite) TestNotConfiguredProvidersFail() {
+	_, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://gitlab.com/org/repo", "https://openshift.io/home", nil)
+	require.NotNil(s.T(), err)
+	_, err = s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://bitbucket.org/org/repo", "https://openshift.io/home", nil)
+	require.NotNil(s.T(), err)
+}
+
 func (s *LinkTestSuite) stateParam(location string) string {
 	locationURL, err := url.Parse(location)
 	require.Nil(s.T(), err)
@@ -109,7 +156,7 @@ func (s *LinkTestSuite) stateParam(location string) string {
 }
 
 func (s *LinkTestSuite) TestCallbackFailsForUnknownIdentity() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, uuid.NewV4().String(), "https://github.com/org/repo", "https://openshift.io/home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, uuid.NewV4().String(), "https://github.com/org/repo", "https://openshift.io/home", nil)
 	require.Nil(s.T(), err)
 	state := s.stateParam(location)
 
@@ -121,7 +168,7 @@ func (s *LinkTestSuite) TestCallbackFailsForUnknownIdentity() {
 }
 
 func (s *LinkTestSuite) TestProviderSavesTokenOK() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", nil)
 	require.Nil(s.T(), err)
 	state := s.stateParam(location)
 
@@ -136,8 +183,95 @@ func (s *LinkTestSuite) TestProviderSavesTokenOK() {
 	s.checkToken(GitHubProviderID, token)
 }
 
+func (s *LinkTestSuite) TestProviderSavesTokenWithCodeVerifierOK() {
+	// RFC 7636 Appendix B
+	codeVerifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	codeChallenge := &oauth.CodeChallenge{Challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", Method: oauth.CodeChallengeMethodS256}
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", codeChallenge)
+	require.Nil(s.T(), err)
+	state := s.stateParam(location)
+
+	token := uuid.NewV4().String()
+	linkServiceWithDummyProviderFactory := NewLinkServiceWithFactory(s.Configuration, gormapplication.NewGormDB(s.DB), &test.DummyProviderFactory{Token: token, Config: s.Configuration})
+
+	// The public client is redirected with the code and a new state
+	code := uuid.NewV4().String()
+	callbackLocation, err := linkServiceWithDummyProviderFactory.Callback(context.Background(), s.requestData, state, code)
+	require.Nil(s.T(), err)
+	callbackURL, err := url.Parse(callbackLocation)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), "openshift.io", callbackURL.Host)
+	require.Equal(s.T(), code, callbackURL.Query().Get("code"))
+	newState := callbackURL.Query().Get("state")
+	require.NotEmpty(s.T(), newState)
+	require.NotEqual(s.T(), state, newState)
+
+	// The state can't be reused
+	_, err = linkServiceWithDummyProviderFactory.CompleteLink(context.Background(), s.requestData, state, code, codeVerifier)
+	require.NotNil(s.T(), err)
+
+	// The public client completes the linking with the code verifier
+	completeLocation, err := linkServiceWithDummyProviderFactory.CompleteLink(context.Background(), s.requestData, newState, code, codeVerifier)
+	require.Nil(s.T(), err)
+	completeURL, err := url.Parse(completeLocation)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), "openshift.io", completeURL.Host)
+	require.Equal(s.T(), "/home", completeURL.Path)
+
+	s.checkToken(GitHubProviderID, token)
+}
+
+func (s *LinkTestSuite) TestProviderWithInvalidCodeVerifierFails() {
+	codeChallenge := &oauth.CodeChallenge{Challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", Method: oauth.CodeChallengeMethodS256}
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", codeChallenge)
+	require.Nil(s.T(), err)
+	state := s.stateParam(location)
+
+	linkServiceWithDummyProviderFactory := NewLinkServiceWithFactory(s.Configuration, gormapplication.NewGormDB(s.DB), &test.DummyProviderFactory{Token: uuid.NewV4().String(), Config: s.Configuration})
+
+	code := uuid.NewV4().String()
+	callbackLocation, err := linkServiceWithDummyProviderFactory.Callback(context.Background(), s.requestData, state, code)
+	require.Nil(s.T(), err)
+	_, err = linkServiceWithDummyProviderFactory.CompleteLink(context.Background(), s.requestData, s.stateParam(callbackLocation), code, "wrong-verifier-wrong-verifier-wrong-verifier-wrong")
+	require.NotNil(s.T(), err)
+}
+
+func (s *LinkTestSuite) TestCompleteLinkWithoutCodeChallengeFails() {
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", nil)
+	require.Nil(s.T(), err)
+
+	linkServiceWithDummyProviderFactory := NewLinkServiceWithFactory(s.Configuration, gormapplication.NewGormDB(s.DB), &test.DummyProviderFactory{Token: uuid.NewV4().String(), Config: s.Configuration})
+
+	_, err = linkServiceWithDummyProviderFactory.CompleteLink(context.Background(), s.requestData, s.stateParam(location), uuid.NewV4().String(), "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	require.NotNil(s.T(), err)
+}
+
+func (s *LinkTestSuite) TestPublicClientLinksMultipleResourcesWithNewCodeChallenges() {
+	// RFC 7636 Appendix B
+	codeVerifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	codeChallenge := &oauth.CodeChallenge{Challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", Method: oauth.CodeChallengeMethodS256}
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo,https://api.starter-us-east-2.openshift.com", "https://openshift.io/_home", codeChallenge)
+	require.Nil(s.T(), err)
+
+	token := uuid.NewV4().String()
+	linkServiceWithDummyProviderFactory := NewLinkServiceWithFactory(s.Configuration, gormapplication.NewGormDB(s.DB), &test.DummyProviderFactory{Token: token, Config: s.Configuration})
+	code := uuid.NewV4().String()
+	callbackLocation, err := linkServiceWithDummyProviderFactory.Callback(context.Background(), s.requestData, s.stateParam(location), code)
+	require.Nil(s.T(), err)
+	completeLocation, err := linkServiceWithDummyProviderFactory.CompleteLink(context.Background(), s.requestData, s.stateParam(callbackLocation), code, codeVerifier)
+	require.Nil(s.T(), err)
+	s.checkToken(GitHubProviderID, token)
+
+	// The public client is not redirected to OSO with the same code challenge, it's given the resources left to link instead
+	completeURL, err := url.Parse(completeLocation)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), "openshift.io", completeURL.Host)
+	require.Equal(s.T(), "/_home", completeURL.Path)
+	require.Equal(s.T(), "https://api.starter-us-east-2.openshift.com", completeURL.Query().Get("link_next"))
+}
+
 func (s *LinkTestSuite) TestProviderSavesTokenWithUnavailableProfileFails() {
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo", "https://openshift.io/home", nil)
 	require.Nil(s.T(), err)
 	state := s.stateParam(location)
 
@@ -152,7 +286,7 @@ func (s *LinkTestSuite) TestProviderSavesTokenWithUnavailableProfileFails() {
 
 func (s *LinkTestSuite) TestProviderSavesTokensForMultipleResources() {
 	// Redirect to GitHub first
-	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo,https://api.starter-us-east-2.openshift.com", "https://openshift.io/_home")
+	location, err := s.linkService.ProviderLocation(context.Background(), s.requestData, s.testIdentity.ID.String(), "https://github.com/org/repo,https://api.starter-us-east-2.openshift.com", "https://openshift.io/_home", nil)
 	require.Nil(s.T(), err)
 	locationURL, err := url.Parse(location)
 	require.Nil(s.T(), err)
@@ -195,3 +329,21 @@ func (s *LinkTestSuite) checkToken(providerID string, expectedToken string) {
 	require.Equal(s.T(), expectedToken, tokens[0].Token)
 	require.Equal(s.T(), expectedToken+"testuser", tokens[0].Username)
 }
+
+// nativeProvidersConfig configures the GitLab and Bitbucket providers, which can't be used with the default configuration
+type nativeProvidersConfig struct {
+	*configuration.ConfigurationData
+	gitLabURL string
+}
+
+func (c nativeProvidersConfig) GetGitLabURL() string {
+	return c.gitLabURL
+}
+
+func (c nativeProvidersConfig) GetGitLabClientID() string {
+	return "gitlab-client"
+}
+
+func (c nativeProvidersConfig) GetBitbucketClientID() string {
+	return "bitbucket-client"
+}
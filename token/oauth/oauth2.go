@@ -82,6 +82,11 @@ func (provider *OauthIdentityProvider) UserProfilePayload(ctx context.Context, t
 
 // SaveReferrer validates referrer and saves it in DB
 func SaveReferrer(ctx context.Context, db application.DB, state uuid.UUID, referrer string, validReferrerURL string) error {
+	return SaveReferrerWithCodeChallenge(ctx, db, state, referrer, validReferrerURL, nil)
+}
+
+// SaveReferrerWithCodeChallenge validates referrer and saves it in DB with the code challenge of the public client, if any
+func SaveReferrerWithCodeChallenge(ctx context.Context, db application.DB, state uuid.UUID, referrer string, validReferrerURL string, codeChallenge *CodeChallenge) error {
 	matched, err := regexp.MatchString(validReferrerURL, referrer)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
@@ -104,14 +109,22 @@ func SaveReferrer(ctx context.Context, db application.DB, state uuid.UUID, refer
 		ID:       state,
 		Referrer: referrer,
 	}
-	err = application.Transactional(db, func(appl application.Application) error {
-		_, err := appl.OauthStates().Create(ctx, &ref)
+	if codeChallenge != nil {
+		ref.CodeChallenge = codeChallenge.Challenge
+		ref.CodeChallengeMethod = codeChallenge.Method
+	}
+	return saveStateReference(ctx, db, &ref)
+}
+
+func saveStateReference(ctx context.Context, db application.DB, ref *auth.OauthStateReference) error {
+	err := application.Transactional(db, func(appl application.Application) error {
+		_, err := appl.OauthStates().Create(ctx, ref)
 		return err
 	})
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
-			"state":    state,
-			"referrer": referrer,
+			"state":    ref.ID,
+			"referrer": ref.Referrer,
 			"err":      err,
 		}, "unable to create oauth state reference")
 		return err
@@ -121,21 +134,29 @@ func SaveReferrer(ctx context.Context, db application.DB, state uuid.UUID, refer
 
 // LoadReferrer loads referrer from DB
 func LoadReferrer(ctx context.Context, db application.DB, state string) (string, error) {
-	var referrer string
+	ref, err := LoadStateReference(ctx, db, state)
+	if err != nil {
+		return "", err
+	}
+	return ref.Referrer, nil
+}
+
+// LoadStateReference loads the state reference from DB and deletes it, so the state can be used only once
+func LoadStateReference(ctx context.Context, db application.DB, state string) (*auth.OauthStateReference, error) {
+	var ref *auth.OauthStateReference
 	stateID, err := uuid.FromString(state)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"state": state,
 			"err":   err,
 		}, "unable to convert oauth state to uuid")
-		return "", err
+		return nil, err
 	}
 	err = application.Transactional(db, func(appl application.Application) error {
-		ref, err := appl.OauthStates().Load(ctx, stateID)
+		ref, err = appl.OauthStates().Load(ctx, stateID)
 		if err != nil {
 			return err
 		}
-		referrer = ref.Referrer
 		err = appl.OauthStates().Delete(ctx, stateID)
 		return err
 	})
@@ -144,7 +165,7 @@ func LoadReferrer(ctx context.Context, db application.DB, state string) (string,
 			"state": state,
 			"err":   err,
 		}, "unable to delete oauth state reference")
-		return "", err
+		return nil, err
 	}
-	return referrer, nil
+	return ref, nil
 }
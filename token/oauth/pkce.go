@@ -0,0 +1,131 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/auth"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// CodeChallengeMethodS256 is the RFC 7636 code challenge method which sends the SHA-256 hash of the code verifier
+	CodeChallengeMethodS256 = "S256"
+	// CodeChallengeMethodPlain is the RFC 7636 code challenge method which sends the code verifier
+	CodeChallengeMethodPlain = "plain"
+	// AuthorizationCodeGrantType is the grant type used to exchange an authorization code for tokens
+	AuthorizationCodeGrantType = "authorization_code"
+
+	// authorizationCodeLifespan is how long an authorization code issued to a public client can be exchanged for tokens
+	authorizationCodeLifespan = 5 * time.Minute
+)
+
+// codeVerifierPattern matches the code verifiers and the code challenges defined by RFC 7636:
+// 43 to 128 unreserved characters. The challenges of the S256 method are 43 characters long.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// CodeChallenge represents a RFC 7636 code challenge sent by a public client
+type CodeChallenge struct {
+	Challenge string
+	Method    string
+}
+
+// NewCodeChallenge validates the code challenge and its method. The method defaults to "plain".
+// Returns nil if there is no code challenge.
+func NewCodeChallenge(challenge *string, method *string) (*CodeChallenge, error) {
+	if challenge == nil || *challenge == "" {
+		if method != nil {
+			return nil, errors.NewBadParameterError("code_challenge", "nil").Expected("code challenge of the code challenge method")
+		}
+		return nil, nil
+	}
+	codeChallenge := &CodeChallenge{Challenge: *challenge, Method: CodeChallengeMethodPlain}
+	if method != nil {
+		codeChallenge.Method = *method
+	}
+	if codeChallenge.Method != CodeChallengeMethodS256 && codeChallenge.Method != CodeChallengeMethodPlain {
+		return nil, errors.NewBadParameterError("code_challenge_method", codeChallenge.Method).Expected(CodeChallengeMethodS256 + " or " + CodeChallengeMethodPlain)
+	}
+	if !codeVerifierPattern.MatchString(codeChallenge.Challenge) {
+		return nil, errors.NewBadParameterError("code_challenge", codeChallenge.Challenge).Expected("43 to 128 characters among [A-Z] / [a-z] / [0-9] / \"-\" / \".\" / \"_\" / \"~\"")
+	}
+	return codeChallenge, nil
+}
+
+// StateCodeChallenge returns the code challenge stored with the state reference or nil if the client didn't send any
+func StateCodeChallenge(ref auth.OauthStateReference) *CodeChallenge {
+	if ref.CodeChallenge == "" {
+		return nil
+	}
+	return &CodeChallenge{Challenge: ref.CodeChallenge, Method: ref.CodeChallengeMethod}
+}
+
+// Verify returns true if the code verifier matches the code challenge
+func (c CodeChallenge) Verify(verifier string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	expected := verifier
+	if c.Method == CodeChallengeMethodS256 {
+		hash := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(c.Challenge)) == 1
+}
+
+// SaveAuthorizationCode saves an authorization code issued at login to the public client which sent the code challenge.
+// The referrer has already been validated when the login started. Returns the code, which is the ID of the state reference.
+func SaveAuthorizationCode(ctx context.Context, db application.DB, referrer string, codeChallenge CodeChallenge, identityID uuid.UUID, sessionState string) (string, error) {
+	ref := auth.OauthStateReference{
+		ID:                  uuid.NewV4(),
+		Referrer:            referrer,
+		CodeChallenge:       codeChallenge.Challenge,
+		CodeChallengeMethod: codeChallenge.Method,
+		IdentityID:          &identityID,
+		SessionState:        sessionState,
+	}
+	err := saveStateReference(ctx, db, &ref)
+	if err != nil {
+		return "", err
+	}
+	return ref.ID.String(), nil
+}
+
+// LoadAuthorizationCode loads the state reference of an authorization code issued at login and checks the code verifier.
+// The code is deleted even if the code verifier doesn't match, so it can be used only once.
+func LoadAuthorizationCode(ctx context.Context, db application.DB, code string, codeVerifier string) (*auth.OauthStateReference, error) {
+	ref, err := LoadStateReference(ctx, db, code)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("invalid authorization code")
+	}
+	codeChallenge := StateCodeChallenge(*ref)
+	if ref.IdentityID == nil || codeChallenge == nil {
+		log.Error(ctx, map[string]interface{}{
+			"code": code,
+		}, "the state reference is not an authorization code")
+		return nil, errors.NewUnauthorizedError("invalid authorization code")
+	}
+	if time.Since(ref.CreatedAt) > authorizationCodeLifespan {
+		log.Warn(ctx, map[string]interface{}{
+			"code":        code,
+			"identity_id": ref.IdentityID,
+		}, "expired authorization code")
+		return nil, errors.NewUnauthorizedError("expired authorization code")
+	}
+	if !codeChallenge.Verify(codeVerifier) {
+		log.Warn(ctx, map[string]interface{}{
+			"code":        code,
+			"identity_id": ref.IdentityID,
+		}, "the code verifier doesn't match the code challenge")
+		return nil, errors.NewUnauthorizedError("invalid code verifier")
+	}
+	return ref, nil
+}
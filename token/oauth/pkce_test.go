@@ -0,0 +1,79 @@
+package oauth_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/token/oauth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// codeVerifier and s256CodeChallenge are the example of RFC 7636 Appendix B
+const (
+	codeVerifier      = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	s256CodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestNewCodeChallenge(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+
+	t.Run("no code challenge", func(t *testing.T) {
+		codeChallenge, err := oauth.NewCodeChallenge(nil, nil)
+		require.Nil(t, err)
+		assert.Nil(t, codeChallenge)
+	})
+
+	t.Run("method defaults to plain", func(t *testing.T) {
+		challenge := codeVerifier
+		codeChallenge, err := oauth.NewCodeChallenge(&challenge, nil)
+		require.Nil(t, err)
+		assert.Equal(t, oauth.CodeChallenge{Challenge: codeVerifier, Method: oauth.CodeChallengeMethodPlain}, *codeChallenge)
+	})
+
+	t.Run("S256", func(t *testing.T) {
+		challenge := s256CodeChallenge
+		method := oauth.CodeChallengeMethodS256
+		codeChallenge, err := oauth.NewCodeChallenge(&challenge, &method)
+		require.Nil(t, err)
+		assert.Equal(t, oauth.CodeChallenge{Challenge: s256CodeChallenge, Method: oauth.CodeChallengeMethodS256}, *codeChallenge)
+	})
+
+	t.Run("method without code challenge", func(t *testing.T) {
+		method := oauth.CodeChallengeMethodS256
+		_, err := oauth.NewCodeChallenge(nil, &method)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		challenge := s256CodeChallenge
+		method := "S512"
+		_, err := oauth.NewCodeChallenge(&challenge, &method)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("invalid code challenge", func(t *testing.T) {
+		for _, challenge := range []string{"too-short", s256CodeChallenge[:42] + "=", s256CodeChallenge + "/"} {
+			_, err := oauth.NewCodeChallenge(&challenge, nil)
+			assert.NotNil(t, err, challenge)
+		}
+	})
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+
+	s256 := oauth.CodeChallenge{Challenge: s256CodeChallenge, Method: oauth.CodeChallengeMethodS256}
+	assert.True(t, s256.Verify(codeVerifier))
+	assert.False(t, s256.Verify(s256CodeChallenge))
+	assert.False(t, s256.Verify(codeVerifier[1:]+"a"))
+	assert.False(t, s256.Verify(""))
+
+	plain := oauth.CodeChallenge{Challenge: codeVerifier, Method: oauth.CodeChallengeMethodPlain}
+	assert.True(t, plain.Verify(codeVerifier))
+	assert.False(t, plain.Verify(s256CodeChallenge))
+	assert.False(t, plain.Verify(""))
+}
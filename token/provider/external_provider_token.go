@@ -10,11 +10,14 @@ import (
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormsupport"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
 	errs "github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/oauth2"
 )
 
 // ExternalToken describes a single ExternalToken
@@ -27,6 +30,19 @@ type ExternalToken struct {
 	Username   string
 	IdentityID uuid.UUID `sql:"type:uuid"` // use NullUUID ?
 	Identity   account.Identity
+	// RefreshToken is used to obtain a new token when the token expires. Not all the providers issue refresh tokens.
+	RefreshToken string
+	// TokenType is the type of the token returned by the provider, e.g. "bearer"
+	TokenType string
+	// ExpiresAt is the expiry time of the token, or nil if the token doesn't expire or its expiry is unknown
+	ExpiresAt *time.Time
+	// TokenKeyID is the ID of the key-encryption key the data key of the token is encrypted with.
+	// The token is stored in plaintext if it's empty.
+	TokenKeyID string
+	// TokenEncryptedKey is the encrypted data key the token is encrypted with
+	TokenEncryptedKey string
+	// RefreshTokenEncryptedKey is the encrypted data key the refresh token is encrypted with
+	RefreshTokenEncryptedKey string
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -46,26 +62,51 @@ func (m ExternalToken) GetLastModified() time.Time {
 	return m.UpdatedAt
 }
 
+// UpdateFromOAuth2Token sets the token, the refresh token, the token type and the expiry to the ones of the given token
+// issued by the provider. The refresh token is kept if the provider doesn't issue a new one.
+func (m *ExternalToken) UpdateFromOAuth2Token(token *oauth2.Token) {
+	m.Token = token.AccessToken
+	if token.RefreshToken != "" {
+		m.RefreshToken = token.RefreshToken
+	}
+	m.TokenType = token.TokenType
+	m.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		m.ExpiresAt = &expiry
+	}
+}
+
+// ExpiresWithin returns true if the token expires within the given duration (or has expired)
+func (m ExternalToken) ExpiresWithin(d time.Duration) bool {
+	return m.ExpiresAt != nil && m.ExpiresAt.Before(time.Now().Add(d))
+}
+
 // GormExternalTokenRepository is the implementation of the storage interface for
-// ExternalToken.
+// ExternalToken. The tokens are encrypted with the cipher before they are stored,
+// and decrypted when they are loaded.
 type GormExternalTokenRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *encryption.Cipher
 }
 
 // NewExternalTokenRepository creates a new storage type.
-func NewExternalTokenRepository(db *gorm.DB) *GormExternalTokenRepository {
-	return &GormExternalTokenRepository{db: db}
+// The tokens are stored in plaintext if the cipher is nil, and the encrypted tokens can't be loaded.
+func NewExternalTokenRepository(db *gorm.DB, cipher *encryption.Cipher) *GormExternalTokenRepository {
+	return &GormExternalTokenRepository{db: db, cipher: cipher}
 }
 
 // ExternalTokenRepository represents the storage interface.
 type ExternalTokenRepository interface {
 	repository.Exister
 	Load(ctx context.Context, id uuid.UUID) (*ExternalToken, error)
+	LoadForUpdate(ctx context.Context, id uuid.UUID) (*ExternalToken, error)
 	Create(ctx context.Context, ExternalToken *ExternalToken) error
 	Save(ctx context.Context, ExternalToken *ExternalToken) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	LoadByProviderIDAndIdentityID(ctx context.Context, providerID uuid.UUID, identityID uuid.UUID) ([]ExternalToken, error)
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]ExternalToken, error)
+	Reencrypt(ctx context.Context, batchSize int) (int, error)
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -80,29 +121,54 @@ func (m *GormExternalTokenRepository) TableName() string {
 // This is more for use internally, and probably not what you want in  your controllers
 func (m *GormExternalTokenRepository) Load(ctx context.Context, id uuid.UUID) (*ExternalToken, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "load"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "load").Finish()
+	return m.load(m.db, id)
+}
+
+// LoadForUpdate returns a single ExternalToken and locks it until the end of the transaction,
+// so it can't be updated by a concurrent transaction in the meantime
+func (m *GormExternalTokenRepository) LoadForUpdate(ctx context.Context, id uuid.UUID) (*ExternalToken, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "load_for_update"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "load_for_update").Finish()
+	return m.load(m.db.Set("gorm:query_option", "FOR UPDATE"), id)
+}
 
+func (m *GormExternalTokenRepository) load(db *gorm.DB, id uuid.UUID) (*ExternalToken, error) {
 	var native ExternalToken
-	err := m.db.Table(m.TableName()).Where("id = ?", id).Find(&native).Error
+	err := db.Table(m.TableName()).Where("id = ?", id).Find(&native).Error
 	if err == gorm.ErrRecordNotFound {
 		return nil, errors.NewNotFoundError("external_token", id.String())
 	}
-
-	return &native, errs.WithStack(err)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	err = m.decrypt(&native)
+	if err != nil {
+		return nil, err
+	}
+	return &native, nil
 }
 
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormExternalTokenRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "exists"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "exists").Finish()
 	return repository.CheckHardDeletableExists(ctx, m.db, m.TableName(), id)
 }
 
 // Create creates a new record.
 func (m *GormExternalTokenRepository) Create(ctx context.Context, model *ExternalToken) error {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "create"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "create").Finish()
 	if model.ID == uuid.Nil {
 		model.ID = uuid.NewV4()
 	}
-	err := m.db.Create(model).Error
+	defer m.restorePlaintext(model, model.Token, model.RefreshToken)
+	err := m.encrypt(model)
+	if err != nil {
+		return err
+	}
+	err = m.db.Create(model).Error
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"external_token_id": model.ID,
@@ -119,6 +185,7 @@ func (m *GormExternalTokenRepository) Create(ctx context.Context, model *Externa
 // Save modifies a single record.
 func (m *GormExternalTokenRepository) Save(ctx context.Context, model *ExternalToken) error {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "save"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "save").Finish()
 
 	obj, err := m.Load(ctx, model.ID)
 	if err != nil {
@@ -129,7 +196,33 @@ func (m *GormExternalTokenRepository) Save(ctx context.Context, model *ExternalT
 		}, "unable to update the external_token")
 		return errs.WithStack(err)
 	}
+	defer m.restorePlaintext(model, model.Token, model.RefreshToken)
+	err = m.encrypt(model)
+	if err != nil {
+		return err
+	}
 	err = m.db.Model(obj).Updates(model).Error
+	if err == nil {
+		// the fields with a zero value are not updated with a struct
+		zeroFields := map[string]interface{}{}
+		if model.TokenKeyID == "" {
+			zeroFields["token_key_id"] = ""
+			zeroFields["token_encrypted_key"] = ""
+		}
+		if model.RefreshToken == "" {
+			zeroFields["refresh_token"] = ""
+			zeroFields["refresh_token_encrypted_key"] = ""
+		}
+		if model.TokenType == "" {
+			zeroFields["token_type"] = ""
+		}
+		if model.ExpiresAt == nil {
+			zeroFields["expires_at"] = nil
+		}
+		if len(zeroFields) > 0 {
+			err = m.db.Model(obj).Updates(zeroFields).Error
+		}
+	}
 
 	log.Debug(ctx, map[string]interface{}{
 		"external_token_id": model.ID,
@@ -141,6 +234,7 @@ func (m *GormExternalTokenRepository) Save(ctx context.Context, model *ExternalT
 // Delete removes a single record. This is a hard delete!
 func (m *GormExternalTokenRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "delete"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "delete").Finish()
 
 	obj := ExternalToken{ID: id}
 	db := m.db.Delete(obj)
@@ -171,8 +265,14 @@ func (m *GormExternalTokenRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, errs.WithStack(err)
 	}
+	for i := range externalProviderTokens {
+		err = m.decrypt(&externalProviderTokens[i])
+		if err != nil {
+			return nil, err
+		}
+	}
 	log.Debug(nil, map[string]interface{}{
-		"external_provider_token_query": externalProviderTokens,
+		"external_provider_token_query_count": len(externalProviderTokens),
 	}, "external_token query executed successfully!")
 
 	return externalProviderTokens, nil
@@ -181,6 +281,7 @@ func (m *GormExternalTokenRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([
 // LoadByProviderIDAndIdentityID loads tokens by IdentityID and ProviderID
 func (m *GormExternalTokenRepository) LoadByProviderIDAndIdentityID(ctx context.Context, providerID uuid.UUID, identityID uuid.UUID) ([]ExternalToken, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "LoadByProviderIDAndIdentityID"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "LoadByProviderIDAndIdentityID").Finish()
 	var externalProviderTokens []ExternalToken
 	externalProviderTokens, err := m.Query(ExternalTokenFilterByIdentityID(identityID), ExternalTokenFilterByProviderID(providerID), ExternalTokenWithIdentity())
 	if err != nil && err != gorm.ErrRecordNotFound {
@@ -189,6 +290,129 @@ func (m *GormExternalTokenRepository) LoadByProviderIDAndIdentityID(ctx context.
 	return externalProviderTokens, nil
 }
 
+// Reencrypt re-encrypts the tokens stored in plaintext or encrypted with another key than the current key of the cipher,
+// by batches of the given size, and returns the number of re-encrypted tokens.
+// The tokens which can't be decrypted are skipped, and a token which is modified concurrently is left to the writer.
+func (m *GormExternalTokenRepository) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "reencrypt"}, time.Now())
+	defer tracing.StartDBSpan(ctx, "ExternalToken", "reencrypt").Finish()
+	if m.cipher == nil {
+		return 0, errs.New("unable to re-encrypt the external tokens without a cipher")
+	}
+	reencrypted := 0
+	lastID := uuid.Nil
+	for {
+		var tokens []ExternalToken
+		err := m.db.Table(m.TableName()).Where("token_key_id <> ? AND id > ?", m.cipher.KeyID(), lastID).Order("id").Limit(batchSize).Find(&tokens).Error
+		if err != nil {
+			return reencrypted, errs.WithStack(err)
+		}
+		if len(tokens) == 0 {
+			return reencrypted, nil
+		}
+		for i := range tokens {
+			token := &tokens[i]
+			lastID = token.ID
+			storedToken := token.Token
+			err = m.decrypt(token)
+			if err == nil {
+				err = m.encrypt(token)
+			}
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"external_token_id": token.ID,
+					"key_id":            token.TokenKeyID,
+					"err":               err,
+				}, "unable to re-encrypt the external_token")
+				continue
+			}
+			// the columns are updated without changing the modification time, and only if the token is still the one which was loaded
+			db := m.db.Table(m.TableName()).Where("id = ? AND token = ?", token.ID, storedToken).UpdateColumns(map[string]interface{}{
+				"token":                       token.Token,
+				"token_key_id":                token.TokenKeyID,
+				"token_encrypted_key":         token.TokenEncryptedKey,
+				"refresh_token":               token.RefreshToken,
+				"refresh_token_encrypted_key": token.RefreshTokenEncryptedKey,
+			})
+			if db.Error != nil {
+				return reencrypted, errs.WithStack(db.Error)
+			}
+			reencrypted += int(db.RowsAffected)
+		}
+	}
+}
+
+// encrypt replaces the plaintext token and refresh token of the model with their encrypted values.
+// The tokens are left in plaintext if there is no cipher.
+func (m *GormExternalTokenRepository) encrypt(model *ExternalToken) error {
+	if m.cipher == nil {
+		model.TokenKeyID = ""
+		model.TokenEncryptedKey = ""
+		model.RefreshTokenEncryptedKey = ""
+		return nil
+	}
+	envelope, err := m.cipher.Encrypt(model.Token, model.ID.Bytes())
+	if err != nil {
+		return errs.Wrapf(err, "unable to encrypt the external token %s", model.ID)
+	}
+	model.Token = envelope.Ciphertext
+	model.TokenKeyID = envelope.KeyID
+	model.TokenEncryptedKey = envelope.EncryptedKey
+	model.RefreshTokenEncryptedKey = ""
+	if model.RefreshToken != "" {
+		envelope, err = m.cipher.Encrypt(model.RefreshToken, refreshTokenAssociatedData(model.ID))
+		if err != nil {
+			return errs.Wrapf(err, "unable to encrypt the refresh token of the external token %s", model.ID)
+		}
+		model.RefreshToken = envelope.Ciphertext
+		model.RefreshTokenEncryptedKey = envelope.EncryptedKey
+	}
+	return nil
+}
+
+// decrypt replaces the encrypted token and refresh token of the model with their plaintext values
+func (m *GormExternalTokenRepository) decrypt(model *ExternalToken) error {
+	if model.TokenKeyID == "" {
+		return nil
+	}
+	if m.cipher == nil {
+		return errs.Errorf("unable to decrypt the external token %s without a cipher", model.ID)
+	}
+	token, err := m.cipher.Decrypt(encryption.Envelope{
+		KeyID:        model.TokenKeyID,
+		EncryptedKey: model.TokenEncryptedKey,
+		Ciphertext:   model.Token,
+	}, model.ID.Bytes())
+	if err != nil {
+		return errs.Wrapf(err, "unable to decrypt the external token %s", model.ID)
+	}
+	if model.RefreshToken != "" {
+		refreshToken, err := m.cipher.Decrypt(encryption.Envelope{
+			KeyID:        model.TokenKeyID,
+			EncryptedKey: model.RefreshTokenEncryptedKey,
+			Ciphertext:   model.RefreshToken,
+		}, refreshTokenAssociatedData(model.ID))
+		if err != nil {
+			return errs.Wrapf(err, "unable to decrypt the refresh token of the external token %s", model.ID)
+		}
+		model.RefreshToken = refreshToken
+	}
+	model.Token = token
+	return nil
+}
+
+// refreshTokenAssociatedData returns the associated data of the refresh token, which differs from the one of the token
+// so the encrypted tokens can't be swapped
+func refreshTokenAssociatedData(id uuid.UUID) []byte {
+	return append(id.Bytes(), []byte("refresh_token")...)
+}
+
+// restorePlaintext gives the caller its model back with the plaintext tokens after they have been stored encrypted
+func (m *GormExternalTokenRepository) restorePlaintext(model *ExternalToken, token string, refreshToken string) {
+	model.Token = token
+	model.RefreshToken = refreshToken
+}
+
 // ExternalTokenFilterByIdentityID is a gorm filter for a Belongs To relationship.
 func ExternalTokenFilterByIdentityID(identityID uuid.UUID) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
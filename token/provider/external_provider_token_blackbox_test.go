@@ -3,11 +3,13 @@ package provider_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
 	"github.com/fabric8-services/fabric8-auth/resource"
 	"github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
 	"github.com/fabric8-services/fabric8-auth/token/provider"
 
 	"github.com/jinzhu/gorm"
@@ -15,6 +17,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/oauth2"
 )
 
 type externalTokenBlackboxTest struct {
@@ -28,7 +31,7 @@ func TestRunExternalTokenBlackboxTest(t *testing.T) {
 
 func (s *externalTokenBlackboxTest) SetupTest() {
 	s.DBTestSuite.SetupTest()
-	s.repo = provider.NewExternalTokenRepository(s.DB)
+	s.repo = provider.NewExternalTokenRepository(s.DB, s.TokenCipher)
 }
 
 func (s *externalTokenBlackboxTest) TestOKToDelete() {
@@ -103,6 +106,37 @@ func (s *externalTokenBlackboxTest) TestExternalProviderOKToSave() {
 	s.assertToken(*externalToken, *externalTokenLoaded)
 }
 
+func (s *externalTokenBlackboxTest) TestLoadForUpdateLocksToken() {
+	// given a token loaded for update in a transaction
+	externalToken := createAndLoadExternalToken(s)
+	tx := s.DB.Begin()
+	defer tx.Rollback()
+	locked, err := provider.NewExternalTokenRepository(tx, s.TokenCipher).LoadForUpdate(s.Ctx, externalToken.ID)
+	require.Nil(s.T(), err)
+	s.assertToken(*externalToken, *locked)
+	// when another transaction loads it for update
+	loaded := make(chan error)
+	go func() {
+		otherTx := s.DB.Begin()
+		defer otherTx.Rollback()
+		_, err := provider.NewExternalTokenRepository(otherTx, s.TokenCipher).LoadForUpdate(s.Ctx, externalToken.ID)
+		loaded <- err
+	}()
+	// then it waits until the first transaction ends
+	select {
+	case <-loaded:
+		s.T().Fatal("the token was loaded while it was locked")
+	case <-time.After(200 * time.Millisecond):
+	}
+	require.Nil(s.T(), tx.Commit().Error)
+	select {
+	case err := <-loaded:
+		require.Nil(s.T(), err)
+	case <-time.After(5 * time.Second):
+		s.T().Fatal("the token was not loaded once unlocked")
+	}
+}
+
 func (s *externalTokenBlackboxTest) TestExternalProviderOKToFilterByIdentityID() {
 	// given
 	externalToken := createAndLoadExternalToken(s)
@@ -155,6 +189,148 @@ func (s *externalTokenBlackboxTest) TestExternalProviderOKToFilterByIdentityIDAn
 
 }
 
+func (s *externalTokenBlackboxTest) TestTokenIsEncrypted() {
+	// given
+	externalToken := createAndLoadExternalToken(s)
+	// when
+	var native provider.ExternalToken
+	err := s.DB.Table(s.repo.TableName()).Where("id = ?", externalToken.ID).Find(&native).Error
+	// then
+	require.Nil(s.T(), err)
+	assert.NotEqual(s.T(), externalToken.Token, native.Token)
+	assert.Equal(s.T(), s.TokenCipher.KeyID(), native.TokenKeyID)
+	assert.NotEmpty(s.T(), native.TokenEncryptedKey)
+}
+
+func (s *externalTokenBlackboxTest) TestRefreshTokenAndExpiry() {
+	// given
+	externalToken := createAndLoadExternalToken(s)
+	expiresAt := time.Now().Add(time.Hour).Round(time.Second)
+	externalToken.UpdateFromOAuth2Token(&oauth2.Token{
+		AccessToken:  uuid.NewV4().String(),
+		RefreshToken: uuid.NewV4().String(),
+		TokenType:    "bearer",
+		Expiry:       expiresAt,
+	})
+
+	s.T().Run("saved", func(t *testing.T) {
+		// when
+		err := s.repo.Save(s.Ctx, externalToken)
+		// then
+		require.Nil(t, err)
+		loaded, err := s.repo.Load(s.Ctx, externalToken.ID)
+		require.Nil(t, err)
+		s.assertToken(*externalToken, *loaded)
+		assert.Equal(t, externalToken.RefreshToken, loaded.RefreshToken)
+		assert.Equal(t, "bearer", loaded.TokenType)
+		require.NotNil(t, loaded.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*loaded.ExpiresAt))
+		assert.False(t, loaded.ExpiresWithin(time.Minute))
+		assert.True(t, loaded.ExpiresWithin(2*time.Hour))
+	})
+
+	s.T().Run("refresh token encrypted", func(t *testing.T) {
+		var native provider.ExternalToken
+		err := s.DB.Table(s.repo.TableName()).Where("id = ?", externalToken.ID).Find(&native).Error
+		require.Nil(t, err)
+		assert.NotEqual(t, externalToken.RefreshToken, native.RefreshToken)
+		assert.NotEmpty(t, native.RefreshTokenEncryptedKey)
+	})
+
+	s.T().Run("cleared when relinked", func(t *testing.T) {
+		// given a token without refresh token nor expiry
+		externalToken.RefreshToken = ""
+		externalToken.UpdateFromOAuth2Token(&oauth2.Token{AccessToken: uuid.NewV4().String()})
+		// when
+		err := s.repo.Save(s.Ctx, externalToken)
+		// then
+		require.Nil(t, err)
+		loaded, err := s.repo.Load(s.Ctx, externalToken.ID)
+		require.Nil(t, err)
+		assert.Equal(t, "", loaded.RefreshToken)
+		assert.Nil(t, loaded.ExpiresAt)
+		assert.False(t, loaded.ExpiresWithin(time.Hour))
+	})
+}
+
+func (s *externalTokenBlackboxTest) TestReencrypt() {
+
+	s.T().Run("plaintext token", func(t *testing.T) {
+		// given a token stored before the tokens were encrypted
+		s.repo = provider.NewExternalTokenRepository(s.DB, nil)
+		externalToken := createAndLoadExternalToken(s)
+		s.repo = provider.NewExternalTokenRepository(s.DB, s.TokenCipher)
+		// when
+		reencrypted, err := s.repo.Reencrypt(s.Ctx, 2)
+		// then
+		require.Nil(t, err)
+		assert.True(t, reencrypted >= 1)
+		s.assertStoredWithKey(externalToken, s.TokenCipher.KeyID())
+	})
+
+	s.T().Run("token encrypted with the deprecated key", func(t *testing.T) {
+		// given a token encrypted before the key rotation
+		key, keyID := s.Configuration.GetExternalTokenEncryptionKey()
+		oldCipher, err := encryption.NewCipher(keyConfig{key: []byte("qPHTT2J7vXOHKeqHVKCWjwC06nsNnSuw5bUGtRyIYcc="), keyID: "old-key"})
+		require.Nil(t, err)
+		s.repo = provider.NewExternalTokenRepository(s.DB, oldCipher)
+		externalToken := createAndLoadExternalToken(s)
+		cipher, err := encryption.NewCipher(keyConfig{key: key, keyID: keyID, deprecatedKey: []byte("qPHTT2J7vXOHKeqHVKCWjwC06nsNnSuw5bUGtRyIYcc="), deprecatedKeyID: "old-key"})
+		require.Nil(t, err)
+		s.repo = provider.NewExternalTokenRepository(s.DB, cipher)
+		// when
+		reencrypted, err := s.repo.Reencrypt(s.Ctx, 2)
+		// then
+		require.Nil(t, err)
+		assert.True(t, reencrypted >= 1)
+		s.assertStoredWithKey(externalToken, keyID)
+	})
+
+	s.T().Run("token encrypted with an unknown key", func(t *testing.T) {
+		// given
+		unknownCipher, err := encryption.NewCipher(keyConfig{key: []byte("qPHTT2J7vXOHKeqHVKCWjwC06nsNnSuw5bUGtRyIYcc="), keyID: "unknown-key"})
+		require.Nil(t, err)
+		s.repo = provider.NewExternalTokenRepository(s.DB, unknownCipher)
+		externalToken := createAndLoadExternalToken(s)
+		s.repo = provider.NewExternalTokenRepository(s.DB, s.TokenCipher)
+		// when
+		_, err = s.repo.Reencrypt(s.Ctx, 2)
+		// then the token is skipped
+		require.Nil(t, err)
+		_, err = s.repo.Load(s.Ctx, externalToken.ID)
+		require.NotNil(t, err)
+		// cleanup, so the token doesn't fail the other tests loading all the tokens
+		require.Nil(t, s.repo.Delete(s.Ctx, externalToken.ID))
+	})
+}
+
+// assertStoredWithKey checks that the token is stored encrypted with the given key and can be loaded
+func (s *externalTokenBlackboxTest) assertStoredWithKey(externalToken *provider.ExternalToken, keyID string) {
+	var native provider.ExternalToken
+	err := s.DB.Table(s.repo.TableName()).Where("id = ?", externalToken.ID).Find(&native).Error
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), keyID, native.TokenKeyID)
+	assert.NotEqual(s.T(), externalToken.Token, native.Token)
+	loaded, err := s.repo.Load(s.Ctx, externalToken.ID)
+	require.Nil(s.T(), err)
+	s.assertToken(*externalToken, *loaded)
+}
+
+type keyConfig struct {
+	key             []byte
+	keyID           string
+	deprecatedKey   []byte
+	deprecatedKeyID string
+}
+
+func (c keyConfig) GetExternalTokenEncryptionKey() ([]byte, string) {
+	return c.key, c.keyID
+}
+
+func (c keyConfig) GetDeprecatedExternalTokenEncryptionKey() ([]byte, string) {
+	return c.deprecatedKey, c.deprecatedKeyID
+}
+
 func createAndLoadExternalToken(s *externalTokenBlackboxTest) *provider.ExternalToken {
 
 	identity, err := test.CreateTestIdentity(s.DB, uuid.NewV4().String(), "kc")
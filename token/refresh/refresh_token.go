@@ -0,0 +1,186 @@
+package refresh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RefreshToken describes a refresh token issued by the Auth service.
+// The refresh tokens obtained by rotating the refresh token of a login session belong to the same session.
+type RefreshToken struct {
+	gormsupport.LifecycleHardDelete
+	ID         uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:refresh_token_id"`
+	TokenHash  string
+	IdentityID uuid.UUID `sql:"type:uuid"`
+	ClientID   string
+	SessionID  uuid.UUID  `sql:"type:uuid"`
+	ParentID   *uuid.UUID `sql:"type:uuid"`
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	RotatedAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m RefreshToken) TableName() string {
+	return "refresh_token"
+}
+
+// Hash returns the hash of the refresh token which is stored instead of the token itself
+func Hash(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// GormRefreshTokenRepository is the implementation of the storage interface for RefreshToken.
+type GormRefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new storage type.
+func NewRefreshTokenRepository(db *gorm.DB) *GormRefreshTokenRepository {
+	return &GormRefreshTokenRepository{db: db}
+}
+
+// RefreshTokenRepository represents the storage interface.
+type RefreshTokenRepository interface {
+	Load(ctx context.Context, id uuid.UUID) (*RefreshToken, error)
+	LoadByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	Create(ctx context.Context, refreshToken *RefreshToken) error
+	MarkRotated(ctx context.Context, id uuid.UUID) (bool, error)
+	ListBySession(ctx context.Context, sessionID uuid.UUID) ([]RefreshToken, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) (int64, error)
+	RevokeForIdentity(ctx context.Context, identityID uuid.UUID) (int64, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormRefreshTokenRepository) TableName() string {
+	return "refresh_token"
+}
+
+// Load returns the refresh token for the given ID
+// returns NotFoundError if the refresh token doesn't exist
+func (m *GormRefreshTokenRepository) Load(ctx context.Context, id uuid.UUID) (*RefreshToken, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "load"}, time.Now())
+	var native RefreshToken
+	err := m.db.Table(m.TableName()).Where("refresh_token_id = ?", id).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("refresh_token", id.String())
+	}
+	return &native, errs.WithStack(err)
+}
+
+// LoadByHash returns the refresh token with the given hash
+// returns NotFoundError if no such refresh token has been issued
+func (m *GormRefreshTokenRepository) LoadByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "loadByHash"}, time.Now())
+	var native RefreshToken
+	err := m.db.Table(m.TableName()).Where("token_hash = ?", tokenHash).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("refresh_token", tokenHash)
+	}
+	return &native, errs.WithStack(err)
+}
+
+// Create creates a new record.
+func (m *GormRefreshTokenRepository) Create(ctx context.Context, model *RefreshToken) error {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "create"}, time.Now())
+	if model.ID == uuid.Nil {
+		model.ID = uuid.NewV4()
+	}
+	err := m.db.Create(model).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"refresh_token_id": model.ID,
+			"session_id":       model.SessionID,
+			"err":              err,
+		}, "unable to create the refresh token")
+		return errs.WithStack(err)
+	}
+	log.Debug(ctx, map[string]interface{}{
+		"refresh_token_id": model.ID,
+		"session_id":       model.SessionID,
+	}, "refresh token created")
+	return nil
+}
+
+// MarkRotated records that the refresh token has been exchanged for a new one.
+// Returns false if the refresh token has already been rotated or revoked.
+// The check and the update are done with a single statement, so a refresh token can be rotated only once,
+// even if it's used concurrently.
+func (m *GormRefreshTokenRepository) MarkRotated(ctx context.Context, id uuid.UUID) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "markRotated"}, time.Now())
+	db := m.db.Model(&RefreshToken{}).
+		Where("refresh_token_id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"rotated_at": gorm.NowFunc()})
+	if db.Error != nil {
+		return false, errs.WithStack(db.Error)
+	}
+	return db.RowsAffected > 0, nil
+}
+
+// ListBySession returns the refresh tokens of the session in the order they were issued
+func (m *GormRefreshTokenRepository) ListBySession(ctx context.Context, sessionID uuid.UUID) ([]RefreshToken, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "listBySession"}, time.Now())
+	var rows []RefreshToken
+	err := m.db.Table(m.TableName()).Where("session_id = ?", sessionID).Order("issued_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// RevokeSession revokes all the refresh tokens of the session which are not revoked yet
+// and returns the number of revoked tokens
+func (m *GormRefreshTokenRepository) RevokeSession(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "revokeSession"}, time.Now())
+	db := m.db.Model(&RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": gorm.NowFunc()})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"session_id": sessionID,
+			"err":        db.Error,
+		}, "unable to revoke the refresh tokens of the session")
+		return 0, errs.WithStack(db.Error)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"session_id": sessionID,
+		"revoked":    db.RowsAffected,
+	}, "refresh tokens of the session revoked")
+	return db.RowsAffected, nil
+}
+
+// RevokeForIdentity revokes all the refresh tokens of the identity which are not revoked yet,
+// which ends all its sessions, and returns the number of revoked tokens
+func (m *GormRefreshTokenRepository) RevokeForIdentity(ctx context.Context, identityID uuid.UUID) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "refresh_token", "revokeForIdentity"}, time.Now())
+	db := m.db.Model(&RefreshToken{}).
+		Where("identity_id = ? AND revoked_at IS NULL", identityID).
+		Updates(map[string]interface{}{"revoked_at": gorm.NowFunc()})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": identityID,
+			"err":         db.Error,
+		}, "unable to revoke the refresh tokens of the identity")
+		return 0, errs.WithStack(db.Error)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": identityID,
+		"revoked":     db.RowsAffected,
+	}, "refresh tokens of the identity revoked")
+	return db.RowsAffected, nil
+}
@@ -0,0 +1,124 @@
+package refresh_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type refreshTokenBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo     *refresh.GormRefreshTokenRepository
+	identity account.Identity
+}
+
+func TestRunRefreshTokenBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &refreshTokenBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *refreshTokenBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = refresh.NewRefreshTokenRepository(s.DB)
+	var err error
+	s.identity, err = testsupport.CreateTestIdentity(s.DB, "refresh_token_blackbox_test-"+uuid.NewV4().String(), "KC")
+	require.Nil(s.T(), err)
+}
+
+func (s *refreshTokenBlackboxTest) TestCreateAndLoadByHash() {
+	// given
+	refreshToken := s.createRefreshToken(uuid.NewV4(), nil)
+	// when
+	loaded, err := s.repo.LoadByHash(s.Ctx, refreshToken.TokenHash)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), refreshToken.ID, loaded.ID)
+	assert.Equal(s.T(), s.identity.ID, loaded.IdentityID)
+	assert.Equal(s.T(), refreshToken.SessionID, loaded.SessionID)
+	assert.Equal(s.T(), "test-client", loaded.ClientID)
+	assert.Nil(s.T(), loaded.ParentID)
+	assert.Nil(s.T(), loaded.RotatedAt)
+	assert.Nil(s.T(), loaded.RevokedAt)
+}
+
+func (s *refreshTokenBlackboxTest) TestLoadByUnknownHashFails() {
+	// when
+	_, err := s.repo.LoadByHash(s.Ctx, refresh.Hash(uuid.NewV4().String()))
+	// then
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *refreshTokenBlackboxTest) TestMarkRotatedOnlyOnce() {
+	// given
+	refreshToken := s.createRefreshToken(uuid.NewV4(), nil)
+	// when
+	rotated, err := s.repo.MarkRotated(s.Ctx, refreshToken.ID)
+	require.Nil(s.T(), err)
+	rotatedTwice, err := s.repo.MarkRotated(s.Ctx, refreshToken.ID)
+	require.Nil(s.T(), err)
+	// then
+	assert.True(s.T(), rotated)
+	assert.False(s.T(), rotatedTwice)
+	loaded, err := s.repo.Load(s.Ctx, refreshToken.ID)
+	require.Nil(s.T(), err)
+	assert.NotNil(s.T(), loaded.RotatedAt)
+}
+
+func (s *refreshTokenBlackboxTest) TestRevokeSession() {
+	// given
+	sessionID := uuid.NewV4()
+	parent := s.createRefreshToken(sessionID, nil)
+	child := s.createRefreshToken(sessionID, &parent.ID)
+	other := s.createRefreshToken(uuid.NewV4(), nil)
+	// when
+	revoked, err := s.repo.RevokeSession(s.Ctx, sessionID)
+	// then
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(2), revoked)
+	refreshTokens, err := s.repo.ListBySession(s.Ctx, sessionID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), refreshTokens, 2)
+	assert.Equal(s.T(), parent.ID, refreshTokens[0].ID)
+	assert.Equal(s.T(), child.ID, refreshTokens[1].ID)
+	for _, refreshToken := range refreshTokens {
+		assert.NotNil(s.T(), refreshToken.RevokedAt)
+	}
+	loaded, err := s.repo.Load(s.Ctx, other.ID)
+	require.Nil(s.T(), err)
+	assert.Nil(s.T(), loaded.RevokedAt)
+	// a revoked refresh token can't be rotated
+	rotated, err := s.repo.MarkRotated(s.Ctx, child.ID)
+	require.Nil(s.T(), err)
+	assert.False(s.T(), rotated)
+}
+
+func (s *refreshTokenBlackboxTest) createRefreshToken(sessionID uuid.UUID, parentID *uuid.UUID) *refresh.RefreshToken {
+	issuedAt := time.Now()
+	if parentID != nil {
+		// keep the order of the tokens of the session
+		issuedAt = issuedAt.Add(time.Second)
+	}
+	refreshToken := &refresh.RefreshToken{
+		TokenHash:  refresh.Hash(uuid.NewV4().String()),
+		IdentityID: s.identity.ID,
+		ClientID:   "test-client",
+		SessionID:  sessionID,
+		ParentID:   parentID,
+		IssuedAt:   issuedAt,
+		ExpiresAt:  issuedAt.Add(time.Hour),
+	}
+	err := s.repo.Create(s.Ctx, refreshToken)
+	require.Nil(s.T(), err)
+	return refreshToken
+}
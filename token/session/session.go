@@ -0,0 +1,151 @@
+// Package session manages the login sessions of the users. A session starts when the Auth service issues
+// tokens to a user and lasts as long as its refresh token is rotated. The refresh tokens of a session are stored
+// hashed, so a session can be revoked and the reuse of a rotated refresh token, which is a sign of a stolen token,
+// revokes the whole session.
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/token/refresh"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Start issues the tokens of a new session for the identity and stores the refresh token.
+// The client ID identifies the client the tokens are issued to; it can be empty.
+func Start(ctx context.Context, db application.DB, manager token.Manager, req *goa.RequestData, identity account.Identity, sessionState string, clientID string) (*token.TokenSet, error) {
+	var tokenSet *token.TokenSet
+	err := application.Transactional(db, func(appl application.Application) error {
+		var err error
+		tokenSet, err = issue(ctx, appl, manager, req, identity, sessionState, clientID, uuid.NewV4(), nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokenSet, nil
+}
+
+// Refresh rotates the refresh token: new tokens of the same session are issued and the refresh token can't be used anymore.
+// Returns UnauthorizedError if the refresh token is unknown or revoked. The whole session is revoked if the refresh token
+// has already been rotated.
+func Refresh(ctx context.Context, db application.DB, manager token.Manager, req *goa.RequestData, refreshToken string, claims *token.TokenClaims) (*token.TokenSet, error) {
+	var tokenSet *token.TokenSet
+	var reused *refresh.RefreshToken
+	err := application.Transactional(db, func(appl application.Application) error {
+		stored, err := appl.RefreshTokens().LoadByHash(ctx, refresh.Hash(refreshToken))
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return errors.NewUnauthorizedError("unknown refresh token")
+			}
+			return errors.NewInternalError(ctx, err)
+		}
+		if stored.RevokedAt != nil {
+			return errors.NewUnauthorizedError("the refresh token has been revoked")
+		}
+		if stored.IdentityID.String() != claims.Subject {
+			return errors.NewUnauthorizedError("the refresh token has not been issued to the subject of the token")
+		}
+		rotated, err := appl.RefreshTokens().MarkRotated(ctx, stored.ID)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		if !rotated {
+			// the refresh token is reused: revoke the session, keeping the revocation when the transaction is committed
+			_, err = appl.RefreshTokens().RevokeSession(ctx, stored.SessionID)
+			if err != nil {
+				return errors.NewInternalError(ctx, err)
+			}
+			reused = stored
+			return nil
+		}
+		identities, err := appl.Identities().Query(account.IdentityFilterByID(stored.IdentityID), account.IdentityWithUser())
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		if len(identities) == 0 {
+			log.Error(ctx, map[string]interface{}{
+				"identity_id": stored.IdentityID,
+			}, "the identity of the refresh token doesn't exist")
+			return errors.NewUnauthorizedError("unknown identity")
+		}
+		tokenSet, err = issue(ctx, appl, manager, req, identities[0], claims.SessionState, stored.ClientID, stored.SessionID, &stored.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused != nil {
+		log.Warn(ctx, map[string]interface{}{
+			"identity_id":      reused.IdentityID,
+			"session_id":       reused.SessionID,
+			"refresh_token_id": reused.ID,
+		}, "a rotated refresh token has been reused. The session has been revoked")
+		return nil, errors.NewUnauthorizedError("the refresh token has already been used")
+	}
+	return tokenSet, nil
+}
+
+// Revoke revokes the refresh tokens of the session of the identity.
+// Returns NotFoundError if the identity has no such session.
+func Revoke(ctx context.Context, appl application.Application, identityID uuid.UUID, sessionID uuid.UUID) error {
+	refreshTokens, err := appl.RefreshTokens().ListBySession(ctx, sessionID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	if len(refreshTokens) == 0 || !uuid.Equal(refreshTokens[0].IdentityID, identityID) {
+		return errors.NewNotFoundError("session", sessionID.String())
+	}
+	_, err = appl.RefreshTokens().RevokeSession(ctx, sessionID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	return nil
+}
+
+// issue generates the tokens of the session and stores the refresh token.
+// Returns UnauthorizedError if the user has been deactivated or is not approved.
+func issue(ctx context.Context, appl application.Application, manager token.Manager, req *goa.RequestData, identity account.Identity, sessionState string, clientID string, sessionID uuid.UUID, parentID *uuid.UUID) (*token.TokenSet, error) {
+	if identity.User.Deactivated {
+		log.Warn(ctx, map[string]interface{}{
+			"identity_id": identity.ID,
+		}, "no tokens issued to a deactivated user")
+		return nil, errors.NewUnauthorizedError("the user account has been deactivated")
+	}
+	if identity.UserID.Valid && !identity.User.Approved() {
+		log.Warn(ctx, map[string]interface{}{
+			"identity_id":    identity.ID,
+			"approval_state": identity.User.ApprovalState,
+		}, "no tokens issued to a user who is not approved")
+		return nil, errors.NewUnauthorizedError("the user account is not approved")
+	}
+	tokenSet, err := manager.GenerateUserTokenSet(ctx, req, identity, sessionState, sessionID)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	claims, err := manager.ParseRefreshToken(ctx, *tokenSet.RefreshToken)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	err = appl.RefreshTokens().Create(ctx, &refresh.RefreshToken{
+		TokenHash:  refresh.Hash(*tokenSet.RefreshToken),
+		IdentityID: identity.ID,
+		ClientID:   clientID,
+		SessionID:  sessionID,
+		ParentID:   parentID,
+		IssuedAt:   time.Unix(claims.IssuedAt, 0),
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+	})
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return tokenSet, nil
+}
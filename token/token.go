@@ -10,6 +10,9 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/fabric8-services/fabric8-auth/account"
+	config "github.com/fabric8-services/fabric8-auth/configuration"
+	autherrors "github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
 	logintokencontext "github.com/fabric8-services/fabric8-auth/login/tokencontext"
 	"github.com/fabric8-services/fabric8-auth/rest"
@@ -33,13 +36,28 @@ import (
 
 const (
 	AuthServiceAccountID = "8f558668-4db7-4280-8e65-408bcb95f9d9"
+
+	// TokenExchangeGrantType is the grant type of the token exchange defined by RFC 8693
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// AccessTokenType is the RFC 8693 token type identifier of access tokens
+	AccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
 )
 
 // configuration represents configuration needed to construct a token manager
 type configuration interface {
+	UserTokenConfiguration
 	GetKeycloakEndpointCerts() string
 	GetServiceAccountPrivateKey() ([]byte, string)
 	GetDeprecatedServiceAccountPrivateKey() ([]byte, string)
+	GetServiceAccountPrivateKeyRetireAfter() time.Time
+	GetDeprecatedServiceAccountPrivateKeyRetireAfter() time.Time
+	GetServiceAccountKeyRing() []config.ServiceAccountKey
+}
+
+// UserTokenConfiguration represents the configuration of the user tokens issued by the token manager
+type UserTokenConfiguration interface {
+	GetUserAccessTokenExpiresIn() time.Duration
+	GetUserRefreshTokenExpiresIn() time.Duration
 }
 
 type JsonKeys struct {
@@ -55,11 +73,23 @@ type TokenClaims struct {
 	Email         string                `json:"email"`
 	Company       string                `json:"company"`
 	SessionState  string                `json:"session_state"`
+	SessionID     string                `json:"sid"`
+	Type          string                `json:"typ"`
 	Approved      bool                  `json:"approved"`
 	Authorization *AuthorizationPayload `json:"authorization"`
+	Actor         *Actor                `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// Actor represents the "act" claim of the tokens obtained by token exchange (RFC 8693).
+// It identifies the service account acting on behalf of the subject of the token.
+// Nested actors represent the prior actors of a delegation chain.
+type Actor struct {
+	Subject            string `json:"sub"`
+	ServiceAccountName string `json:"service_accountname,omitempty"`
+	Actor              *Actor `json:"act,omitempty"`
+}
+
 // AuthorizationPayload represents an authz payload in the rpt token
 type AuthorizationPayload struct {
 	Permissions []Permissions `json:"permissions"`
@@ -78,11 +108,17 @@ type Manager interface {
 	ParseTokenWithMapClaims(ctx context.Context, tokenString string) (jwt.MapClaims, error)
 	PublicKey(keyID string) *rsa.PublicKey
 	PublicKeys() []*rsa.PublicKey
+	SelectKeys(req *http.Request) []goajwt.Key
 	JsonWebKeys() JsonKeys
 	PemKeys() JsonKeys
 	AuthServiceAccountToken(req *goa.RequestData) (string, error)
 	GenerateServiceAccountToken(req *goa.RequestData, saID string, saName string) (string, error)
 	GenerateUnsignedServiceAccountToken(req *goa.RequestData, saID string, saName string) *jwt.Token
+	GenerateUserTokenSet(ctx context.Context, req *goa.RequestData, identity account.Identity, sessionState string, sessionID uuid.UUID) (*TokenSet, error)
+	ParseRefreshToken(ctx context.Context, tokenString string) (*TokenClaims, error)
+	ExchangeToken(ctx context.Context, req *goa.RequestData, subjectToken string, saID string, saName string, audience string) (*TokenSet, error)
+	CheckSigningKeys() error
+	UpdateKeyRing(keys []config.ServiceAccountKey) error
 }
 
 // PrivateKey represents an RSA private key with a Key ID
@@ -97,20 +133,23 @@ type PublicKey struct {
 }
 
 type tokenManager struct {
-	publicKeysMap            map[string]*rsa.PublicKey
-	publicKeys               []*PublicKey
-	serviceAccountPrivateKey *PrivateKey
-	jsonWebKeys              JsonKeys
-	pemKeys                  JsonKeys
-	serviceAccountToken      string
-	serviceAccountLock       sync.RWMutex
+	publicKeysMap         map[string]*rsa.PublicKey
+	publicKeys            []*PublicKey
+	keyRing               *keyRing
+	configuredKeys        []*SigningKey
+	serviceAccountToken   *serviceAccountToken
+	serviceAccountLock    sync.RWMutex
+	accessTokenExpiresIn  time.Duration
+	refreshTokenExpiresIn time.Duration
 }
 
 // NewManager returns a new token Manager for handling tokens
 func NewManager(config configuration) (Manager, error) {
 	// Load public keys from Keycloak and add them to the manager
 	tm := &tokenManager{
-		publicKeysMap: map[string]*rsa.PublicKey{},
+		publicKeysMap:         map[string]*rsa.PublicKey{},
+		accessTokenExpiresIn:  config.GetUserAccessTokenExpiresIn(),
+		refreshTokenExpiresIn: config.GetUserRefreshTokenExpiresIn(),
 	}
 
 	keycloakKeys, err := FetchKeys(config.GetKeycloakEndpointCerts())
@@ -126,8 +165,10 @@ func NewManager(config configuration) (Manager, error) {
 		}, "Public key added")
 	}
 
-	// Load the service account private key and add it to the manager.
-	// Extract the public key from it and add it to the map of public keys.
+	// Load the service account private key, the deprecated one if any and the keys of the key ring.
+	// The public keys are published as long as the keys are not retired. The service account private key
+	// and the deprecated one are retired after their configured retirement time, if any, so the service
+	// can be migrated to the key ring without downtime.
 	key, kid := config.GetServiceAccountPrivateKey()
 	if len(key) == 0 || kid == "" {
 		log.Error(nil, map[string]interface{}{
@@ -140,14 +181,14 @@ func NewManager(config configuration) (Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	tm.serviceAccountPrivateKey = &PrivateKey{KeyID: kid, Key: rsaServiceAccountKey}
-	pk := &rsaServiceAccountKey.PublicKey
-	tm.publicKeysMap[kid] = pk
-	tm.publicKeys = append(tm.publicKeys, &PublicKey{KeyID: kid, Key: pk})
+	signingKeys := []*SigningKey{{
+		PrivateKey:  PrivateKey{KeyID: kid, Key: rsaServiceAccountKey},
+		RetireAfter: config.GetServiceAccountPrivateKeyRetireAfter(),
+	}}
 	log.Info(nil, map[string]interface{}{
-		"kid": kid,
+		"kid":          kid,
+		"retire_after": config.GetServiceAccountPrivateKeyRetireAfter(),
 	}, "Service account private key added")
-	// Extract public key from deprecated service account private key if any and add it to the manager
 	key, kid = config.GetDeprecatedServiceAccountPrivateKey()
 	if len(key) == 0 || kid == "" {
 		log.Debug(nil, map[string]interface{}{
@@ -159,42 +200,78 @@ func NewManager(config configuration) (Manager, error) {
 		if err != nil {
 			return nil, err
 		}
-		pk := &rsaServiceAccountKey.PublicKey
-		tm.publicKeysMap[kid] = pk
-		tm.publicKeys = append(tm.publicKeys, &PublicKey{KeyID: kid, Key: pk})
+		signingKeys = append(signingKeys, &SigningKey{
+			PrivateKey:  PrivateKey{KeyID: kid, Key: rsaServiceAccountKey},
+			RetireAfter: config.GetDeprecatedServiceAccountPrivateKeyRetireAfter(),
+		})
 		log.Info(nil, map[string]interface{}{
-			"kid": kid,
+			"kid":          kid,
+			"retire_after": config.GetDeprecatedServiceAccountPrivateKeyRetireAfter(),
 		}, "Deprecated service account private key added")
 	}
+	tm.configuredKeys = signingKeys
+	ringKeys, err := parseKeyRing(config.GetServiceAccountKeyRing())
+	if err != nil {
+		return nil, err
+	}
+	for _, ringKey := range ringKeys {
+		log.Info(nil, map[string]interface{}{
+			"kid":          ringKey.KeyID,
+			"not_before":   ringKey.NotBefore,
+			"retire_after": ringKey.RetireAfter,
+		}, "Service account key ring key added")
+	}
+	tm.keyRing = newKeyRing(append(append([]*SigningKey{}, signingKeys...), ringKeys...)...)
+	if tm.keyRing.signingKey() == nil {
+		return nil, errors.New("no active key in the service account key ring")
+	}
 
-	jsonKeys, err := toJsonWebKeys(tm.publicKeys)
+	// Check that all the public keys can be published
+	_, err = toJsonWebKeys(tm.allPublicKeys())
 	if err != nil {
 		log.Error(nil, map[string]interface{}{
 			"err": err,
 		}, "unable to convert public keys to JSON Web Keys")
 		return nil, errors.New("unable to convert public keys to JSON Web Keys")
 	}
-	tm.jsonWebKeys = jsonKeys
-
-	jsonKeys, err = toPemKeys(tm.publicKeys)
+	_, err = toPemKeys(tm.allPublicKeys())
 	if err != nil {
 		log.Error(nil, map[string]interface{}{
 			"err": err,
 		}, "unable to convert public keys to PEM Keys")
 		return nil, errors.New("unable to convert public keys to PEM Keys")
 	}
-	tm.pemKeys = jsonKeys
 
 	return tm, nil
 }
 
+// parseKeyRing parses the private keys of the given keys of the key ring
+func parseKeyRing(keys []config.ServiceAccountKey) ([]*SigningKey, error) {
+	var signingKeys []*SigningKey
+	for _, ringKey := range keys {
+		rsaServiceAccountKey, err := jwt.ParseRSAPrivateKeyFromPEM(ringKey.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid private key %s of the service account key ring", ringKey.KeyID)
+		}
+		signingKeys = append(signingKeys, &SigningKey{
+			PrivateKey:  PrivateKey{KeyID: ringKey.KeyID, Key: rsaServiceAccountKey},
+			NotBefore:   ringKey.NotBefore,
+			RetireAfter: ringKey.RetireAfter,
+		})
+	}
+	return signingKeys, nil
+}
+
 // NewManagerWithPublicKey returns a new token Manager for handling tokens with the only public key
-func NewManagerWithPublicKey(key *PublicKey, serviceAccountKey *PrivateKey) Manager {
-	saPublicKey := &serviceAccountKey.Key.PublicKey
+func NewManagerWithPublicKey(key *PublicKey, serviceAccountKey *PrivateKey, config UserTokenConfiguration) Manager {
+	signingKey := &SigningKey{PrivateKey: *serviceAccountKey}
 	return &tokenManager{
-		publicKeysMap:            map[string]*rsa.PublicKey{key.KeyID: key.Key, serviceAccountKey.KeyID: saPublicKey},
-		publicKeys:               []*PublicKey{key, {KeyID: serviceAccountKey.KeyID, Key: saPublicKey}},
-		serviceAccountPrivateKey: serviceAccountKey,
+		publicKeysMap:         map[string]*rsa.PublicKey{key.KeyID: key.Key},
+		publicKeys:            []*PublicKey{key},
+		keyRing:               newKeyRing(signingKey),
+		configuredKeys:        []*SigningKey{signingKey},
+		accessTokenExpiresIn:  config.GetUserAccessTokenExpiresIn(),
+		refreshTokenExpiresIn: config.GetUserRefreshTokenExpiresIn(),
 	}
 }
 
@@ -293,12 +370,29 @@ func toJsonWebKeys(publicKeys []*PublicKey) (JsonKeys, error) {
 
 // JsonWebKeys returns all the public keys in JSON Web Keys format
 func (mgm *tokenManager) JsonWebKeys() JsonKeys {
-	return mgm.jsonWebKeys
+	keys, err := toJsonWebKeys(mgm.allPublicKeys())
+	if err != nil {
+		log.Error(nil, map[string]interface{}{
+			"err": err,
+		}, "unable to convert public keys to JSON Web Keys")
+	}
+	return keys
 }
 
 // PemKeys returns all the public keys in PEM-like format (PEM without header and footer)
 func (mgm *tokenManager) PemKeys() JsonKeys {
-	return mgm.pemKeys
+	keys, err := toPemKeys(mgm.allPublicKeys())
+	if err != nil {
+		log.Error(nil, map[string]interface{}{
+			"err": err,
+		}, "unable to convert public keys to PEM Keys")
+	}
+	return keys
+}
+
+// allPublicKeys returns the Keycloak public keys followed by the public keys of the key ring which are published
+func (mgm *tokenManager) allPublicKeys() []*PublicKey {
+	return append(append([]*PublicKey{}, mgm.publicKeys...), mgm.keyRing.publicKeys()...)
 }
 
 func toPemKeys(publicKeys []*PublicKey) (JsonKeys, error) {
@@ -358,6 +452,34 @@ func (mgm *tokenManager) keyFunction(ctx context.Context) jwt.Keyfunc {
 	}
 }
 
+// CheckSigningKeys returns an error if there is no active key in the key ring to sign the tokens with
+func (mgm *tokenManager) CheckSigningKeys() error {
+	if mgm.keyRing.signingKey() == nil {
+		return errors.New("no active key in the service account key ring")
+	}
+	return nil
+}
+
+// UpdateKeyRing replaces the keys of the key ring with the given keys, which are reloaded from the configuration
+// so the keys added to or removed from the key ring directory are taken into account without restarting the service.
+// The service account private key and the deprecated one are kept. The key ring is left unchanged
+// if a key is invalid or if no key would be active.
+func (mgm *tokenManager) UpdateKeyRing(keys []config.ServiceAccountKey) error {
+	ringKeys, err := parseKeyRing(keys)
+	if err != nil {
+		return err
+	}
+	updated := newKeyRing(append(append([]*SigningKey{}, mgm.configuredKeys...), ringKeys...)...)
+	if updated.signingKey() == nil {
+		return errors.New("no active key in the service account key ring")
+	}
+	mgm.keyRing.setKeys(updated.keys...)
+	log.Debug(nil, map[string]interface{}{
+		"keys": len(ringKeys),
+	}, "service account key ring updated")
+	return nil
+}
+
 func (mgm *tokenManager) Locate(ctx context.Context) (uuid.UUID, error) {
 	token := goajwt.ContextJWT(ctx)
 	if token == nil {
@@ -376,50 +498,144 @@ func (mgm *tokenManager) Locate(ctx context.Context) (uuid.UUID, error) {
 
 // PublicKey returns the public key by the ID
 func (mgm *tokenManager) PublicKey(keyID string) *rsa.PublicKey {
-	return mgm.publicKeysMap[keyID]
+	if key, found := mgm.publicKeysMap[keyID]; found {
+		return key
+	}
+	return mgm.keyRing.publicKey(keyID)
+}
+
+// SelectKeys returns the public key identified by the "kid" header of the token of the request, if any.
+// It implements the KeyResolver interface of the goa JWT middleware, so the key is looked up for every request:
+// the tokens signed with a retired key are rejected as soon as the key is retired and the tokens signed with
+// a key added to the key ring since the start of the service are accepted.
+func (mgm *tokenManager) SelectKeys(req *http.Request) []goajwt.Key {
+	kid := tokenKeyID(req)
+	if kid == "" {
+		return nil
+	}
+	key := mgm.PublicKey(kid)
+	if key == nil {
+		return nil
+	}
+	return []goajwt.Key{key}
+}
+
+// tokenKeyID returns the "kid" header of the bearer token of the request, if any. The token is not verified.
+func tokenKeyID(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+		return ""
+	}
+	segments := strings.Split(strings.TrimSpace(authorization[len("bearer "):]), ".")
+	if len(segments) != 3 {
+		return ""
+	}
+	data, err := jwt.DecodeSegment(segments[0])
+	if err != nil {
+		return ""
+	}
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	if json.Unmarshal(data, &header) != nil {
+		return ""
+	}
+	return header.KeyID
 }
 
 // PublicKeys returns all the public keys
 func (mgm *tokenManager) PublicKeys() []*rsa.PublicKey {
-	keys := make([]*rsa.PublicKey, 0, len(mgm.publicKeysMap))
-	for _, key := range mgm.publicKeys {
+	publicKeys := mgm.allPublicKeys()
+	keys := make([]*rsa.PublicKey, 0, len(publicKeys))
+	for _, key := range publicKeys {
 		keys = append(keys, key.Key)
 	}
 	return keys
 }
 
-// AuthServiceAccountToken returns the service account token which authenticates the Auth service
+const (
+	// authServiceAccountTokenExpiresIn is the lifetime of the service account token which authenticates the Auth service
+	authServiceAccountTokenExpiresIn = 24 * time.Hour
+	// authServiceAccountTokenRenewBefore is how long before its expiration the cached service account token is re-signed
+	authServiceAccountTokenRenewBefore = time.Hour
+)
+
+// serviceAccountToken is a signed service account token along with the ID of the key used to sign it and its expiration time
+type serviceAccountToken struct {
+	token     string
+	keyID     string
+	expiresAt time.Time
+}
+
+// valid returns true if the token is still signed with the current signing key and is not about to expire
+func (t *serviceAccountToken) valid(signingKeyID string, now time.Time) bool {
+	return t != nil && t.keyID == signingKeyID && now.Before(t.expiresAt.Add(-authServiceAccountTokenRenewBefore))
+}
+
+// AuthServiceAccountToken returns the service account token which authenticates the Auth service.
+// The token is cached and re-signed when the signing key of the key ring changes or when the token is about to expire.
 func (mgm *tokenManager) AuthServiceAccountToken(req *goa.RequestData) (string, error) {
-	var token string
-	if token = mgm.getServiceAccountToken(); token == "" {
-		return mgm.initServiceAccountToken(req)
+	if token := mgm.getServiceAccountToken(); token != nil {
+		return token.token, nil
 	}
-	return token, nil
+	return mgm.initServiceAccountToken(req)
 }
 
-func (mgm *tokenManager) getServiceAccountToken() string {
+// getServiceAccountToken returns the cached service account token if it's still valid, nil otherwise
+func (mgm *tokenManager) getServiceAccountToken() *serviceAccountToken {
 	mgm.serviceAccountLock.RLock()
 	defer mgm.serviceAccountLock.RUnlock()
-	return mgm.serviceAccountToken
+	signingKey := mgm.keyRing.signingKey()
+	if signingKey != nil && mgm.serviceAccountToken.valid(signingKey.KeyID, time.Now()) {
+		return mgm.serviceAccountToken
+	}
+	return nil
 }
 
 func (mgm *tokenManager) initServiceAccountToken(req *goa.RequestData) (string, error) {
 	mgm.serviceAccountLock.Lock()
 	defer mgm.serviceAccountLock.Unlock()
 
-	tokenStr, err := mgm.GenerateServiceAccountToken(req, AuthServiceAccountID, "fabric8-auth")
+	now := time.Now()
+	signingKey := mgm.keyRing.signingKey()
+	if signingKey == nil {
+		return "", errors.New("no active key in the service account key ring")
+	}
+	// Another request may have re-signed the token in the meantime
+	if mgm.serviceAccountToken.valid(signingKey.KeyID, now) {
+		return mgm.serviceAccountToken.token, nil
+	}
+
+	token := mgm.GenerateUnsignedServiceAccountToken(req, AuthServiceAccountID, "fabric8-auth")
+	expiresAt := now.Add(authServiceAccountTokenExpiresIn)
+	token.Claims.(jwt.MapClaims)["exp"] = expiresAt.Unix()
+	tokenStr, err := mgm.signToken(token)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
-	mgm.serviceAccountToken = tokenStr
+	mgm.serviceAccountToken = &serviceAccountToken{
+		token:     tokenStr,
+		keyID:     token.Header["kid"].(string),
+		expiresAt: expiresAt,
+	}
 
-	return mgm.serviceAccountToken, nil
+	return tokenStr, nil
 }
 
 // GenerateServiceAccountToken generates and signs a new Service Account Token (Protection API Token)
 func (mgm *tokenManager) GenerateServiceAccountToken(req *goa.RequestData, saID string, saName string) (string, error) {
 	token := mgm.GenerateUnsignedServiceAccountToken(req, saID, saName)
-	tokenStr, err := token.SignedString(mgm.serviceAccountPrivateKey.Key)
+	return mgm.signToken(token)
+}
+
+// signToken signs the token with the key of the key ring identified by the "kid" header of the token
+func (mgm *tokenManager) signToken(token *jwt.Token) (string, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := mgm.keyRing.privateKey(kid)
+	if key == nil {
+		return "", errors.Errorf("no such key in the key ring: %s", kid)
+	}
+	tokenStr, err := token.SignedString(key.Key)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -429,7 +645,7 @@ func (mgm *tokenManager) GenerateServiceAccountToken(req *goa.RequestData, saID
 // GenerateUnsignedServiceAccountToken generates an unsigned Service Account Token (Protection API Token)
 func (mgm *tokenManager) GenerateUnsignedServiceAccountToken(req *goa.RequestData, saID string, saName string) *jwt.Token {
 	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = mgm.serviceAccountPrivateKey.KeyID
+	token.Header["kid"] = mgm.keyRing.signingKey().KeyID
 	token.Claims.(jwt.MapClaims)["service_accountname"] = saName
 	token.Claims.(jwt.MapClaims)["sub"] = saID
 	token.Claims.(jwt.MapClaims)["jti"] = uuid.NewV4().String()
@@ -439,6 +655,171 @@ func (mgm *tokenManager) GenerateUnsignedServiceAccountToken(req *goa.RequestDat
 	return token
 }
 
+// GenerateUserTokenSet generates and signs a new access token and a new refresh token for the identity.
+// The tokens are signed with the service account private key, so they can be verified with the published keys.
+// The Keycloak session state is kept in the tokens as it's needed to link the user account to external providers.
+// The ID of the login session the tokens belong to is set in the "sid" claim.
+func (mgm *tokenManager) GenerateUserTokenSet(ctx context.Context, req *goa.RequestData, identity account.Identity, sessionState string, sessionID uuid.UUID) (*TokenSet, error) {
+	now := time.Now()
+	accessToken := mgm.newUserToken(req, identity.ID.String(), sessionState, sessionID, "Bearer", now, mgm.accessTokenExpiresIn)
+	claims := accessToken.Claims.(jwt.MapClaims)
+	claims["name"] = identity.User.FullName
+	claims["preferred_username"] = identity.Username
+	claims["given_name"], claims["family_name"] = splitFullName(identity.User.FullName)
+	claims["email"] = identity.User.Email
+	claims["company"] = identity.User.Company
+	claims["approved"] = identity.User.Approved()
+	accessTokenStr, err := mgm.signToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := mgm.newUserToken(req, identity.ID.String(), sessionState, sessionID, "Refresh", now, mgm.refreshTokenExpiresIn)
+	refreshTokenStr, err := mgm.signToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn := int64(mgm.accessTokenExpiresIn.Seconds())
+	refreshExpiresIn := int64(mgm.refreshTokenExpiresIn.Seconds())
+	var notBeforePolicy int64
+	tokenType := "bearer"
+	log.Debug(ctx, map[string]interface{}{
+		"identity_id": identity.ID,
+	}, "user tokens generated")
+	return &TokenSet{
+		AccessToken:      &accessTokenStr,
+		ExpiresIn:        &expiresIn,
+		NotBeforePolicy:  &notBeforePolicy,
+		RefreshExpiresIn: &refreshExpiresIn,
+		RefreshToken:     &refreshTokenStr,
+		TokenType:        &tokenType,
+	}, nil
+}
+
+func (mgm *tokenManager) newUserToken(req *goa.RequestData, identityID string, sessionState string, sessionID uuid.UUID, tokenType string, now time.Time, expiresIn time.Duration) *jwt.Token {
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = mgm.keyRing.signingKey().KeyID
+	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = uuid.NewV4().String()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = 0
+	claims["exp"] = now.Add(expiresIn).Unix()
+	claims["iss"] = rest.AbsoluteURL(req, "")
+	claims["typ"] = tokenType
+	claims["sub"] = identityID
+	claims["session_state"] = sessionState
+	claims["sid"] = sessionID.String()
+	return token
+}
+
+// splitFullName splits the full name of a user into the given name and the family name
+func splitFullName(fullName string) (string, string) {
+	names := strings.SplitN(strings.TrimSpace(fullName), " ", 2)
+	if len(names) < 2 {
+		return names[0], ""
+	}
+	return names[0], strings.TrimSpace(names[1])
+}
+
+// ParseRefreshToken parses and validates a refresh token issued by the token manager
+func (mgm *tokenManager) ParseRefreshToken(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := mgm.keyRing.publicKey(kid)
+		if key == nil {
+			return nil, errors.Errorf("the token is not signed by the Auth service: %v", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(*TokenClaims)
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+	if claims.Type != "Refresh" {
+		return nil, errors.Errorf("not a refresh token: %s", claims.Type)
+	}
+	if _, err := uuid.FromString(claims.Subject); err != nil {
+		return nil, errors.New("subject claim from token is not UUID " + err.Error())
+	}
+	return claims, nil
+}
+
+// ExchangeToken validates the subject token and issues a new access token which allows the service account
+// to act on behalf of the subject of the token (RFC 8693 delegation).
+// The new token is restricted to the given audience, names the service account in its "act" claim
+// and doesn't outlive the subject token. The authorization payload of the subject token is not copied.
+// A subject token which is itself obtained by token exchange can only be exchanged by a service account
+// it's intended for.
+func (mgm *tokenManager) ExchangeToken(ctx context.Context, req *goa.RequestData, subjectToken string, saID string, saName string, audience string) (*TokenSet, error) {
+	claims, err := mgm.ParseToken(ctx, subjectToken)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":                  err,
+			"service_account_name": saName,
+		}, "invalid subject token")
+		return nil, autherrors.NewBadParameterError("subject_token", "invalid token").Expected("a valid access token")
+	}
+	err = CheckClaims(claims)
+	if err != nil {
+		return nil, autherrors.NewBadParameterError("subject_token", err.Error()).Expected("a user access token")
+	}
+	if claims.Actor != nil && claims.Audience != saName {
+		log.Error(ctx, map[string]interface{}{
+			"audience":             claims.Audience,
+			"service_account_name": saName,
+		}, "the subject token is not intended for the service account")
+		return nil, autherrors.NewUnauthorizedError("the subject token is not intended for the service account")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, autherrors.NewBadParameterError("subject_token", "no expiration").Expected("an access token with an expiration time")
+	}
+
+	now := time.Now().Unix()
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = mgm.keyRing.signingKey().KeyID
+	token.Claims.(jwt.MapClaims)["jti"] = uuid.NewV4().String()
+	token.Claims.(jwt.MapClaims)["iat"] = now
+	token.Claims.(jwt.MapClaims)["nbf"] = 0
+	token.Claims.(jwt.MapClaims)["exp"] = claims.ExpiresAt
+	token.Claims.(jwt.MapClaims)["iss"] = rest.AbsoluteURL(req, "")
+	token.Claims.(jwt.MapClaims)["aud"] = audience
+	token.Claims.(jwt.MapClaims)["typ"] = "Bearer"
+	token.Claims.(jwt.MapClaims)["sub"] = claims.Subject
+	token.Claims.(jwt.MapClaims)["session_state"] = claims.SessionState
+	token.Claims.(jwt.MapClaims)["approved"] = claims.Approved
+	token.Claims.(jwt.MapClaims)["name"] = claims.Name
+	token.Claims.(jwt.MapClaims)["preferred_username"] = claims.Username
+	token.Claims.(jwt.MapClaims)["given_name"] = claims.GivenName
+	token.Claims.(jwt.MapClaims)["family_name"] = claims.FamilyName
+	token.Claims.(jwt.MapClaims)["email"] = claims.Email
+	token.Claims.(jwt.MapClaims)["company"] = claims.Company
+	token.Claims.(jwt.MapClaims)["act"] = &Actor{
+		Subject:            saID,
+		ServiceAccountName: saName,
+		Actor:              claims.Actor,
+	}
+	tokenStr, err := mgm.signToken(token)
+	if err != nil {
+		return nil, err
+	}
+	expiresIn := claims.ExpiresAt - now
+	tokenType := "bearer"
+	log.Info(ctx, map[string]interface{}{
+		"identity_id":          claims.Subject,
+		"service_account_name": saName,
+		"audience":             audience,
+	}, "token exchanged")
+	return &TokenSet{
+		AccessToken: &tokenStr,
+		ExpiresIn:   &expiresIn,
+		TokenType:   &tokenType,
+	}, nil
+}
+
 // IsSpecificServiceAccount checks if the request is done by a service account listed in the names param
 // based on the JWT Token provided in context
 func IsSpecificServiceAccount(ctx context.Context, names []string) bool {
@@ -492,6 +873,73 @@ func CheckClaims(claims *TokenClaims) error {
 	return nil
 }
 
+// AccessTokenValidation returns the validation function of the JWT middlewares.
+// It rejects the tokens which are signed by a trusted key but are not access tokens intended for the Auth service,
+// such as the refresh tokens issued by the Auth service or the tokens obtained by token exchange.
+// The tokens with an audience are only accepted if it's one of the given audiences.
+func AccessTokenValidation(audiences ...string) goa.Middleware {
+	return func(nextHandler goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			token := goajwt.ContextJWT(ctx)
+			if token == nil {
+				return goajwt.ErrJWTError("missing token")
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				return goajwt.ErrJWTError("unsupported token claims")
+			}
+			err := CheckAccessTokenClaims(claims, audiences...)
+			if err != nil {
+				return goajwt.ErrJWTError(err)
+			}
+			return nextHandler(ctx, rw, req)
+		}
+	}
+}
+
+// CheckAccessTokenClaims checks that the token can be used as an access token by the Auth service.
+// The tokens of the service accounts have no type. The tokens naming an actor in their "act" claim
+// are only intended for the service they have been exchanged for.
+func CheckAccessTokenClaims(claims jwt.MapClaims, audiences ...string) error {
+	if tokenType, found := claims["typ"]; found && tokenType != "Bearer" {
+		return errors.Errorf("not an access token: %v", tokenType)
+	}
+	if _, found := claims["act"]; found {
+		return errors.New("the token is issued to a service account acting on behalf of its subject")
+	}
+	if !hasAudience(claims["aud"], audiences) {
+		return errors.Errorf("the token is intended for another audience: %v", claims["aud"])
+	}
+	return nil
+}
+
+// hasAudience checks if the audience claim is missing or names one of the given audiences
+func hasAudience(aud interface{}, audiences []string) bool {
+	switch typed := aud.(type) {
+	case nil:
+		return true
+	case string:
+		return typed == "" || contains(audiences, typed)
+	case []interface{}:
+		for _, a := range typed {
+			if s, ok := a.(string); ok && contains(audiences, s) {
+				return true
+			}
+		}
+		return len(typed) == 0
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // ReadManagerFromContext extracts the token manager
 func ReadManagerFromContext(ctx context.Context) (*tokenManager, error) {
 	tm := logintokencontext.ReadTokenManagerFromContext(ctx)
@@ -48,9 +48,9 @@ func (s *TokenWhiteBoxTest) TestKeycloakTokensLoaded() {
 	}
 	require.True(s.T(), len(s.manager.PublicKeys()) >= minKeyNumber)
 
-	require.Equal(s.T(), len(s.manager.publicKeys), len(s.manager.PublicKeys()))
+	require.Equal(s.T(), len(s.manager.allPublicKeys()), len(s.manager.PublicKeys()))
 	require.Equal(s.T(), len(s.manager.publicKeys), len(s.manager.publicKeysMap))
-	for i, k := range s.manager.publicKeys {
+	for i, k := range s.manager.allPublicKeys() {
 		require.NotEqual(s.T(), "", k.KeyID)
 		require.NotNil(s.T(), s.manager.PublicKey(k.KeyID))
 		require.Equal(s.T(), s.manager.PublicKeys()[i], k.Key)
@@ -76,8 +76,8 @@ func (s *TokenWhiteBoxTest) TestAuthServiceAccount() {
 		if kid == nil {
 			return nil, errors.New("There is no 'kid' header in the token")
 		}
-		if fmt.Sprintf("%s", kid) != s.manager.serviceAccountPrivateKey.KeyID {
-			return nil, errors.New(fmt.Sprintf("The key ID %s doesn't match the private key ID %s", kid, s.manager.serviceAccountPrivateKey.KeyID))
+		if fmt.Sprintf("%s", kid) != s.manager.keyRing.signingKey().KeyID {
+			return nil, errors.New(fmt.Sprintf("The key ID %s doesn't match the private key ID %s", kid, s.manager.keyRing.signingKey().KeyID))
 		}
 		key := s.manager.PublicKey(fmt.Sprintf("%s", kid))
 		if key == nil {
@@ -106,6 +106,24 @@ func (s *TestTokenSuite) TestCheckClaimsFails() {
 	assert.NotNil(s.T(), token.CheckClaims(claimsNoSubject))
 }
 
+func (s *TestTokenSuite) TestCheckAccessTokenClaims() {
+	assert.Nil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer"}))
+	// the tokens of the service accounts have no type
+	assert.Nil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"service_accountname": "fabric8-wit"}))
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Refresh"}))
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "ID"}))
+
+	// the audience, if any, must be one of the given audiences
+	assert.Nil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "aud": "fabric8-online-platform"}, "fabric8-online-platform"))
+	assert.Nil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "aud": []interface{}{"account", "fabric8-online-platform"}}, "fabric8-online-platform"))
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "aud": "fabric8-tenant"}, "fabric8-online-platform"))
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "aud": []interface{}{"fabric8-tenant"}}, "fabric8-online-platform"))
+	// the exchanged tokens are rejected whatever their audience
+	act := map[string]interface{}{"sub": uuid.NewV4().String(), "service_accountname": "fabric8-wit"}
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "act": act}))
+	assert.NotNil(s.T(), token.CheckAccessTokenClaims(jwt.MapClaims{"typ": "Bearer", "act": act, "aud": "fabric8-online-platform"}, "fabric8-online-platform"))
+}
+
 func (s *TestTokenSuite) TestLocateTokenInContex() {
 	id := uuid.NewV4()
 
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/fabric8-services/fabric8-auth/account"
 	config "github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/resource"
 
@@ -49,13 +51,13 @@ func newTestTokenManager() *tokenManager {
 	if err != nil {
 		panic(fmt.Errorf("failed to parse priviate key: %s", err.Error()))
 	}
-	serviceAccountKey := &PrivateKey{KeyID: "9MLnViaRkhVj1GT9kpWUkwHIwUD-wZfUxR-3CpkE-Xs", Key: rsaServiceAccountKey}
-	saPublicKey := &serviceAccountKey.Key.PublicKey
+	serviceAccountKey := &SigningKey{PrivateKey: PrivateKey{KeyID: "9MLnViaRkhVj1GT9kpWUkwHIwUD-wZfUxR-3CpkE-Xs", Key: rsaServiceAccountKey}}
 
 	return &tokenManager{
-		publicKeysMap:            map[string]*rsa.PublicKey{serviceAccountKey.KeyID: saPublicKey},
-		publicKeys:               []*PublicKey{{KeyID: serviceAccountKey.KeyID, Key: saPublicKey}},
-		serviceAccountPrivateKey: serviceAccountKey,
+		publicKeysMap:         map[string]*rsa.PublicKey{},
+		keyRing:               newKeyRing(serviceAccountKey),
+		accessTokenExpiresIn:  time.Hour,
+		refreshTokenExpiresIn: 24 * time.Hour,
 	}
 }
 
@@ -97,8 +99,8 @@ func (s *TestWhiteboxTokenSuite) checkServiceAccountToken(rawToken string, saID
 		if kid == nil {
 			return nil, errors.New("There is no 'kid' header in the token")
 		}
-		if fmt.Sprintf("%s", kid) != s.tokenManager.serviceAccountPrivateKey.KeyID {
-			return nil, errors.New(fmt.Sprintf("The key ID %s doesn't match the private key ID %s", kid, s.tokenManager.serviceAccountPrivateKey.KeyID))
+		if fmt.Sprintf("%s", kid) != s.tokenManager.keyRing.signingKey().KeyID {
+			return nil, errors.New(fmt.Sprintf("The key ID %s doesn't match the private key ID %s", kid, s.tokenManager.keyRing.signingKey().KeyID))
 		}
 		key := s.tokenManager.PublicKey(fmt.Sprintf("%s", kid))
 		if key == nil {
@@ -127,6 +129,87 @@ func (s *TestWhiteboxTokenSuite) checkServiceAccountToken(rawToken string, saID
 	assert.False(s.T(), IsSpecificServiceAccount(ctx, []string{saName + "wrongName", saName + "wrongName"}))
 }
 
+func (s *TestWhiteboxTokenSuite) TestUserTokenSetGeneratedOK() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	identity := account.Identity{
+		ID:       uuid.NewV4(),
+		Username: "testuser",
+		User: account.User{
+			FullName:      "Test Developer User",
+			Email:         "testuser@example.com",
+			Company:       "Company Inc.",
+			ApprovalState: account.KeycloakApprovalState(true),
+		},
+	}
+	sessionState := uuid.NewV4().String()
+	sessionID := uuid.NewV4()
+
+	tokenSet, err := s.tokenManager.GenerateUserTokenSet(context.Background(), r, identity, sessionState, sessionID)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(60*60), *tokenSet.ExpiresIn)
+	assert.Equal(s.T(), int64(24*60*60), *tokenSet.RefreshExpiresIn)
+	assert.Equal(s.T(), "bearer", *tokenSet.TokenType)
+
+	claims, err := s.tokenManager.ParseToken(context.Background(), *tokenSet.AccessToken)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), CheckClaims(claims))
+	assert.Equal(s.T(), identity.ID.String(), claims.Subject)
+	assert.Equal(s.T(), "testuser", claims.Username)
+	assert.Equal(s.T(), "Test Developer User", claims.Name)
+	assert.Equal(s.T(), "Test", claims.GivenName)
+	assert.Equal(s.T(), "Developer User", claims.FamilyName)
+	assert.Equal(s.T(), "testuser@example.com", claims.Email)
+	assert.Equal(s.T(), "Company Inc.", claims.Company)
+	assert.Equal(s.T(), sessionState, claims.SessionState)
+	assert.Equal(s.T(), sessionID.String(), claims.SessionID)
+	assert.Equal(s.T(), "Bearer", claims.Type)
+	assert.Equal(s.T(), "http://example.com", claims.Issuer)
+	assert.True(s.T(), claims.Approved)
+
+	refreshClaims, err := s.tokenManager.ParseRefreshToken(context.Background(), *tokenSet.RefreshToken)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), identity.ID.String(), refreshClaims.Subject)
+	assert.Equal(s.T(), sessionState, refreshClaims.SessionState)
+	assert.Equal(s.T(), sessionID.String(), refreshClaims.SessionID)
+
+	// The access token is not a refresh token
+	_, err = s.tokenManager.ParseRefreshToken(context.Background(), *tokenSet.AccessToken)
+	require.NotNil(s.T(), err)
+}
+
+func (s *TestWhiteboxTokenSuite) TestUserTokenSetOfNotApprovedUser() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	identity := account.Identity{
+		ID:       uuid.NewV4(),
+		Username: "testuser",
+		User: account.User{
+			ApprovalState: account.KeycloakApprovalState(false),
+		},
+	}
+
+	tokenSet, err := s.tokenManager.GenerateUserTokenSet(context.Background(), r, identity, "", uuid.NewV4())
+	require.Nil(s.T(), err)
+	claims, err := s.tokenManager.ParseToken(context.Background(), *tokenSet.AccessToken)
+	require.Nil(s.T(), err)
+	assert.False(s.T(), claims.Approved)
+}
+
+func (s *TestWhiteboxTokenSuite) TestParseExpiredRefreshTokenFails() {
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	token := s.tokenManager.newUserToken(r, uuid.NewV4().String(), "", uuid.NewV4(), "Refresh", time.Now().Add(-48*time.Hour), 24*time.Hour)
+	tokenString, err := token.SignedString(s.tokenManager.keyRing.signingKey().Key)
+	require.Nil(s.T(), err)
+
+	_, err = s.tokenManager.ParseRefreshToken(context.Background(), tokenString)
+	require.NotNil(s.T(), err)
+}
+
 func createInvalidSAContext() context.Context {
 	claims := jwt.MapClaims{}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
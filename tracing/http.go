@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	goaclient "github.com/goadesign/goa/client"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Transport starts a span for every request sent to another service and propagates the trace context in its headers.
+// Requests whose context contains no span are sent as is.
+type Transport struct {
+	// Base is the transport sending the requests. http.DefaultTransport is used if nil.
+	Base http.RoundTripper
+	// PeerService is the name of the service the requests are sent to, e.g. "keycloak"
+	PeerService string
+}
+
+// NewHTTPClient returns a client tracing the requests sent to the given service.
+// The context of a request must be set with Request.WithContext to be part of the trace.
+func NewHTTPClient(peerService string) *http.Client {
+	return &http.Client{Transport: &Transport{PeerService: peerService}}
+}
+
+// RoundTrip sends the request in a new span
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	parent := opentracing.SpanFromContext(req.Context())
+	if parent == nil {
+		return base.RoundTrip(req)
+	}
+	span := opentracing.StartSpan(t.PeerService+" "+req.Method, opentracing.ChildOf(parent.Context()))
+	defer span.Finish()
+	ext.SpanKindRPCClient.Set(span)
+	ext.PeerService.Set(span, t.PeerService)
+	ext.HTTPMethod.Set(span, req.Method)
+	// the query is left out as it may contain secrets
+	ext.HTTPUrl.Set(span, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	// a RoundTripper must not modify the request, so the headers are set on a copy
+	traced := new(http.Request)
+	*traced = *req
+	traced.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		traced.Header[k] = v
+	}
+	err := span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(traced.Header))
+	if err != nil {
+		span.LogKV("event", "unable to inject the trace context", "error", err.Error())
+	}
+	res, err := base.RoundTrip(traced)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+		return nil, err
+	}
+	ext.HTTPStatusCode.Set(span, uint16(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(span, true)
+	}
+	return res, nil
+}
+
+// Doer is a goa client Doer sending the requests with their context, so they are part of the trace
+type Doer struct {
+	client *http.Client
+}
+
+// NewDoer returns a goa client Doer tracing the requests sent to the given service
+func NewDoer(peerService string) goaclient.Doer {
+	return &Doer{client: NewHTTPClient(peerService)}
+}
+
+// Do sends the request with the given context
+func (d *Doer) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return d.client.Do(req.WithContext(ctx))
+}
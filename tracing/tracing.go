@@ -0,0 +1,120 @@
+// Package tracing traces the requests handled by the service across the controllers, the repositories
+// and the calls to the other services, which receive the trace context in the headers of the requests.
+// The spans are reported by the global tracer, which is set up by Configure.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/goadesign/goa"
+	"github.com/goadesign/goa/middleware"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	errs "github.com/pkg/errors"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+const (
+	// ExporterNone disables the tracing
+	ExporterNone = "none"
+	// ExporterJaeger reports the spans to a Jaeger agent
+	ExporterJaeger = "jaeger"
+	// ExporterMemory keeps the spans in memory, to be used in tests
+	ExporterMemory = "memory"
+
+	serviceName = "fabric8-auth"
+)
+
+type tracingConfiguration interface {
+	GetTracingExporter() string
+	GetTracingJaegerAgentHostPort() string
+	GetTracingSamplingRate() float64
+}
+
+// Configure sets up the global tracer with the configured exporter.
+// The returned closer flushes the spans which are not reported yet and must be closed when the service stops.
+func Configure(config tracingConfiguration) (io.Closer, error) {
+	switch config.GetTracingExporter() {
+	case ExporterNone, "":
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+		return nopCloser{}, nil
+	case ExporterMemory:
+		opentracing.SetGlobalTracer(mocktracer.New())
+		return nopCloser{}, nil
+	case ExporterJaeger:
+		cfg := jaegercfg.Configuration{
+			Sampler: &jaegercfg.SamplerConfig{
+				Type:  jaeger.SamplerTypeProbabilistic,
+				Param: config.GetTracingSamplingRate(),
+			},
+			Reporter: &jaegercfg.ReporterConfig{
+				LocalAgentHostPort: config.GetTracingJaegerAgentHostPort(),
+			},
+		}
+		tracer, closer, err := cfg.New(serviceName)
+		if err != nil {
+			return nil, errs.Wrap(err, "unable to create the Jaeger tracer")
+		}
+		opentracing.SetGlobalTracer(tracer)
+		return closer, nil
+	default:
+		return nil, errs.Errorf("unknown tracing exporter '%s'", config.GetTracingExporter())
+	}
+}
+
+// Middleware starts a span for every request handled by the service, named after the controller and the action.
+// The span continues the trace of the caller if the request contains a trace context.
+func Middleware() goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			tracer := opentracing.GlobalTracer()
+			// the request has no trace context if the caller is not traced
+			caller, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+			span := tracer.StartSpan(goa.ContextController(ctx)+"."+goa.ContextAction(ctx), ext.RPCServerOption(caller))
+			defer span.Finish()
+			ext.Component.Set(span, serviceName)
+			ext.HTTPMethod.Set(span, req.Method)
+			ext.HTTPUrl.Set(span, req.URL.Path)
+			if reqID := middleware.ContextRequestID(ctx); reqID != "" {
+				span.SetTag("request_id", reqID)
+			}
+
+			err := h(opentracing.ContextWithSpan(ctx, span), rw, req)
+
+			status := goa.ContextResponse(ctx).Status
+			ext.HTTPStatusCode.Set(span, uint16(status))
+			if err != nil || status >= http.StatusInternalServerError {
+				ext.Error.Set(span, true)
+			}
+			return err
+		}
+	}
+}
+
+// StartSpan starts a span which is a child of the span of the context, if any,
+// and returns a context containing the new span
+func StartSpan(ctx context.Context, operationName string) (opentracing.Span, context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return opentracing.StartSpanFromContext(ctx, operationName)
+}
+
+// StartDBSpan starts a span for an operation of a repository, to be finished when the operation is done:
+//
+//	defer tracing.StartDBSpan(ctx, "user", "load").Finish()
+func StartDBSpan(ctx context.Context, repository string, operation string) opentracing.Span {
+	span, _ := StartSpan(ctx, "db."+repository+"."+operation)
+	ext.DBType.Set(span, "sql")
+	return span
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
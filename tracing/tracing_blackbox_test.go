@@ -0,0 +1,119 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/tracing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type tracingBlackboxTest struct {
+	suite.Suite
+	tracer *mocktracer.MockTracer
+}
+
+func TestRunTracingBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	suite.Run(t, &tracingBlackboxTest{})
+}
+
+func (s *tracingBlackboxTest) SetupTest() {
+	closer, err := tracing.Configure(&dummyTracingConfig{exporter: tracing.ExporterMemory})
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), closer.Close())
+	s.tracer = opentracing.GlobalTracer().(*mocktracer.MockTracer)
+}
+
+func (s *tracingBlackboxTest) TearDownTest() {
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+}
+
+func (s *tracingBlackboxTest) TestUnknownExporter() {
+	_, err := tracing.Configure(&dummyTracingConfig{exporter: "zipkin"})
+	assert.NotNil(s.T(), err)
+}
+
+func (s *tracingBlackboxTest) TestTransportPropagatesTraceContext() {
+	// given
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	parent, ctx := tracing.StartSpan(context.Background(), "LoginController.login")
+	req, err := http.NewRequest("GET", server.URL+"/auth/realms/fabric8?secret=1234", nil)
+	require.Nil(s.T(), err)
+	// when
+	res, err := tracing.NewHTTPClient("keycloak").Do(req.WithContext(ctx))
+	parent.Finish()
+	// then
+	require.Nil(s.T(), err)
+	defer res.Body.Close()
+	spans := s.tracer.FinishedSpans()
+	require.Len(s.T(), spans, 2)
+	span := spans[0]
+	assert.Equal(s.T(), "keycloak GET", span.OperationName)
+	assert.Equal(s.T(), parent.(*mocktracer.MockSpan).SpanContext.SpanID, span.ParentID)
+	assert.Equal(s.T(), server.URL+"/auth/realms/fabric8", span.Tag("http.url"))
+	assert.Equal(s.T(), uint16(http.StatusServiceUnavailable), span.Tag("http.status_code"))
+	assert.Equal(s.T(), true, span.Tag("error"))
+	// the server receives the context of the span of the call
+	received, err := s.tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(headers))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), span.SpanContext.SpanID, received.(mocktracer.MockSpanContext).SpanID)
+	// the request of the caller is not modified
+	assert.Empty(s.T(), req.Header)
+}
+
+func (s *tracingBlackboxTest) TestTransportWithoutTrace() {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	// when
+	res, err := tracing.NewHTTPClient("wit").Get(server.URL)
+	// then
+	require.Nil(s.T(), err)
+	defer res.Body.Close()
+	assert.Empty(s.T(), s.tracer.FinishedSpans())
+}
+
+func (s *tracingBlackboxTest) TestDBSpan() {
+	// given
+	parent, ctx := tracing.StartSpan(context.Background(), "UserController.show")
+	// when
+	tracing.StartDBSpan(ctx, "user", "load").Finish()
+	parent.Finish()
+	// then
+	spans := s.tracer.FinishedSpans()
+	require.Len(s.T(), spans, 2)
+	assert.Equal(s.T(), "db.user.load", spans[0].OperationName)
+	assert.Equal(s.T(), spans[1].SpanContext.SpanID, spans[0].ParentID)
+}
+
+type dummyTracingConfig struct {
+	exporter string
+}
+
+func (c *dummyTracingConfig) GetTracingExporter() string {
+	return c.exporter
+}
+
+func (c *dummyTracingConfig) GetTracingJaegerAgentHostPort() string {
+	return "localhost:6831"
+}
+
+func (c *dummyTracingConfig) GetTracingSamplingRate() float64 {
+	return 1
+}
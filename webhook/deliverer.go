@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	// EventHeader is the header of the deliveries containing the type of the event
+	EventHeader = "X-Fabric8-Event"
+	// DeliveryHeader is the header of the deliveries containing the ID of the delivery
+	DeliveryHeader = "X-Fabric8-Delivery"
+	// SignatureHeader is the header of the deliveries containing the signature of the body
+	SignatureHeader = "X-Fabric8-Signature"
+
+	// deliveryLease is the time a delivery is reserved for the deliverer sending it
+	deliveryLease = 5 * time.Minute
+)
+
+type delivererConfiguration interface {
+	GetOutboxPollInterval() time.Duration
+	GetOutboxBatchSize() int
+	GetOutboxMaxAttempts() int
+	GetOutboxRetryBackoff() time.Duration
+	GetWebhookTimeout() time.Duration
+}
+
+// Sign returns the signature of the body sent with the given secret, which is the hex encoded
+// HMAC-SHA256 of the body prefixed with the name of the algorithm, e.g. "sha256=5257a869..."
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliverer POSTs the pending deliveries to the webhooks.
+// A failed delivery is retried with an exponential backoff until the maximum number of attempts is reached.
+type Deliverer struct {
+	subscriptions SubscriptionRepository
+	deliveries    DeliveryRepository
+	config        delivererConfiguration
+	client        *http.Client
+	stopped       chan struct{}
+}
+
+// NewDeliverer creates a deliverer sending the deliveries to the webhooks.
+// The cipher decrypts the secrets the deliveries are signed with.
+func NewDeliverer(db *gorm.DB, config delivererConfiguration, cipher *encryption.Cipher) *Deliverer {
+	return &Deliverer{
+		subscriptions: NewSubscriptionRepository(db, cipher),
+		deliveries:    NewDeliveryRepository(db),
+		config:        config,
+		client:        &http.Client{Timeout: config.GetWebhookTimeout()},
+	}
+}
+
+// Start sends the pending deliveries in the background until the context is done.
+// The delivery in progress when the context is done is not cancelled: use Wait to wait for it to complete.
+func (d *Deliverer) Start(ctx context.Context) {
+	d.stopped = make(chan struct{})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(d.config.GetOutboxPollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.DeliverPending(ctx)
+			}
+		}
+	}()
+}
+
+// Wait waits until the deliverer started with Start is stopped and the delivery in progress is complete
+func (d *Deliverer) Wait() {
+	if d.stopped != nil {
+		<-d.stopped
+	}
+}
+
+// DeliverPending sends the deliveries which are due and returns the number of successful deliveries.
+// The remaining deliveries are left pending when the context is done.
+func (d *Deliverer) DeliverPending(ctx context.Context) int {
+	deliveries, err := d.deliveries.ListPending(ctx, d.config.GetOutboxBatchSize())
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "unable to list the pending webhook deliveries")
+		return 0
+	}
+	delivered := 0
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+		if d.deliver(outbox.WithoutCancel(ctx), &deliveries[i]) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// deliver sends the delivery to the webhook and records the result of the attempt.
+// Returns true if the webhook accepted the delivery.
+func (d *Deliverer) deliver(ctx context.Context, delivery *Delivery) bool {
+	claimed, err := d.deliveries.Claim(ctx, delivery, deliveryLease)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"err":         err,
+		}, "unable to claim the webhook delivery")
+		return false
+	}
+	if !claimed {
+		// the delivery is being sent by another deliverer
+		return false
+	}
+	subscription, err := d.subscriptions.Load(ctx, delivery.SubscriptionID)
+	if err != nil {
+		// the deliveries of a deleted subscription are deleted with it
+		log.Error(ctx, map[string]interface{}{
+			"delivery_id":     delivery.ID,
+			"subscription_id": delivery.SubscriptionID,
+			"err":             err,
+		}, "unable to load the webhook subscription")
+		return false
+	}
+	status, err := d.post(ctx, subscription, delivery)
+	accepted := err == nil
+	if accepted {
+		err = d.deliveries.MarkDelivered(ctx, delivery.ID, status)
+	} else if delivery.Attempts+1 >= d.config.GetOutboxMaxAttempts() {
+		log.Error(ctx, map[string]interface{}{
+			"delivery_id":     delivery.ID,
+			"subscription_id": delivery.SubscriptionID,
+			"event_id":        delivery.EventID,
+			"attempts":        delivery.Attempts + 1,
+			"err":             err,
+		}, "giving up delivering the event to the webhook")
+		err = d.deliveries.MarkFailed(ctx, delivery.ID, status, err.Error())
+	} else {
+		log.Warn(ctx, map[string]interface{}{
+			"delivery_id":     delivery.ID,
+			"subscription_id": delivery.SubscriptionID,
+			"event_id":        delivery.EventID,
+			"attempts":        delivery.Attempts + 1,
+			"err":             err,
+		}, "unable to deliver the event to the webhook")
+		err = d.deliveries.MarkRetry(ctx, delivery.ID, status, err.Error(), time.Now().Add(outbox.Backoff(d.config.GetOutboxRetryBackoff(), delivery.Attempts+1)))
+	}
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"err":         err,
+		}, "unable to record the attempt of the webhook delivery")
+	}
+	return accepted
+}
+
+// post sends the payload of the delivery to the webhook and returns the status of the response, or 0 if no response was received.
+// Returns an error unless the webhook responds with a 2xx status.
+func (d *Deliverer) post(ctx context.Context, subscription *Subscription, delivery *Delivery) (int, error) {
+	req, err := http.NewRequest("POST", subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, errs.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, delivery.Payload))
+	res, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, errs.WithStack(err)
+	}
+	defer res.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("the webhook responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
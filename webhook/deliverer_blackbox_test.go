@@ -0,0 +1,227 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/webhook"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type delivererBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	subscriptions *webhook.GormSubscriptionRepository
+	deliveries    *webhook.GormDeliveryRepository
+}
+
+func TestRunDelivererBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &delivererBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *delivererBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.subscriptions = webhook.NewSubscriptionRepository(s.DB, s.TokenCipher)
+	s.deliveries = webhook.NewDeliveryRepository(s.DB)
+}
+
+func (s *delivererBlackboxTest) TestSign() {
+	// the expected signature is computed with `echo -n '{"id":"1"}' | openssl dgst -sha256 -hmac secret`
+	assert.Equal(s.T(), "sha256=6146142a2ce0159e84c0767881e4ec80bc397da62526e7d19f70795eb79460c0", webhook.Sign("secret", []byte(`{"id":"1"}`)))
+}
+
+func (s *delivererBlackboxTest) TestDeliverSignedEvent() {
+	// given
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	subscription := s.createSubscription(server.URL, outbox.UserUpdated)
+	event := s.scheduleEvent(outbox.UserUpdated)
+	deliverer := webhook.NewDeliverer(s.DB, &dummyDelivererConfig{maxAttempts: 3}, s.TokenCipher)
+	// when
+	deliverer.DeliverPending(s.Ctx)
+	// then
+	require.NotNil(s.T(), received)
+	assert.Equal(s.T(), "POST", received.Method)
+	assert.Equal(s.T(), outbox.UserUpdated, received.Header.Get(webhook.EventHeader))
+	assert.Equal(s.T(), webhook.Sign(subscription.Secret, body), received.Header.Get(webhook.SignatureHeader))
+	var message webhook.Message
+	require.Nil(s.T(), json.Unmarshal(body, &message))
+	assert.Equal(s.T(), event.ID, message.ID)
+	assert.Equal(s.T(), outbox.UserUpdated, message.Type)
+	assert.JSONEq(s.T(), string(event.Payload), string(message.Data))
+	deliveries, err := s.deliveries.ListBySubscription(s.Ctx, subscription.ID, 10)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), deliveries, 1)
+	assert.Equal(s.T(), deliveries[0].ID.String(), received.Header.Get(webhook.DeliveryHeader))
+	assert.NotNil(s.T(), deliveries[0].DeliveredAt)
+	assert.Equal(s.T(), 1, deliveries[0].Attempts)
+	require.NotNil(s.T(), deliveries[0].ResponseStatus)
+	assert.Equal(s.T(), http.StatusAccepted, *deliveries[0].ResponseStatus)
+}
+
+func (s *delivererBlackboxTest) TestStartAndStop() {
+	// given
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(webhook.EventHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	s.createSubscription(server.URL, outbox.TokenDeleted)
+	s.scheduleEvent(outbox.TokenDeleted)
+	deliverer := webhook.NewDeliverer(s.DB, &dummyDelivererConfig{maxAttempts: 3}, s.TokenCipher)
+	ctx, cancel := context.WithCancel(s.Ctx)
+	defer cancel()
+	// when
+	deliverer.Start(ctx)
+	// then
+	select {
+	case eventType := <-received:
+		assert.Equal(s.T(), outbox.TokenDeleted, eventType)
+	case <-time.After(10 * time.Second):
+		assert.Fail(s.T(), "the event has not been delivered")
+	}
+	// when
+	cancel()
+	// then
+	stopped := make(chan struct{})
+	go func() {
+		deliverer.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		assert.Fail(s.T(), "the deliverer has not been stopped")
+	}
+}
+
+func (s *delivererBlackboxTest) TestRetryUntilMaxAttempts() {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	subscription := s.createSubscription(server.URL, outbox.TokenDeleted)
+	s.scheduleEvent(outbox.TokenDeleted)
+	deliverer := webhook.NewDeliverer(s.DB, &dummyDelivererConfig{maxAttempts: 2}, s.TokenCipher)
+	// when
+	deliverer.DeliverPending(s.Ctx)
+	// then the delivery is retried later
+	delivery := s.loadDelivery(subscription.ID)
+	assert.Equal(s.T(), 1, delivery.Attempts)
+	assert.Nil(s.T(), delivery.FailedAt)
+	require.NotNil(s.T(), delivery.ResponseStatus)
+	assert.Equal(s.T(), http.StatusServiceUnavailable, *delivery.ResponseStatus)
+	require.NotNil(s.T(), delivery.LastError)
+	assert.Equal(s.T(), "the webhook responded with status 503", *delivery.LastError)
+	assert.True(s.T(), delivery.NextAttemptAt.After(time.Now()))
+
+	// when the next attempt is due and fails
+	s.DB.Model(&webhook.Delivery{}).Where("delivery_id = ?", delivery.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+	deliverer.DeliverPending(s.Ctx)
+	// then the event is not delivered anymore
+	delivery = s.loadDelivery(subscription.ID)
+	assert.Equal(s.T(), 2, delivery.Attempts)
+	assert.NotNil(s.T(), delivery.FailedAt)
+	assert.Nil(s.T(), delivery.DeliveredAt)
+}
+
+func (s *delivererBlackboxTest) TestSinkIgnoresOtherEventTypes() {
+	// given
+	subscription := s.createSubscription("https://wit.example.com/api/events", outbox.IdentityLinked)
+	// when
+	s.scheduleEvent(outbox.UserCreated)
+	// then
+	deliveries, err := s.deliveries.ListBySubscription(s.Ctx, subscription.ID, 10)
+	require.Nil(s.T(), err)
+	assert.Empty(s.T(), deliveries)
+}
+
+func (s *delivererBlackboxTest) TestDeleteSubscriptionDeletesDeliveries() {
+	// given
+	subscription := s.createSubscription("https://wit.example.com/api/events", outbox.UserCreated)
+	s.scheduleEvent(outbox.UserCreated)
+	delivery := s.loadDelivery(subscription.ID)
+	// when
+	err := s.subscriptions.Delete(s.Ctx, subscription.ID)
+	// then
+	require.Nil(s.T(), err)
+	_, err = s.deliveries.Load(s.Ctx, delivery.ID)
+	assert.NotNil(s.T(), err)
+}
+
+func (s *delivererBlackboxTest) createSubscription(url string, eventTypes ...string) *webhook.Subscription {
+	subscription := &webhook.Subscription{
+		OwnerID:    uuid.NewV4(),
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     uuid.NewV4().String(),
+	}
+	err := s.subscriptions.Create(s.Ctx, subscription)
+	require.Nil(s.T(), err)
+	return subscription
+}
+
+// scheduleEvent hands a new event of the given type to the webhook sink, as the outbox dispatcher does
+func (s *delivererBlackboxTest) scheduleEvent(eventType string) outbox.Event {
+	event := outbox.Event{
+		ID:         uuid.NewV4(),
+		Type:       eventType,
+		IdentityID: uuid.NewV4(),
+		Payload:    outbox.Payload(`{"identity_id":"` + uuid.NewV4().String() + `"}`),
+	}
+	event.CreatedAt = time.Now()
+	err := webhook.NewSink(s.DB, s.TokenCipher).Deliver(s.Ctx, event)
+	require.Nil(s.T(), err)
+	return event
+}
+
+func (s *delivererBlackboxTest) loadDelivery(subscriptionID uuid.UUID) webhook.Delivery {
+	deliveries, err := s.deliveries.ListBySubscription(s.Ctx, subscriptionID, 10)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), deliveries, 1)
+	return deliveries[0]
+}
+
+type dummyDelivererConfig struct {
+	maxAttempts int
+}
+
+func (c *dummyDelivererConfig) GetOutboxPollInterval() time.Duration {
+	return 100 * time.Millisecond
+}
+
+func (c *dummyDelivererConfig) GetOutboxBatchSize() int {
+	return 1000
+}
+
+func (c *dummyDelivererConfig) GetOutboxMaxAttempts() int {
+	return c.maxAttempts
+}
+
+func (c *dummyDelivererConfig) GetOutboxRetryBackoff() time.Duration {
+	return time.Minute
+}
+
+func (c *dummyDelivererConfig) GetWebhookTimeout() time.Duration {
+	return 5 * time.Second
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Delivery is the delivery of an event to a webhook subscription
+type Delivery struct {
+	gormsupport.LifecycleHardDelete
+	ID             uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:delivery_id"`
+	SubscriptionID uuid.UUID `sql:"type:uuid"`
+	EventID        uuid.UUID `sql:"type:uuid"`
+	EventType      string
+	// Payload is the body of the request POSTed to the webhook
+	Payload       outbox.Payload `sql:"type:jsonb"`
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time
+	// ResponseStatus is the HTTP status returned by the webhook at the last attempt, if any
+	ResponseStatus *int
+	LastError      *string
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m Delivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// GormDeliveryRepository is the implementation of the storage interface for Delivery.
+type GormDeliveryRepository struct {
+	db *gorm.DB
+}
+
+// NewDeliveryRepository creates a new storage type.
+func NewDeliveryRepository(db *gorm.DB) *GormDeliveryRepository {
+	return &GormDeliveryRepository{db: db}
+}
+
+// DeliveryRepository represents the storage interface.
+type DeliveryRepository interface {
+	Load(ctx context.Context, id uuid.UUID) (*Delivery, error)
+	CreateIfNotExists(ctx context.Context, delivery *Delivery) (bool, error)
+	ListPending(ctx context.Context, limit int) ([]Delivery, error)
+	Claim(ctx context.Context, delivery *Delivery, lease time.Duration) (bool, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID, responseStatus int) error
+	MarkRetry(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, nextAttemptAt time.Time) error
+	MarkFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string) error
+	ListBySubscription(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]Delivery, error)
+	DeleteByEvents(ctx context.Context, eventIDs []uuid.UUID) (int64, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormDeliveryRepository) TableName() string {
+	return "webhook_delivery"
+}
+
+// Load returns the delivery for the given ID
+// returns NotFoundError if the delivery doesn't exist
+func (m *GormDeliveryRepository) Load(ctx context.Context, id uuid.UUID) (*Delivery, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "load"}, time.Now())
+	var native Delivery
+	err := m.db.Table(m.TableName()).Where("delivery_id = ?", id).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("webhook_delivery", id.String())
+	}
+	return &native, errs.WithStack(err)
+}
+
+// CreateIfNotExists creates a new record unless the event has already been scheduled for delivery to the subscription.
+// Returns false if the delivery already exists.
+func (m *GormDeliveryRepository) CreateIfNotExists(ctx context.Context, model *Delivery) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "create"}, time.Now())
+	if model.ID == uuid.Nil {
+		model.ID = uuid.NewV4()
+	}
+	now := gorm.NowFunc()
+	db := m.db.Exec(`INSERT INTO webhook_delivery
+		(delivery_id, created_at, updated_at, subscription_id, event_id, event_type, payload, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+		model.ID, now, now, model.SubscriptionID, model.EventID, model.EventType, model.Payload, model.NextAttemptAt)
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"subscription_id": model.SubscriptionID,
+			"event_id":        model.EventID,
+			"err":             db.Error,
+		}, "unable to create the webhook delivery")
+		return false, errs.WithStack(db.Error)
+	}
+	return db.RowsAffected > 0, nil
+}
+
+// ListPending returns the deliveries which are due, oldest first
+func (m *GormDeliveryRepository) ListPending(ctx context.Context, limit int) ([]Delivery, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "listPending"}, time.Now())
+	var rows []Delivery
+	err := m.db.Table(m.TableName()).
+		Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", gorm.NowFunc()).
+		Order("created_at").Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// Claim postpones the next attempt of the pending delivery by the given lease, so no other deliverer sends it meanwhile.
+// Returns false if the delivery has been claimed by another deliverer since it was loaded.
+func (m *GormDeliveryRepository) Claim(ctx context.Context, delivery *Delivery, lease time.Duration) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "claim"}, time.Now())
+	nextAttemptAt := gorm.NowFunc().Add(lease)
+	db := m.db.Model(&Delivery{}).
+		Where("delivery_id = ? AND next_attempt_at = ? AND delivered_at IS NULL AND failed_at IS NULL", delivery.ID, delivery.NextAttemptAt).
+		Updates(map[string]interface{}{"next_attempt_at": nextAttemptAt})
+	if db.Error != nil {
+		return false, errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = nextAttemptAt
+	return true, nil
+}
+
+// MarkDelivered records that the webhook accepted the delivery
+func (m *GormDeliveryRepository) MarkDelivered(ctx context.Context, id uuid.UUID, responseStatus int) error {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "markDelivered"}, time.Now())
+	return m.update(ctx, id, map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"delivered_at":    gorm.NowFunc(),
+		"response_status": responseStatus,
+		"last_error":      nil,
+	})
+}
+
+// MarkRetry records a failed delivery which will be attempted again at the given time.
+// The response status is 0 if the webhook could not be reached.
+func (m *GormDeliveryRepository) MarkRetry(ctx context.Context, id uuid.UUID, responseStatus int, lastError string, nextAttemptAt time.Time) error {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "markRetry"}, time.Now())
+	return m.update(ctx, id, map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nextAttemptAt,
+		"response_status": nullableStatus(responseStatus),
+		"last_error":      lastError,
+	})
+}
+
+// MarkFailed records a failed delivery which won't be attempted again.
+// The response status is 0 if the webhook could not be reached.
+func (m *GormDeliveryRepository) MarkFailed(ctx context.Context, id uuid.UUID, responseStatus int, lastError string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "markFailed"}, time.Now())
+	return m.update(ctx, id, map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"failed_at":       gorm.NowFunc(),
+		"response_status": nullableStatus(responseStatus),
+		"last_error":      lastError,
+	})
+}
+
+// ListBySubscription returns the latest deliveries of the subscription, most recent first
+func (m *GormDeliveryRepository) ListBySubscription(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]Delivery, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "listBySubscription"}, time.Now())
+	var rows []Delivery
+	err := m.db.Table(m.TableName()).Where("subscription_id = ?", subscriptionID).Order("created_at DESC").Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
+// DeleteByEvents deletes the deliveries of the given events to all the webhooks
+// and returns the number of deleted deliveries
+func (m *GormDeliveryRepository) DeleteByEvents(ctx context.Context, eventIDs []uuid.UUID) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_delivery", "deleteByEvents"}, time.Now())
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+	db := m.db.Where("event_id IN (?)", eventIDs).Delete(&Delivery{})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": db.Error,
+		}, "unable to delete the webhook deliveries of the events")
+		return 0, errs.WithStack(db.Error)
+	}
+	return db.RowsAffected, nil
+}
+
+func (m *GormDeliveryRepository) update(ctx context.Context, id uuid.UUID, values map[string]interface{}) error {
+	err := m.db.Model(&Delivery{}).Where("delivery_id = ?", id).Updates(values).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"delivery_id": id,
+			"err":         err,
+		}, "unable to update the webhook delivery")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// nullableStatus returns nil if no response has been received from the webhook
+func nullableStatus(responseStatus int) interface{} {
+	if responseStatus == 0 {
+		return nil
+	}
+	return responseStatus
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Message is the body of the requests POSTed to the webhooks
+type Message struct {
+	// ID is the ID of the event. An event can be delivered several times to a webhook with the same ID.
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	// Data is the payload of the event, which depends on its type
+	Data json.RawMessage `json:"data"`
+}
+
+// Sink schedules the delivery of the events recorded in the outbox to the matching webhook subscriptions
+type Sink struct {
+	subscriptions SubscriptionRepository
+	deliveries    DeliveryRepository
+}
+
+// NewSink creates a sink scheduling the deliveries to the webhooks.
+// The cipher decrypts the secrets of the subscriptions.
+func NewSink(db *gorm.DB, cipher *encryption.Cipher) *Sink {
+	return &Sink{
+		subscriptions: NewSubscriptionRepository(db, cipher),
+		deliveries:    NewDeliveryRepository(db),
+	}
+}
+
+// Name returns the name of the sink
+func (s *Sink) Name() string {
+	return "webhooks"
+}
+
+// Deliver creates a delivery of the event for every subscription to its type.
+// The deliveries which already exist are left untouched, so the same event can be handled several times.
+func (s *Sink) Deliver(ctx context.Context, event outbox.Event) error {
+	subscriptions, err := s.subscriptions.ListByEventType(ctx, event.Type)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+	payload, err := json.Marshal(Message{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	for _, subscription := range subscriptions {
+		_, err := s.deliveries.CreateIfNotExists(ctx, &Delivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			NextAttemptAt:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
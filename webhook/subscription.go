@@ -0,0 +1,263 @@
+// Package webhook delivers the events recorded in the outbox to the webhooks registered by the service accounts.
+// The events are fanned out by the Sink into a delivery for every matching subscription, then POSTed
+// by the Deliverer to the URL of the subscription as JSON signed with the secret of the subscription,
+// which is stored encrypted with the key-encryption key of the external tokens.
+// The failed deliveries are retried and all the deliveries are kept as a log the owner of the subscription can query.
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/token/encryption"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Subscription is a webhook registered by a service account to receive the events of the given types
+type Subscription struct {
+	gormsupport.LifecycleHardDelete
+	ID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:subscription_id"`
+	// OwnerID is the ID of the service account which registered the webhook
+	OwnerID    uuid.UUID `sql:"type:uuid"`
+	URL        string
+	EventTypes pq.StringArray `sql:"type:text[]"`
+	// Secret is the shared secret used to sign the deliveries
+	Secret string
+	// SecretKeyID is the ID of the key-encryption key the data key of the secret is encrypted with.
+	// The secret is stored in plaintext if it's empty.
+	SecretKeyID string
+	// SecretEncryptedKey is the encrypted data key the secret is encrypted with
+	SecretEncryptedKey string
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m Subscription) TableName() string {
+	return "webhook_subscription"
+}
+
+// GormSubscriptionRepository is the implementation of the storage interface for Subscription.
+// The secrets are encrypted with the cipher before they are stored, and decrypted when they are loaded.
+type GormSubscriptionRepository struct {
+	db     *gorm.DB
+	cipher *encryption.Cipher
+}
+
+// NewSubscriptionRepository creates a new storage type.
+// The secrets are stored in plaintext if the cipher is nil, and the encrypted secrets can't be loaded.
+func NewSubscriptionRepository(db *gorm.DB, cipher *encryption.Cipher) *GormSubscriptionRepository {
+	return &GormSubscriptionRepository{db: db, cipher: cipher}
+}
+
+// SubscriptionRepository represents the storage interface.
+type SubscriptionRepository interface {
+	Load(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	Create(ctx context.Context, subscription *Subscription) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListByOwner(ctx context.Context, ownerID uuid.UUID) ([]Subscription, error)
+	ListByEventType(ctx context.Context, eventType string) ([]Subscription, error)
+	Reencrypt(ctx context.Context, batchSize int) (int, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormSubscriptionRepository) TableName() string {
+	return "webhook_subscription"
+}
+
+// Load returns the subscription for the given ID
+// returns NotFoundError if the subscription doesn't exist
+func (m *GormSubscriptionRepository) Load(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "load"}, time.Now())
+	var native Subscription
+	err := m.db.Table(m.TableName()).Where("subscription_id = ?", id).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("webhook_subscription", id.String())
+	}
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	err = m.decrypt(&native)
+	if err != nil {
+		return nil, err
+	}
+	return &native, nil
+}
+
+// Create creates a new record.
+func (m *GormSubscriptionRepository) Create(ctx context.Context, model *Subscription) error {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "create"}, time.Now())
+	if model.ID == uuid.Nil {
+		model.ID = uuid.NewV4()
+	}
+	secret := model.Secret
+	err := m.encrypt(model)
+	if err != nil {
+		return err
+	}
+	err = m.db.Create(model).Error
+	// the caller gets its model back with the plaintext secret
+	model.Secret = secret
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"subscription_id": model.ID,
+			"owner_id":        model.OwnerID,
+			"err":             err,
+		}, "unable to create the webhook subscription")
+		return errs.WithStack(err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"subscription_id": model.ID,
+		"owner_id":        model.OwnerID,
+		"event_types":     model.EventTypes,
+	}, "webhook subscription created")
+	return nil
+}
+
+// Delete removes a single record and its deliveries. This is a hard delete!
+// returns NotFoundError if the subscription doesn't exist
+func (m *GormSubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "delete"}, time.Now())
+	db := m.db.Delete(Subscription{ID: id})
+	if db.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"subscription_id": id,
+			"err":             db.Error,
+		}, "unable to delete the webhook subscription")
+		return errs.WithStack(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return errors.NewNotFoundError("webhook_subscription", id.String())
+	}
+	log.Info(ctx, map[string]interface{}{
+		"subscription_id": id,
+	}, "webhook subscription deleted")
+	return nil
+}
+
+// ListByOwner returns the subscriptions of the service account in the order they were created
+func (m *GormSubscriptionRepository) ListByOwner(ctx context.Context, ownerID uuid.UUID) ([]Subscription, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "listByOwner"}, time.Now())
+	var rows []Subscription
+	err := m.db.Table(m.TableName()).Where("owner_id = ?", ownerID).Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return m.decryptAll(rows)
+}
+
+// ListByEventType returns the subscriptions receiving the events of the given type
+func (m *GormSubscriptionRepository) ListByEventType(ctx context.Context, eventType string) ([]Subscription, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "listByEventType"}, time.Now())
+	var rows []Subscription
+	err := m.db.Table(m.TableName()).Where("? = ANY(event_types)", eventType).Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return m.decryptAll(rows)
+}
+
+// Reencrypt re-encrypts the secrets stored in plaintext or encrypted with another key than the current key of the cipher,
+// by batches of the given size, and returns the number of re-encrypted secrets.
+// The secrets which can't be decrypted are skipped.
+func (m *GormSubscriptionRepository) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "webhook_subscription", "reencrypt"}, time.Now())
+	if m.cipher == nil {
+		return 0, errs.New("unable to re-encrypt the webhook secrets without a cipher")
+	}
+	reencrypted := 0
+	lastID := uuid.Nil
+	for {
+		var rows []Subscription
+		err := m.db.Table(m.TableName()).Where("secret_key_id <> ? AND subscription_id > ?", m.cipher.KeyID(), lastID).Order("subscription_id").Limit(batchSize).Find(&rows).Error
+		if err != nil {
+			return reencrypted, errs.WithStack(err)
+		}
+		if len(rows) == 0 {
+			return reencrypted, nil
+		}
+		for i := range rows {
+			subscription := &rows[i]
+			lastID = subscription.ID
+			storedSecret := subscription.Secret
+			err = m.decrypt(subscription)
+			if err == nil {
+				err = m.encrypt(subscription)
+			}
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"subscription_id": subscription.ID,
+					"key_id":          subscription.SecretKeyID,
+					"err":             err,
+				}, "unable to re-encrypt the secret of the webhook subscription")
+				continue
+			}
+			// the subscriptions are never updated, but a subscription may have been deleted meanwhile
+			db := m.db.Table(m.TableName()).Where("subscription_id = ? AND secret = ?", subscription.ID, storedSecret).UpdateColumns(map[string]interface{}{
+				"secret":               subscription.Secret,
+				"secret_key_id":        subscription.SecretKeyID,
+				"secret_encrypted_key": subscription.SecretEncryptedKey,
+			})
+			if db.Error != nil {
+				return reencrypted, errs.WithStack(db.Error)
+			}
+			reencrypted += int(db.RowsAffected)
+		}
+	}
+}
+
+// encrypt replaces the plaintext secret of the model with its encrypted value.
+// The secret is left in plaintext if there is no cipher.
+func (m *GormSubscriptionRepository) encrypt(model *Subscription) error {
+	if m.cipher == nil {
+		model.SecretKeyID = ""
+		model.SecretEncryptedKey = ""
+		return nil
+	}
+	envelope, err := m.cipher.Encrypt(model.Secret, model.ID.Bytes())
+	if err != nil {
+		return errs.Wrapf(err, "unable to encrypt the secret of the webhook subscription %s", model.ID)
+	}
+	model.Secret = envelope.Ciphertext
+	model.SecretKeyID = envelope.KeyID
+	model.SecretEncryptedKey = envelope.EncryptedKey
+	return nil
+}
+
+// decrypt replaces the encrypted secret of the model with its plaintext value
+func (m *GormSubscriptionRepository) decrypt(model *Subscription) error {
+	if model.SecretKeyID == "" {
+		return nil
+	}
+	if m.cipher == nil {
+		return errs.Errorf("unable to decrypt the secret of the webhook subscription %s without a cipher", model.ID)
+	}
+	secret, err := m.cipher.Decrypt(encryption.Envelope{
+		KeyID:        model.SecretKeyID,
+		EncryptedKey: model.SecretEncryptedKey,
+		Ciphertext:   model.Secret,
+	}, model.ID.Bytes())
+	if err != nil {
+		return errs.Wrapf(err, "unable to decrypt the secret of the webhook subscription %s", model.ID)
+	}
+	model.Secret = secret
+	return nil
+}
+
+func (m *GormSubscriptionRepository) decryptAll(rows []Subscription) ([]Subscription, error) {
+	for i := range rows {
+		err := m.decrypt(&rows[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,86 @@
+package webhook_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/webhook"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type subscriptionBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo *webhook.GormSubscriptionRepository
+}
+
+func TestRunSubscriptionBlackboxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &subscriptionBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *subscriptionBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = webhook.NewSubscriptionRepository(s.DB, s.TokenCipher)
+}
+
+func (s *subscriptionBlackboxTest) TestSecretIsEncrypted() {
+	// given
+	subscription := s.createSubscription(s.repo)
+	// when
+	native := s.loadNative(subscription.ID)
+	// then
+	assert.NotEqual(s.T(), subscription.Secret, native.Secret)
+	assert.Equal(s.T(), s.TokenCipher.KeyID(), native.SecretKeyID)
+	assert.NotEmpty(s.T(), native.SecretEncryptedKey)
+	loaded, err := s.repo.Load(s.Ctx, subscription.ID)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), subscription.Secret, loaded.Secret)
+	subscriptions, err := s.repo.ListByOwner(s.Ctx, subscription.OwnerID)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), subscriptions, 1)
+	assert.Equal(s.T(), subscription.Secret, subscriptions[0].Secret)
+}
+
+func (s *subscriptionBlackboxTest) TestReencryptPlaintextSecret() {
+	// given a subscription created before the secrets were encrypted
+	subscription := s.createSubscription(webhook.NewSubscriptionRepository(s.DB, nil))
+	require.Equal(s.T(), subscription.Secret, s.loadNative(subscription.ID).Secret)
+	// when
+	reencrypted, err := s.repo.Reencrypt(s.Ctx, 2)
+	// then
+	require.Nil(s.T(), err)
+	assert.True(s.T(), reencrypted >= 1)
+	native := s.loadNative(subscription.ID)
+	assert.NotEqual(s.T(), subscription.Secret, native.Secret)
+	assert.Equal(s.T(), s.TokenCipher.KeyID(), native.SecretKeyID)
+	loaded, err := s.repo.Load(s.Ctx, subscription.ID)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), subscription.Secret, loaded.Secret)
+}
+
+func (s *subscriptionBlackboxTest) createSubscription(repo *webhook.GormSubscriptionRepository) *webhook.Subscription {
+	subscription := &webhook.Subscription{
+		OwnerID:    uuid.NewV4(),
+		URL:        "https://wit.example.com/api/events",
+		EventTypes: pq.StringArray{outbox.UserUpdated},
+		Secret:     uuid.NewV4().String(),
+	}
+	err := repo.Create(s.Ctx, subscription)
+	require.Nil(s.T(), err)
+	return subscription
+}
+
+// loadNative loads the subscription as it is stored
+func (s *subscriptionBlackboxTest) loadNative(id uuid.UUID) webhook.Subscription {
+	var native webhook.Subscription
+	err := s.DB.Table(s.repo.TableName()).Where("subscription_id = ?", id).Find(&native).Error
+	require.Nil(s.T(), err)
+	return native
+}
@@ -0,0 +1,81 @@
+package wit
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+
+	"github.com/goadesign/goa"
+)
+
+type outboxSinkConfiguration interface {
+	GetWITURL(*goa.RequestData) (string, error)
+}
+
+// OutboxSink delivers the user events to WIT, so the users and identities in WIT are kept in sync with the Auth service
+type OutboxSink struct {
+	config           outboxSinkConfiguration
+	RemoteWITService RemoteWITService
+}
+
+// NewOutboxSink creates a sink delivering the user events to WIT
+func NewOutboxSink(config outboxSinkConfiguration) *OutboxSink {
+	return &OutboxSink{
+		config:           config,
+		RemoteWITService: &RemoteWITServiceCaller{},
+	}
+}
+
+// Name returns the name of the sink
+func (s *OutboxSink) Name() string {
+	return "wit"
+}
+
+// Deliver creates or updates the user in WIT. The user is updated with all its attributes and the user
+// is updated instead if it already exists in WIT when delivering a UserCreated event again,
+// so delivering the same event several times has the same result as delivering it once.
+func (s *OutboxSink) Deliver(ctx context.Context, event outbox.Event) error {
+	if event.Type != outbox.UserCreated && event.Type != outbox.UserUpdated {
+		return nil
+	}
+	var user outbox.User
+	err := event.Unmarshal(&user)
+	if err != nil {
+		return err
+	}
+	req := event.RequestData()
+	witURL, err := s.config.GetWITURL(req)
+	if err != nil {
+		return err
+	}
+	identity := user.Identity()
+	if event.Type == outbox.UserCreated {
+		err = s.RemoteWITService.CreateWITUser(ctx, req, &identity, witURL, identity.ID.String())
+		if conflict, _ := errors.IsVersionConflictError(err); !conflict {
+			return err
+		}
+		// the user was already created by a previous delivery of the event
+	}
+	updateUserPayload := &app.UpdateUsersPayload{
+		Data: &app.UpdateUserData{
+			Attributes: &app.UpdateIdentityDataAttributes{
+				Bio:                &identity.User.Bio,
+				Company:            &identity.User.Company,
+				ContextInformation: identity.User.ContextInformation,
+				Email:              &identity.User.Email,
+				FullName:           &identity.User.FullName,
+				ImageURL:           &identity.User.ImageURL,
+				URL:                &identity.User.URL,
+				Username:           &identity.Username,
+			},
+			Type: "identities",
+		},
+	}
+	if identity.RegistrationCompleted {
+		// the registration can only be completed, not reverted
+		updateUserPayload.Data.Attributes.RegistrationCompleted = &identity.RegistrationCompleted
+	}
+	return s.RemoteWITService.UpdateWITUser(ctx, req, updateUserPayload, witURL, identity.ID.String())
+}
@@ -0,0 +1,74 @@
+package wit_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/account"
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/outbox"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/wit"
+
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dummyOutboxSinkConfiguration struct{}
+
+func (c dummyOutboxSinkConfiguration) GetWITURL(*goa.RequestData) (string, error) {
+	return "https://wit.example.com", nil
+}
+
+// dummyRemoteWITService keeps the users in memory and rejects the creation of an existing user as WIT does
+type dummyRemoteWITService struct {
+	users   map[string]string
+	creates int
+	updates int
+}
+
+func (s *dummyRemoteWITService) CreateWITUser(ctx context.Context, req *goa.RequestData, identity *account.Identity, witURL string, identityID string) error {
+	s.creates++
+	if _, exists := s.users[identityID]; exists {
+		return errors.NewVersionConflictError("user already exists in WIT")
+	}
+	s.users[identityID] = identity.User.FullName
+	return nil
+}
+
+func (s *dummyRemoteWITService) UpdateWITUser(ctx context.Context, req *goa.RequestData, updatePayload *app.UpdateUsersPayload, witURL string, identityID string) error {
+	s.updates++
+	if _, exists := s.users[identityID]; !exists {
+		return errors.NewNotFoundError("user", identityID)
+	}
+	s.users[identityID] = *updatePayload.Data.Attributes.FullName
+	return nil
+}
+
+func TestDeliverUserCreatedTwice(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	// given
+	remoteWITService := &dummyRemoteWITService{users: map[string]string{}}
+	sink := wit.NewOutboxSink(dummyOutboxSinkConfiguration{})
+	sink.RemoteWITService = remoteWITService
+	identityID := uuid.NewV4()
+	payload, err := json.Marshal(outbox.User{IdentityID: identityID, UserID: uuid.NewV4(), Username: "jdoe", FullName: "John Doe"})
+	require.Nil(t, err)
+	event := outbox.Event{ID: uuid.NewV4(), Type: outbox.UserCreated, IdentityID: identityID, Origin: "https://auth.example.com", Payload: payload}
+
+	// when
+	err = sink.Deliver(context.Background(), event)
+	require.Nil(t, err)
+	err = sink.Deliver(context.Background(), event)
+
+	// then
+	require.Nil(t, err)
+	assert.Equal(t, 2, remoteWITService.creates)
+	assert.Equal(t, 1, remoteWITService.updates)
+	assert.Equal(t, map[string]string{identityID.String(): "John Doe"}, remoteWITService.users)
+}
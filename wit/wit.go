@@ -7,10 +7,12 @@ import (
 
 	"github.com/fabric8-services/fabric8-auth/account"
 	"github.com/fabric8-services/fabric8-auth/app"
+	autherrors "github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/goasupport"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/token"
+	"github.com/fabric8-services/fabric8-auth/tracing"
 	"github.com/fabric8-services/fabric8-auth/wit/witservice"
 	"github.com/goadesign/goa"
 	goaclient "github.com/goadesign/goa/client"
@@ -69,7 +71,7 @@ func (r *RemoteWITServiceCaller) UpdateWITUser(ctx context.Context, req *goa.Req
 	return nil
 }
 
-// CreateWITUser creates a new user in WIT
+// CreateWITUser creates a new user in WIT. A VersionConflictError is returned if the user already exists in WIT
 func (r *RemoteWITServiceCaller) CreateWITUser(ctx context.Context, req *goa.RequestData, identity *account.Identity, witURL string, identityID string) error {
 	createUserPayload := &witservice.CreateUserAsServiceAccountUsersPayload{
 		Data: &witservice.CreateUserData{
@@ -99,6 +101,13 @@ func (r *RemoteWITServiceCaller) CreateWITUser(ctx context.Context, req *goa.Req
 	}
 	defer res.Body.Close()
 	bodyString := rest.ReadBody(res.Body) // To prevent FDs leaks
+	if res.StatusCode == http.StatusConflict {
+		log.Info(ctx, map[string]interface{}{
+			"identity_id": identityID,
+			"username":    identity.Username,
+		}, "user already exists in WIT")
+		return autherrors.NewVersionConflictError("user already exists in WIT")
+	}
 	if res.StatusCode != http.StatusOK {
 		log.Error(ctx, map[string]interface{}{
 			"identity_id":     identityID,
@@ -122,7 +131,7 @@ func CreateSecureRemoteClientAsServiceAccount(ctx context.Context, req *goa.Requ
 		}, "unable to parse remote endpoint")
 		return nil, err
 	}
-	witclient := witservice.New(goaclient.HTTPClientDoer(http.DefaultClient))
+	witclient := witservice.New(tracing.NewDoer("wit"))
 	witclient.Host = u.Host
 	witclient.Scheme = u.Scheme
 